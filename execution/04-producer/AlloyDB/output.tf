@@ -15,11 +15,17 @@
  */
 
 output "cluster_details" {
-  description = "Display cluster name and details like cluster id, network configuration and state of the AlloyDB cluster created."
+  description = "Display cluster name and details like cluster id, network configuration, state, primary instance IP, SSL mode and Private Service Connect service attachment of the AlloyDB cluster created."
   value = { for name, cluster in module.alloy_db :
     name => {
       "cluster_id" : cluster.cluster_id,
       "network_config" : cluster.cluster.network_config,
       "cluster_status" : cluster.cluster.state,
+      "project_id" : cluster.cluster.project,
+      "region" : cluster.cluster.location,
+      "psc_enabled" : try(cluster.cluster.psc_config[0].psc_enabled, false),
+      "psc_service_attachment_link" : try(cluster.primary_instance.psc_instance_config[0].service_attachment_link, null),
+      "primary_instance_ip" : try(cluster.primary_instance.ip_address, null),
+      "ssl_mode" : try(cluster.primary_instance.client_connection_config[0].ssl_config[0].ssl_mode, null),
   } }
 }
@@ -13,7 +13,7 @@
 # limitations under the License.
 
 output "cloudsql_instance_details" {
-  description = "Display Cloud SQL instance attributes, including name, project ID, region, connection name, IP address (public or private), and database version."
+  description = "Display Cloud SQL instance attributes, including name, project ID, region, connection name, IP address (public or private), database version, SSL mode and Private Service Connect service attachment."
   value = { for name, instance in module.cloudsql :
     name => {
       "name" : instance.name,
@@ -23,6 +23,9 @@ output "cloudsql_instance_details" {
       "database_version" : instance.instances.primary.database_version,
       "public_ip_address" : try(instance.instances.primary.public_ip_address, null)
       "private_ip_address" : try(instance.instances.primary.private_ip_address, null),
+      "psc_enabled" : try(instance.instances.primary.settings[0].ip_configuration[0].psc_config[0].psc_enabled, false),
+      "psc_service_attachment_link" : try(instance.instances.primary.psc_service_attachment_link, null),
+      "ssl_mode" : try(instance.instances.primary.settings[0].ip_configuration[0].ssl_mode, null),
   } }
   sensitive = true
 }
@@ -18,12 +18,17 @@ output "redis_cluster_details" {
     for name, cluster in google_redis_cluster.cluster-ha :
     name => {
       name           = cluster.name
+      project_id     = cluster.project
       region         = cluster.region
       shard_count    = cluster.shard_count
       replica_count  = cluster.replica_count
       psc_connection = try(cluster.psc_connections[0].psc_connection_id, null)
       state          = cluster.state
       network        = cluster.psc_configs[0].network
+
+      psc_service_attachments = try([for attachment in cluster.psc_service_attachments : attachment.service_attachment], [])
+      discovery_endpoints     = try([for endpoint in cluster.discovery_endpoints : { address = endpoint.address, port = endpoint.port }], [])
+      transit_encryption_mode = try(cluster.transit_encryption_mode, null)
     }
   }
 }
@@ -0,0 +1,119 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command configlint checks the tfvars files and YAML configuration under
+// configuration/ without Terraform or credentials, and checks that the
+// network and subnet references of the YAML configuration match the network
+// configured in networking.tfvars and that the address ranges of all stages
+// do not overlap.
+//
+// Usage, from execution/test:
+//
+//	go run ./cmd/configlint [-json] [stage ...]
+//
+// Without stage arguments every stage run.sh knows, and 00-bootstrap, is
+// checked. Diagnostics are printed as file:line:column lines, or as a JSON
+// array with -json. The exit code is 1 when there are errors, 2 when the
+// files cannot be read and 0 otherwise, including when there are only
+// warnings.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configlint"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+)
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print diagnostics as a JSON array")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: configlint [-json] [stage ...]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	os.Exit(run(*jsonOutput, flag.Args()))
+}
+
+func run(jsonOutput bool, names []string) int {
+	root, err := stages.Root()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	targets, err := configlint.Targets()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(names) > 0 {
+		targets, err = selectTargets(targets, names)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	diags, err := configlint.Lint(root, targets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	networkDiags, err := configlint.CheckNetworks(root, targets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	diags = append(diags, networkDiags...)
+	rangeDiags, err := configlint.CheckAddressSpace(root, targets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	diags = append(diags, rangeDiags...)
+	configlint.Sort(diags)
+	if jsonOutput {
+		err = configlint.WriteJSON(os.Stdout, diags)
+	} else {
+		err = configlint.WriteText(os.Stdout, diags)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if configlint.HasErrors(diags) {
+		return 1
+	}
+	return 0
+}
+
+// selectTargets returns the targets named by names, in the order given.
+func selectTargets(targets []configlint.Target, names []string) ([]configlint.Target, error) {
+	var selected []configlint.Target
+	for _, name := range names {
+		found := false
+		for _, target := range targets {
+			if target.Name == name {
+				selected = append(selected, target)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+	}
+	return selected, nil
+}
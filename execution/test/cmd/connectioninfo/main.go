@@ -0,0 +1,133 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command connectioninfo writes the connection information of the
+// databases, caches and endpoints created by the producer stages for the
+// consumer workloads, as a .env file, JSON or a Kubernetes Secret
+// manifest.
+//
+// Usage, from execution/test:
+//
+//	terraform -chdir=../04-producer/CloudSQL output -json > cloudsql.json
+//	go run ./cmd/connectioninfo -cloudsql cloudsql.json [-alloydb alloydb.json] [-mrc mrc.json] \
+//		[-vertex vertex.json] [-networking-manual psc.json] [-format env|json|secret] \
+//		[-spec consumers.yaml -o dir]
+//
+// Without -spec, one bundle named by -consumer holds every connection and
+// is written to stdout. With -spec, a YAML file mapping each consumer to
+// the "producer/name" references of the instances it connects to, every
+// consumer gets a bundle written to dir as <consumer>.env, .json or .yaml.
+// The exit code is 1 when a reference matches no instance, 2 when the
+// input cannot be read and 0 otherwise.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/connectioninfo"
+)
+
+func main() {
+	outputs := map[connectioninfo.Producer]*string{}
+	for _, p := range connectioninfo.Producers {
+		outputs[p] = flag.String(string(p), "", fmt.Sprintf("terraform output -json of the %s producer stage", p))
+	}
+	pscPath := flag.String("networking-manual", "", "terraform output -json of the 05-networking-manual stage, whose PSC endpoint addresses replace private IPs")
+	format := flag.String("format", string(connectioninfo.Env), "output format: env, json or secret")
+	specPath := flag.String("spec", "", "YAML file mapping each consumer to the producer/name references of its instances")
+	consumer := flag.String("consumer", "consumer", "name of the single bundle written without -spec")
+	out := flag.String("o", "", "directory to write one file per consumer to, required with -spec")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: connectioninfo [-cloudsql file] [-alloydb file] [-mrc file] [-vertex file] [-networking-manual file] [-format env|json|secret] [-spec file -o dir | -consumer name]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	given := false
+	for _, path := range outputs {
+		given = given || *path != ""
+	}
+	f := connectioninfo.Format(*format)
+	if flag.NArg() != 0 || !given || (*specPath != "") != (*out != "") ||
+		(f != connectioninfo.Env && f != connectioninfo.JSON && f != connectioninfo.Secret) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	os.Exit(run(outputs, *pscPath, f, *specPath, *consumer, *out))
+}
+
+func run(outputs map[connectioninfo.Producer]*string, pscPath string, f connectioninfo.Format, specPath, consumer, out string) int {
+	var conns []connectioninfo.Connection
+	for _, p := range connectioninfo.Producers {
+		if *outputs[p] == "" {
+			continue
+		}
+		read, err := connectioninfo.ReadOutputs(p, *outputs[p])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		conns = append(conns, read...)
+	}
+	if pscPath != "" {
+		addrs, err := connectioninfo.ReadPSCAddresses(pscPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		connectioninfo.ApplyPSC(conns, addrs)
+	}
+	if specPath == "" {
+		b := connectioninfo.Bundle{Consumer: consumer, Connections: append([]connectioninfo.Connection{}, conns...)}
+		if err := b.Write(os.Stdout, f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return 0
+	}
+	spec, err := connectioninfo.ReadSpec(specPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	code := 0
+	bundles, err := connectioninfo.Bundles(conns, spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, b := range bundles {
+		var buf bytes.Buffer
+		if err := b.Write(&buf, f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		// The bundles hold private addresses and connection names, which
+		// are not meant to be world-readable.
+		path := filepath.Join(out, b.Consumer+f.Extension())
+		if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		fmt.Fprintln(os.Stderr, "wrote", path)
+	}
+	return code
+}
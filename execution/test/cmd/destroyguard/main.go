@@ -0,0 +1,80 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command destroyguard lists the resources a plan deletes or replaces, with
+// the attributes that force each replacement, and fails when a stateful
+// producer such as a Cloud SQL instance or a GKE cluster would be destroyed.
+//
+// Usage, from execution/test:
+//
+//	terraform -chdir=../04-producer/CloudSQL show -json plan > plan.json
+//	go run ./cmd/destroyguard [-overrides overrides.yaml] [-all] plan.json
+//
+// The overrides file lists the addresses that may be deleted or replaced,
+// each with a reason. With -all, deletes and replacements of every resource
+// type block, not only those of stateful types. The exit code is 1 when a
+// change blocks, 2 when the input cannot be read and 0 otherwise.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/destroyguard"
+)
+
+func main() {
+	overridesPath := flag.String("overrides", "", "YAML file listing the addresses allowed to be deleted or replaced")
+	all := flag.Bool("all", false, "block deletes and replacements of every resource type, not only stateful ones")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: destroyguard [-overrides overrides.yaml] [-all] plan.json ...\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	os.Exit(run(*overridesPath, *all, flag.Args()))
+}
+
+func run(overridesPath string, all bool, plans []string) int {
+	overrides := destroyguard.Overrides{}
+	if overridesPath != "" {
+		var err error
+		if overrides, err = destroyguard.ReadOverrides(overridesPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	code := 0
+	for _, path := range plans {
+		plan, err := destroyguard.ReadPlan(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		changes := destroyguard.Inspect(plan)
+		blocking := overrides.Blocking(changes, all)
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+		if len(blocking) > 0 {
+			fmt.Printf("%s: %d of %d deletes and replacements blocked\n", path, len(blocking), len(changes))
+			code = 1
+		}
+	}
+	return code
+}
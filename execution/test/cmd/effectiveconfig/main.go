@@ -0,0 +1,215 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command effectiveconfig prints the configuration each YAML file of a
+// producer or consumer stage effectively gets once locals.tf has applied
+// the defaults of variables.tf, with the source of every value, without
+// running a plan.
+//
+// Usage, from execution/test:
+//
+//	go run ./cmd/effectiveconfig [-json] [-examples] [stage ...]
+//	go run ./cmd/effectiveconfig [-json] -config dir stage
+//
+// Without stage arguments every stage with a configuration folder is
+// printed. With -config the YAML files of dir are read instead of the
+// configuration folder of the stage, and with -examples the *.yaml.example
+// files are read as if they had been copied to *.yaml. YAML keys that
+// locals.tf never reads and required keys a file does not set are flagged,
+// and make the exit code 1; it is 2 when the stage or files cannot be read
+// and 0 otherwise.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/effective"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+)
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print the effective configuration as JSON")
+	configDir := flag.String("config", "", "read the YAML files of this folder instead of the stage's configuration folder")
+	examples := flag.Bool("examples", false, "read the *.yaml.example files as if they were copied without the .example suffix")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: effectiveconfig [-json] [-examples] [-config dir] [stage ...]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	os.Exit(run(*jsonOutput, *examples, *configDir, flag.Args()))
+}
+
+// stageConfig is the effective configuration of the YAML files of a stage.
+type stageConfig struct {
+	Stage     string               `json:"stage"`
+	Pattern   string               `json:"pattern"`
+	Ignored   []string             `json:"ignored,omitempty"`
+	Instances []effective.Instance `json:"instances"`
+}
+
+func run(jsonOutput, examples bool, configDir string, names []string) int {
+	root, err := stages.Root()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	var selected []stages.Stage
+	for _, name := range names {
+		s, ok := stages.Get(name)
+		if !ok || s.Config == "" {
+			fmt.Fprintf(os.Stderr, "%s is not a stage with a configuration folder\n", name)
+			return 2
+		}
+		selected = append(selected, s)
+	}
+	if len(names) == 0 {
+		for _, s := range stages.All {
+			if s.Config != "" {
+				selected = append(selected, s)
+			}
+		}
+	}
+	if configDir != "" && len(selected) != 1 {
+		fmt.Fprintln(os.Stderr, "-config needs exactly one stage")
+		return 2
+	}
+	var configs []stageConfig
+	for _, s := range selected {
+		dir := s.ConfigPath()
+		if configDir != "" {
+			dir = configDir
+		}
+		c, err := resolve(root, s, dir, examples)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		configs = append(configs, c)
+	}
+	if jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(configs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	} else {
+		for _, c := range configs {
+			print(c)
+		}
+	}
+	for _, c := range configs {
+		for _, instance := range c.Instances {
+			if len(instance.Unread) > 0 {
+				return 1
+			}
+			for _, v := range instance.Values {
+				if v.Source == effective.Missing {
+					return 1
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func resolve(root string, s stages.Stage, dir string, examples bool) (stageConfig, error) {
+	stage, err := effective.ReadStage(s.TerraformDir())
+	if err != nil {
+		return stageConfig{}, err
+	}
+	files, ignored, err := stage.Files(dir)
+	if err != nil {
+		return stageConfig{}, err
+	}
+	if examples {
+		if files, err = stage.Examples(dir); err != nil {
+			return stageConfig{}, err
+		}
+		ignored = nil
+	}
+	instances, err := stage.ResolveFiles(files)
+	if err != nil {
+		return stageConfig{}, err
+	}
+	c := stageConfig{Stage: s.Name, Pattern: stage.Pattern, Instances: instances}
+	for _, path := range ignored {
+		c.Ignored = append(c.Ignored, relative(root, path))
+	}
+	for i := range c.Instances {
+		c.Instances[i].File = relative(root, c.Instances[i].File)
+	}
+	return c, nil
+}
+
+func relative(root, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+func print(c stageConfig) {
+	fmt.Printf("%s (%s)\n", c.Stage, c.Pattern)
+	for _, path := range c.Ignored {
+		fmt.Printf("  %s: ignored, the fileset pattern does not select it\n", path)
+	}
+	for _, instance := range c.Instances {
+		fmt.Printf("  %s\n", instance.File)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, v := range instance.Values {
+			fmt.Fprintf(w, "    %s\t%s\t%s\n", v.Key, source(v), format(v))
+		}
+		w.Flush()
+		for _, key := range instance.Unread {
+			fmt.Printf("    warning: %s is never read by locals.tf\n", key)
+		}
+	}
+}
+
+func format(v effective.Value) string {
+	switch {
+	case v.Source == effective.FromExpression:
+		return v.Detail
+	case v.Source == effective.Missing:
+		return "-"
+	case v.Unknown:
+		return "(known at plan time)"
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v.Value); err != nil {
+		return fmt.Sprint(v.Value)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func source(v effective.Value) string {
+	switch v.Source {
+	case effective.FromDefault:
+		return "default " + v.Detail
+	case effective.Missing:
+		return "error: required key not set"
+	}
+	return string(v.Source)
+}
@@ -0,0 +1,144 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command firewallaudit analyzes the firewall rules of the 03-security
+// stages for risky exposure: admin ports open to 0.0.0.0/0, ports beyond
+// what the product of the stage needs, shadowed or redundant rules and deny
+// rules overriding allow rules of the same priority.
+//
+// Usage, from execution/test:
+//
+//	go run ./cmd/firewallaudit [-format text|json|sarif] [stage ...]
+//	go run ./cmd/firewallaudit [-format text|json|sarif] -plan plan.json [-product stage]
+//
+// Without arguments the tfvars files of every 03-security stage are
+// analyzed. With -plan the google_compute_firewall resources of the output
+// of terraform show -json are analyzed instead, against the product of the
+// stage named by -product. The exit code is 1 when there are errors, 2 when
+// the input cannot be read and 0 otherwise.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/firewall"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+)
+
+func main() {
+	format := flag.String("format", "text", "output format: text, json or sarif")
+	plan := flag.String("plan", "", "analyze the firewall rules of this terraform show -json output")
+	product := flag.String("product", "", "with -plan, the 03-security stage whose product ports apply, for example security/alloydb")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: firewallaudit [-format text|json|sarif] [-plan plan.json [-product stage]] [stage ...]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	os.Exit(run(*format, *plan, *product, flag.Args()))
+}
+
+func run(format, plan, product string, names []string) int {
+	if format != "text" && format != "json" && format != "sarif" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", format)
+		return 2
+	}
+	var findings []firewall.Finding
+	if plan != "" {
+		if len(names) > 0 {
+			fmt.Fprintln(os.Stderr, "stages cannot be combined with -plan")
+			return 2
+		}
+		rules, err := firewall.ReadPlan(plan)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		p, err := lookupProduct(product)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		findings = firewall.Analyze(rules, p)
+	} else {
+		root, err := stages.Root()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		if len(names) == 0 {
+			for _, s := range stages.All {
+				if strings.HasPrefix(s.Name, "security/") {
+					names = append(names, s.Name)
+				}
+			}
+		}
+		for _, name := range names {
+			s, ok := stages.Get(name)
+			if !ok || !strings.HasPrefix(name, "security/") {
+				fmt.Fprintf(os.Stderr, "unknown 03-security stage %q\n", name)
+				return 2
+			}
+			p, _ := lookupProduct(name)
+			stageFindings, err := firewall.AnalyzeTFVars(s.TFVarsPath(), p)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+				return 2
+			}
+			for i, f := range stageFindings {
+				if rel, err := filepath.Rel(root, f.File); err == nil {
+					stageFindings[i].File = filepath.ToSlash(rel)
+				}
+			}
+			findings = append(findings, stageFindings...)
+		}
+		firewall.Sort(findings)
+	}
+
+	var err error
+	switch format {
+	case "json":
+		err = firewall.WriteJSON(os.Stdout, findings)
+	case "sarif":
+		err = firewall.WriteSARIF(os.Stdout, "firewallaudit", findings)
+	default:
+		err = firewall.WriteText(os.Stdout, findings)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if firewall.HasErrors(findings) {
+		return 1
+	}
+	return 0
+}
+
+// lookupProduct returns the product of the 03-security stage name, or nil
+// if name is empty or the stage has no product.
+func lookupProduct(name string) (*firewall.Product, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if _, ok := stages.Get(name); !ok {
+		return nil, fmt.Errorf("unknown stage %q", name)
+	}
+	if p, ok := firewall.Products[name]; ok {
+		return &p, nil
+	}
+	return nil, nil
+}
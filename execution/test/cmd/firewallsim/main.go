@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command firewallsim answers whether the VPC firewall allows a connection,
+// before anything is applied, and prints the rule that decides it.
+//
+// Usage, from execution/test:
+//
+//	go run ./cmd/firewallsim [flow flags] rules ...
+//
+// Each rules argument is the output of terraform show -json for a plan or
+// state of a 03-security stage, a tfvars file of one, or the name of a
+// 03-security stage such as security/alloydb for its tfvars file. The flow
+// is described by flags, for example, for a GCE consumer tagged "app"
+// reaching an AlloyDB PSA address:
+//
+//	go run ./cmd/firewallsim -direction egress -src 10.0.0.2 -src-tags app \
+//	    -dst 10.10.0.5 -protocol tcp -port 5432 security/alloydb
+//
+// The exit code is 0 when the flow is allowed, 1 when it is denied and 2
+// when the rules or flags cannot be read.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/firewall"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+)
+
+func main() {
+	direction := flag.String("direction", "ingress", "direction of the flow: ingress or egress")
+	src := flag.String("src", "", "source address or CIDR range (default any)")
+	srcTags := flag.String("src-tags", "", "comma-separated network tags of the source instance")
+	srcSA := flag.String("src-sa", "", "service account of the source instance")
+	dst := flag.String("dst", "", "destination address or CIDR range (default any)")
+	dstTags := flag.String("dst-tags", "", "comma-separated network tags of the destination instance")
+	dstSA := flag.String("dst-sa", "", "service account of the destination instance")
+	protocol := flag.String("protocol", "tcp", "protocol of the flow, such as tcp, udp or icmp")
+	port := flag.Int("port", 0, "destination port of the flow")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: firewallsim [flow flags] plan.json|state.json|file.tfvars|stage ...\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	source, err := firewall.ParseEndpoint(*src, *srcTags, *srcSA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-src: %v\n", err)
+		os.Exit(2)
+	}
+	destination, err := firewall.ParseEndpoint(*dst, *dstTags, *dstSA)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-dst: %v\n", err)
+		os.Exit(2)
+	}
+	flow := firewall.Flow{
+		Direction:   firewall.Direction(strings.ToUpper(*direction)),
+		Source:      source,
+		Destination: destination,
+		Protocol:    *protocol,
+		Port:        *port,
+	}
+	os.Exit(run(flow, flag.Args()))
+}
+
+func run(flow firewall.Flow, args []string) int {
+	var rules []firewall.Rule
+	for _, arg := range args {
+		r, err := readRules(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		rules = append(rules, r...)
+	}
+	d, err := firewall.Evaluate(rules, flow)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	fmt.Println(flow)
+	fmt.Println(d)
+	if !d.Allowed {
+		return 1
+	}
+	return 0
+}
+
+// readRules reads the rules of a terraform show -json file, a tfvars file
+// or the tfvars file of a stage.
+func readRules(arg string) ([]firewall.Rule, error) {
+	path := arg
+	if s, ok := stages.Get(arg); ok {
+		path = s.TFVarsPath()
+	}
+	if strings.HasSuffix(path, ".json") {
+		return firewall.ReadTerraformJSON(path)
+	}
+	rules, findings, err := firewall.ReadTFVars(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range findings {
+		fmt.Fprintf(os.Stderr, "%s (rule skipped)\n", f)
+	}
+	return rules, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command janitor lists the resources integration tests leaked in a
+// project, those named like the tests name them or labeled cncs-created
+// and older than a TTL, and deletes them in dependency order.
+//
+// Usage, from execution/test:
+//
+//	go run ./cmd/janitor [-project id] [-region us-central1] [-ttl 24h] [-dry-run=false]
+//
+// The project defaults to $TF_VAR_project_id, the project the integration
+// tests run in. By default the orphans are only listed; -dry-run=false
+// deletes them. The exit code is 1 when a delete fails, 2 when the
+// resources cannot be listed and 0 otherwise.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+)
+
+func main() {
+	projectID := flag.String("project", os.Getenv("TF_VAR_project_id"), "project to clean up")
+	region := flag.String("region", "us-central1", "region of the AlloyDB and Redis clusters and service connection policies")
+	ttl := flag.Duration("ttl", 24*time.Hour, "minimum age of the resources to delete")
+	dryRun := flag.Bool("dry-run", true, "only list the resources that would be deleted")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: janitor [-project id] [-region region] [-ttl duration] [-dry-run=false]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 || *projectID == "" || *ttl <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	os.Exit(run(janitor.New(*projectID, *region), *ttl, *dryRun))
+}
+
+func run(j *janitor.Janitor, ttl time.Duration, dryRun bool) int {
+	resources, err := j.List()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	candidates := janitor.Plan(resources, janitor.Patterns, ttl, time.Now())
+	for _, c := range candidates {
+		fmt.Println(c)
+	}
+	fmt.Printf("%s: %d of %d resources are orphans older than %s\n", j.ProjectID, len(candidates), len(resources), ttl)
+	if dryRun || len(candidates) == 0 {
+		return 0
+	}
+	if err := j.Delete(os.Stdout, candidates); err != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command pscendpoints generates the psc_endpoints of
+// networking-manual.tfvars from the outputs of the CloudSQL, AlloyDB and
+// MRC producer stages, with an endpoint for every instance that has
+// Private Service Connect enabled.
+//
+// Usage, from execution/test:
+//
+//	terraform -chdir=../04-producer/CloudSQL output -json > cloudsql.json
+//	go run ./cmd/pscendpoints -cloudsql cloudsql.json [-alloydb alloydb.json] [-mrc mrc.json] \
+//		-network vpc -subnetwork subnet [-subnet-range 10.0.0.0/24] [-endpoint-project id] [-o file]
+//
+// Instances that the -existing tfvars file, by default
+// configuration/networking-manual.tfvars, already has an endpoint for are
+// skipped. With -subnet-range, each endpoint gets a free address of the
+// range that no existing endpoint uses. The tfvars are written to stdout,
+// or to the -o file, for review before they replace the existing ones. The
+// exit code is 1 when an instance gets no endpoint, 2 when the input
+// cannot be read and 0 otherwise.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/pscendpoints"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+)
+
+const header = `# Generated by go run ./cmd/pscendpoints from the outputs of the producer
+# stages. Review the endpoints before applying 05-networking-manual.
+
+`
+
+func main() {
+	outputs := map[pscendpoints.Producer]*string{}
+	for _, p := range pscendpoints.Producers {
+		outputs[p] = flag.String(string(p), "", fmt.Sprintf("terraform output -json of the %s producer stage", p))
+	}
+	var opts pscendpoints.Options
+	flag.StringVar(&opts.NetworkName, "network", "", "network of the forwarding rules (required)")
+	flag.StringVar(&opts.SubnetworkName, "subnetwork", "", "subnetwork of the endpoint addresses (required)")
+	flag.StringVar(&opts.EndpointProjectID, "endpoint-project", "", "project of the forwarding rules, by default the project of each instance")
+	subnetRange := flag.String("subnet-range", "", "primary range of the subnetwork to pick free endpoint addresses from")
+	existing := flag.String("existing", stages.MustGet("networking-manual").TFVarsPath(), "tfvars file whose endpoints are skipped and whose addresses are avoided, none when empty")
+	out := flag.String("o", "", "file to write the tfvars to, stdout when empty")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: pscendpoints [-cloudsql file] [-alloydb file] [-mrc file] -network name -subnetwork name [-subnet-range cidr] [-endpoint-project id] [-existing file] [-o file]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	given := false
+	for _, path := range outputs {
+		given = given || *path != ""
+	}
+	if flag.NArg() != 0 || !given || opts.NetworkName == "" || opts.SubnetworkName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *subnetRange != "" {
+		prefix, err := netip.ParsePrefix(*subnetRange)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opts.SubnetRange = prefix
+	}
+	os.Exit(run(outputs, *existing, *out, opts))
+}
+
+func run(outputs map[pscendpoints.Producer]*string, existingPath, out string, opts pscendpoints.Options) int {
+	var existing *pscendpoints.Existing
+	if existingPath != "" {
+		e, err := pscendpoints.ReadExisting(existingPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		default:
+			existing = e
+			opts.Used = append(opts.Used, e.Addresses...)
+		}
+	}
+	var instances []pscendpoints.Instance
+	for _, p := range pscendpoints.Producers {
+		if *outputs[p] == "" {
+			continue
+		}
+		read, err := pscendpoints.ReadOutputs(p, *outputs[p])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		for _, inst := range read {
+			if existing.Has(inst) {
+				fmt.Fprintf(os.Stderr, "%s %s: skipped, %s already has an endpoint\n", inst.Producer, inst.Name, existingPath)
+				continue
+			}
+			instances = append(instances, inst)
+		}
+	}
+	code := 0
+	endpoints, err := pscendpoints.Endpoints(instances, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	var b bytes.Buffer
+	b.WriteString(header)
+	if err := pscendpoints.Write(&b, endpoints); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if out == "" {
+		os.Stdout.Write(b.Bytes())
+	} else if err := os.WriteFile(out, b.Bytes(), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	return code
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command resume-cleanup replays the teardown ledgers integration tests left
+// behind when their process was killed before it could tear down: it
+// destroys the recorded Terraform directories and deletes the recorded
+// resources, newest first, and removes each ledger once nothing is pending.
+//
+// Usage, from execution/test:
+//
+//	go run ./cmd/resume-cleanup [-dir path] [-dry-run]
+//
+// The directory defaults to $CNCS_LEDGER_DIR, or cncs-teardown in the
+// temporary directory, where the tests write their ledgers. Ledgers of tests
+// still running on this host are skipped. Terraform directories are destroyed
+// with the current environment, so $TF_VAR_project_id must be set as it was
+// for the tests. With -dry-run the pending entries are only listed. The exit
+// code is 1 when a teardown fails, 2 when the ledgers cannot be read and 0
+// otherwise.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+)
+
+func main() {
+	dir := flag.String("dir", teardown.Dir(), "directory of the ledgers")
+	dryRun := flag.Bool("dry-run", false, "only list the pending entries of the ledgers")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: resume-cleanup [-dir path] [-dry-run]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	os.Exit(run(*dir, *dryRun))
+}
+
+func run(dir string, dryRun bool) int {
+	ledgers, err := teardown.Unfinished(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	code := 0
+	for _, l := range ledgers {
+		pending := l.Pending()
+		fmt.Printf("%s: %s of run %s in %s, started %s, %d pending\n", l.Path, l.Header.Test, l.Header.Run, l.Header.ProjectID, l.Header.Started.Format("2006-01-02 15:04"), len(pending))
+		for _, e := range pending {
+			fmt.Printf("  %s\n", e)
+		}
+		if dryRun {
+			l.Close()
+			continue
+		}
+		s := teardown.New(l)
+		s.Out = os.Stdout
+		if err := s.Teardown(); err != nil {
+			code = 1
+		}
+		if err := l.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			code = 1
+		}
+	}
+	fmt.Printf("%s: %d unfinished ledgers\n", dir, len(ledgers))
+	return code
+}
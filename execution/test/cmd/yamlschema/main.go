@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command yamlschema regenerates the JSON Schema of the YAML configuration
+// files of the producer and consumer stages from their variables.tf and
+// locals.tf, and writes it next to the config folder of each stage as
+// config.schema.json.
+//
+// Usage, from execution/test:
+//
+//	go run ./cmd/yamlschema [-check] [-validate] [stage ...]
+//
+// Without stage arguments every stage with a configuration folder is
+// generated. With -check nothing is written and the schemas that differ
+// from their Terraform source are listed instead. With -validate the
+// *.yaml and *.yaml.example files of each config folder are validated
+// against the schema. The exit code is 1 when a schema is out of date or a
+// file is invalid, 2 when a stage cannot be read and 0 otherwise.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/yamlschema"
+)
+
+func main() {
+	check := flag.Bool("check", false, "list out-of-date schemas instead of writing them")
+	validate := flag.Bool("validate", false, "validate the YAML files of each config folder against the schema")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: yamlschema [-check] [-validate] [stage ...]\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	os.Exit(run(*check, *validate, flag.Args()))
+}
+
+func run(check, validate bool, names []string) int {
+	root, err := stages.Root()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	var selected []stages.Stage
+	for _, name := range names {
+		s, ok := stages.Get(name)
+		if !ok || s.Config == "" {
+			fmt.Fprintf(os.Stderr, "%s is not a stage with a configuration folder\n", name)
+			return 2
+		}
+		selected = append(selected, s)
+	}
+	if len(names) == 0 {
+		for _, s := range stages.All {
+			if s.Config != "" {
+				selected = append(selected, s)
+			}
+		}
+	}
+	code := 0
+	for _, s := range selected {
+		schema, err := yamlschema.GenerateStage(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", s.Name, err)
+			return 2
+		}
+		data, err := yamlschema.Marshal(schema)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", s.Name, err)
+			return 2
+		}
+		path := yamlschema.Path(s)
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			rel = path
+		}
+		current, err := os.ReadFile(path)
+		switch {
+		case err == nil && bytes.Equal(current, data):
+		case check:
+			fmt.Printf("%s: out of date with %s\n", rel, s.Dir)
+			code = 1
+		default:
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+			fmt.Printf("%s: written\n", rel)
+		}
+		if validate {
+			files, err := configFiles(s.ConfigPath())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 2
+			}
+			for _, file := range files {
+				if err := yamlschema.ValidateFile(schema, file); err != nil {
+					fmt.Println(err)
+					code = 1
+				}
+			}
+		}
+	}
+	return code
+}
+
+// configFiles returns the *.yaml and *.yaml.example files of dir.
+func configFiles(dir string) ([]string, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yaml.example"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
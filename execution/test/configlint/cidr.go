@@ -0,0 +1,419 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// Rules reported by CheckAddressRanges and CheckAddressSpace.
+const (
+	RuleInvalidCIDR   = "invalid-cidr"
+	RuleCIDROverlap   = "cidr-overlap"
+	RuleNonRFC1918    = "non-rfc1918"
+	RuleBGPRange      = "bgp-range"
+	RuleRangeTooSmall = "range-too-small"
+	RuleDanglingRange = "dangling-range"
+)
+
+// Purpose is what an AddressRange is used for.
+type Purpose string
+
+// Purposes of the ranges 02-networking declares.
+const (
+	PurposeSubnet          Purpose = "subnet range"
+	PurposeSecondary       Purpose = "secondary range"
+	PurposePSA             Purpose = "PSA range"
+	PurposeAdvertised      Purpose = "advertised range"
+	PurposeVPNSession      Purpose = "HA VPN BGP session range"
+	PurposeInterconnectBGP Purpose = "VLAN attachment BGP range"
+)
+
+// minPrefix is the longest prefix, and so the smallest range, Google Cloud
+// accepts or the stages need for each purpose: /29 for subnet ranges and
+// /24 for the PSA range that Cloud SQL and AlloyDB allocate from.
+var minPrefix = map[Purpose]int{
+	PurposeSubnet:    29,
+	PurposeSecondary: 29,
+	PurposePSA:       24,
+}
+
+// bgpPrefix is the prefix length of link-local BGP ranges: a /30 per HA VPN
+// tunnel and a /29 per Dedicated Interconnect VLAN attachment.
+var bgpPrefix = map[Purpose]int{
+	PurposeVPNSession:      30,
+	PurposeInterconnectBGP: 29,
+}
+
+// minPodsPrefix is the smallest GKE pod range: every node reserves a /24
+// for its pods at the default of 110 pods per node.
+const minPodsPrefix = 24
+
+var (
+	rfc1918 = []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+	}
+	linkLocal = netip.MustParsePrefix("169.254.0.0/16")
+)
+
+// AddressRange is an IPv4 range declared in networking.tfvars, or by the
+// default of a 02-networking variable.
+type AddressRange struct {
+	Prefix  netip.Prefix
+	Purpose Purpose
+	// Source is the variable path of the range, for example
+	// subnets[0].ip_cidr_range.
+	Source string
+	// Subnet and Name identify secondary ranges, which GKE clusters name
+	// in ip_range_pods and ip_range_services.
+	Subnet string
+	Name   string
+
+	File   string
+	Line   int
+	Column int
+}
+
+func (r AddressRange) String() string {
+	return fmt.Sprintf("%s %s (%s)", r.Purpose, r.Prefix, r.Source)
+}
+
+// rangeVariables lists the 02-networking variables that hold address ranges
+// and their purpose. Subnet and secondary ranges are read from subnets.
+var rangeVariables = []struct {
+	name    string
+	purpose Purpose
+}{
+	{"psa_range", PurposePSA},
+	{"user_specified_ip_range", PurposeAdvertised},
+	{"tunnel_1_router_bgp_session_range", PurposeVPNSession},
+	{"tunnel_2_router_bgp_session_range", PurposeVPNSession},
+	{"first_va_bgp_range", PurposeInterconnectBGP},
+	{"second_va_bgp_range", PurposeInterconnectBGP},
+}
+
+var (
+	subnetName     = regexp.MustCompile(`^subnets\[(\d+)\]\.name$`)
+	subnetRange    = regexp.MustCompile(`^subnets\[(\d+)\]\.ip_cidr_range$`)
+	secondaryRange = regexp.MustCompile(`^subnets\[(\d+)\]\.secondary_ip_ranges\.(.+)$`)
+)
+
+// ReadAddressRanges reads the address ranges of 02-networking from its
+// tfvars file at path, falling back to the defaults of the variables in dir.
+// Empty values and placeholders are skipped, and values that are not IPv4
+// CIDR ranges are returned as diagnostics.
+func ReadAddressRanges(path, dir string) ([]AddressRange, []Diagnostic, error) {
+	vars, err := ReadVariables(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, parseDiags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if parseDiags.HasErrors() {
+		return nil, nil, parseDiags
+	}
+	attrs := f.Body.(*hclsyntax.Body).Attributes
+	leaves := func(name string) []leaf {
+		if attr, ok := attrs[name]; ok {
+			return stringLeaves(attr.Expr, name)
+		}
+		if expr := vars[name].defaultExpr; expr != nil {
+			return stringLeaves(expr, name)
+		}
+		return nil
+	}
+
+	var ranges []AddressRange
+	var diags []Diagnostic
+	add := func(l leaf, purpose Purpose, subnet, name string) {
+		if l.value == "" || placeholder.MatchString(l.value) {
+			return
+		}
+		prefix, err := netip.ParsePrefix(l.value)
+		if err != nil || !prefix.Addr().Is4() {
+			diags = append(diags, Diagnostic{
+				File: l.rng.Filename, Line: l.rng.Start.Line, Column: l.rng.Start.Column,
+				Severity: Error, Rule: RuleInvalidCIDR,
+				Message: fmt.Sprintf("%s %q is not an IPv4 CIDR range", l.path, l.value),
+			})
+			return
+		}
+		ranges = append(ranges, AddressRange{
+			Prefix: prefix, Purpose: purpose, Source: l.path, Subnet: subnet, Name: name,
+			File: l.rng.Filename, Line: l.rng.Start.Line, Column: l.rng.Start.Column,
+		})
+	}
+
+	subnets := leaves("subnets")
+	subnetNames := map[string]string{}
+	for _, l := range subnets {
+		if m := subnetName.FindStringSubmatch(l.path); m != nil {
+			subnetNames[m[1]] = l.value
+		}
+	}
+	for _, l := range subnets {
+		if m := subnetRange.FindStringSubmatch(l.path); m != nil {
+			add(l, PurposeSubnet, subnetNames[m[1]], "")
+		} else if m := secondaryRange.FindStringSubmatch(l.path); m != nil {
+			add(l, PurposeSecondary, subnetNames[m[1]], m[2])
+		}
+	}
+	for _, v := range rangeVariables {
+		for _, l := range leaves(v.name) {
+			add(l, v.purpose, "", "")
+		}
+	}
+	return ranges, diags, nil
+}
+
+// leaf is a string literal inside a tfvars value.
+type leaf struct {
+	path  string
+	value string
+	rng   hcl.Range
+}
+
+// stringLeaves returns the string literals of expr, a tuple, object or
+// string literal, with their path below prefix.
+func stringLeaves(expr hclsyntax.Expression, prefix string) []leaf {
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		if !e.IsStringLiteral() {
+			return nil
+		}
+		v, _ := e.Value(nil)
+		return []leaf{{path: prefix, value: v.AsString(), rng: e.SrcRange}}
+	case *hclsyntax.TupleConsExpr:
+		var leaves []leaf
+		for i, item := range e.Exprs {
+			leaves = append(leaves, stringLeaves(item, prefix+"["+strconv.Itoa(i)+"]")...)
+		}
+		return leaves
+	case *hclsyntax.ObjectConsExpr:
+		var leaves []leaf
+		for _, item := range e.Items {
+			key := hcl.ExprAsKeyword(item.KeyExpr)
+			if key == "" {
+				v, diags := item.KeyExpr.Value(nil)
+				if diags.HasErrors() || v.Type() != cty.String {
+					continue
+				}
+				key = v.AsString()
+			}
+			leaves = append(leaves, stringLeaves(item.ValueExpr, prefix+"."+key)...)
+		}
+		return leaves
+	}
+	return nil
+}
+
+// CheckAddressRanges reports overlapping ranges, ranges outside RFC 1918
+// and ranges too small for their purpose. Subnet, secondary and PSA ranges
+// share the address space of the VPC and must not overlap. Advertised
+// ranges that overlap them are only warned about, since a summary route may
+// cover subnets on purpose. BGP ranges must be link-local ranges of the
+// right size that do not overlap each other.
+func CheckAddressRanges(ranges []AddressRange) []Diagnostic {
+	var diags []Diagnostic
+	report := func(r AddressRange, severity Severity, rule, format string, args ...any) {
+		diags = append(diags, Diagnostic{
+			File: r.File, Line: r.Line, Column: r.Column, Severity: severity, Rule: rule,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+	for i, r := range ranges {
+		if bits, ok := bgpPrefix[r.Purpose]; ok {
+			if !linkLocal.Contains(r.Prefix.Addr()) || r.Prefix.Bits() != bits {
+				report(r, Error, RuleBGPRange, "%s must be a /%d inside %s", r, bits, linkLocal)
+			}
+		} else if r.Purpose != PurposeAdvertised {
+			if !isRFC1918(r.Prefix) {
+				report(r, Warning, RuleNonRFC1918, "%s is outside the RFC 1918 private ranges", r)
+			}
+			if bits, ok := minPrefix[r.Purpose]; ok && r.Prefix.Bits() > bits {
+				report(r, Error, RuleRangeTooSmall, "%s is smaller than the /%d a %s needs", r, bits, r.Purpose)
+			}
+		}
+		for _, other := range ranges[:i] {
+			if !r.Prefix.Overlaps(other.Prefix) || isBGP(r) != isBGP(other) {
+				continue
+			}
+			severity := Error
+			if r.Purpose == PurposeAdvertised || other.Purpose == PurposeAdvertised {
+				severity = Warning
+			}
+			report(r, severity, RuleCIDROverlap, "%s overlaps %s declared at %s:%d", r, other, filepath.Base(other.File), other.Line)
+		}
+	}
+	return diags
+}
+
+func isBGP(r AddressRange) bool {
+	_, ok := bgpPrefix[r.Purpose]
+	return ok
+}
+
+func isRFC1918(p netip.Prefix) bool {
+	for _, private := range rfc1918 {
+		if private.Bits() <= p.Bits() && private.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAddressSpace reads the address ranges of the networking stage, checks
+// them with CheckAddressRanges and checks the ranges the YAML configuration
+// of targets uses with CheckRangeReferences. Files are reported relative to
+// root.
+func CheckAddressSpace(root string, targets []Target) ([]Diagnostic, error) {
+	s := stages.MustGet("networking")
+	ranges, diags, err := ReadAddressRanges(s.TFVarsPath(), s.TerraformDir())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	diags = append(diags, CheckAddressRanges(ranges)...)
+	network, err := ReadNetwork(s.TFVarsPath(), s.TerraformDir())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	refDiags, err := CheckRangeReferences(network, ranges, targets)
+	if err != nil {
+		return nil, err
+	}
+	diags = append(diags, refDiags...)
+	relativize(root, diags)
+	Sort(diags)
+	return diags, nil
+}
+
+// rangeUse describes where the YAML configuration of a stage names
+// address ranges of 02-networking.
+type rangeUse struct {
+	// PSA lists the YAML paths that name the allocated PSA range.
+	PSA []string
+	// Pods and Services are the YAML paths of the secondary range names of
+	// a GKE cluster, on the subnet at Subnetwork.
+	Subnetwork, Pods, Services string
+}
+
+var rangeUses = map[string]rangeUse{
+	"producer/cloudsql": {PSA: []string{
+		"network_config.connectivity.psa_config.allocated_ip_ranges.primary",
+		"network_config.connectivity.psa_config.allocated_ip_ranges.replica",
+	}},
+	"producer/alloydb": {PSA: []string{"allocated_ip_range"}},
+	"producer/gke":     {Subnetwork: "subnetwork", Pods: "ip_range_pods", Services: "ip_range_services"},
+}
+
+// CheckRangeReferences checks that the allocated ranges Cloud SQL and
+// AlloyDB name are the PSA range of network and that the pod and service
+// ranges of GKE clusters are secondary ranges of their subnet, with room
+// for at least one node's pods. Nothing is checked while the network name
+// is unset or still a placeholder.
+func CheckRangeReferences(network Network, ranges []AddressRange, targets []Target) ([]Diagnostic, error) {
+	if network.Name == "" || placeholder.MatchString(network.Name) {
+		return nil, nil
+	}
+	var diags []Diagnostic
+	for _, target := range targets {
+		use, ok := rangeUses[target.Name]
+		if !ok || target.Config == "" {
+			continue
+		}
+		files, err := ConfigFiles(target.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", target.Name, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var doc yaml.Node
+			if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+				// Reported by Lint.
+				continue
+			}
+			c := &networkChecker{network: network, file: file}
+			c.checkRanges(doc.Content[0], use, ranges)
+			diags = append(diags, c.diags...)
+		}
+	}
+	return diags, nil
+}
+
+func (c *networkChecker) checkRanges(doc *yaml.Node, use rangeUse, ranges []AddressRange) {
+	for _, path := range use.PSA {
+		node := lookupScalar(doc, path)
+		if node == nil || node.Value == c.network.PSARangeName {
+			continue
+		}
+		c.report(node, RuleDanglingRange, "%q names the allocated range %q, but %s allocates its PSA range as %q",
+			path, node.Value, c.networkingFile(), c.network.PSARangeName)
+	}
+	if use.Subnetwork == "" {
+		return
+	}
+	subnetNode := lookupScalar(doc, use.Subnetwork)
+	if subnetNode == nil {
+		return
+	}
+	subnet := parseResourceRef(subnetNode.Value, "subnetworks").Name
+	if _, ok := c.network.subnet(subnet); !ok {
+		// Reported by CheckNetworkReferences.
+		return
+	}
+	for _, path := range []string{use.Pods, use.Services} {
+		node := lookupScalar(doc, path)
+		if node == nil {
+			continue
+		}
+		r, ok := secondaryRangeOf(ranges, subnet, node.Value)
+		switch {
+		case !ok:
+			c.report(node, RuleDanglingRange, "%q names secondary range %q, which subnet %q does not have in %s",
+				path, node.Value, subnet, c.networkingFile())
+		case path == use.Pods && r.Prefix.Bits() > minPodsPrefix:
+			c.report(node, RuleRangeTooSmall, "%q names %s, which is smaller than the /%d the pods of one node need",
+				path, r, minPodsPrefix)
+		}
+	}
+}
+
+func secondaryRangeOf(ranges []AddressRange, subnet, name string) (AddressRange, bool) {
+	for _, r := range ranges {
+		if r.Purpose == PurposeSecondary && r.Subnet == subnet && r.Name == name {
+			return r, true
+		}
+	}
+	return AddressRange{}, false
+}
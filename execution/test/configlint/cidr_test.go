@@ -0,0 +1,208 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const rangeVariablesTF = `variable "subnets" {
+  type    = list(any)
+  default = []
+}
+variable "psa_range" {
+  type    = string
+  default = "10.0.64.0/20"
+}
+variable "user_specified_ip_range" {
+  type    = list(string)
+  default = ["199.36.154.8/30"]
+}
+variable "tunnel_1_router_bgp_session_range" {
+  type    = string
+  default = "169.254.1.2/30"
+}
+variable "tunnel_2_router_bgp_session_range" {
+  type    = string
+  default = "169.254.2.2/30"
+}
+variable "first_va_bgp_range" {
+  type    = string
+  default = ""
+}
+variable "second_va_bgp_range" {
+  type    = string
+  default = ""
+}
+`
+
+func mustPrefix(t *testing.T, s string) netip.Prefix {
+	t.Helper()
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// diagnosticStrings returns diags, relative to dir and sorted, as strings.
+func diagnosticStrings(dir string, diags []Diagnostic) []string {
+	relativize(dir, diags)
+	Sort(diags)
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	return got
+}
+
+/*
+TestAddressRanges verifies that ranges are collected from networking.tfvars
+and the variable defaults, and that overlaps, non-private ranges, ranges
+too small for their purpose, misplaced BGP ranges and invalid CIDRs are
+reported at the line that declares them.
+*/
+func TestAddressRanges(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"02-networking/variables.tf": rangeVariablesTF,
+		"networking.tfvars": `subnets = [
+  {
+    name          = "subnet-a"
+    region        = "us-central1"
+    ip_cidr_range = "10.0.0.0/16"
+    secondary_ip_ranges = {
+      pods     = "10.4.0.0/14"
+      services = "10.0.128.0/20"
+    }
+  },
+  {
+    name          = "subnet-b"
+    region        = "us-central1"
+    ip_cidr_range = "100.64.0.0/30"
+  },
+  {
+    name          = "subnet-c"
+    region        = "us-central1"
+    ip_cidr_range = "10.1.0.0/33"
+  },
+]
+user_specified_ip_range = ["10.0.0.0/8"]
+tunnel_1_router_bgp_session_range = "169.254.1.2/30"
+tunnel_2_router_bgp_session_range = "169.254.1.1/30"
+first_va_bgp_range = "10.255.0.0/29"
+`,
+	})
+	ranges, diags, err := ReadAddressRanges(filepath.Join(dir, "networking.tfvars"), filepath.Join(dir, "02-networking"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, r := range ranges {
+		sources = append(sources, r.String())
+	}
+	wantSources := []string{
+		"subnet range 10.0.0.0/16 (subnets[0].ip_cidr_range)",
+		"secondary range 10.4.0.0/14 (subnets[0].secondary_ip_ranges.pods)",
+		"secondary range 10.0.128.0/20 (subnets[0].secondary_ip_ranges.services)",
+		"subnet range 100.64.0.0/30 (subnets[1].ip_cidr_range)",
+		"PSA range 10.0.64.0/20 (psa_range)",
+		"advertised range 10.0.0.0/8 (user_specified_ip_range[0])",
+		"HA VPN BGP session range 169.254.1.2/30 (tunnel_1_router_bgp_session_range)",
+		"HA VPN BGP session range 169.254.1.1/30 (tunnel_2_router_bgp_session_range)",
+		"VLAN attachment BGP range 10.255.0.0/29 (first_va_bgp_range)",
+	}
+	if diff := cmp.Diff(wantSources, sources); diff != "" {
+		t.Errorf("ReadAddressRanges() mismatch (-want +got):\n%s", diff)
+	}
+	if r := ranges[1]; r.Subnet != "subnet-a" || r.Name != "pods" {
+		t.Errorf("secondary range = %+v, want subnet-a/pods", r)
+	}
+
+	diags = append(diags, CheckAddressRanges(ranges)...)
+	got := diagnosticStrings(dir, diags)
+	want := []string{
+		`02-networking/variables.tf:7:13: error: PSA range 10.0.64.0/20 (psa_range) overlaps subnet range 10.0.0.0/16 (subnets[0].ip_cidr_range) declared at networking.tfvars:5 [cidr-overlap]`,
+		`networking.tfvars:8:18: error: secondary range 10.0.128.0/20 (subnets[0].secondary_ip_ranges.services) overlaps subnet range 10.0.0.0/16 (subnets[0].ip_cidr_range) declared at networking.tfvars:5 [cidr-overlap]`,
+		`networking.tfvars:14:21: warning: subnet range 100.64.0.0/30 (subnets[1].ip_cidr_range) is outside the RFC 1918 private ranges [non-rfc1918]`,
+		`networking.tfvars:14:21: error: subnet range 100.64.0.0/30 (subnets[1].ip_cidr_range) is smaller than the /29 a subnet range needs [range-too-small]`,
+		`networking.tfvars:19:21: error: subnets[2].ip_cidr_range "10.1.0.0/33" is not an IPv4 CIDR range [invalid-cidr]`,
+		`networking.tfvars:22:28: warning: advertised range 10.0.0.0/8 (user_specified_ip_range[0]) overlaps subnet range 10.0.0.0/16 (subnets[0].ip_cidr_range) declared at networking.tfvars:5 [cidr-overlap]`,
+		`networking.tfvars:22:28: warning: advertised range 10.0.0.0/8 (user_specified_ip_range[0]) overlaps secondary range 10.4.0.0/14 (subnets[0].secondary_ip_ranges.pods) declared at networking.tfvars:7 [cidr-overlap]`,
+		`networking.tfvars:22:28: warning: advertised range 10.0.0.0/8 (user_specified_ip_range[0]) overlaps secondary range 10.0.128.0/20 (subnets[0].secondary_ip_ranges.services) declared at networking.tfvars:8 [cidr-overlap]`,
+		`networking.tfvars:22:28: warning: advertised range 10.0.0.0/8 (user_specified_ip_range[0]) overlaps PSA range 10.0.64.0/20 (psa_range) declared at variables.tf:7 [cidr-overlap]`,
+		`networking.tfvars:24:37: error: HA VPN BGP session range 169.254.1.1/30 (tunnel_2_router_bgp_session_range) overlaps HA VPN BGP session range 169.254.1.2/30 (tunnel_1_router_bgp_session_range) declared at networking.tfvars:23 [cidr-overlap]`,
+		`networking.tfvars:25:22: error: VLAN attachment BGP range 10.255.0.0/29 (first_va_bgp_range) must be a /29 inside 169.254.0.0/16 [bgp-range]`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CheckAddressRanges() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestCheckRangeReferences verifies that Cloud SQL and AlloyDB allocated
+ranges must name the PSA range and that GKE pod and service ranges must be
+large enough secondary ranges of the cluster's subnet.
+*/
+func TestCheckRangeReferences(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"cloudsql/config/instance.yaml": `network_config:
+  connectivity:
+    psa_config:
+      allocated_ip_ranges:
+        primary: psarange
+        replica: range1
+`,
+		"alloydb/config/instance.yaml": `allocated_ip_range: range1
+`,
+		"gke/config/cluster.yaml": `subnetwork: subnet-a
+ip_range_pods: pods
+ip_range_services: svc
+`,
+	})
+	network := Network{
+		File:         "networking.tfvars",
+		Name:         "vpc",
+		Subnets:      []Subnet{{Name: "subnet-a", Region: "us-central1"}},
+		PSARangeName: "psarange",
+	}
+	ranges := []AddressRange{
+		{Purpose: PurposeSecondary, Subnet: "subnet-a", Name: "pods", Source: "subnets[0].secondary_ip_ranges.pods", Prefix: mustPrefix(t, "10.4.0.0/26")},
+		{Purpose: PurposeSecondary, Subnet: "subnet-a", Name: "services", Source: "subnets[0].secondary_ip_ranges.services", Prefix: mustPrefix(t, "10.5.0.0/20")},
+	}
+	targets := []Target{
+		{Name: "producer/cloudsql", Config: filepath.Join(dir, "cloudsql", "config")},
+		{Name: "producer/alloydb", Config: filepath.Join(dir, "alloydb", "config")},
+		{Name: "producer/gke", Config: filepath.Join(dir, "gke", "config")},
+	}
+	diags, err := CheckRangeReferences(network, ranges, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`alloydb/config/instance.yaml:1:21: error: "allocated_ip_range" names the allocated range "range1", but networking.tfvars allocates its PSA range as "psarange" [dangling-range]`,
+		`cloudsql/config/instance.yaml:6:18: error: "network_config.connectivity.psa_config.allocated_ip_ranges.replica" names the allocated range "range1", but networking.tfvars allocates its PSA range as "psarange" [dangling-range]`,
+		`gke/config/cluster.yaml:2:16: error: "ip_range_pods" names secondary range 10.4.0.0/26 (subnets[0].secondary_ip_ranges.pods), which is smaller than the /24 the pods of one node need [range-too-small]`,
+		`gke/config/cluster.yaml:3:20: error: "ip_range_services" names secondary range "svc", which subnet "subnet-a" does not have in networking.tfvars [dangling-range]`,
+	}
+	if diff := cmp.Diff(want, diagnosticStrings(dir, diags)); diff != "" {
+		t.Errorf("CheckRangeReferences() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configlint checks the tfvars files and YAML configuration under
+// configuration/ without running Terraform, so that mistakes such as a
+// missing required key, an unreplaced <placeholder> from a *.yaml.example
+// file or an empty string for a boolean variable are reported with their
+// file and line before run.sh starts planning.
+//
+// YAML files are checked against the configschema struct of their stage:
+// fields without omitempty are required keys and keys without a field are
+// reported as unknown. tfvars files are checked against the variable blocks
+// of their stage's Terraform directory: their type constraints, including
+// object shapes, and the validation blocks that only use the variable
+// itself. CheckVars applies the same checks to the Vars a test passes to
+// terraform.Options.
+//
+// CheckNetworks checks across stages that the network and subnet references
+// of the producer and consumer YAML files match the network, subnets and
+// PSA range configured for 02-networking.
+package configlint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configschema"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+)
+
+// Severity is the severity of a Diagnostic.
+type Severity string
+
+const (
+	// Error marks a problem that makes run.sh fail or deploy something other
+	// than intended.
+	Error Severity = "error"
+	// Warning marks a value Terraform ignores, such as a misspelled key.
+	Warning Severity = "warning"
+)
+
+// Rules reported in Diagnostic.Rule.
+const (
+	RuleSyntax          = "syntax"
+	RuleRequiredKey     = "required-key"
+	RuleUnknownKey      = "unknown-key"
+	RulePlaceholder     = "placeholder"
+	RuleEmptyValue      = "empty-value"
+	RuleMissingVariable = "missing-variable"
+	RuleUnknownVariable = "unknown-variable"
+	RuleTypeMismatch    = "type-mismatch"
+	RuleValidation      = "validation"
+)
+
+// Diagnostic is one problem found in a configuration file.
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Message  string   `json:"message"`
+}
+
+// String formats d as "file:line:column: severity: message [rule]".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", d.File, d.Line, d.Column, d.Severity, d.Message, d.Rule)
+}
+
+// placeholder matches the <...> markers of the configuration examples, such
+// as <project-id> or <service(producer/consumer)-project-id>.
+var placeholder = regexp.MustCompile(`<[A-Za-z][\w().\-/]*>`)
+
+// Target is a tfvars file and configuration folder that belong to one
+// Terraform directory.
+type Target struct {
+	// Name is the run.sh stage name, or "bootstrap".
+	Name string
+	// TerraformDir is the directory whose variable blocks the tfvars file
+	// sets.
+	TerraformDir string
+	// TFVars is the path of the tfvars file.
+	TFVars string
+	// Config is the configuration folder, or "" if the stage has none.
+	Config string
+	// Schema is the configschema struct of one YAML file in Config.
+	Schema any
+}
+
+// Schemas maps the stages that read YAML configuration to the configschema
+// struct of one file.
+var Schemas = map[string]any{
+	"producer/alloydb":          configschema.AlloyDB{},
+	"producer/mrc":              configschema.MRC{},
+	"producer/cloudsql":         configschema.CloudSQL{},
+	"producer/gke":              configschema.GKE{},
+	"producer/vectorsearch":     configschema.VectorSearch{},
+	"producer/onlineendpoint":   configschema.VertexEndpoint{},
+	"consumer/gce":              configschema.GCE{},
+	"consumer/cloudrun/job":     configschema.CloudRun{},
+	"consumer/cloudrun/service": configschema.CloudRun{},
+}
+
+// Targets returns the targets of every run.sh stage, preceded by the
+// 00-bootstrap stage, which is applied by hand before run.sh.
+func Targets() ([]Target, error) {
+	root, err := stages.Root()
+	if err != nil {
+		return nil, err
+	}
+	targets := []Target{{
+		Name:         "bootstrap",
+		TerraformDir: filepath.Join(root, "execution", "00-bootstrap"),
+		TFVars:       filepath.Join(root, "configuration", "bootstrap.tfvars"),
+	}}
+	for _, s := range stages.All {
+		targets = append(targets, Target{
+			Name:         s.Name,
+			TerraformDir: s.TerraformDir(),
+			TFVars:       s.TFVarsPath(),
+			Config:       s.ConfigPath(),
+			Schema:       Schemas[s.Name],
+		})
+	}
+	return targets, nil
+}
+
+// Lint checks the tfvars file and the YAML configuration of every target
+// and returns the diagnostics sorted by file and line. Files are reported
+// relative to root.
+func Lint(root string, targets []Target) ([]Diagnostic, error) {
+	var diags []Diagnostic
+	for _, target := range targets {
+		d, err := LintTFVars(target.TFVars, target.TerraformDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", target.Name, err)
+		}
+		diags = append(diags, d...)
+		if target.Config == "" || target.Schema == nil {
+			continue
+		}
+		files, err := ConfigFiles(target.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", target.Name, err)
+		}
+		for _, file := range files {
+			d, err := LintYAMLFile(file, target.Schema)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", target.Name, err)
+			}
+			diags = append(diags, d...)
+		}
+	}
+	relativize(root, diags)
+	Sort(diags)
+	return diags, nil
+}
+
+// relativize makes the files of diags relative to root.
+func relativize(root string, diags []Diagnostic) {
+	for i := range diags {
+		if rel, ok := relative(root, diags[i].File); ok {
+			diags[i].File = rel
+		}
+	}
+}
+
+// relative returns path as a slash-separated path relative to root, if it
+// is inside root.
+func relative(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// ConfigFiles returns the YAML files of a configuration folder that the
+// stages read, skipping the *.yaml.example files and files whose name
+// starts with "_", which the fileset of locals.tf ignores.
+func ConfigFiles(dir string) ([]string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, m := range matches {
+		if !strings.HasPrefix(filepath.Base(m), "_") {
+			files = append(files, m)
+		}
+	}
+	return files, nil
+}
+
+// Sort orders diags by file, line and column.
+func Sort(diags []Diagnostic) {
+	sort.SliceStable(diags, func(i, j int) bool {
+		a, b := diags[i], diags[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
+
+// HasErrors reports whether any diagnostic has the Error severity.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes one line per diagnostic followed by a summary line.
+func WriteText(w io.Writer, diags []Diagnostic) error {
+	errors := 0
+	for _, d := range diags {
+		if d.Severity == Error {
+			errors++
+		}
+		if _, err := fmt.Fprintln(w, d); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d error(s), %d warning(s)\n", errors, len(diags)-errors)
+	return err
+}
+
+// WriteJSON writes diags as an indented JSON array.
+func WriteJSON(w io.Writer, diags []Diagnostic) error {
+	if diags == nil {
+		diags = []Diagnostic{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(diags)
+}
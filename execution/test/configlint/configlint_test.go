@@ -0,0 +1,239 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configschema"
+	"github.com/google/go-cmp/cmp"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const cloudSQLYAML = `name: ""
+project_id: <project-id>
+database_version: POSTGRES_15
+tier: db-f1-micro
+netwrok_config: {}
+network_config:
+  connectivity:
+    psa_config:
+      allocated_ip_ranges:
+        primary: range1
+`
+
+/*
+TestLintYAML verifies that missing and empty required keys, unknown keys and
+placeholders are reported at their line, including in nested objects.
+*/
+func TestLintYAML(t *testing.T) {
+	got := LintYAML("instance.yaml", []byte(cloudSQLYAML), configschema.CloudSQL{})
+	want := []Diagnostic{
+		{File: "instance.yaml", Line: 1, Column: 7, Severity: Error, Rule: RuleEmptyValue, Message: `required key "name" is empty`},
+		{File: "instance.yaml", Line: 2, Column: 13, Severity: Error, Rule: RulePlaceholder, Message: `"project_id" still contains the placeholder <project-id>`},
+		{File: "instance.yaml", Line: 5, Column: 1, Severity: Warning, Rule: RuleUnknownKey, Message: `unknown key "netwrok_config", which the stage ignores`},
+		{File: "instance.yaml", Line: 9, Column: 7, Severity: Error, Rule: RuleRequiredKey, Message: `missing required key "network_config.connectivity.psa_config.private_network"`},
+		{File: "instance.yaml", Line: 1, Column: 1, Severity: Error, Rule: RuleRequiredKey, Message: `missing required key "region"`},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LintYAML() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestLintYAMLSyntaxError verifies that a file that is not valid YAML is
+reported at the line of the parse error.
+*/
+func TestLintYAMLSyntaxError(t *testing.T) {
+	got := LintYAML("instance.yaml", []byte("name: a\n  region: us-central1\n"), configschema.CloudSQL{})
+	want := []Diagnostic{{
+		File: "instance.yaml", Line: 2, Column: 1, Severity: Error, Rule: RuleSyntax,
+		Message: "mapping values are not allowed in this context",
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LintYAML() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+const networkingTFVars = `project_id = "<project-id>"
+region     = "us-central1"
+
+create_scp_policy = ""
+create_nat        = "" # Use true or false
+psa_range_name    = ""
+deletion_policy   = ""
+subnets = [
+  {
+    name   = "subnet-1"
+    region = "<region>"
+  }
+]
+crate_havpn = true
+`
+
+/*
+TestLintTFVars verifies that empty strings for bool variables and for
+string variables with a non-empty default, placeholders, unknown variables
+and missing required variables are reported.
+*/
+func TestLintTFVars(t *testing.T) {
+	vars := map[string]Variable{
+		"project_id":        {Name: "project_id", Type: "string", Required: true},
+		"region":            {Name: "region", Type: "string", Required: true},
+		"network_name":      {Name: "network_name", Type: "string", Required: true},
+		"create_scp_policy": {Name: "create_scp_policy", Type: "bool", Default: cty.False},
+		"create_nat":        {Name: "create_nat", Type: "string", Default: cty.StringVal("true")},
+		"psa_range_name":    {Name: "psa_range_name", Type: "string", Default: cty.StringVal("psarange")},
+		"deletion_policy":   {Name: "deletion_policy", Type: "string", Default: cty.StringVal("")},
+		"subnets":           {Name: "subnets", Default: cty.ListValEmpty(cty.DynamicPseudoType)},
+		"create_havpn":      {Name: "create_havpn", Type: "string", Default: cty.StringVal("false")},
+	}
+	got := lintTFVars("networking.tfvars", []byte(networkingTFVars), vars)
+	Sort(got)
+	want := []Diagnostic{
+		{File: "networking.tfvars", Line: 1, Column: 1, Severity: Error, Rule: RuleMissingVariable, Message: `required variable "network_name" is not set`},
+		{File: "networking.tfvars", Line: 1, Column: 14, Severity: Error, Rule: RulePlaceholder, Message: "project_id still contains the placeholder <project-id>"},
+		{File: "networking.tfvars", Line: 4, Column: 21, Severity: Error, Rule: RuleEmptyValue, Message: "create_scp_policy must be a bool, not an empty string"},
+		{File: "networking.tfvars", Line: 5, Column: 21, Severity: Error, Rule: RuleEmptyValue, Message: `create_nat is an empty string, which overrides the default "true"`},
+		{File: "networking.tfvars", Line: 6, Column: 21, Severity: Error, Rule: RuleEmptyValue, Message: `psa_range_name is an empty string, which overrides the default "psarange"`},
+		{File: "networking.tfvars", Line: 11, Column: 14, Severity: Error, Rule: RulePlaceholder, Message: "subnets still contains the placeholder <region>"},
+		{File: "networking.tfvars", Line: 14, Column: 1, Severity: Warning, Rule: RuleUnknownVariable, Message: `variable "crate_havpn" is not declared by the stage, Terraform ignores it`},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("lintTFVars() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestReadVariables verifies that variable types, defaults and required
+variables are read from a Terraform directory.
+*/
+func TestReadVariables(t *testing.T) {
+	dir := t.TempDir()
+	src := `variable "project_id" {
+  type = string
+}
+variable "create_nat" {
+  type    = string
+  default = "true"
+}
+variable "subnets" {
+  type = list(object({
+    name = string
+  }))
+  default = []
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := ReadVariables(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := vars["project_id"]; v.Type != "string" || !v.Required {
+		t.Errorf("project_id = %+v, want a required string", v)
+	}
+	if v := vars["create_nat"]; v.Required || v.Default != cty.StringVal("true") {
+		t.Errorf("create_nat = %+v, want default \"true\"", v)
+	}
+	if v := vars["subnets"]; v.Type != "" || v.Required {
+		t.Errorf("subnets = %+v, want an optional variable without primitive type", v)
+	}
+}
+
+/*
+TestExamplesDefineRequiredKeys verifies that every *.yaml.example file
+contains all required keys of its stage's schema, so that only its
+placeholders are left to replace. Keys the stage ignores are only warnings
+and are not checked.
+*/
+func TestExamplesDefineRequiredKeys(t *testing.T) {
+	targets, err := Targets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range targets {
+		if target.Config == "" {
+			continue
+		}
+		if target.Schema == nil {
+			t.Errorf("%s: no schema for configuration folder %s", target.Name, target.Config)
+			continue
+		}
+		examples, err := filepath.Glob(filepath.Join(target.Config, "*.yaml.example"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, example := range examples {
+			diags, err := LintYAMLFile(example, target.Schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range diags {
+				if d.Severity == Error && d.Rule != RulePlaceholder {
+					t.Errorf("%s: %v", target.Name, d)
+				}
+			}
+		}
+	}
+}
+
+/*
+TestOutput verifies the text and JSON formats of diagnostics.
+*/
+func TestOutput(t *testing.T) {
+	diags := []Diagnostic{
+		{File: "configuration/networking.tfvars", Line: 21, Column: 14, Severity: Error, Rule: RuleEmptyValue, Message: "create_nat is empty"},
+		{File: "configuration/networking.tfvars", Line: 30, Column: 1, Severity: Warning, Rule: RuleUnknownVariable, Message: "unknown"},
+	}
+	var text bytes.Buffer
+	if err := WriteText(&text, diags); err != nil {
+		t.Fatal(err)
+	}
+	wantText := "configuration/networking.tfvars:21:14: error: create_nat is empty [empty-value]\n" +
+		"configuration/networking.tfvars:30:1: warning: unknown [unknown-variable]\n" +
+		"1 error(s), 1 warning(s)\n"
+	if diff := cmp.Diff(wantText, text.String()); diff != "" {
+		t.Errorf("WriteText() mismatch (-want +got):\n%s", diff)
+	}
+
+	var out bytes.Buffer
+	if err := WriteJSON(&out, diags); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Diagnostic
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(diags, decoded); diff != "" {
+		t.Errorf("WriteJSON() round trip mismatch (-want +got):\n%s", diff)
+	}
+	out.Reset()
+	if err := WriteJSON(&out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "[]" {
+		t.Errorf("WriteJSON(nil) = %s, want []", got)
+	}
+	if !HasErrors(diags) || HasErrors(diags[1:]) {
+		t.Error("HasErrors() does not match the Error diagnostics")
+	}
+}
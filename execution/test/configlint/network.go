@@ -0,0 +1,356 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"gopkg.in/yaml.v3"
+)
+
+// Rules reported by CheckNetworkReferences.
+const (
+	RuleDanglingNetwork = "dangling-network"
+	RuleDanglingSubnet  = "dangling-subnet"
+	RuleRegionMismatch  = "region-mismatch"
+	RuleMissingPSARange = "missing-psa-range"
+)
+
+// Network is the VPC that 02-networking creates, as configured by its tfvars
+// file and the defaults of its variables.
+type Network struct {
+	// File is the tfvars file the network was read from.
+	File      string
+	ProjectID string
+	Name      string
+	Subnets   []Subnet
+	// PSARange is the private services access range, or "" when
+	// 02-networking allocates none.
+	PSARange string
+	// PSARangeName is the name of the allocated PSA range, which producers
+	// name in their allocated_ip_range settings.
+	PSARangeName string
+}
+
+// Subnet is one entry of the subnets variable of 02-networking.
+type Subnet struct {
+	Name   string
+	Region string
+}
+
+// subnet returns the subnet named name.
+func (n Network) subnet(name string) (Subnet, bool) {
+	for _, s := range n.Subnets {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Subnet{}, false
+}
+
+// ReadNetwork reads the network 02-networking creates from its tfvars file
+// at path, falling back to the defaults of the variables in dir.
+func ReadNetwork(path, dir string) (Network, error) {
+	vars, err := ReadVariables(dir)
+	if err != nil {
+		return Network{}, err
+	}
+	values, err := readTFVarsValues(path)
+	if err != nil {
+		return Network{}, err
+	}
+	value := func(name string) cty.Value {
+		if v, ok := values[name]; ok {
+			return v
+		}
+		return vars[name].Default
+	}
+	network := Network{
+		File:         path,
+		ProjectID:    stringValue(value("project_id")),
+		Name:         stringValue(value("network_name")),
+		PSARange:     stringValue(value("psa_range")),
+		PSARangeName: stringValue(value("psa_range_name")),
+	}
+	if subnets := value("subnets"); subnets != cty.NilVal && subnets.IsKnown() && !subnets.IsNull() && subnets.CanIterateElements() {
+		for it := subnets.ElementIterator(); it.Next(); {
+			_, s := it.Element()
+			network.Subnets = append(network.Subnets, Subnet{
+				Name:   stringAttr(s, "name"),
+				Region: stringAttr(s, "region"),
+			})
+		}
+	}
+	return network, nil
+}
+
+// readTFVarsValues evaluates the attributes of the tfvars file at path.
+// Attributes that are not literal values are left out.
+func readTFVarsValues(path string) (map[string]cty.Value, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	values := map[string]cty.Value{}
+	for name, attr := range f.Body.(*hclsyntax.Body).Attributes {
+		if v, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+			values[name] = v
+		}
+	}
+	return values, nil
+}
+
+func stringValue(v cty.Value) string {
+	if v == cty.NilVal || !v.IsKnown() || v.IsNull() || v.Type() != cty.String {
+		return ""
+	}
+	return v.AsString()
+}
+
+func stringAttr(v cty.Value, name string) string {
+	if v == cty.NilVal || !v.IsKnown() || v.IsNull() || !v.Type().IsObjectType() || !v.Type().HasAttribute(name) {
+		return ""
+	}
+	return stringValue(v.GetAttr(name))
+}
+
+// networkUse describes where the YAML configuration of a stage refers to
+// the network of 02-networking.
+type networkUse struct {
+	// Network and Subnetwork are the YAML paths of the network and subnet
+	// references. Subnetwork is empty when the stage takes no subnet.
+	Network    string
+	Subnetwork string
+	// Region is the YAML path of the instance region, defaulted from the
+	// region variable of the stage.
+	Region string
+	// PSA is true when the instance connects to Network through private
+	// services access.
+	PSA bool
+}
+
+// networkUses lists the stages whose YAML configuration refers to the
+// network of 02-networking.
+var networkUses = map[string]networkUse{
+	"producer/cloudsql":       {Network: "network_config.connectivity.psa_config.private_network", PSA: true},
+	"producer/alloydb":        {Network: "network_id", PSA: true},
+	"producer/mrc":            {Network: "network_id"},
+	"producer/gke":            {Network: "network", Subnetwork: "subnetwork", Region: "region"},
+	"producer/vectorsearch":   {Network: "index_endpoint_network", PSA: true},
+	"producer/onlineendpoint": {Network: "network", PSA: true},
+	"consumer/gce":            {Network: "network", Subnetwork: "subnetwork", Region: "region"},
+}
+
+// CheckNetworks reads the network of the networking stage and checks the
+// references to it in the YAML configuration of targets with
+// CheckNetworkReferences. Files are reported relative to root.
+func CheckNetworks(root string, targets []Target) ([]Diagnostic, error) {
+	s := stages.MustGet("networking")
+	network, err := ReadNetwork(s.TFVarsPath(), s.TerraformDir())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	diags, err := CheckNetworkReferences(network, targets)
+	if err != nil {
+		return nil, err
+	}
+	relativize(root, diags)
+	Sort(diags)
+	return diags, nil
+}
+
+// CheckNetworkReferences checks that the network and subnet references in
+// the YAML configuration of targets name the network and subnets of
+// network, that a referenced subnet is in the region of the instance using
+// it and that network has a PSA range when an instance connects through
+// private services access. Nothing is checked while the network name is
+// unset or still a placeholder, and references that are empty or contain
+// placeholders are left to Lint.
+func CheckNetworkReferences(network Network, targets []Target) ([]Diagnostic, error) {
+	if network.Name == "" || placeholder.MatchString(network.Name) {
+		return nil, nil
+	}
+	var diags []Diagnostic
+	for _, target := range targets {
+		use, ok := networkUses[target.Name]
+		if !ok || target.Config == "" {
+			continue
+		}
+		var defaultRegion string
+		if use.Region != "" {
+			vars, err := ReadVariables(target.TerraformDir)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", target.Name, err)
+			}
+			defaultRegion = stringValue(vars["region"].Default)
+		}
+		files, err := ConfigFiles(target.Config)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", target.Name, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var doc yaml.Node
+			if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+				// Reported by Lint.
+				continue
+			}
+			c := &networkChecker{network: network, file: file}
+			c.check(doc.Content[0], use, defaultRegion)
+			diags = append(diags, c.diags...)
+		}
+	}
+	return diags, nil
+}
+
+type networkChecker struct {
+	network Network
+	file    string
+	diags   []Diagnostic
+}
+
+func (c *networkChecker) report(node *yaml.Node, rule, format string, args ...any) {
+	c.diags = append(c.diags, Diagnostic{
+		File:     c.file,
+		Line:     node.Line,
+		Column:   node.Column,
+		Severity: Error,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *networkChecker) check(doc *yaml.Node, use networkUse, defaultRegion string) {
+	if node := lookupScalar(doc, use.Network); node != nil {
+		ref := parseResourceRef(node.Value, "networks")
+		if ref.Name != c.network.Name || (ref.Project != "" && !isProjectNumber(ref.Project) && ref.Project != c.network.ProjectID) {
+			c.report(node, RuleDanglingNetwork, "%q refers to network %q, but %s creates %q in project %q",
+				use.Network, node.Value, c.networkingFile(), c.network.Name, c.network.ProjectID)
+		} else if use.PSA && c.network.PSARange == "" {
+			c.report(node, RuleMissingPSARange, "%q connects through private services access, but %s configures no psa_range",
+				use.Network, c.networkingFile())
+		}
+	}
+	if use.Subnetwork == "" {
+		return
+	}
+	node := lookupScalar(doc, use.Subnetwork)
+	if node == nil {
+		return
+	}
+	ref := parseResourceRef(node.Value, "subnetworks")
+	subnet, ok := c.network.subnet(ref.Name)
+	if !ok || (ref.Project != "" && !isProjectNumber(ref.Project) && ref.Project != c.network.ProjectID) {
+		c.report(node, RuleDanglingSubnet, "%q refers to subnet %q, which is not in the subnets of %s",
+			use.Subnetwork, node.Value, c.networkingFile())
+		return
+	}
+	if ref.Region != "" && ref.Region != subnet.Region {
+		c.report(node, RuleRegionMismatch, "%q names region %s, but subnet %q is in %s",
+			use.Subnetwork, ref.Region, subnet.Name, subnet.Region)
+		return
+	}
+	region := defaultRegion
+	if r := lookupScalar(doc, use.Region); r != nil {
+		region = r.Value
+	}
+	if region != "" && subnet.Region != "" && region != subnet.Region {
+		c.report(node, RuleRegionMismatch, "subnet %q is in %s, but the instance is in %s", subnet.Name, subnet.Region, region)
+	}
+}
+
+func (c *networkChecker) networkingFile() string {
+	if root, err := stages.Root(); err == nil {
+		if rel, ok := relative(root, c.network.File); ok {
+			return rel
+		}
+	}
+	return c.network.File
+}
+
+// lookupScalar returns the non-empty scalar at the dotted path in the
+// mapping node, or nil if it is unset, empty or holds a placeholder.
+func lookupScalar(node *yaml.Node, path string) *yaml.Node {
+	if path == "" {
+		return nil
+	}
+	for _, key := range strings.Split(path, ".") {
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!str" || node.Value == "" || placeholder.MatchString(node.Value) {
+		return nil
+	}
+	return node
+}
+
+// resourceRef is a network or subnet reference split into its parts.
+type resourceRef struct {
+	Project string
+	Region  string
+	Name    string
+}
+
+// selfLink matches the project, location and name of network and subnet
+// self links and resource IDs, for example
+// projects/p/regions/us-central1/subnetworks/s.
+var selfLink = regexp.MustCompile(`(?:^|/)projects/([^/]+)/(?:global|regions/([^/]+))/(networks|subnetworks)/([^/]+)$`)
+
+// parseResourceRef parses a reference to a resource of kind, "networks" or
+// "subnetworks", given by name, resource ID or self link.
+func parseResourceRef(ref, kind string) resourceRef {
+	m := selfLink.FindStringSubmatch(ref)
+	if m == nil || m[3] != kind {
+		return resourceRef{Name: ref}
+	}
+	return resourceRef{Project: m[1], Region: m[2], Name: m[4]}
+}
+
+// isProjectNumber reports whether project is a project number, which some
+// APIs require instead of the project ID and which cannot be resolved
+// offline.
+func isProjectNumber(project string) bool {
+	for _, r := range project {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return project != ""
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeFiles writes files, keyed by their path relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+/*
+TestReadNetwork verifies that the network is read from the tfvars file and
+that unset variables fall back to their defaults.
+*/
+func TestReadNetwork(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"02-networking/variables.tf": `variable "project_id" { type = string }
+variable "network_name" { type = string }
+variable "psa_range" {
+  type    = string
+  default = "10.0.64.0/20"
+}
+variable "subnets" {
+  type    = list(any)
+  default = []
+}
+`,
+		"networking.tfvars": `project_id   = "host-project"
+network_name = "vpc"
+subnets = [
+  { name = "subnet-a", region = "us-central1", ip_cidr_range = "10.0.0.0/24" },
+  { name = "subnet-b", region = "europe-west1", ip_cidr_range = "10.0.1.0/24" },
+]
+`,
+	})
+	got, err := ReadNetwork(filepath.Join(dir, "networking.tfvars"), filepath.Join(dir, "02-networking"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Network{
+		File:      filepath.Join(dir, "networking.tfvars"),
+		ProjectID: "host-project",
+		Name:      "vpc",
+		Subnets:   []Subnet{{Name: "subnet-a", Region: "us-central1"}, {Name: "subnet-b", Region: "europe-west1"}},
+		PSARange:  "10.0.64.0/20",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ReadNetwork() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestCheckNetworkReferences verifies that references to other networks,
+projects and subnets, subnets in another region than their instance and
+PSA producers without a PSA range are reported.
+*/
+func TestCheckNetworkReferences(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"gce/variables.tf": `variable "region" { type = string }`,
+		"gce/config/ok.yaml": `network: projects/host-project/global/networks/vpc
+subnetwork: projects/host-project/regions/us-central1/subnetworks/subnet-a
+region: us-central1
+`,
+		"gce/config/wrong.yaml": `network: projects/other-project/global/networks/vpc
+subnetwork: subnet-c
+region: us-central1
+`,
+		"gce/config/region.yaml": `network: vpc
+subnetwork: subnet-b
+region: us-central1
+`,
+		"gce/config/placeholder.yaml": `network: projects/<project-id>/global/networks/<network-name>
+subnetwork: projects/host-project/regions/us-central1/subnetworks/subnet-a
+region: us-central1
+`,
+		"gke/variables.tf": `variable "region" {
+  type    = string
+  default = "us-central1"
+}
+`,
+		"gke/config/cluster.yaml": `network: vpc
+subnetwork: projects/host-project/regions/us-east1/subnetworks/subnet-a
+`,
+		"gke/config/zonal.yaml": `network: vpc
+subnetwork: subnet-b
+`,
+		"vectorsearch/config/index.yaml": `index_endpoint_network: projects/123456789/global/networks/vpc
+`,
+		"cloudsql/config/other.yaml": `network_config:
+  connectivity:
+    psa_config:
+      private_network: projects/host-project/global/networks/other-vpc
+`,
+	})
+	targets := []Target{
+		{Name: "consumer/gce", TerraformDir: filepath.Join(dir, "gce"), Config: filepath.Join(dir, "gce", "config")},
+		{Name: "producer/gke", TerraformDir: filepath.Join(dir, "gke"), Config: filepath.Join(dir, "gke", "config")},
+		{Name: "producer/vectorsearch", TerraformDir: filepath.Join(dir, "vectorsearch"), Config: filepath.Join(dir, "vectorsearch", "config")},
+		{Name: "producer/cloudsql", TerraformDir: filepath.Join(dir, "cloudsql"), Config: filepath.Join(dir, "cloudsql", "config")},
+	}
+	network := Network{
+		File:      "networking.tfvars",
+		ProjectID: "host-project",
+		Name:      "vpc",
+		Subnets:   []Subnet{{Name: "subnet-a", Region: "us-central1"}, {Name: "subnet-b", Region: "europe-west1"}},
+	}
+	diags, err := CheckNetworkReferences(network, targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relativize(dir, diags)
+	Sort(diags)
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	want := []string{
+		`cloudsql/config/other.yaml:4:24: error: "network_config.connectivity.psa_config.private_network" refers to network "projects/host-project/global/networks/other-vpc", but networking.tfvars creates "vpc" in project "host-project" [dangling-network]`,
+		`gce/config/region.yaml:2:13: error: subnet "subnet-b" is in europe-west1, but the instance is in us-central1 [region-mismatch]`,
+		`gce/config/wrong.yaml:1:10: error: "network" refers to network "projects/other-project/global/networks/vpc", but networking.tfvars creates "vpc" in project "host-project" [dangling-network]`,
+		`gce/config/wrong.yaml:2:13: error: "subnetwork" refers to subnet "subnet-c", which is not in the subnets of networking.tfvars [dangling-subnet]`,
+		`gke/config/cluster.yaml:2:13: error: "subnetwork" names region us-east1, but subnet "subnet-a" is in us-central1 [region-mismatch]`,
+		`gke/config/zonal.yaml:2:13: error: subnet "subnet-b" is in europe-west1, but the instance is in us-central1 [region-mismatch]`,
+		`vectorsearch/config/index.yaml:1:25: error: "index_endpoint_network" connects through private services access, but networking.tfvars configures no psa_range [missing-psa-range]`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CheckNetworkReferences() mismatch (-want +got):\n%s", diff)
+	}
+
+	network.Name = "<network-name>"
+	if diags, err := CheckNetworkReferences(network, targets); err != nil || len(diags) != 0 {
+		t.Errorf("CheckNetworkReferences() with a placeholder network = %v, %v, want no diagnostics", diags, err)
+	}
+}
+
+/*
+TestParseResourceRef verifies that names, resource IDs and self links of
+networks and subnets are split into project, region and name.
+*/
+func TestParseResourceRef(t *testing.T) {
+	tests := []struct {
+		ref, kind string
+		want      resourceRef
+	}{
+		{"vpc", "networks", resourceRef{Name: "vpc"}},
+		{"projects/p/global/networks/vpc", "networks", resourceRef{Project: "p", Name: "vpc"}},
+		{"https://www.googleapis.com/compute/v1/projects/p/global/networks/vpc", "networks", resourceRef{Project: "p", Name: "vpc"}},
+		{"projects/p/regions/us-central1/subnetworks/s", "subnetworks", resourceRef{Project: "p", Region: "us-central1", Name: "s"}},
+		{"projects/p/regions/us-central1/subnetworks/s", "networks", resourceRef{Name: "projects/p/regions/us-central1/subnetworks/s"}},
+	}
+	for _, tc := range tests {
+		if got := parseResourceRef(tc.ref, tc.kind); got != tc.want {
+			t.Errorf("parseResourceRef(%q, %q) = %+v, want %+v", tc.ref, tc.kind, got, tc.want)
+		}
+	}
+}
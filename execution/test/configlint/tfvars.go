@@ -0,0 +1,233 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Variable is a variable block of a Terraform directory.
+type Variable struct {
+	Name string
+	// Type is the primitive type keyword, "string", "number" or "bool", or
+	// "" for collection, object and unspecified types.
+	Type string
+	// Default is the default value, or cty.NilVal if the variable is
+	// required or its default is not a literal.
+	Default cty.Value
+	// Required is true when the variable has no default.
+	Required bool
+	// Constraint is the type constraint, cty.DynamicPseudoType when the
+	// variable has no type, or cty.NilType when it was not read from a
+	// variable block.
+	Constraint cty.Type
+
+	// defaultExpr is the expression of the default, for diagnostics that
+	// point into variables.tf.
+	defaultExpr hclsyntax.Expression
+	// typeDefaults are the defaults of the optional() attributes of
+	// Constraint.
+	typeDefaults *typeexpr.Defaults
+	validations  []validation
+}
+
+// validation is a validation block of a variable.
+type validation struct {
+	condition    hcl.Expression
+	errorMessage hcl.Expression
+}
+
+// ReadVariables parses the variable blocks of every *.tf file in dir.
+func ReadVariables(dir string) (map[string]Variable, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Terraform files in %s", dir)
+	}
+	vars := map[string]Variable{}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f, diags := hclsyntax.ParseConfig(src, file, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, block := range f.Body.(*hclsyntax.Body).Blocks {
+			if block.Type != "variable" || len(block.Labels) != 1 {
+				continue
+			}
+			v := Variable{Name: block.Labels[0], Required: true, Constraint: cty.DynamicPseudoType}
+			if attr, ok := block.Body.Attributes["type"]; ok {
+				v.Type = hcl.ExprAsKeyword(attr.Expr)
+				if ty, defaults, diags := typeexpr.TypeConstraintWithDefaults(attr.Expr); !diags.HasErrors() {
+					v.Constraint, v.typeDefaults = ty, defaults
+				}
+			}
+			for _, b := range block.Body.Blocks {
+				if b.Type != "validation" {
+					continue
+				}
+				condition, ok := b.Body.Attributes["condition"]
+				if !ok {
+					continue
+				}
+				val := validation{condition: condition.Expr}
+				if msg, ok := b.Body.Attributes["error_message"]; ok {
+					val.errorMessage = msg.Expr
+				}
+				v.validations = append(v.validations, val)
+			}
+			if attr, ok := block.Body.Attributes["default"]; ok {
+				v.Required = false
+				v.defaultExpr = attr.Expr
+				if val, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+					v.Default = val
+				}
+			}
+			vars[v.Name] = v
+		}
+	}
+	return vars, nil
+}
+
+// LintTFVars checks the tfvars file at path against the variables of the
+// Terraform directory dir. It reports required variables the file does not
+// set, variables dir does not declare, unreplaced placeholders, empty
+// strings given for bool or number variables or for string variables whose
+// default is not empty, values Terraform cannot convert to the type of
+// their variable and values that fail a validation block that can be
+// evaluated without the other variables.
+func LintTFVars(path, dir string) ([]Diagnostic, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := ReadVariables(dir)
+	if err != nil {
+		return nil, err
+	}
+	return lintTFVars(path, src, vars), nil
+}
+
+func lintTFVars(file string, src []byte, vars map[string]Variable) []Diagnostic {
+	f, parseDiags := hclsyntax.ParseConfig(src, file, hcl.InitialPos)
+	if parseDiags.HasErrors() {
+		var diags []Diagnostic
+		for _, d := range parseDiags {
+			diags = append(diags, hclDiagnostic(file, d))
+		}
+		return diags
+	}
+	body := f.Body.(*hclsyntax.Body)
+	var diags []Diagnostic
+	report := func(rng hcl.Range, severity Severity, rule, format string, args ...any) {
+		diags = append(diags, Diagnostic{
+			File:     file,
+			Line:     rng.Start.Line,
+			Column:   rng.Start.Column,
+			Severity: severity,
+			Rule:     rule,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, block := range body.Blocks {
+		report(block.TypeRange, Error, RuleSyntax, "unexpected %s block, tfvars files only set variables", block.Type)
+	}
+	var names []string
+	for name := range body.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attr := body.Attributes[name]
+		v, ok := vars[name]
+		if !ok {
+			report(attr.NameRange, Warning, RuleUnknownVariable, "variable %q is not declared by the stage, Terraform ignores it", name)
+		}
+		placeholders := false
+		hclsyntax.VisitAll(attr.Expr, func(node hclsyntax.Node) hcl.Diagnostics {
+			tmpl, ok := node.(*hclsyntax.TemplateExpr)
+			if !ok || !tmpl.IsStringLiteral() {
+				return nil
+			}
+			val, _ := tmpl.Value(nil)
+			for _, p := range placeholder.FindAllString(val.AsString(), -1) {
+				report(tmpl.SrcRange, Error, RulePlaceholder, "%s still contains the placeholder %s", name, p)
+				placeholders = true
+			}
+			return nil
+		})
+		if !ok {
+			continue
+		}
+		val, valDiags := attr.Expr.Value(nil)
+		if valDiags.HasErrors() {
+			continue
+		}
+		if val.Type() == cty.String && val.IsKnown() && !val.IsNull() && val.AsString() == "" {
+			switch {
+			case v.Type == "bool" || v.Type == "number":
+				report(attr.Expr.Range(), Error, RuleEmptyValue, "%s must be a %s, not an empty string", name, v.Type)
+				continue
+			case v.Type == "string" && v.Default != cty.NilVal && v.Default.Type() == cty.String &&
+				!v.Default.IsNull() && v.Default.AsString() != "":
+				report(attr.Expr.Range(), Error, RuleEmptyValue, "%s is an empty string, which overrides the default %q", name, v.Default.AsString())
+				continue
+			}
+		}
+		if placeholders {
+			continue
+		}
+		for _, p := range v.check(val) {
+			report(attr.Expr.Range(), Error, p.rule, "%s", p.message)
+		}
+	}
+
+	var required []string
+	for name, v := range vars {
+		if _, ok := body.Attributes[name]; v.Required && !ok {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	for _, name := range required {
+		report(hcl.Range{Start: hcl.InitialPos}, Error, RuleMissingVariable, "required variable %q is not set", name)
+	}
+	return diags
+}
+
+func hclDiagnostic(file string, d *hcl.Diagnostic) Diagnostic {
+	diag := Diagnostic{File: file, Line: 1, Column: 1, Severity: Error, Rule: RuleSyntax, Message: d.Summary}
+	if d.Detail != "" {
+		diag.Message += ": " + d.Detail
+	}
+	if d.Subject != nil {
+		diag.Line, diag.Column = d.Subject.Start.Line, d.Subject.Start.Column
+	}
+	return diag
+}
@@ -0,0 +1,230 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/tryfunc"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// problem is a value that does not match its variable.
+type problem struct {
+	rule    string
+	message string
+}
+
+// check returns the problems of val as the value of v: a value Terraform
+// cannot convert to the type constraint, or a validation condition that is
+// false. Conditions that use other variables or functions unknown to
+// functions cannot be evaluated statically and are skipped.
+func (v Variable) check(val cty.Value) []problem {
+	if v.Constraint == cty.NilType {
+		return nil
+	}
+	converted, err := convert.Convert(val, v.Constraint)
+	if err != nil {
+		return []problem{{RuleTypeMismatch, fmt.Sprintf("%s: %s", v.Name, err.Error())}}
+	}
+	if v.typeDefaults != nil {
+		converted = v.typeDefaults.Apply(converted)
+	}
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(map[string]cty.Value{v.Name: converted})},
+		Functions: functions,
+	}
+	var problems []problem
+	for _, val := range v.validations {
+		ok, diags := val.condition.Value(ctx)
+		if diags.HasErrors() || !ok.IsWhollyKnown() || ok.IsNull() {
+			continue
+		}
+		if ok, err := convert.Convert(ok, cty.Bool); err != nil || ok.True() {
+			continue
+		}
+		message := "the validation condition is false"
+		if val.errorMessage != nil {
+			if msg, diags := val.errorMessage.Value(ctx); !diags.HasErrors() && msg.Type() == cty.String && msg.IsWhollyKnown() && !msg.IsNull() {
+				message = strings.TrimSpace(msg.AsString())
+			}
+		}
+		problems = append(problems, problem{RuleValidation, fmt.Sprintf("%s: %s", v.Name, message)})
+	}
+	return problems
+}
+
+// functions are the Terraform functions validation conditions may call.
+var functions = map[string]function.Function{
+	"abs":        stdlib.AbsoluteFunc,
+	"alltrue":    allTrueFunc,
+	"anytrue":    anyTrueFunc,
+	"can":        tryfunc.CanFunc,
+	"coalesce":   stdlib.CoalesceFunc,
+	"concat":     stdlib.ConcatFunc,
+	"contains":   stdlib.ContainsFunc,
+	"distinct":   stdlib.DistinctFunc,
+	"endswith":   endsWithFunc,
+	"flatten":    stdlib.FlattenFunc,
+	"format":     stdlib.FormatFunc,
+	"join":       stdlib.JoinFunc,
+	"keys":       stdlib.KeysFunc,
+	"length":     stdlib.LengthFunc,
+	"lookup":     stdlib.LookupFunc,
+	"lower":      stdlib.LowerFunc,
+	"max":        stdlib.MaxFunc,
+	"merge":      stdlib.MergeFunc,
+	"min":        stdlib.MinFunc,
+	"regex":      stdlib.RegexFunc,
+	"split":      stdlib.SplitFunc,
+	"startswith": startsWithFunc,
+	"tobool":     stdlib.MakeToFunc(cty.Bool),
+	"tolist":     stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+	"tomap":      stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+	"tonumber":   stdlib.MakeToFunc(cty.Number),
+	"toset":      stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+	"tostring":   stdlib.MakeToFunc(cty.String),
+	"trimspace":  stdlib.TrimSpaceFunc,
+	"try":        tryfunc.TryFunc,
+	"upper":      stdlib.UpperFunc,
+	"values":     stdlib.ValuesFunc,
+}
+
+// boolsFunc returns a function of a list of bools that is want when one of
+// them is want, and !want otherwise, as alltrue and anytrue.
+func boolsFunc(want bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "list", Type: cty.List(cty.Bool)}},
+		Type:   function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			list := args[0]
+			if !list.IsWhollyKnown() {
+				return cty.UnknownVal(cty.Bool), nil
+			}
+			for it := list.ElementIterator(); it.Next(); {
+				_, v := it.Element()
+				// alltrue is false, and anytrue ignores, null elements.
+				if v.IsNull() {
+					if want {
+						continue
+					}
+					return cty.False, nil
+				}
+				if v.True() == want {
+					return cty.BoolVal(want), nil
+				}
+			}
+			return cty.BoolVal(!want), nil
+		},
+	})
+}
+
+var (
+	allTrueFunc = boolsFunc(false)
+	anyTrueFunc = boolsFunc(true)
+)
+
+// affixFunc returns startswith or endswith.
+func affixFunc(has func(s, affix string) bool) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "str", Type: cty.String}, {Name: "affix", Type: cty.String}},
+		Type:   function.StaticReturnType(cty.Bool),
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			return cty.BoolVal(has(args[0].AsString(), args[1].AsString())), nil
+		},
+	})
+}
+
+var (
+	startsWithFunc = affixFunc(strings.HasPrefix)
+	endsWithFunc   = affixFunc(strings.HasSuffix)
+)
+
+// CheckVars fails the test for each problem CheckVarsE reports.
+func CheckVars(t testing.TB, dir string, vars map[string]any) {
+	t.Helper()
+	if err := CheckVarsE(dir, vars); err != nil {
+		t.Error(err)
+	}
+}
+
+// CheckVarsE checks the Vars of terraform.Options, as a test builds them,
+// against the variables of the Terraform directory dir. It reports
+// variables dir does not declare, which terraform plan rejects when given
+// with -var, required variables vars does not set, values Terraform cannot
+// convert to the type of their variable and values that fail a validation
+// block that can be evaluated statically.
+func CheckVarsE(dir string, vars map[string]any) error {
+	declared, err := ReadVariables(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for name := range vars {
+		names = append(names, name)
+	}
+	for name, v := range declared {
+		if _, ok := vars[name]; v.Required && !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		v, ok := declared[name]
+		value, set := vars[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s: variable %q is not declared [%s]", dir, name, RuleUnknownVariable))
+			continue
+		case !set:
+			errs = append(errs, fmt.Errorf("%s: required variable %q is not set [%s]", dir, name, RuleMissingVariable))
+			continue
+		}
+		val, err := goValue(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %w", dir, name, err))
+			continue
+		}
+		for _, p := range v.check(val) {
+			errs = append(errs, fmt.Errorf("%s: %s [%s]", dir, p.message, p.rule))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// goValue converts a Go value of terraform.Options.Vars to the value
+// Terraform receives.
+func goValue(v any) (cty.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	ty, err := ctyjson.ImpliedType(data)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	return ctyjson.Unmarshal(data, ty)
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const typedVariablesTF = `variable "project_id" {
+  type = string
+}
+
+variable "create_nat" {
+  type    = bool
+  default = true
+}
+
+variable "subnets" {
+  type = list(object({
+    name   = string
+    region = optional(string, "us-central1")
+  }))
+  default = []
+  validation {
+    condition     = alltrue([for s in var.subnets : startswith(s.region, "us-")])
+    error_message = "Subnets must be in a us- region."
+  }
+}
+
+variable "activation_policy" {
+  type    = string
+  default = "ALWAYS"
+  validation {
+    condition     = contains(["ALWAYS", "NEVER", "ON_DEMAND"], var.activation_policy)
+    error_message = "activation_policy must be ALWAYS, NEVER or ON_DEMAND."
+  }
+}
+
+variable "prefix" {
+  type    = string
+  default = "test"
+  validation {
+    condition     = var.prefix != var.project_id
+    error_message = "prefix must differ from project_id."
+  }
+}
+`
+
+// writeVariables writes typedVariablesTF to a temporary Terraform directory
+// and returns it.
+func writeVariables(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "variables.tf"), []byte(typedVariablesTF), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+/*
+TestLintTFVarsTypes verifies that values that do not convert to the type of
+their variable and values that fail a validation block are reported, and
+that validations using other variables are skipped.
+*/
+func TestLintTFVarsTypes(t *testing.T) {
+	vars, err := ReadVariables(writeVariables(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := `project_id = "p"
+create_nat = "yes"
+subnets = [
+  { name = "a" },
+  { name = "b", region = "europe-west1" },
+  { region = "us-east1" },
+]
+activation_policy = "SOMETIMES"
+prefix            = "p"
+`
+	got := lintTFVars("networking.tfvars", []byte(src), vars)
+	Sort(got)
+	want := []Diagnostic{
+		{File: "networking.tfvars", Line: 2, Column: 14, Severity: Error, Rule: RuleTypeMismatch, Message: "create_nat: a bool is required"},
+		{File: "networking.tfvars", Line: 3, Column: 11, Severity: Error, Rule: RuleTypeMismatch, Message: `subnets: element 2: attribute "name" is required`},
+		{File: "networking.tfvars", Line: 8, Column: 21, Severity: Error, Rule: RuleValidation, Message: "activation_policy: activation_policy must be ALWAYS, NEVER or ON_DEMAND."},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("lintTFVars() mismatch (-want +got):\n%s", diff)
+	}
+
+	got = lintTFVars("networking.tfvars", []byte("project_id = \"p\"\nsubnets = [{ name = \"b\", region = \"europe-west1\" }]\n"), vars)
+	want = []Diagnostic{
+		{File: "networking.tfvars", Line: 2, Column: 11, Severity: Error, Rule: RuleValidation, Message: "subnets: Subnets must be in a us- region."},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("lintTFVars() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestCheckVars verifies that the Vars map of a test is checked for
+undeclared and missing required variables, types and validations.
+*/
+func TestCheckVars(t *testing.T) {
+	dir := writeVariables(t)
+	if err := CheckVarsE(dir, map[string]any{
+		"project_id": "p",
+		"create_nat": "true",
+		"subnets":    []map[string]any{{"name": "a", "region": "us-east1"}},
+	}); err != nil {
+		t.Errorf("CheckVarsE() = %v, want nil", err)
+	}
+	err := CheckVarsE(dir, map[string]any{
+		"create_nat":        map[string]any{"enabled": true},
+		"activation_policy": "SOMETIMES",
+		"crate_havpn":       true,
+	})
+	if err == nil {
+		t.Fatal("CheckVarsE() = nil, want errors")
+	}
+	var got []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		got = append(got, strings.TrimPrefix(line, dir+": "))
+	}
+	want := []string{
+		"activation_policy: activation_policy must be ALWAYS, NEVER or ON_DEMAND. [validation]",
+		`variable "crate_havpn" is not declared [unknown-variable]`,
+		"create_nat: bool required, but have object [type-mismatch]",
+		`required variable "project_id" is not set [missing-variable]`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CheckVarsE() mismatch (-want +got):\n%s", diff)
+	}
+}
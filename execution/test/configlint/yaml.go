@@ -0,0 +1,199 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configlint
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LintYAMLFile reads the YAML file at path and lints it with LintYAML.
+func LintYAMLFile(path string, schema any) ([]Diagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LintYAML(path, data, schema), nil
+}
+
+// LintYAML checks one YAML configuration file against schema, a
+// configschema struct. It reports missing required keys, required keys
+// left empty, unknown keys and unreplaced placeholders.
+func LintYAML(file string, data []byte, schema any) []Diagnostic {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []Diagnostic{yamlSyntaxError(file, err)}
+	}
+	if len(doc.Content) == 0 {
+		return []Diagnostic{{
+			File: file, Line: 1, Column: 1, Severity: Error, Rule: RuleSyntax,
+			Message: "file is empty",
+		}}
+	}
+	l := &yamlLinter{file: file}
+	l.check(doc.Content[0], reflect.TypeOf(schema), "")
+	return l.diags
+}
+
+// yamlLineError matches the parse errors of yaml.v3, which carry the line
+// in their message.
+var yamlLineError = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// yamlSyntaxError turns a yaml.v3 parse error into a diagnostic.
+func yamlSyntaxError(file string, err error) Diagnostic {
+	d := Diagnostic{File: file, Line: 1, Column: 1, Severity: Error, Rule: RuleSyntax, Message: err.Error()}
+	if m := yamlLineError.FindStringSubmatch(err.Error()); m != nil {
+		d.Line, _ = strconv.Atoi(m[1])
+		d.Message = m[2]
+	}
+	return d
+}
+
+type yamlLinter struct {
+	file  string
+	diags []Diagnostic
+}
+
+func (l *yamlLinter) report(node *yaml.Node, severity Severity, rule, format string, args ...any) {
+	l.diags = append(l.diags, Diagnostic{
+		File:     l.file,
+		Line:     node.Line,
+		Column:   node.Column,
+		Severity: severity,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// check walks node along typ, the Go type decoded from it. typ is nil for
+// values whose structure the schema leaves open, such as the node pools of
+// GKE, which are only checked for placeholders.
+func (l *yamlLinter) check(node *yaml.Node, typ reflect.Type, path string) {
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.Tag == "!!str" {
+			for _, p := range placeholder.FindAllString(node.Value, -1) {
+				l.report(node, Error, RulePlaceholder, "%s still contains the placeholder %s", describe(path), p)
+			}
+		}
+	case yaml.SequenceNode:
+		var elem reflect.Type
+		if typ != nil && typ.Kind() == reflect.Slice {
+			elem = typ.Elem()
+		}
+		for i, item := range node.Content {
+			l.check(item, elem, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case yaml.MappingNode:
+		switch {
+		case typ != nil && typ.Kind() == reflect.Struct:
+			l.checkStruct(node, typ, path)
+		case typ != nil && typ.Kind() == reflect.Map:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				l.check(node.Content[i+1], typ.Elem(), join(path, node.Content[i].Value))
+			}
+		default:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				l.check(node.Content[i+1], nil, join(path, node.Content[i].Value))
+			}
+		}
+	}
+}
+
+// checkStruct checks the keys of a mapping decoded into the struct typ.
+func (l *yamlLinter) checkStruct(node *yaml.Node, typ reflect.Type, path string) {
+	fields := yamlFields(typ)
+	byName := map[string]yamlField{}
+	for _, f := range fields {
+		byName[f.name] = f
+	}
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		seen[key.Value] = true
+		field, ok := byName[key.Value]
+		if !ok {
+			l.report(key, Warning, RuleUnknownKey, "unknown key %s, which the stage ignores", describe(join(path, key.Value)))
+			continue
+		}
+		if field.required && isEmpty(value) {
+			l.report(value, Error, RuleEmptyValue, "required key %s is empty", describe(join(path, key.Value)))
+			continue
+		}
+		l.check(value, field.typ, join(path, key.Value))
+	}
+	for _, f := range fields {
+		if f.required && !seen[f.name] {
+			l.report(node, Error, RuleRequiredKey, "missing required key %s", describe(join(path, f.name)))
+		}
+	}
+}
+
+// yamlField is a struct field of a configschema type.
+type yamlField struct {
+	name     string
+	typ      reflect.Type
+	required bool
+}
+
+// yamlFields returns the YAML keys of the struct typ in declaration order.
+// Fields without omitempty are required, as documented in configschema.
+func yamlFields(typ reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("yaml")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields = append(fields, yamlField{name: name, typ: f.Type, required: !strings.Contains(opts, "omitempty")})
+	}
+	return fields
+}
+
+// isEmpty reports whether node is null or an empty string.
+func isEmpty(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && (node.Tag == "!!null" || (node.Tag == "!!str" && node.Value == ""))
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func describe(path string) string {
+	if path == "" {
+		return "the document"
+	}
+	return fmt.Sprintf("%q", path)
+}
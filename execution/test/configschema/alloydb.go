@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+// AlloyDB is a single AlloyDB cluster read by 04-producer/AlloyDB/locals.tf.
+type AlloyDB struct {
+	// Required keys.
+	ClusterID          string                 `yaml:"cluster_id"`
+	ClusterDisplayName string                 `yaml:"cluster_display_name"`
+	ProjectID          string                 `yaml:"project_id"`
+	Region             string                 `yaml:"region"`
+	NetworkID          string                 `yaml:"network_id"`
+	PrimaryInstance    AlloyDBPrimaryInstance `yaml:"primary_instance"`
+
+	// Optional keys, defaulted from variables.tf when unset.
+	DatabaseVersion          string                        `yaml:"database_version,omitempty"`
+	AllocatedIPRange         *string                       `yaml:"allocated_ip_range,omitempty"`
+	ClusterLabels            map[string]string             `yaml:"cluster_labels,omitempty"`
+	ClusterInitialUser       *AlloyDBInitialUser           `yaml:"cluster_initial_user,omitempty"`
+	ReadPoolInstance         []AlloyDBReadPoolInstance     `yaml:"read_pool_instance,omitempty"`
+	AutomatedBackupPolicy    *AlloyDBAutomatedBackupPolicy `yaml:"automated_backup_policy,omitempty"`
+	ClusterEncryptionKeyName *string                       `yaml:"cluster_encryption_key_name,omitempty"`
+
+	// DeletionProtection is set by the unit test fixtures but never read by
+	// locals.tf.
+	DeletionProtection *bool `yaml:"deletion_protection,omitempty"`
+}
+
+// AlloyDBPrimaryInstance is passed as-is to the alloy-db module's primary_instance.
+type AlloyDBPrimaryInstance struct {
+	InstanceID          string                      `yaml:"instance_id"`
+	DisplayName         string                      `yaml:"display_name,omitempty"`
+	InstanceType        string                      `yaml:"instance_type,omitempty"`
+	DatabaseFlags       map[string]string           `yaml:"database_flags,omitempty"`
+	Labels              map[string]string           `yaml:"labels,omitempty"`
+	Annotations         map[string]string           `yaml:"annotations,omitempty"`
+	GCEZone             string                      `yaml:"gce_zone,omitempty"`
+	AvailabilityType    string                      `yaml:"availability_type,omitempty"`
+	MachineCPUCount     *int                        `yaml:"machine_cpu_count,omitempty"`
+	SSLMode             string                      `yaml:"ssl_mode,omitempty"`
+	RequireConnectors   *bool                       `yaml:"require_connectors,omitempty"`
+	QueryInsightsConfig *AlloyDBQueryInsightsConfig `yaml:"query_insights_config,omitempty"`
+}
+
+// AlloyDBReadPoolInstance is one entry of var.read_pool_instance.
+type AlloyDBReadPoolInstance struct {
+	InstanceID          string                      `yaml:"instance_id"`
+	DisplayName         string                      `yaml:"display_name"`
+	NodeCount           *int                        `yaml:"node_count,omitempty"`
+	DatabaseFlags       map[string]string           `yaml:"database_flags,omitempty"`
+	AvailabilityType    string                      `yaml:"availability_type,omitempty"`
+	GCEZone             string                      `yaml:"gce_zone,omitempty"`
+	MachineCPUCount     *int                        `yaml:"machine_cpu_count,omitempty"`
+	SSLMode             string                      `yaml:"ssl_mode,omitempty"`
+	RequireConnectors   *bool                       `yaml:"require_connectors,omitempty"`
+	QueryInsightsConfig *AlloyDBQueryInsightsConfig `yaml:"query_insights_config,omitempty"`
+}
+
+// AlloyDBQueryInsightsConfig configures Query Insights for an instance.
+type AlloyDBQueryInsightsConfig struct {
+	QueryStringLength     *int  `yaml:"query_string_length,omitempty"`
+	RecordApplicationTags *bool `yaml:"record_application_tags,omitempty"`
+	RecordClientAddress   *bool `yaml:"record_client_address,omitempty"`
+	QueryPlansPerMinute   *int  `yaml:"query_plans_per_minute,omitempty"`
+}
+
+// AlloyDBInitialUser mirrors var.cluster_initial_user.
+type AlloyDBInitialUser struct {
+	User     string `yaml:"user,omitempty"`
+	Password string `yaml:"password"`
+}
+
+// AlloyDBAutomatedBackupPolicy mirrors var.automated_backup_policy.
+type AlloyDBAutomatedBackupPolicy struct {
+	Location                    string                 `yaml:"location,omitempty"`
+	BackupWindow                string                 `yaml:"backup_window,omitempty"`
+	Enabled                     *bool                  `yaml:"enabled,omitempty"`
+	WeeklySchedule              *AlloyDBWeeklySchedule `yaml:"weekly_schedule,omitempty"`
+	QuantityBasedRetentionCount *int                   `yaml:"quantity_based_retention_count,omitempty"`
+	TimeBasedRetentionCount     string                 `yaml:"time_based_retention_count,omitempty"`
+	Labels                      map[string]string      `yaml:"labels,omitempty"`
+	BackupEncryptionKeyName     string                 `yaml:"backup_encryption_key_name,omitempty"`
+}
+
+// AlloyDBWeeklySchedule selects the days and times automated backups run.
+type AlloyDBWeeklySchedule struct {
+	DaysOfWeek []string `yaml:"days_of_week,omitempty"`
+	StartTimes []string `yaml:"start_times"`
+}
@@ -0,0 +1,183 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+// CloudRun is a single Cloud Run job or service. 06-consumer/CloudRun/Job and
+// 06-consumer/CloudRun/Service read the same keys and only differ in the
+// default of create_job.
+type CloudRun struct {
+	// Required keys.
+	ProjectID string `yaml:"project_id"`
+	Name      string `yaml:"name"`
+	Region    string `yaml:"region"`
+
+	// Optional keys, defaulted from variables.tf when unset.
+	Containers           map[string]CloudRunContainer `yaml:"containers,omitempty"`
+	CreateJob            *bool                        `yaml:"create_job,omitempty"`
+	CustomAudiences      []string                     `yaml:"custom_audiences,omitempty"`
+	EncryptionKey        *string                      `yaml:"encryption_key,omitempty"`
+	EventarcTriggers     *CloudRunEventarcTriggers    `yaml:"eventarc_triggers,omitempty"`
+	IAM                  map[string][]string          `yaml:"iam,omitempty"`
+	Ingress              *string                      `yaml:"ingress,omitempty"`
+	Labels               map[string]string            `yaml:"labels,omitempty"`
+	LaunchStage          *string                      `yaml:"launch_stage,omitempty"`
+	Prefix               *string                      `yaml:"prefix,omitempty"`
+	Revision             *CloudRunRevision            `yaml:"revision,omitempty"`
+	ServiceAccount       *string                      `yaml:"service_account,omitempty"`
+	ServiceAccountCreate *bool                        `yaml:"service_account_create,omitempty"`
+	TagBindings          map[string]string            `yaml:"tag_bindings,omitempty"`
+	Volumes              map[string]CloudRunVolume    `yaml:"volumes,omitempty"`
+	VPCConnectorCreate   *CloudRunVPCConnector        `yaml:"vpc_connector_create,omitempty"`
+}
+
+// CloudRunContainer is a container keyed by name in CloudRun.Containers.
+type CloudRunContainer struct {
+	Image         string                          `yaml:"image"`
+	Command       []string                        `yaml:"command,omitempty"`
+	Args          []string                        `yaml:"args,omitempty"`
+	Env           map[string]string               `yaml:"env,omitempty"`
+	EnvFromKey    map[string]CloudRunSecretKeyRef `yaml:"env_from_key,omitempty"`
+	LivenessProbe *CloudRunProbe                  `yaml:"liveness_probe,omitempty"`
+	Ports         map[string]CloudRunPort         `yaml:"ports,omitempty"`
+	Resources     *CloudRunResources              `yaml:"resources,omitempty"`
+	StartupProbe  *CloudRunProbe                  `yaml:"startup_probe,omitempty"`
+	VolumeMounts  map[string]string               `yaml:"volume_mounts,omitempty"`
+}
+
+// CloudRunSecretKeyRef sources an environment variable from Secret Manager.
+type CloudRunSecretKeyRef struct {
+	Secret  string `yaml:"secret"`
+	Version string `yaml:"version"`
+}
+
+// CloudRunProbe is a liveness or startup probe. TCPSocket is only accepted
+// for startup probes.
+type CloudRunProbe struct {
+	GRPC                *CloudRunGRPCAction    `yaml:"grpc,omitempty"`
+	HTTPGet             *CloudRunHTTPGetAction `yaml:"http_get,omitempty"`
+	TCPSocket           *CloudRunTCPAction     `yaml:"tcp_socket,omitempty"`
+	FailureThreshold    *int                   `yaml:"failure_threshold,omitempty"`
+	InitialDelaySeconds *int                   `yaml:"initial_delay_seconds,omitempty"`
+	PeriodSeconds       *int                   `yaml:"period_seconds,omitempty"`
+	TimeoutSeconds      *int                   `yaml:"timeout_seconds,omitempty"`
+}
+
+// CloudRunGRPCAction probes a gRPC health endpoint.
+type CloudRunGRPCAction struct {
+	Port    *int    `yaml:"port,omitempty"`
+	Service *string `yaml:"service,omitempty"`
+}
+
+// CloudRunHTTPGetAction probes an HTTP path.
+type CloudRunHTTPGetAction struct {
+	HTTPHeaders map[string]string `yaml:"http_headers,omitempty"`
+	Path        *string           `yaml:"path,omitempty"`
+}
+
+// CloudRunTCPAction probes a TCP port.
+type CloudRunTCPAction struct {
+	Port *int `yaml:"port,omitempty"`
+}
+
+// CloudRunPort is a port keyed by name in CloudRunContainer.Ports.
+type CloudRunPort struct {
+	ContainerPort *int    `yaml:"container_port,omitempty"`
+	Name          *string `yaml:"name,omitempty"`
+}
+
+// CloudRunResources sets container limits and CPU allocation.
+type CloudRunResources struct {
+	Limits          *CloudRunLimits `yaml:"limits,omitempty"`
+	CPUIdle         *bool           `yaml:"cpu_idle,omitempty"`
+	StartupCPUBoost *bool           `yaml:"startup_cpu_boost,omitempty"`
+}
+
+// CloudRunLimits caps container CPU and memory.
+type CloudRunLimits struct {
+	CPU    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+}
+
+// CloudRunEventarcTriggers mirrors var.eventarc_triggers.
+type CloudRunEventarcTriggers struct {
+	AuditLog             map[string]CloudRunAuditLogTrigger `yaml:"audit_log,omitempty"`
+	PubSub               map[string]string                  `yaml:"pubsub,omitempty"`
+	ServiceAccountEmail  *string                            `yaml:"service_account_email,omitempty"`
+	ServiceAccountCreate *bool                              `yaml:"service_account_create,omitempty"`
+}
+
+// CloudRunAuditLogTrigger fires on a Cloud Audit Log method of a service.
+type CloudRunAuditLogTrigger struct {
+	Method  string `yaml:"method"`
+	Service string `yaml:"service"`
+}
+
+// CloudRunRevision mirrors var.revision.
+type CloudRunRevision struct {
+	Name                     *string            `yaml:"name,omitempty"`
+	Gen2ExecutionEnvironment *bool              `yaml:"gen2_execution_environment,omitempty"`
+	MaxConcurrency           *int               `yaml:"max_concurrency,omitempty"`
+	MaxInstanceCount         *int               `yaml:"max_instance_count,omitempty"`
+	MinInstanceCount         *int               `yaml:"min_instance_count,omitempty"`
+	VPCAccess                *CloudRunVPCAccess `yaml:"vpc_access,omitempty"`
+	Timeout                  *string            `yaml:"timeout,omitempty"`
+}
+
+// CloudRunVPCAccess routes revision egress through a connector or subnet.
+type CloudRunVPCAccess struct {
+	Connector *string  `yaml:"connector,omitempty"`
+	Egress    *string  `yaml:"egress,omitempty"`
+	Subnet    *string  `yaml:"subnet,omitempty"`
+	Tags      []string `yaml:"tags,omitempty"`
+}
+
+// CloudRunVolume is a volume keyed by name in CloudRun.Volumes.
+type CloudRunVolume struct {
+	Secret            *CloudRunSecretVolume `yaml:"secret,omitempty"`
+	CloudSQLInstances []string              `yaml:"cloud_sql_instances,omitempty"`
+	EmptyDirSize      *string               `yaml:"empty_dir_size,omitempty"`
+}
+
+// CloudRunSecretVolume mounts a Secret Manager secret as a file.
+type CloudRunSecretVolume struct {
+	Name        string  `yaml:"name"`
+	DefaultMode *string `yaml:"default_mode,omitempty"`
+	Path        *string `yaml:"path,omitempty"`
+	Version     *string `yaml:"version,omitempty"`
+	Mode        *string `yaml:"mode,omitempty"`
+}
+
+// CloudRunVPCConnector mirrors var.vpc_connector_create.
+type CloudRunVPCConnector struct {
+	IPCIDRRange *string                     `yaml:"ip_cidr_range,omitempty"`
+	MachineType *string                     `yaml:"machine_type,omitempty"`
+	Name        *string                     `yaml:"name,omitempty"`
+	Network     *string                     `yaml:"network,omitempty"`
+	Instances   *CloudRunScalingBounds      `yaml:"instances,omitempty"`
+	Throughput  *CloudRunScalingBounds      `yaml:"throughput,omitempty"`
+	Subnet      *CloudRunVPCConnectorSubnet `yaml:"subnet,omitempty"`
+}
+
+// CloudRunScalingBounds is a min/max pair for connector scaling.
+type CloudRunScalingBounds struct {
+	Max *int `yaml:"max,omitempty"`
+	Min *int `yaml:"min,omitempty"`
+}
+
+// CloudRunVPCConnectorSubnet places the connector in an existing subnet.
+type CloudRunVPCConnectorSubnet struct {
+	Name      *string `yaml:"name,omitempty"`
+	ProjectID *string `yaml:"project_id,omitempty"`
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+// CloudSQL is a single Cloud SQL instance read by 04-producer/CloudSQL/locals.tf.
+type CloudSQL struct {
+	// Required keys.
+	Name          string                `yaml:"name"`
+	ProjectID     string                `yaml:"project_id"`
+	Region        string                `yaml:"region"`
+	NetworkConfig CloudSQLNetworkConfig `yaml:"network_config"`
+
+	// Optional keys, defaulted from variables.tf when unset.
+	DatabaseVersion             string                       `yaml:"database_version,omitempty"`
+	Tier                        string                       `yaml:"tier,omitempty"`
+	AvailabilityType            string                       `yaml:"availability_type,omitempty"`
+	ActivationPolicy            string                       `yaml:"activation_policy,omitempty"`
+	BackupConfiguration         *CloudSQLBackupConfiguration `yaml:"backup_configuration,omitempty"`
+	Collation                   *string                      `yaml:"collation,omitempty"`
+	ConnectorEnforcement        *string                      `yaml:"connector_enforcement,omitempty"`
+	DataCache                   *bool                        `yaml:"data_cache,omitempty"`
+	Databases                   []string                     `yaml:"databases,omitempty"`
+	DiskAutoresizeLimit         *int                         `yaml:"disk_autoresize_limit,omitempty"`
+	DiskSize                    *int                         `yaml:"disk_size,omitempty"`
+	DiskType                    string                       `yaml:"disk_type,omitempty"`
+	Edition                     string                       `yaml:"edition,omitempty"`
+	Flags                       map[string]string            `yaml:"flags,omitempty"`
+	GCPDeletionProtection       *bool                        `yaml:"gcp_deletion_protection,omitempty"`
+	InsightsConfig              *CloudSQLInsightsConfig      `yaml:"insights_config,omitempty"`
+	Labels                      map[string]string            `yaml:"labels,omitempty"`
+	MaintenanceConfig           *CloudSQLMaintenanceConfig   `yaml:"maintenance_config,omitempty"`
+	Prefix                      *string                      `yaml:"prefix,omitempty"`
+	Replicas                    map[string]CloudSQLReplica   `yaml:"replicas,omitempty"`
+	RootPassword                *string                      `yaml:"root_password,omitempty"`
+	SSL                         *CloudSQLSSL                 `yaml:"ssl,omitempty"`
+	TerraformDeletionProtection *bool                        `yaml:"terraform_deletion_protection,omitempty"`
+	Users                       map[string]CloudSQLUser      `yaml:"users,omitempty"`
+
+	// EncryptionKeyName and TimeZone are read from the "encryption" and
+	// "timezone" keys, which differ from their variables.tf names.
+	EncryptionKeyName *string `yaml:"encryption,omitempty"`
+	TimeZone          *string `yaml:"timezone,omitempty"`
+}
+
+// CloudSQLNetworkConfig is the network_config object passed to the fabric
+// cloudsql-instance module.
+type CloudSQLNetworkConfig struct {
+	AuthorizedNetworks map[string]string    `yaml:"authorized_networks,omitempty"`
+	Connectivity       CloudSQLConnectivity `yaml:"connectivity"`
+}
+
+// CloudSQLConnectivity selects public IP, PSA and PSC connectivity.
+type CloudSQLConnectivity struct {
+	PublicIPv4                   *bool              `yaml:"public_ipv4,omitempty"`
+	PSAConfig                    *CloudSQLPSAConfig `yaml:"psa_config,omitempty"`
+	PSCAllowedConsumerProjects   []string           `yaml:"psc_allowed_consumer_projects,omitempty"`
+	EnablePrivatePathForServices *bool              `yaml:"enable_private_path_for_services,omitempty"`
+}
+
+// CloudSQLPSAConfig attaches the instance to a VPC through private services access.
+type CloudSQLPSAConfig struct {
+	PrivateNetwork    string                     `yaml:"private_network"`
+	AllocatedIPRanges *CloudSQLAllocatedIPRanges `yaml:"allocated_ip_ranges,omitempty"`
+}
+
+// CloudSQLAllocatedIPRanges names the PSA ranges used by the primary and replicas.
+type CloudSQLAllocatedIPRanges struct {
+	Primary string `yaml:"primary,omitempty"`
+	Replica string `yaml:"replica,omitempty"`
+}
+
+// CloudSQLBackupConfiguration mirrors var.backup_configuration.
+type CloudSQLBackupConfiguration struct {
+	Enabled                    *bool   `yaml:"enabled,omitempty"`
+	BinaryLogEnabled           *bool   `yaml:"binary_log_enabled,omitempty"`
+	StartTime                  string  `yaml:"start_time,omitempty"`
+	Location                   *string `yaml:"location,omitempty"`
+	LogRetentionDays           *int    `yaml:"log_retention_days,omitempty"`
+	PointInTimeRecoveryEnabled *bool   `yaml:"point_in_time_recovery_enabled,omitempty"`
+	RetentionCount             *int    `yaml:"retention_count,omitempty"`
+}
+
+// CloudSQLInsightsConfig mirrors var.insights_config.
+type CloudSQLInsightsConfig struct {
+	QueryStringLength     *int  `yaml:"query_string_length,omitempty"`
+	RecordApplicationTags *bool `yaml:"record_application_tags,omitempty"`
+	RecordClientAddress   *bool `yaml:"record_client_address,omitempty"`
+	QueryPlansPerMinute   *int  `yaml:"query_plans_per_minute,omitempty"`
+}
+
+// CloudSQLMaintenanceConfig mirrors var.maintenance_config.
+type CloudSQLMaintenanceConfig struct {
+	MaintenanceWindow     *CloudSQLMaintenanceWindow     `yaml:"maintenance_window,omitempty"`
+	DenyMaintenancePeriod *CloudSQLDenyMaintenancePeriod `yaml:"deny_maintenance_period,omitempty"`
+}
+
+// CloudSQLMaintenanceWindow sets the weekly maintenance day (1-7) and hour (0-23).
+type CloudSQLMaintenanceWindow struct {
+	Day         int    `yaml:"day"`
+	Hour        int    `yaml:"hour"`
+	UpdateTrack string `yaml:"update_track,omitempty"`
+}
+
+// CloudSQLDenyMaintenancePeriod blocks maintenance between two yyyy-mm-dd dates.
+type CloudSQLDenyMaintenancePeriod struct {
+	StartDate string `yaml:"start_date"`
+	EndDate   string `yaml:"end_date"`
+	StartTime string `yaml:"start_time,omitempty"`
+}
+
+// CloudSQLReplica is a read replica keyed by name in CloudSQL.Replicas.
+type CloudSQLReplica struct {
+	Region            string  `yaml:"region"`
+	EncryptionKeyName *string `yaml:"encryption_key_name,omitempty"`
+}
+
+// CloudSQLSSL mirrors var.ssl.
+type CloudSQLSSL struct {
+	ClientCertificates []string `yaml:"client_certificates,omitempty"`
+	RequireSSL         *bool    `yaml:"require_ssl,omitempty"`
+	SSLMode            string   `yaml:"ssl_mode,omitempty"`
+}
+
+// CloudSQLUser is a database user keyed by name in CloudSQL.Users.
+type CloudSQLUser struct {
+	Password *string `yaml:"password,omitempty"`
+	Type     string  `yaml:"type,omitempty"`
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package configschema holds typed Go representations of the YAML files read
+// by the locals.tf of every 04-producer and 06-consumer stage.
+//
+// Each struct field maps to exactly one key the stage reads, either directly
+// (instance.x) or through a try(instance.x, var.x) fallback. Required keys use
+// value types, while optional keys use pointers, slices or maps tagged with
+// omitempty so that an unset field is left out of the YAML and the Terraform
+// default from variables.tf applies.
+package configschema
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bool returns a pointer to v, for use with optional boolean fields.
+func Bool(v bool) *bool {
+	return &v
+}
+
+// Int returns a pointer to v, for use with optional number fields.
+func Int(v int) *int {
+	return &v
+}
+
+// String returns a pointer to v, for use with optional string fields.
+func String(v string) *string {
+	return &v
+}
+
+// Marshal encodes a config struct into the YAML document a stage expects.
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("marshalling %T: %w", v, err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("marshalling %T: %w", v, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteFile marshals v and writes it to path, replacing any existing file.
+func WriteFile(path string, v any) error {
+	data, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Unmarshal decodes a YAML document into v. When strict is true, keys that
+// have no matching field in v are reported as errors instead of being
+// silently dropped, which is how Terraform treats them.
+func Unmarshal(data []byte, v any, strict bool) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(strict)
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("unmarshalling into %T: %w", v, err)
+	}
+	return nil
+}
+
+// ReadFile reads and decodes the YAML file at path into v.
+func ReadFile(path string, v any, strict bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if err := Unmarshal(data, v, strict); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// schemaSources ties each config type to the locals.tf that reads it.
+var schemaSources = []struct {
+	name       string
+	value      any
+	localsPath string
+	// listLocal is the local holding the per-instance objects; only key
+	// references after it are considered.
+	listLocal string
+	// iterator is the for-expression variable bound to each YAML document.
+	iterator string
+	// unread are the struct keys that fixtures or examples set but
+	// locals.tf never reads.
+	unread []string
+}{
+	{"CloudSQL", CloudSQL{}, "../../04-producer/CloudSQL/locals.tf", "instance_list", "instance", nil},
+	{"AlloyDB", AlloyDB{}, "../../04-producer/AlloyDB/locals.tf", "instance_list", "instance", []string{"deletion_protection"}},
+	{"MRC", MRC{}, "../../04-producer/MRC/locals.tf", "instance_list", "instance", nil},
+	{"GKE", GKE{}, "../../04-producer/GKE/locals.tf", "cluster_list", "cluster", nil},
+	{"VectorSearch", VectorSearch{}, "../../04-producer/VectorSearch/locals.tf", "instance_list", "instance", []string{"dimension"}},
+	{"VertexEndpoint", VertexEndpoint{}, "../../04-producer/Vertex-AI-Online-Endpoints/locals.tf", "endpoint_list", "endpoint", nil},
+	{"GCE", GCE{}, "../../06-consumer/GCE/locals.tf", "instance_list", "instance", nil},
+	{"CloudRunJob", CloudRun{}, "../../06-consumer/CloudRun/Job/locals.tf", "instance_list", "instance", nil},
+	{"CloudRunService", CloudRun{}, "../../06-consumer/CloudRun/Service/locals.tf", "instance_list", "instance", nil},
+}
+
+/*
+TestSchemaMatchesLocals verifies that every top-level key read by a stage's
+locals.tf has a struct field and that no struct field names a key locals.tf
+never reads, other than the listed unread keys.
+*/
+func TestSchemaMatchesLocals(t *testing.T) {
+	for _, src := range schemaSources {
+		t.Run(src.name, func(t *testing.T) {
+			content, err := os.ReadFile(src.localsPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := string(content)
+			start := strings.Index(body, src.listLocal+" =")
+			if start < 0 {
+				t.Fatalf("local %q not found in %s", src.listLocal, src.localsPath)
+			}
+			keyRef := regexp.MustCompile(`\b` + src.iterator + `\.(\w+)`)
+			keys := map[string]bool{}
+			for _, m := range keyRef.FindAllStringSubmatch(body[start:], -1) {
+				keys[m[1]] = true
+			}
+			for _, key := range src.unread {
+				if keys[key] {
+					t.Errorf("unread key %q is read by %s", key, src.localsPath)
+				}
+				keys[key] = true
+			}
+			want := sortedKeys(keys)
+			got := yamlKeys(reflect.TypeOf(src.value))
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("YAML keys mismatch with %s (-locals.tf +struct):\n%s", src.localsPath, diff)
+			}
+		})
+	}
+}
+
+/*
+TestUnitFixturesDecode verifies that the unit test fixtures decode strictly
+into the typed configs, so that a misspelled or unknown key fails, and set
+every required key.
+*/
+func TestUnitFixturesDecode(t *testing.T) {
+	fixtures := []struct {
+		folder   string
+		newValue func() any
+		required func(v any) []string
+	}{
+		{"../unit/producer/CloudSQL/config", func() any { return &CloudSQL{} }, func(v any) []string {
+			c := v.(*CloudSQL)
+			return []string{c.Name, c.ProjectID, c.Region, c.NetworkConfig.Connectivity.PSAConfig.PrivateNetwork}
+		}},
+		{"../unit/producer/AlloyDB/config", func() any { return &AlloyDB{} }, func(v any) []string {
+			c := v.(*AlloyDB)
+			return []string{c.ClusterID, c.ClusterDisplayName, c.ProjectID, c.Region, c.NetworkID, c.PrimaryInstance.InstanceID}
+		}},
+		{"../unit/producer/MRC/config", func() any { return &MRC{} }, func(v any) []string {
+			c := v.(*MRC)
+			return []string{c.RedisClusterName, c.ProjectID, c.NetworkID}
+		}},
+		{"../unit/producer/GKE/config", func() any { return &GKE{} }, func(v any) []string {
+			c := v.(*GKE)
+			return []string{c.Name, c.ProjectID, c.Network, c.Subnetwork, c.IPRangePods, c.IPRangeServices}
+		}},
+		{"../unit/producer/VectorSearch/config", func() any { return &VectorSearch{} }, func(v any) []string {
+			c := v.(*VectorSearch)
+			return []string{c.ProjectID, c.IndexDisplayName, c.Region, c.IndexEndpointDisplayName, c.DeployedIndexID}
+		}},
+		{"../unit/producer/Vertex-AI-Online-Endpoints/config", func() any { return &VertexEndpoint{} }, func(v any) []string {
+			c := v.(*VertexEndpoint)
+			return []string{c.DisplayName, c.Project, c.Location, c.Network}
+		}},
+		{"../unit/consumer/GCE/config", func() any { return &GCE{} }, func(v any) []string {
+			c := v.(*GCE)
+			return []string{c.Name, c.ProjectID, c.Region, c.Zone, c.Image, c.Network, c.Subnetwork}
+		}},
+		{"../unit/consumer/CloudRun/Job/config", func() any { return &CloudRun{} }, func(v any) []string {
+			c := v.(*CloudRun)
+			return []string{c.Name, c.ProjectID, c.Region}
+		}},
+		{"../unit/consumer/CloudRun/Service/config", func() any { return &CloudRun{} }, func(v any) []string {
+			c := v.(*CloudRun)
+			return []string{c.Name, c.ProjectID, c.Region}
+		}},
+	}
+	for _, fixture := range fixtures {
+		files, err := filepath.Glob(filepath.Join(fixture.folder, "*.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Errorf("no YAML fixtures found in %s", fixture.folder)
+		}
+		for _, file := range files {
+			v := fixture.newValue()
+			if err := ReadFile(file, v, true); err != nil {
+				t.Errorf("ReadFile(%s) = %v", file, err)
+				continue
+			}
+			for _, value := range fixture.required(v) {
+				if value == "" {
+					t.Errorf("%s: required key decoded as empty string", file)
+				}
+			}
+		}
+	}
+}
+
+/*
+TestMarshalOmitsUnsetOptionalKeys verifies that unset optional keys are left
+out of the generated YAML so that Terraform falls back to its defaults, and
+that explicit zero values are kept.
+*/
+func TestMarshalOmitsUnsetOptionalKeys(t *testing.T) {
+	instance := CloudSQL{
+		Name:      "dummy",
+		ProjectID: "dummy-project-id",
+		Region:    "us-central1",
+		NetworkConfig: CloudSQLNetworkConfig{
+			Connectivity: CloudSQLConnectivity{
+				PSAConfig: &CloudSQLPSAConfig{
+					PrivateNetwork: "projects/dummy-project-id/global/networks/dummy-vpc",
+				},
+			},
+		},
+		GCPDeletionProtection: Bool(false),
+	}
+	got, err := Marshal(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `name: dummy
+project_id: dummy-project-id
+region: us-central1
+network_config:
+  connectivity:
+    psa_config:
+      private_network: projects/dummy-project-id/global/networks/dummy-vpc
+gcp_deletion_protection: false
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("Marshal() mismatch (-want +got):\n%s", diff)
+	}
+	var decoded CloudSQL
+	if err := Unmarshal(got, &decoded, true); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(instance, decoded); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestStrictUnmarshalRejectsUnknownKeys verifies that a misspelled key is
+reported in strict mode instead of being silently ignored.
+*/
+func TestStrictUnmarshalRejectsUnknownKeys(t *testing.T) {
+	data := []byte("redis_cluster_name: mrc\nproject_id: p\nnetwork_id: n\nshard_cuont: 3\n")
+	var lenient MRC
+	if err := Unmarshal(data, &lenient, false); err != nil {
+		t.Errorf("Unmarshal(strict=false) = %v, want nil", err)
+	}
+	var strict MRC
+	if err := Unmarshal(data, &strict, true); err == nil || !strings.Contains(err.Error(), "shard_cuont") {
+		t.Errorf("Unmarshal(strict=true) = %v, want error naming shard_cuont", err)
+	}
+}
+
+// yamlKeys returns the sorted top-level YAML keys of a struct type.
+func yamlKeys(typ reflect.Type) []string {
+	keys := map[string]bool{}
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("yaml"), ",")
+		keys[name] = true
+	}
+	return sortedKeys(keys)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+// GCE is a single Compute Engine instance read by 06-consumer/GCE/locals.tf.
+type GCE struct {
+	// Required keys. Image is read without a fallback for the boot disk
+	// initialize_params, so it is required even though var.image exists.
+	ProjectID  string `yaml:"project_id"`
+	Name       string `yaml:"name"`
+	Region     string `yaml:"region"`
+	Zone       string `yaml:"zone"`
+	Image      string `yaml:"image"`
+	Network    string `yaml:"network"`
+	Subnetwork string `yaml:"subnetwork"`
+
+	// Optional keys, defaulted from variables.tf when unset.
+	CanIPForward              *bool                          `yaml:"can_ip_forward,omitempty"`
+	Hostname                  *string                        `yaml:"hostname,omitempty"`
+	EnableDisplay             *bool                          `yaml:"enable_display,omitempty"`
+	Description               string                         `yaml:"description,omitempty"`
+	InstanceType              string                         `yaml:"instance_type,omitempty"`
+	MinCPUPlatform            *string                        `yaml:"min_cpu_platform,omitempty"`
+	Tags                      []string                       `yaml:"tags,omitempty"`
+	Labels                    map[string]string              `yaml:"labels,omitempty"`
+	Metadata                  map[string]string              `yaml:"metadata,omitempty"`
+	NetworkAttachedInterfaces []string                       `yaml:"network_attached_interfaces,omitempty"`
+	Options                   *GCEOptions                    `yaml:"options,omitempty"`
+	ScratchDisks              *GCEScratchDisks               `yaml:"scratch_disks,omitempty"`
+	ShieldedConfig            *GCEShieldedConfig             `yaml:"shielded_config,omitempty"`
+	SnapshotSchedules         map[string]GCESnapshotSchedule `yaml:"snapshot_schedules,omitempty"`
+	TagBindings               map[string]string              `yaml:"tag_bindings,omitempty"`
+	TagBindingsFirewall       map[string]string              `yaml:"tag_bindings_firewall,omitempty"`
+	ServiceAccount            *GCEServiceAccount             `yaml:"service_account,omitempty"`
+	BootDisk                  *GCEBootDisk                   `yaml:"boot_disk,omitempty"`
+	AttachedDisks             []GCEAttachedDisk              `yaml:"attached_disks,omitempty"`
+}
+
+// GCEOptions mirrors var.options.
+type GCEOptions struct {
+	AllowStoppingForUpdate *bool                      `yaml:"allow_stopping_for_update,omitempty"`
+	DeletionProtection     *bool                      `yaml:"deletion_protection,omitempty"`
+	NodeAffinities         map[string]GCENodeAffinity `yaml:"node_affinities,omitempty"`
+	Spot                   *bool                      `yaml:"spot,omitempty"`
+	TerminationAction      *string                    `yaml:"termination_action,omitempty"`
+}
+
+// GCENodeAffinity pins the instance to sole-tenant nodes by label.
+type GCENodeAffinity struct {
+	Values []string `yaml:"values"`
+	In     *bool    `yaml:"in,omitempty"`
+}
+
+// GCEScratchDisks mirrors var.scratch_disks.
+type GCEScratchDisks struct {
+	Count     int    `yaml:"count"`
+	Interface string `yaml:"interface"`
+}
+
+// GCEShieldedConfig mirrors var.shielded_config.
+type GCEShieldedConfig struct {
+	EnableSecureBoot          bool `yaml:"enable_secure_boot"`
+	EnableVTPM                bool `yaml:"enable_vtpm"`
+	EnableIntegrityMonitoring bool `yaml:"enable_integrity_monitoring"`
+}
+
+// GCESnapshotSchedule is a snapshot resource policy keyed by name.
+type GCESnapshotSchedule struct {
+	Schedule           GCESnapshotScheduleWindow   `yaml:"schedule"`
+	Description        *string                     `yaml:"description,omitempty"`
+	RetentionPolicy    *GCESnapshotRetentionPolicy `yaml:"retention_policy,omitempty"`
+	SnapshotProperties *GCESnapshotProperties      `yaml:"snapshot_properties,omitempty"`
+}
+
+// GCESnapshotScheduleWindow must set exactly one of Daily, Hourly or Weekly.
+type GCESnapshotScheduleWindow struct {
+	Daily  *GCEDailySchedule   `yaml:"daily,omitempty"`
+	Hourly *GCEHourlySchedule  `yaml:"hourly,omitempty"`
+	Weekly []GCEWeeklySchedule `yaml:"weekly,omitempty"`
+}
+
+// GCEDailySchedule takes a snapshot every DaysInCycle days.
+type GCEDailySchedule struct {
+	DaysInCycle int    `yaml:"days_in_cycle"`
+	StartTime   string `yaml:"start_time"`
+}
+
+// GCEHourlySchedule takes a snapshot every HoursInCycle hours.
+type GCEHourlySchedule struct {
+	HoursInCycle int    `yaml:"hours_in_cycle"`
+	StartTime    string `yaml:"start_time"`
+}
+
+// GCEWeeklySchedule takes a snapshot on Day at StartTime.
+type GCEWeeklySchedule struct {
+	Day       string `yaml:"day"`
+	StartTime string `yaml:"start_time"`
+}
+
+// GCESnapshotRetentionPolicy bounds how long snapshots are kept.
+type GCESnapshotRetentionPolicy struct {
+	MaxRetentionDays       int   `yaml:"max_retention_days"`
+	OnSourceDiskDeleteKeep *bool `yaml:"on_source_disk_delete_keep,omitempty"`
+}
+
+// GCESnapshotProperties is applied to every snapshot the schedule creates.
+type GCESnapshotProperties struct {
+	ChainName        *string           `yaml:"chain_name,omitempty"`
+	GuestFlush       *bool             `yaml:"guest_flush,omitempty"`
+	Labels           map[string]string `yaml:"labels,omitempty"`
+	StorageLocations []string          `yaml:"storage_locations,omitempty"`
+}
+
+// GCEServiceAccount is merged key by key with var.service_account.
+type GCEServiceAccount struct {
+	AutoCreate *bool    `yaml:"auto_create,omitempty"`
+	Email      *string  `yaml:"email,omitempty"`
+	Scopes     []string `yaml:"scopes,omitempty"`
+}
+
+// GCEBootDisk is merged key by key with var.boot_disk.
+type GCEBootDisk struct {
+	AutoDelete         *bool                  `yaml:"auto_delete,omitempty"`
+	SnapshotSchedule   *string                `yaml:"snapshot_schedule,omitempty"`
+	Source             *string                `yaml:"source,omitempty"`
+	InitializeParams   *GCEBootDiskInitParams `yaml:"initialize_params,omitempty"`
+	UseIndependentDisk *bool                  `yaml:"use_independent_disk,omitempty"`
+}
+
+// GCEBootDiskInitParams sizes the boot disk. Its image always comes from GCE.Image.
+type GCEBootDiskInitParams struct {
+	Size *int    `yaml:"size,omitempty"`
+	Type *string `yaml:"type,omitempty"`
+}
+
+// GCEAttachedDisk is one entry of var.attached_disks.
+type GCEAttachedDisk struct {
+	Name             string                  `yaml:"name"`
+	DeviceName       *string                 `yaml:"device_name,omitempty"`
+	Size             string                  `yaml:"size"`
+	SnapshotSchedule *string                 `yaml:"snapshot_schedule,omitempty"`
+	Source           *string                 `yaml:"source,omitempty"`
+	SourceType       *string                 `yaml:"source_type,omitempty"`
+	Options          *GCEAttachedDiskOptions `yaml:"options,omitempty"`
+}
+
+// GCEAttachedDiskOptions overrides var.attached_disk_defaults for one disk.
+type GCEAttachedDiskOptions struct {
+	AutoDelete  *bool   `yaml:"auto_delete,omitempty"`
+	Mode        string  `yaml:"mode,omitempty"`
+	ReplicaZone *string `yaml:"replica_zone,omitempty"`
+	Type        string  `yaml:"type,omitempty"`
+}
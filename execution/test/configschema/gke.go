@@ -0,0 +1,196 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+// GKE is a single GKE cluster read by 04-producer/GKE/locals.tf.
+type GKE struct {
+	// Required keys.
+	ProjectID       string `yaml:"project_id"`
+	Name            string `yaml:"name"`
+	Network         string `yaml:"network"`
+	Subnetwork      string `yaml:"subnetwork"`
+	IPRangePods     string `yaml:"ip_range_pods"`
+	IPRangeServices string `yaml:"ip_range_services"`
+
+	// Optional keys, defaulted from variables.tf when unset.
+	Region                                  string                           `yaml:"region,omitempty"`
+	Zones                                   []string                         `yaml:"zones,omitempty"`
+	Description                             string                           `yaml:"description,omitempty"`
+	Regional                                *bool                            `yaml:"regional,omitempty"`
+	NetworkProjectID                        string                           `yaml:"network_project_id,omitempty"`
+	KubernetesVersion                       string                           `yaml:"kubernetes_version,omitempty"`
+	MasterAuthorizedNetworks                []GKEMasterAuthorizedNetwork     `yaml:"master_authorized_networks,omitempty"`
+	EnableVerticalPodAutoscaling            *bool                            `yaml:"enable_vertical_pod_autoscaling,omitempty"`
+	HorizontalPodAutoscaling                *bool                            `yaml:"horizontal_pod_autoscaling,omitempty"`
+	HTTPLoadBalancing                       *bool                            `yaml:"http_load_balancing,omitempty"`
+	ServiceExternalIPs                      *bool                            `yaml:"service_external_ips,omitempty"`
+	DatapathProvider                        string                           `yaml:"datapath_provider,omitempty"`
+	MaintenanceStartTime                    string                           `yaml:"maintenance_start_time,omitempty"`
+	MaintenanceExclusions                   []GKEMaintenanceExclusion        `yaml:"maintenance_exclusions,omitempty"`
+	MaintenanceEndTime                      string                           `yaml:"maintenance_end_time,omitempty"`
+	MaintenanceRecurrence                   string                           `yaml:"maintenance_recurrence,omitempty"`
+	AdditionalIPRangePods                   []string                         `yaml:"additional_ip_range_pods,omitempty"`
+	StackType                               string                           `yaml:"stack_type,omitempty"`
+	NodePools                               []map[string]any                 `yaml:"node_pools,omitempty"`
+	WindowsNodePools                        []map[string]string              `yaml:"windows_node_pools,omitempty"`
+	NodePoolsLabels                         map[string]map[string]string     `yaml:"node_pools_labels,omitempty"`
+	NodePoolsResourceLabels                 map[string]map[string]string     `yaml:"node_pools_resource_labels,omitempty"`
+	NodePoolsMetadata                       map[string]map[string]string     `yaml:"node_pools_metadata,omitempty"`
+	NodePoolsLinuxNodeConfigsSysctls        map[string]map[string]string     `yaml:"node_pools_linux_node_configs_sysctls,omitempty"`
+	EnableCostAllocation                    *bool                            `yaml:"enable_cost_allocation,omitempty"`
+	ResourceUsageExportDatasetID            string                           `yaml:"resource_usage_export_dataset_id,omitempty"`
+	EnableNetworkEgressExport               *bool                            `yaml:"enable_network_egress_export,omitempty"`
+	EnableResourceConsumptionExport         *bool                            `yaml:"enable_resource_consumption_export,omitempty"`
+	ClusterAutoscaling                      *GKEClusterAutoscaling           `yaml:"cluster_autoscaling,omitempty"`
+	NodePoolsTaints                         map[string][]GKENodePoolTaint    `yaml:"node_pools_taints,omitempty"`
+	NodePoolsTags                           map[string][]string              `yaml:"node_pools_tags,omitempty"`
+	NodePoolsOAuthScopes                    map[string][]string              `yaml:"node_pools_oauth_scopes,omitempty"`
+	NetworkTags                             []string                         `yaml:"network_tags,omitempty"`
+	StubDomains                             map[string][]string              `yaml:"stub_domains,omitempty"`
+	UpstreamNameservers                     []string                         `yaml:"upstream_nameservers,omitempty"`
+	NonMasqueradeCIDRs                      []string                         `yaml:"non_masquerade_cidrs,omitempty"`
+	IPMasqResyncInterval                    string                           `yaml:"ip_masq_resync_interval,omitempty"`
+	IPMasqLinkLocal                         *bool                            `yaml:"ip_masq_link_local,omitempty"`
+	ConfigureIPMasq                         *bool                            `yaml:"configure_ip_masq,omitempty"`
+	LoggingService                          string                           `yaml:"logging_service,omitempty"`
+	MonitoringService                       string                           `yaml:"monitoring_service,omitempty"`
+	CreateServiceAccount                    *bool                            `yaml:"create_service_account,omitempty"`
+	GrantRegistryAccess                     *bool                            `yaml:"grant_registry_access,omitempty"`
+	RegistryProjectIDs                      []string                         `yaml:"registry_project_ids,omitempty"`
+	ServiceAccount                          string                           `yaml:"service_account,omitempty"`
+	ServiceAccountName                      string                           `yaml:"service_account_name,omitempty"`
+	BootDiskKMSKey                          *string                          `yaml:"boot_disk_kms_key,omitempty"`
+	IssueClientCertificate                  *bool                            `yaml:"issue_client_certificate,omitempty"`
+	ClusterIPv4CIDR                         *string                          `yaml:"cluster_ipv4_cidr,omitempty"`
+	ClusterResourceLabels                   map[string]string                `yaml:"cluster_resource_labels,omitempty"`
+	DNSCache                                *bool                            `yaml:"dns_cache,omitempty"`
+	AuthenticatorSecurityGroup              *string                          `yaml:"authenticator_security_group,omitempty"`
+	IdentityNamespace                       string                           `yaml:"identity_namespace,omitempty"`
+	EnableMeshCertificates                  *bool                            `yaml:"enable_mesh_certificates,omitempty"`
+	ReleaseChannel                          string                           `yaml:"release_channel,omitempty"`
+	GatewayAPIChannel                       *string                          `yaml:"gateway_api_channel,omitempty"`
+	AddClusterFirewallRules                 *bool                            `yaml:"add_cluster_firewall_rules,omitempty"`
+	AddMasterWebhookFirewallRules           *bool                            `yaml:"add_master_webhook_firewall_rules,omitempty"`
+	FirewallPriority                        *int                             `yaml:"firewall_priority,omitempty"`
+	FirewallInboundPorts                    []string                         `yaml:"firewall_inbound_ports,omitempty"`
+	AddShadowFirewallRules                  *bool                            `yaml:"add_shadow_firewall_rules,omitempty"`
+	ShadowFirewallRulesPriority             *int                             `yaml:"shadow_firewall_rules_priority,omitempty"`
+	ShadowFirewallRulesLogConfig            *GKEShadowFirewallRulesLogConfig `yaml:"shadow_firewall_rules_log_config,omitempty"`
+	EnableConfidentialNodes                 *bool                            `yaml:"enable_confidential_nodes,omitempty"`
+	EnableCiliumClusterwideNetworkPolicy    *bool                            `yaml:"enable_cilium_clusterwide_network_policy,omitempty"`
+	SecurityPostureMode                     string                           `yaml:"security_posture_mode,omitempty"`
+	SecurityPostureVulnerabilityMode        string                           `yaml:"security_posture_vulnerability_mode,omitempty"`
+	DisableDefaultSNAT                      *bool                            `yaml:"disable_default_snat,omitempty"`
+	NotificationConfigTopic                 string                           `yaml:"notification_config_topic,omitempty"`
+	NotificationFilterEventType             []string                         `yaml:"notification_filter_event_type,omitempty"`
+	DeletionProtection                      *bool                            `yaml:"deletion_protection,omitempty"`
+	EnableTPU                               *bool                            `yaml:"enable_tpu,omitempty"`
+	NetworkPolicy                           *bool                            `yaml:"network_policy,omitempty"`
+	NetworkPolicyProvider                   string                           `yaml:"network_policy_provider,omitempty"`
+	InitialNodeCount                        *int                             `yaml:"initial_node_count,omitempty"`
+	RemoveDefaultNodePool                   *bool                            `yaml:"remove_default_node_pool,omitempty"`
+	FilestoreCSIDriver                      *bool                            `yaml:"filestore_csi_driver,omitempty"`
+	DisableLegacyMetadataEndpoints          *bool                            `yaml:"disable_legacy_metadata_endpoints,omitempty"`
+	DefaultMaxPodsPerNode                   *int                             `yaml:"default_max_pods_per_node,omitempty"`
+	DatabaseEncryption                      []GKEDatabaseEncryption          `yaml:"database_encryption,omitempty"`
+	EnableShieldedNodes                     *bool                            `yaml:"enable_shielded_nodes,omitempty"`
+	EnableBinaryAuthorization               *bool                            `yaml:"enable_binary_authorization,omitempty"`
+	NodeMetadata                            string                           `yaml:"node_metadata,omitempty"`
+	ClusterDNSProvider                      string                           `yaml:"cluster_dns_provider,omitempty"`
+	ClusterDNSScope                         string                           `yaml:"cluster_dns_scope,omitempty"`
+	ClusterDNSDomain                        string                           `yaml:"cluster_dns_domain,omitempty"`
+	GCEPDCSIDriver                          *bool                            `yaml:"gce_pd_csi_driver,omitempty"`
+	GKEBackupAgentConfig                    *bool                            `yaml:"gke_backup_agent_config,omitempty"`
+	GCSFuseCSIDriver                        *bool                            `yaml:"gcs_fuse_csi_driver,omitempty"`
+	StatefulHA                              *bool                            `yaml:"stateful_ha,omitempty"`
+	Timeouts                                map[string]string                `yaml:"timeouts,omitempty"`
+	MonitoringEnableManagedPrometheus       *bool                            `yaml:"monitoring_enable_managed_prometheus,omitempty"`
+	MonitoringEnableObservabilityMetrics    *bool                            `yaml:"monitoring_enable_observability_metrics,omitempty"`
+	MonitoringObservabilityMetricsRelayMode *string                          `yaml:"monitoring_observability_metrics_relay_mode,omitempty"`
+	MonitoringEnabledComponents             []string                         `yaml:"monitoring_enabled_components,omitempty"`
+	LoggingEnabledComponents                []string                         `yaml:"logging_enabled_components,omitempty"`
+	EnableKubernetesAlpha                   *bool                            `yaml:"enable_kubernetes_alpha,omitempty"`
+	ConfigConnector                         *bool                            `yaml:"config_connector,omitempty"`
+	EnableIntranodeVisibility               *bool                            `yaml:"enable_intranode_visibility,omitempty"`
+	EnableL4ILBSubsetting                   *bool                            `yaml:"enable_l4_ilb_subsetting,omitempty"`
+	FleetProject                            *string                          `yaml:"fleet_project,omitempty"`
+	EnablePrivateEndpoint                   *bool                            `yaml:"enable_private_endpoint,omitempty"`
+	EnablePrivateNodes                      *bool                            `yaml:"enable_private_nodes,omitempty"`
+	MasterIPv4CIDRBlock                     string                           `yaml:"master_ipv4_cidr_block,omitempty"`
+}
+
+// GKEMasterAuthorizedNetwork is a CIDR allowed to reach the control plane.
+type GKEMasterAuthorizedNetwork struct {
+	CIDRBlock   string `yaml:"cidr_block"`
+	DisplayName string `yaml:"display_name"`
+}
+
+// GKEMaintenanceExclusion is a window during which maintenance is blocked.
+type GKEMaintenanceExclusion struct {
+	Name           string `yaml:"name"`
+	StartTime      string `yaml:"start_time"`
+	EndTime        string `yaml:"end_time"`
+	ExclusionScope string `yaml:"exclusion_scope"`
+}
+
+// GKEClusterAutoscaling mirrors var.cluster_autoscaling.
+type GKEClusterAutoscaling struct {
+	Enabled                   bool             `yaml:"enabled"`
+	AutoscalingProfile        string           `yaml:"autoscaling_profile"`
+	MinCPUCores               int              `yaml:"min_cpu_cores"`
+	MaxCPUCores               int              `yaml:"max_cpu_cores"`
+	MinMemoryGB               int              `yaml:"min_memory_gb"`
+	MaxMemoryGB               int              `yaml:"max_memory_gb"`
+	GPUResources              []GKEGPUResource `yaml:"gpu_resources"`
+	AutoRepair                bool             `yaml:"auto_repair"`
+	AutoUpgrade               bool             `yaml:"auto_upgrade"`
+	DiskSize                  *int             `yaml:"disk_size,omitempty"`
+	DiskType                  *string          `yaml:"disk_type,omitempty"`
+	ImageType                 *string          `yaml:"image_type,omitempty"`
+	Strategy                  *string          `yaml:"strategy,omitempty"`
+	MaxSurge                  *int             `yaml:"max_surge,omitempty"`
+	MaxUnavailable            *int             `yaml:"max_unavailable,omitempty"`
+	NodePoolSoakDuration      *string          `yaml:"node_pool_soak_duration,omitempty"`
+	BatchSoakDuration         *string          `yaml:"batch_soak_duration,omitempty"`
+	BatchPercentage           *float64         `yaml:"batch_percentage,omitempty"`
+	BatchNodeCount            *int             `yaml:"batch_node_count,omitempty"`
+	EnableSecureBoot          *bool            `yaml:"enable_secure_boot,omitempty"`
+	EnableIntegrityMonitoring *bool            `yaml:"enable_integrity_monitoring,omitempty"`
+}
+
+// GKEGPUResource bounds one GPU type for node auto-provisioning.
+type GKEGPUResource struct {
+	ResourceType string `yaml:"resource_type"`
+	Minimum      int    `yaml:"minimum"`
+	Maximum      int    `yaml:"maximum"`
+}
+
+// GKENodePoolTaint is a taint applied to the nodes of a node pool.
+type GKENodePoolTaint struct {
+	Key    string `yaml:"key"`
+	Value  string `yaml:"value"`
+	Effect string `yaml:"effect"`
+}
+
+// GKEShadowFirewallRulesLogConfig sets logging for the shadow firewall rules.
+type GKEShadowFirewallRulesLogConfig struct {
+	Metadata string `yaml:"metadata"`
+}
+
+// GKEDatabaseEncryption configures application-layer secrets encryption.
+type GKEDatabaseEncryption struct {
+	State   string `yaml:"state"`
+	KeyName string `yaml:"key_name"`
+}
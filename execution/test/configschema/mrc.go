@@ -0,0 +1,29 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+// MRC is a single Memorystore for Redis Cluster read by 04-producer/MRC/locals.tf.
+type MRC struct {
+	// Required keys.
+	RedisClusterName string `yaml:"redis_cluster_name"`
+	ProjectID        string `yaml:"project_id"`
+	NetworkID        string `yaml:"network_id"`
+
+	// Optional keys, defaulted from variables.tf when unset.
+	Region                    string `yaml:"region,omitempty"`
+	ShardCount                *int   `yaml:"shard_count,omitempty"`
+	ReplicaCount              *int   `yaml:"replica_count,omitempty"`
+	DeletionProtectionEnabled *bool  `yaml:"deletion_protection_enabled,omitempty"`
+}
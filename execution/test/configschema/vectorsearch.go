@@ -0,0 +1,95 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+// VectorSearch is a single Vector Search index, endpoint and deployment read
+// by 04-producer/VectorSearch/locals.tf.
+type VectorSearch struct {
+	// Required keys.
+	ProjectID                string `yaml:"project_id"`
+	IndexDisplayName         string `yaml:"index_display_name"`
+	Region                   string `yaml:"region"`
+	IndexEndpointDisplayName string `yaml:"index_endpoint_display_name"`
+	DeployedIndexID          string `yaml:"deployed_index_id"`
+
+	// ApproximateNeighborsCount has no variables.tf fallback in locals.tf.
+	ApproximateNeighborsCount *int `yaml:"approximate_neighbors_count,omitempty"`
+
+	// Optional keys, defaulted from variables.tf when unset.
+	IndexEndpointNetwork        *string                              `yaml:"index_endpoint_network,omitempty"`
+	IndexLabels                 map[string]string                    `yaml:"index_labels,omitempty"`
+	IndexDescription            *string                              `yaml:"index_description,omitempty"`
+	IndexUpdateMethod           string                               `yaml:"index_update_method,omitempty"`
+	ShardSize                   string                               `yaml:"shard_size,omitempty"`
+	DistanceMeasureType         string                               `yaml:"distance_measure_type,omitempty"`
+	IndexEndpointDescription    *string                              `yaml:"index_endpoint_description,omitempty"`
+	IndexEndpointLabels         map[string]string                    `yaml:"index_endpoint_labels,omitempty"`
+	TreeAHConfig                *VectorSearchTreeAHConfig            `yaml:"tree_ah_config,omitempty"`
+	BruteForceConfig            *string                              `yaml:"brute_force_config,omitempty"`
+	DeployedDisplayName         *string                              `yaml:"deployed_display_name,omitempty"`
+	ReservedIPRanges            []string                             `yaml:"reserved_ip_ranges,omitempty"`
+	EnableAccessLogging         *bool                                `yaml:"enable_access_logging,omitempty"`
+	DeploymentGroup             *string                              `yaml:"deployment_group,omitempty"`
+	AutomaticResources          *VectorSearchAutomaticResources      `yaml:"automatic_resources,omitempty"`
+	DedicatedResources          *VectorSearchDedicatedResources      `yaml:"dedicated_resources,omitempty"`
+	DeployedIndexAuthConfig     *VectorSearchDeployedIndexAuthConfig `yaml:"deployed_index_auth_config,omitempty"`
+	PublicEndpointEnabled       *bool                                `yaml:"public_endpoint_enabled,omitempty"`
+	PrivateServiceConnectConfig *VectorSearchPSCConfig               `yaml:"private_service_connect_config,omitempty"`
+
+	// Dimension is set by the configuration examples but never read by
+	// locals.tf, which takes the dimensions variable instead.
+	Dimension *int `yaml:"dimension,omitempty"`
+}
+
+// VectorSearchTreeAHConfig selects the tree-AH algorithm for the index.
+type VectorSearchTreeAHConfig struct {
+	LeafNodeEmbeddingCount   *int `yaml:"leaf_node_embedding_count,omitempty"`
+	LeafNodesToSearchPercent *int `yaml:"leaf_nodes_to_search_percent,omitempty"`
+}
+
+// VectorSearchAutomaticResources sizes an automatically scaled deployment.
+type VectorSearchAutomaticResources struct {
+	MinReplicaCount *int `yaml:"min_replica_count,omitempty"`
+	MaxReplicaCount *int `yaml:"max_replica_count,omitempty"`
+}
+
+// VectorSearchDedicatedResources sizes a deployment on dedicated machines.
+type VectorSearchDedicatedResources struct {
+	MachineSpec     VectorSearchMachineSpec `yaml:"machine_spec"`
+	MinReplicaCount *int                    `yaml:"min_replica_count,omitempty"`
+	MaxReplicaCount *int                    `yaml:"max_replica_count,omitempty"`
+}
+
+// VectorSearchMachineSpec names the machine type of dedicated resources.
+type VectorSearchMachineSpec struct {
+	MachineType string `yaml:"machine_type"`
+}
+
+// VectorSearchDeployedIndexAuthConfig restricts callers of the deployed index.
+type VectorSearchDeployedIndexAuthConfig struct {
+	AuthProvider VectorSearchAuthProvider `yaml:"auth_provider"`
+}
+
+// VectorSearchAuthProvider lists the accepted JWT audiences and issuers.
+type VectorSearchAuthProvider struct {
+	Audiences      string   `yaml:"audiences,omitempty"`
+	AllowedIssuers []string `yaml:"allowed_issuers,omitempty"`
+}
+
+// VectorSearchPSCConfig exposes the index endpoint through Private Service Connect.
+type VectorSearchPSCConfig struct {
+	EnablePrivateServiceConnect bool     `yaml:"enable_private_service_connect"`
+	ProjectAllowlist            []string `yaml:"project_allowlist"`
+}
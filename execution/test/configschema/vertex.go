@@ -0,0 +1,31 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configschema
+
+// VertexEndpoint is a single Vertex AI online endpoint read by
+// 04-producer/Vertex-AI-Online-Endpoints/locals.tf.
+type VertexEndpoint struct {
+	// Required keys. DisplayName is also the for_each key of the endpoint.
+	DisplayName string `yaml:"display_name"`
+	Project     string `yaml:"project"`
+	Location    string `yaml:"location"`
+	Network     string `yaml:"network"`
+
+	// Optional keys, defaulted from variables.tf when unset.
+	Name        string            `yaml:"name,omitempty"`
+	Description string            `yaml:"description,omitempty"`
+	Region      string            `yaml:"region,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+}
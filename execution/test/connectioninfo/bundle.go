@@ -0,0 +1,201 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectioninfo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bundle is the connection information of one consumer.
+type Bundle struct {
+	Consumer    string       `json:"consumer"`
+	Connections []Connection `json:"connections"`
+}
+
+// Spec maps each consumer to the references, "producer/name", of the
+// instances it connects to. A reference "producer/*" selects every
+// instance of the producer.
+type Spec map[string][]string
+
+// ReadSpec reads a Spec from the YAML file at path, for example:
+//
+//	web-app:
+//	  - cloudsql/orders
+//	  - mrc/sessions
+//	batch-job:
+//	  - alloydb/*
+func ReadSpec(path string) (Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// Bundles returns the bundle of every consumer of spec, sorted by
+// consumer, with the connections in the order of conns. References that
+// select no connection are errors.
+func Bundles(conns []Connection, spec Spec) ([]Bundle, error) {
+	consumers := make([]string, 0, len(spec))
+	for consumer := range spec {
+		consumers = append(consumers, consumer)
+	}
+	sort.Strings(consumers)
+	var bundles []Bundle
+	var errs []error
+	for _, consumer := range consumers {
+		selected := map[string]bool{}
+		for _, ref := range spec[consumer] {
+			found := false
+			for _, c := range conns {
+				if c.Ref() == ref || ref == string(c.Producer)+"/*" {
+					selected[c.Ref()], found = true, true
+				}
+			}
+			if !found {
+				errs = append(errs, fmt.Errorf("%s: %s matches no producer instance", consumer, ref))
+			}
+		}
+		b := Bundle{Consumer: consumer, Connections: []Connection{}}
+		for _, c := range conns {
+			if selected[c.Ref()] {
+				b.Connections = append(b.Connections, c)
+			}
+		}
+		bundles = append(bundles, b)
+	}
+	return bundles, errors.Join(errs...)
+}
+
+// Format is an output format of a bundle.
+type Format string
+
+const (
+	Env    Format = "env"
+	JSON   Format = "json"
+	Secret Format = "secret"
+)
+
+// Extension returns the file extension of f, including the dot.
+func (f Format) Extension() string {
+	if f == Secret {
+		return ".yaml"
+	}
+	return "." + string(f)
+}
+
+// Write writes b to w in format f.
+func (b Bundle) Write(w io.Writer, f Format) error {
+	var buf bytes.Buffer
+	switch f {
+	case Env:
+		for _, c := range b.Connections {
+			fmt.Fprintf(&buf, "# %s %s\n", c.Producer, c.Name)
+			for _, kv := range c.variables() {
+				fmt.Fprintf(&buf, "%s=%s\n", kv[0], envQuote(kv[1]))
+			}
+		}
+	case JSON:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(b); err != nil {
+			return err
+		}
+	case Secret:
+		fmt.Fprintf(&buf, "apiVersion: v1\nkind: Secret\nmetadata:\n  name: %s\ntype: Opaque\nstringData:", SecretName(b.Consumer))
+		var vars [][2]string
+		for _, c := range b.Connections {
+			vars = append(vars, c.variables()...)
+		}
+		if len(vars) == 0 {
+			buf.WriteString(" {}")
+		}
+		buf.WriteString("\n")
+		for _, kv := range vars {
+			// A JSON string is a double-quoted YAML scalar.
+			value, _ := json.Marshal(kv[1])
+			fmt.Fprintf(&buf, "  %s: %s\n", kv[0], value)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", f)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// variables returns the environment variables of c, named
+// PRODUCER_NAME_FIELD, in a fixed order.
+func (c Connection) variables() [][2]string {
+	prefix := envName(string(c.Producer) + "_" + c.Name)
+	var vars [][2]string
+	add := func(field, value string) {
+		if value != "" {
+			vars = append(vars, [2]string{prefix + "_" + field, value})
+		}
+	}
+	add("HOST", c.Host)
+	if c.Port != 0 {
+		add("PORT", strconv.Itoa(c.Port))
+	}
+	add("CONNECTION_NAME", c.ConnectionName)
+	add("TLS_MODE", c.TLSMode)
+	add("ENDPOINT_ID", c.EndpointID)
+	add("REGION", c.Region)
+	return vars
+}
+
+var (
+	notEnv    = regexp.MustCompile(`[^A-Z0-9_]+`)
+	notDNS    = regexp.MustCompile(`[^a-z0-9-]+`)
+	envSafe   = regexp.MustCompile(`^[A-Za-z0-9_./:@-]*$`)
+	dashRunes = regexp.MustCompile(`-+`)
+)
+
+// envName turns s into an environment variable name.
+func envName(s string) string {
+	return notEnv.ReplaceAllString(strings.ToUpper(s), "_")
+}
+
+// envQuote quotes value for a .env file when it holds other characters
+// than those of names, addresses and paths.
+func envQuote(value string) string {
+	if envSafe.MatchString(value) {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// SecretName returns the name of the Kubernetes Secret of consumer, a DNS
+// subdomain name.
+func SecretName(consumer string) string {
+	name := notDNS.ReplaceAllString(strings.ToLower(consumer), "-")
+	name = strings.Trim(dashRunes.ReplaceAllString(name, "-"), "-")
+	return name + "-connection-info"
+}
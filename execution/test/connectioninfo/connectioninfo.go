@@ -0,0 +1,237 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connectioninfo aggregates the outputs of the producer stages into
+// the connection information a consumer workload needs: host, port,
+// connection name and TLS mode of the Cloud SQL instances, AlloyDB clusters
+// and Redis clusters, and the IDs of the Vertex AI endpoints.
+//
+// The outputs are read as written by terraform output -json. When the
+// 05-networking-manual stage created a PSC endpoint for a Cloud SQL
+// instance or an AlloyDB cluster, the endpoint address is the host instead
+// of the private IP of the instance. Connections are grouped into one
+// Bundle per consumer, written as a .env file, JSON or a Kubernetes Secret
+// manifest.
+package connectioninfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Producer is a stage whose instances consumers connect to.
+type Producer string
+
+const (
+	CloudSQL Producer = "cloudsql"
+	AlloyDB  Producer = "alloydb"
+	MRC      Producer = "mrc"
+	Vertex   Producer = "vertex"
+)
+
+// Producers lists the producers in the order their connections are
+// written.
+var Producers = []Producer{CloudSQL, AlloyDB, MRC, Vertex}
+
+// Outputs maps each producer to the output of its stage that describes its
+// instances.
+var Outputs = map[Producer]string{
+	CloudSQL: "cloudsql_instance_details",
+	AlloyDB:  "cluster_details",
+	MRC:      "redis_cluster_details",
+	Vertex:   "endpoint_configurations",
+}
+
+// Access values of a Connection.
+const (
+	// Private is a host on the private IP of the instance.
+	Private = "private"
+	// PSC is a host on a PSC endpoint of 05-networking-manual.
+	PSC = "psc"
+)
+
+// Connection is how a consumer reaches a producer instance.
+type Connection struct {
+	Producer Producer `json:"producer"`
+	Name     string   `json:"name"`
+	Host     string   `json:"host,omitempty"`
+	Port     int      `json:"port,omitempty"`
+	// Access is how Host is reached, Private or PSC.
+	Access string `json:"access,omitempty"`
+	// ConnectionName is the instance connection name the Cloud SQL
+	// connectors and Auth Proxy use.
+	ConnectionName string `json:"connection_name,omitempty"`
+	TLSMode        string `json:"tls_mode,omitempty"`
+	EndpointID     string `json:"endpoint_id,omitempty"`
+	Region         string `json:"region,omitempty"`
+	// ServiceAttachment is matched against the targets of the PSC endpoints.
+	ServiceAttachment string `json:"-"`
+}
+
+// Ref returns the reference of c in a bundle spec, "producer/name".
+func (c Connection) Ref() string {
+	return string(c.Producer) + "/" + c.Name
+}
+
+// Default ports, by producer or Cloud SQL database engine.
+var ports = map[string]int{
+	"MYSQL":     3306,
+	"POSTGRES":  5432,
+	"SQLSERVER": 1433,
+	"alloydb":   5432,
+	"mrc":       6379,
+}
+
+// ReadOutputs reads the connections of producer from the output of
+// terraform output -json at path.
+func ReadOutputs(producer Producer, path string) ([]Connection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	conns, err := ParseOutputs(producer, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return conns, nil
+}
+
+// ParseOutputs returns the connections of producer, sorted by name, from
+// the output of terraform output -json.
+func ParseOutputs(producer Producer, data []byte) ([]Connection, error) {
+	name, ok := Outputs[producer]
+	if !ok {
+		return nil, fmt.Errorf("unknown producer %q", producer)
+	}
+	var details map[string]struct {
+		Name                     string `json:"name"`
+		ClusterID                string `json:"cluster_id"`
+		Region                   string `json:"region"`
+		ConnectionName           string `json:"connection_name"`
+		DatabaseVersion          string `json:"database_version"`
+		PrivateIPAddress         string `json:"private_ip_address"`
+		PrimaryInstanceIP        string `json:"primary_instance_ip"`
+		SSLMode                  string `json:"ssl_mode"`
+		PSCServiceAttachmentLink string `json:"psc_service_attachment_link"`
+		DiscoveryEndpoints       []struct {
+			Address string `json:"address"`
+			Port    int    `json:"port"`
+		} `json:"discovery_endpoints"`
+		TransitEncryptionMode string `json:"transit_encryption_mode"`
+	}
+	if err := outputValue(data, name, &details); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	conns := make([]Connection, 0, len(keys))
+	for _, key := range keys {
+		d := details[key]
+		c := Connection{Producer: producer, Name: key, Region: d.Region, Access: Private}
+		switch producer {
+		case CloudSQL:
+			c.Host, c.ConnectionName, c.TLSMode = d.PrivateIPAddress, d.ConnectionName, d.SSLMode
+			c.Port = ports[strings.SplitN(d.DatabaseVersion, "_", 2)[0]]
+			c.ServiceAttachment = d.PSCServiceAttachmentLink
+		case AlloyDB:
+			if d.ClusterID != "" {
+				c.Name = d.ClusterID
+			}
+			c.Host, c.Port, c.TLSMode = d.PrimaryInstanceIP, ports[string(AlloyDB)], d.SSLMode
+			c.ServiceAttachment = d.PSCServiceAttachmentLink
+		case MRC:
+			// The discovery endpoint is already an address of the consumer
+			// network, created by the service connection policy.
+			c.Port, c.TLSMode = ports[string(MRC)], d.TransitEncryptionMode
+			if len(d.DiscoveryEndpoints) > 0 {
+				c.Host, c.Port = d.DiscoveryEndpoints[0].Address, d.DiscoveryEndpoints[0].Port
+			}
+		case Vertex:
+			c.EndpointID, c.Access = d.Name, ""
+		}
+		if c.Host == "" && c.Access == Private {
+			c.Access = ""
+		}
+		conns = append(conns, c)
+	}
+	return conns, nil
+}
+
+// ReadPSCAddresses reads the PSC endpoint addresses from the output of
+// terraform output -json of 05-networking-manual at path.
+func ReadPSCAddresses(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ParsePSCAddresses(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return addrs, nil
+}
+
+// ParsePSCAddresses returns the address of each PSC endpoint of
+// 05-networking-manual, keyed by the service attachment it targets.
+func ParsePSCAddresses(data []byte) (map[string]string, error) {
+	var targets, addresses map[string]string
+	if err := outputValue(data, "forwarding_rule_target", &targets); err != nil {
+		return nil, err
+	}
+	if err := outputValue(data, "ip_address_literal", &addresses); err != nil {
+		return nil, err
+	}
+	addrs := map[string]string{}
+	for index, target := range targets {
+		if addr := addresses[index]; addr != "" {
+			addrs[target] = addr
+		}
+	}
+	return addrs, nil
+}
+
+// ApplyPSC replaces the host of every connection whose service attachment
+// has a PSC endpoint in addrs by the endpoint address.
+func ApplyPSC(conns []Connection, addrs map[string]string) {
+	for i, c := range conns {
+		if addr, ok := addrs[c.ServiceAttachment]; ok && c.ServiceAttachment != "" {
+			conns[i].Host, conns[i].Access = addr, PSC
+		}
+	}
+}
+
+// outputValue decodes the value of the output name of data, the output of
+// terraform output -json, into v.
+func outputValue(data []byte, name string, v any) error {
+	var outputs map[string]struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return err
+	}
+	output, ok := outputs[name]
+	if !ok {
+		return fmt.Errorf("output %q is not set", name)
+	}
+	if err := json.Unmarshal(output.Value, v); err != nil {
+		return fmt.Errorf("output %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connectioninfo
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/golden"
+	"github.com/google/go-cmp/cmp"
+)
+
+// readFixtures reads the recorded outputs of testdata and applies the PSC
+// endpoints of networking-manual.json.
+func readFixtures(t *testing.T) []Connection {
+	t.Helper()
+	var conns []Connection
+	for _, p := range Producers {
+		read, err := ReadOutputs(p, filepath.Join("testdata", string(p)+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, read...)
+	}
+	addrs, err := ReadPSCAddresses(filepath.Join("testdata", "networking-manual.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ApplyPSC(conns, addrs)
+	return conns
+}
+
+/*
+TestReadOutputs verifies the host, port and TLS mode read for each producer,
+and that a Cloud SQL instance with a PSC endpoint is reached on the endpoint
+address.
+*/
+func TestReadOutputs(t *testing.T) {
+	want := []Connection{
+		{Producer: CloudSQL, Name: "orders", Host: "10.20.0.3", Port: 5432, Access: Private, ConnectionName: "producer-project:us-central1:orders", TLSMode: "ENCRYPTED_ONLY", Region: "us-central1"},
+		{Producer: CloudSQL, Name: "reports", Host: "10.128.0.26", Port: 3306, Access: PSC, ConnectionName: "producer-project:us-central1:reports", TLSMode: "ALLOW_UNENCRYPTED_AND_ENCRYPTED", Region: "us-central1", ServiceAttachment: "projects/a1b2c3-tp/regions/us-central1/serviceAttachments/a-1234-psc-service-attachment-5678"},
+		{Producer: AlloyDB, Name: "inventory-cluster", Host: "10.30.0.2", Port: 5432, Access: Private, TLSMode: "ENCRYPTED_ONLY", Region: "us-central1"},
+		{Producer: MRC, Name: "sessions", Host: "10.40.0.5", Port: 6379, Access: Private, TLSMode: "TRANSIT_ENCRYPTION_MODE_SERVER_AUTHENTICATION", Region: "us-central1"},
+		{Producer: Vertex, Name: "recommendations", EndpointID: "4812390123456789012", Region: "us-central1"},
+	}
+	if diff := cmp.Diff(want, readFixtures(t)); diff != "" {
+		t.Errorf("connections mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := ParseOutputs(MRC, []byte(`{"cluster_details": {"value": {}}}`)); err == nil {
+		t.Error("ParseOutputs() of another stage = nil error, want an error")
+	}
+}
+
+/*
+TestBundlesMatchGolden writes the bundle of every consumer of
+testdata/spec.yaml in every format and compares it with its golden file.
+Run the test with -update to regenerate them.
+*/
+func TestBundlesMatchGolden(t *testing.T) {
+	spec, err := ReadSpec(filepath.Join("testdata", "spec.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundles, err := Bundles(readFixtures(t), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range bundles {
+		for _, f := range []Format{Env, JSON, Secret} {
+			t.Run(b.Consumer+f.Extension(), func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := b.Write(&buf, f); err != nil {
+					t.Fatal(err)
+				}
+				golden.File(t, filepath.Join("testdata", b.Consumer+".golden"+f.Extension()), buf.Bytes())
+			})
+		}
+	}
+}
+
+/*
+TestBundlesUnknownReference verifies that a reference matching no producer
+instance is reported with its consumer.
+*/
+func TestBundlesUnknownReference(t *testing.T) {
+	_, err := Bundles(readFixtures(t), Spec{"web-app": {"cloudsql/orders", "cloudsql/missing", "alloydb/*"}, "cache": {"mrc/*"}})
+	if err == nil || !strings.Contains(err.Error(), "web-app: cloudsql/missing matches no producer instance") {
+		t.Fatalf("Bundles() error = %v, want the unknown cloudsql/missing", err)
+	}
+	if strings.Contains(err.Error(), "alloydb/*") || strings.Contains(err.Error(), "mrc/*") {
+		t.Errorf("Bundles() error = %v, want wildcards to match", err)
+	}
+}
+
+/*
+TestSecretName verifies that consumer names are turned into valid Secret
+names.
+*/
+func TestSecretName(t *testing.T) {
+	for consumer, want := range map[string]string{
+		"web-app":    "web-app-connection-info",
+		"batch_job":  "batch-job-connection-info",
+		"-Cloud Run": "cloud-run-connection-info",
+	} {
+		if got := SecretName(consumer); got != want {
+			t.Errorf("SecretName(%q) = %q, want %q", consumer, got, want)
+		}
+	}
+}
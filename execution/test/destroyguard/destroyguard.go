@@ -0,0 +1,301 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package destroyguard finds the resources a plan deletes or replaces and
+// explains why, so that a renamed Cloud SQL instance, a changed AlloyDB
+// cluster_id or a renamed YAML file, which changes the for_each key of a
+// producer module, does not silently destroy and recreate a database.
+//
+// Replacements are explained with the attributes Terraform reports in
+// replace_paths and their values before and after. A delete next to a create
+// of the same resource under another for_each key is reported as a changed
+// key. Deletes and replacements of StatefulTypes block the plan unless an
+// overrides file lists their address:
+//
+//	allow:
+//	  - address: module.cloudsql["old"].google_sql_database_instance.primary
+//	    reason: instance replaced by module.cloudsql["new"] during the migration
+//
+// Unit tests call Check, which reports every delete and replacement:
+//
+//	destroyguard.Check(t, plans.Plan(t, terraformOptions))
+package destroyguard
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"gopkg.in/yaml.v3"
+)
+
+// StatefulTypes are the resource types whose replacement loses data or a
+// cluster that consumers depend on.
+var StatefulTypes = []string{
+	"google_alloydb_cluster",
+	"google_container_cluster",
+	"google_redis_cluster",
+	"google_sql_database_instance",
+	"google_vertex_ai_index",
+}
+
+// IsStateful reports whether resourceType is one of StatefulTypes.
+func IsStateful(resourceType string) bool {
+	for _, t := range StatefulTypes {
+		if t == resourceType {
+			return true
+		}
+	}
+	return false
+}
+
+// Action is a destructive action of a plan.
+type Action string
+
+const (
+	Delete  Action = "delete"
+	Replace Action = "replace"
+)
+
+// Change is a resource a plan deletes or replaces.
+type Change struct {
+	Address  string
+	Type     string
+	Action   Action
+	Stateful bool
+	// Reasons explains the change, for example the attributes that force a
+	// replacement.
+	Reasons []string
+	// Override is the reason of the overrides entry that allows the change,
+	// empty when none does.
+	Override string
+}
+
+// String formats c as "address: replace of stateful type: reason; reason".
+func (c Change) String() string {
+	kind := c.Type
+	if c.Stateful {
+		kind = "stateful " + kind
+	}
+	s := fmt.Sprintf("%s: %s of %s: %s", c.Address, c.Action, kind, strings.Join(c.Reasons, "; "))
+	if c.Override != "" {
+		s += " (allowed: " + c.Override + ")"
+	}
+	return s
+}
+
+// ReadPlan reads the output of terraform show -json for a plan.
+func ReadPlan(path string) (*tfjson.Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan tfjson.Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &plan, nil
+}
+
+// Inspect returns the managed resources plan deletes or replaces, sorted by
+// address.
+func Inspect(plan *tfjson.Plan) []Change {
+	created := map[string][]string{}
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.DataResourceMode && rc.Change != nil && rc.Change.Actions.Create() {
+			key := unkeyed(rc.Address)
+			created[key] = append(created[key], rc.Address)
+		}
+	}
+	var changes []Change
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode == tfjson.DataResourceMode || rc.Change == nil {
+			continue
+		}
+		c := Change{Address: rc.Address, Type: rc.Type, Stateful: IsStateful(rc.Type)}
+		switch {
+		case rc.Change.Actions.Replace():
+			c.Action = Replace
+			c.Reasons = replaceReasons(rc.Change)
+		case rc.Change.Actions.Delete():
+			c.Action = Delete
+			c.Reasons = []string{deleteReason(rc.Address, created[unkeyed(rc.Address)])}
+		default:
+			continue
+		}
+		changes = append(changes, c)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+	return changes
+}
+
+// keys matches the for_each and count keys of a resource address.
+var keys = regexp.MustCompile(`\["(?:[^"\\]|\\.)*"\]|\[\d+\]`)
+
+// unkeyed returns address without its for_each and count keys.
+func unkeyed(address string) string {
+	return keys.ReplaceAllString(address, "")
+}
+
+func deleteReason(address string, created []string) string {
+	for _, other := range created {
+		if other != address {
+			return fmt.Sprintf("for_each key changed, %s is created instead", other)
+		}
+	}
+	return "removed from the configuration"
+}
+
+// replaceReasons describes the attributes of change that force the
+// replacement, with their values before and after.
+func replaceReasons(change *tfjson.Change) []string {
+	if len(change.ReplacePaths) == 0 {
+		return []string{"the plan does not say which attribute forces the replacement"}
+	}
+	var reasons []string
+	for _, p := range change.ReplacePaths {
+		path, ok := p.([]any)
+		if !ok {
+			continue
+		}
+		before := describe(lookup(change.Before, path), lookup(change.BeforeSensitive, path), nil)
+		after := describe(lookup(change.After, path), lookup(change.AfterSensitive, path), lookup(change.AfterUnknown, path))
+		reasons = append(reasons, fmt.Sprintf("%s %s -> %s forces replacement", formatPath(path), before, after))
+	}
+	return reasons
+}
+
+// lookup returns the element of v at path, or nil.
+func lookup(v any, path []any) any {
+	for _, step := range path {
+		switch s := step.(type) {
+		case string:
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil
+			}
+			v = m[s]
+		case float64:
+			l, ok := v.([]any)
+			if !ok || int(s) < 0 || int(s) >= len(l) {
+				return nil
+			}
+			v = l[int(s)]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// describe formats a value of a change, hiding sensitive values.
+func describe(v, sensitive, unknown any) string {
+	switch {
+	case sensitive == true:
+		return "(sensitive)"
+	case unknown == true:
+		return "(known after apply)"
+	case v == nil:
+		return "null"
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(encoded)
+}
+
+// formatPath formats a replace path as a gjson path such as
+// "settings.0.tier".
+func formatPath(path []any) string {
+	parts := make([]string, len(path))
+	for i, step := range path {
+		parts[i] = fmt.Sprint(step)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Overrides maps the addresses that may be deleted or replaced to the reason
+// they may.
+type Overrides map[string]string
+
+// ReadOverrides reads an overrides file.
+func ReadOverrides(path string) (Overrides, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Allow []struct {
+			Address string `yaml:"address"`
+			Reason  string `yaml:"reason"`
+		} `yaml:"allow"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	overrides := Overrides{}
+	var errs []error
+	for i, a := range file.Allow {
+		if a.Address == "" || a.Reason == "" {
+			errs = append(errs, fmt.Errorf("%s: allow entry %d needs an address and a reason", path, i))
+			continue
+		}
+		overrides[a.Address] = a.Reason
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// Blocking sets the Override of the changes o allows and returns the
+// changes that are neither allowed nor, unless all is true, of a stateful
+// type.
+func (o Overrides) Blocking(changes []Change, all bool) []Change {
+	var blocking []Change
+	for i := range changes {
+		changes[i].Override = o[changes[i].Address]
+		if changes[i].Override == "" && (all || changes[i].Stateful) {
+			blocking = append(blocking, changes[i])
+		}
+	}
+	return blocking
+}
+
+// Check reports every resource plan deletes or replaces, stateful or not,
+// as a test failure with its reasons.
+func Check(t testing.TB, plan *terraform.PlanStruct) {
+	t.Helper()
+	for _, c := range Inspect(&plan.RawPlan) {
+		t.Error(c)
+	}
+}
+
+// CheckE is like Check but returns the changes as an error instead of
+// reporting them.
+func CheckE(plan *terraform.PlanStruct) error {
+	var errs []error
+	for _, c := range Inspect(&plan.RawPlan) {
+		errs = append(errs, errors.New(c.String()))
+	}
+	return errors.Join(errs...)
+}
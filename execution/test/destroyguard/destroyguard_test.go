@@ -0,0 +1,165 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destroyguard
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeFile writes content to name in a temporary directory and returns its
+// path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const planJSON = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {
+      "address": "module.cloudsql[\"dummy1\"].google_sql_database_instance.primary",
+      "mode": "managed",
+      "type": "google_sql_database_instance",
+      "change": {
+        "actions": ["delete", "create"],
+        "before": {"name": "dummy1", "root_password": "secret", "settings": [{"tier": "db-f1-micro"}]},
+        "after": {"name": "dummy1-renamed", "root_password": null, "settings": [{"tier": "db-f1-micro"}]},
+        "after_unknown": {"root_password": true},
+        "before_sensitive": {"root_password": true},
+        "replace_paths": [["name"], ["root_password"]]
+      }
+    },
+    {
+      "address": "module.alloydb[\"old-file\"].module.alloydb.google_alloydb_cluster.default",
+      "mode": "managed",
+      "type": "google_alloydb_cluster",
+      "change": {"actions": ["delete"], "before": {"cluster_id": "c"}, "after": null}
+    },
+    {
+      "address": "module.alloydb[\"new-file\"].module.alloydb.google_alloydb_cluster.default",
+      "mode": "managed",
+      "type": "google_alloydb_cluster",
+      "change": {"actions": ["create"], "before": null, "after": {"cluster_id": "c"}}
+    },
+    {
+      "address": "google_compute_firewall.old",
+      "mode": "managed",
+      "type": "google_compute_firewall",
+      "change": {"actions": ["delete"], "before": {"name": "old"}, "after": null}
+    },
+    {
+      "address": "google_redis_cluster.cache",
+      "mode": "managed",
+      "type": "google_redis_cluster",
+      "change": {"actions": ["create", "delete"], "before": {"name": "cache"}, "after": {"name": "cache"}}
+    },
+    {
+      "address": "google_container_cluster.gke",
+      "mode": "managed",
+      "type": "google_container_cluster",
+      "change": {"actions": ["update"], "before": {"name": "gke"}, "after": {"name": "gke"}}
+    },
+    {
+      "address": "data.google_project.project",
+      "mode": "data",
+      "type": "google_project",
+      "change": {"actions": ["delete"]}
+    }
+  ]
+}`
+
+/*
+TestInspect verifies that deletes and replacements are found and explained
+by the attributes that force them or by a changed for_each key, and that
+updates, creates and data sources are ignored.
+*/
+func TestInspect(t *testing.T) {
+	plan, err := ReadPlan(writeFile(t, "plan.json", planJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range Inspect(plan) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`google_compute_firewall.old: delete of google_compute_firewall: removed from the configuration`,
+		`google_redis_cluster.cache: replace of stateful google_redis_cluster: the plan does not say which attribute forces the replacement`,
+		`module.alloydb["old-file"].module.alloydb.google_alloydb_cluster.default: delete of stateful google_alloydb_cluster: for_each key changed, module.alloydb["new-file"].module.alloydb.google_alloydb_cluster.default is created instead`,
+		`module.cloudsql["dummy1"].google_sql_database_instance.primary: replace of stateful google_sql_database_instance: name "dummy1" -> "dummy1-renamed" forces replacement; root_password (sensitive) -> (known after apply) forces replacement`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Inspect() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestBlocking verifies that overridden changes are allowed with their reason
+and that only stateful types block unless all types are requested.
+*/
+func TestBlocking(t *testing.T) {
+	plan, err := ReadPlan(writeFile(t, "plan.json", planJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	overrides, err := ReadOverrides(writeFile(t, "overrides.yaml", `allow:
+  - address: google_redis_cluster.cache
+    reason: node type change approved in the change request
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := func(changes []Change) []string {
+		var a []string
+		for _, c := range changes {
+			a = append(a, c.Address)
+		}
+		return a
+	}
+	changes := Inspect(plan)
+	want := []string{
+		`module.alloydb["old-file"].module.alloydb.google_alloydb_cluster.default`,
+		`module.cloudsql["dummy1"].google_sql_database_instance.primary`,
+	}
+	if diff := cmp.Diff(want, addresses(overrides.Blocking(changes, false))); diff != "" {
+		t.Errorf("Blocking(false) mismatch (-want +got):\n%s", diff)
+	}
+	if got := changes[1].String(); !strings.HasSuffix(got, "(allowed: node type change approved in the change request)") {
+		t.Errorf("Blocking() did not record the override: %s", got)
+	}
+	want = append([]string{"google_compute_firewall.old"}, want...)
+	if diff := cmp.Diff(want, addresses(overrides.Blocking(changes, true))); diff != "" {
+		t.Errorf("Blocking(true) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestReadOverridesErrors verifies that entries without a reason are rejected.
+*/
+func TestReadOverridesErrors(t *testing.T) {
+	_, err := ReadOverrides(writeFile(t, "overrides.yaml", "allow:\n  - address: google_redis_cluster.cache\n"))
+	if err == nil || !strings.Contains(err.Error(), "allow entry 0 needs an address and a reason") {
+		t.Errorf("ReadOverrides() = %v, want an error for the missing reason", err)
+	}
+}
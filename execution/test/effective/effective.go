@@ -0,0 +1,332 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package effective reproduces in Go how the locals.tf of a 04-producer or
+// 06-consumer stage turns each YAML file of its configuration folder into
+// the settings of one instance, so that the effective configuration can be
+// reviewed without running a plan.
+//
+// ReadStage parses locals.tf for the fileset pattern that selects the YAML
+// files and for the object built from each of them, where every attribute is
+// either read from the YAML file (instance.x), read with a fallback to a
+// variable default (try(instance.x, var.x)) or computed by another
+// expression. Resolve applies the same selection and fallbacks to a
+// configuration folder, with the defaults of variables.tf, and reports the
+// YAML keys that locals.tf never reads.
+//
+// The defaults are the literal default values of variables.tf: attributes
+// that an optional() type constraint would add to an object default are
+// reported as null, and defaults that are not literals as unknown.
+package effective
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configlint"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Kind is how locals.tf sets an attribute of an instance.
+type Kind string
+
+const (
+	// Required attributes are read from the YAML file, and the plan fails
+	// when the file does not set them.
+	Required Kind = "required"
+	// Fallback attributes are read from the YAML file or, when the file does
+	// not set them, from the default of a variable.
+	Fallback Kind = "fallback"
+	// Optional attributes are read from the YAML file and are null when the
+	// file does not set them.
+	Optional Kind = "optional"
+	// Computed attributes are set by any other expression.
+	Computed Kind = "computed"
+)
+
+// Key is an attribute of the object locals.tf builds for each YAML file.
+type Key struct {
+	// Name is the dotted path of the attribute in the object, for example
+	// "boot_disk.initialize_params.size".
+	Name string
+	Kind Kind
+	// YAML is the dotted path read from the YAML file, empty for Computed
+	// keys.
+	YAML string
+	// Variable is the dotted path of the fallback, for example
+	// "boot_disk.initialize_params.size" for var.boot_disk.initialize_params.size.
+	Variable string
+	// Expression is the source of Computed keys.
+	Expression string
+}
+
+// Stage is what the locals.tf of a stage reads from its YAML files.
+type Stage struct {
+	// Dir is the Terraform directory of the stage.
+	Dir string
+	// Pattern is the fileset pattern selecting the YAML files, for example
+	// "[^_]*.yaml".
+	Pattern string
+	// FilesLocal is the name of the local holding the decoded YAML files, for
+	// example "instances".
+	FilesLocal string
+	// Keys are the attributes of each instance, in locals.tf order.
+	Keys []Key
+	// Reads are the dotted YAML paths locals.tf reads anywhere, including
+	// for_each keys and expressions of Computed keys.
+	Reads []string
+	// Defaults are the literal defaults of the variables of the stage.
+	Defaults map[string]cty.Value
+}
+
+// ReadStage parses the locals.tf and variables of the Terraform directory
+// dir.
+func ReadStage(dir string) (*Stage, error) {
+	path := filepath.Join(dir, "locals.tf")
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	locals := map[string]hclsyntax.Expression{}
+	for _, block := range f.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "locals" {
+			continue
+		}
+		for name, attr := range block.Body.Attributes {
+			locals[name] = attr.Expr
+		}
+	}
+	s := &Stage{Dir: dir}
+	for name, expr := range locals {
+		if pattern, ok := filesetPattern(expr); ok {
+			s.Pattern, s.FilesLocal = pattern, name
+		}
+	}
+	if s.FilesLocal == "" {
+		return nil, fmt.Errorf("%s: no local reads YAML files with fileset", path)
+	}
+	loop := InstanceLoop(locals, s.FilesLocal)
+	if loop == nil {
+		return nil, fmt.Errorf("%s: no for expression iterates over local.%s", path, s.FilesLocal)
+	}
+	p := &parser{src: src, iterator: loop.ValVar}
+	p.reads(loop)
+	if obj := instanceObject(loop.ValExpr); obj != nil {
+		p.object("", obj)
+	}
+	s.Keys, s.Reads = p.keys, p.readPaths
+	if s.Defaults, err = readDefaults(dir); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// filesetPattern returns the pattern of the fileset call in expr, if any.
+func filesetPattern(expr hclsyntax.Expression) (string, bool) {
+	pattern, found := "", false
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		call, ok := node.(*hclsyntax.FunctionCallExpr)
+		if !ok || call.Name != "fileset" || len(call.Args) != 2 {
+			return nil
+		}
+		if v, diags := call.Args[1].Value(nil); !diags.HasErrors() && v.Type() == cty.String {
+			pattern, found = v.AsString(), true
+		}
+		return nil
+	})
+	return pattern, found
+}
+
+// InstanceLoop returns the for expression of locals that iterates over
+// local.files, the local holding the decoded YAML files. A loop building an
+// instance object is preferred over one that only indexes the files, and
+// locals are visited in name order so that the choice is stable.
+func InstanceLoop(locals map[string]hclsyntax.Expression, files string) *hclsyntax.ForExpr {
+	names := make([]string, 0, len(locals))
+	for name := range locals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var first, object *hclsyntax.ForExpr
+	for _, name := range names {
+		hclsyntax.VisitAll(locals[name], func(node hclsyntax.Node) hcl.Diagnostics {
+			f, ok := node.(*hclsyntax.ForExpr)
+			if !ok || object != nil {
+				return nil
+			}
+			for _, t := range f.CollExpr.Variables() {
+				if t.RootName() != "local" || len(t) < 2 {
+					continue
+				}
+				if attr, ok := t[1].(hcl.TraverseAttr); !ok || attr.Name != files {
+					continue
+				}
+				if first == nil {
+					first = f
+				}
+				if instanceObject(f.ValExpr) != nil {
+					object = f
+				}
+			}
+			return nil
+		})
+	}
+	if object != nil {
+		return object
+	}
+	return first
+}
+
+// instanceObject returns the object built for each instance, unwrapping the
+// single-element tuples that are flattened by some stages.
+func instanceObject(expr hclsyntax.Expression) *hclsyntax.ObjectConsExpr {
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		return e
+	case *hclsyntax.TupleConsExpr:
+		if len(e.Exprs) == 1 {
+			return instanceObject(e.Exprs[0])
+		}
+	}
+	return nil
+}
+
+type parser struct {
+	src       []byte
+	iterator  string
+	keys      []Key
+	readPaths []string
+}
+
+// reads records the YAML paths read anywhere in node.
+func (p *parser) reads(node hclsyntax.Node) {
+	seen := map[string]bool{}
+	hclsyntax.VisitAll(node, func(n hclsyntax.Node) hcl.Diagnostics {
+		expr, ok := n.(*hclsyntax.ScopeTraversalExpr)
+		if !ok {
+			return nil
+		}
+		if path, ok := traversalPath(expr.Traversal, p.iterator); ok && !seen[path] {
+			seen[path] = true
+			p.readPaths = append(p.readPaths, path)
+		}
+		return nil
+	})
+}
+
+// object records the keys of obj, prefixing their names with prefix.
+func (p *parser) object(prefix string, obj *hclsyntax.ObjectConsExpr) {
+	for _, item := range obj.Items {
+		name := hcl.ExprAsKeyword(item.KeyExpr)
+		if name == "" {
+			continue
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		p.keys = append(p.keys, p.key(name, item.ValueExpr)...)
+	}
+}
+
+// key returns the keys that expr, the value of attribute name, sets.
+func (p *parser) key(name string, expr hclsyntax.Expression) []Key {
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		before := len(p.keys)
+		p.object(name, e)
+		nested := append([]Key(nil), p.keys[before:]...)
+		p.keys = p.keys[:before]
+		return nested
+	case *hclsyntax.ScopeTraversalExpr:
+		if path, ok := traversalPath(e.Traversal, p.iterator); ok {
+			return []Key{{Name: name, Kind: Required, YAML: path}}
+		}
+	case *hclsyntax.FunctionCallExpr:
+		if e.Name != "try" || len(e.Args) == 0 || len(e.Args) > 2 {
+			break
+		}
+		first, ok := e.Args[0].(*hclsyntax.ScopeTraversalExpr)
+		if !ok {
+			break
+		}
+		path, ok := traversalPath(first.Traversal, p.iterator)
+		if !ok {
+			break
+		}
+		if len(e.Args) == 1 {
+			return []Key{{Name: name, Kind: Optional, YAML: path}}
+		}
+		if second, ok := e.Args[1].(*hclsyntax.ScopeTraversalExpr); ok {
+			if variable, ok := traversalPath(second.Traversal, "var"); ok {
+				return []Key{{Name: name, Kind: Fallback, YAML: path, Variable: variable}}
+			}
+		}
+	}
+	rng := expr.Range()
+	source := strings.Join(strings.Fields(string(p.src[rng.Start.Byte:rng.End.Byte])), " ")
+	return []Key{{Name: name, Kind: Computed, Expression: source}}
+}
+
+// traversalPath returns the dotted path of t after its root, if the root is
+// root, for example "boot_disk.size" for instance.boot_disk.size.
+func traversalPath(t hcl.Traversal, root string) (string, bool) {
+	if t.RootName() != root || len(t) < 2 {
+		return "", false
+	}
+	var parts []string
+	for _, step := range t[1:] {
+		switch s := step.(type) {
+		case hcl.TraverseAttr:
+			parts = append(parts, s.Name)
+		case hcl.TraverseIndex:
+			if s.Key.Type() == cty.String {
+				parts = append(parts, s.Key.AsString())
+			} else if s.Key.Type() == cty.Number {
+				parts = append(parts, s.Key.AsBigFloat().String())
+			} else {
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+	return strings.Join(parts, "."), true
+}
+
+// readDefaults returns the default values of the variables of dir, unknown
+// for required variables and defaults that are not literals.
+func readDefaults(dir string) (map[string]cty.Value, error) {
+	vars, err := configlint.ReadVariables(dir)
+	if err != nil {
+		return nil, err
+	}
+	defaults := map[string]cty.Value{}
+	for name, v := range vars {
+		if v.Default == cty.NilVal {
+			defaults[name] = cty.DynamicVal
+		} else {
+			defaults[name] = v.Default
+		}
+	}
+	return defaults, nil
+}
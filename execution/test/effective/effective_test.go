@@ -0,0 +1,215 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effective
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeFiles writes files, keyed by name, to a temporary directory and
+// returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const localsTF = `locals {
+  config_folder_path = var.config_folder_path
+  instances          = [for file in fileset(local.config_folder_path, "[^_]*.yaml") : yamldecode(file("${local.config_folder_path}/${file}"))]
+  instance_list = flatten([
+    for instance in try(local.instances, []) : {
+      name   = instance.name
+      region = try(instance.region, var.region)
+      count  = try(instance.count)
+      boot_disk = {
+        size = try(instance.boot_disk.size, var.boot_disk.size)
+        type = try(instance.boot_disk.type, var.boot_disk.type)
+      }
+      labels  = merge(var.labels, try(instance.labels, {}))
+      project = var.project_id
+    }
+  ])
+  instance_map = { for instance in local.instance_list : instance.name => instance }
+}
+`
+
+const variablesTF = `variable "config_folder_path" {
+  type = string
+}
+
+variable "region" {
+  type    = string
+  default = "us-central1"
+}
+
+variable "boot_disk" {
+  type = object({
+    size = optional(number, 10)
+    type = optional(string)
+  })
+  default = {
+    size = 10
+  }
+}
+
+variable "labels" {
+  type    = map(string)
+  default = {}
+}
+
+variable "project_id" {
+  type = string
+}
+`
+
+/*
+TestReadStage verifies that the fileset pattern and the keys of the instance
+object are read from locals.tf with how each key is set.
+*/
+func TestReadStage(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"locals.tf": localsTF, "variables.tf": variablesTF})
+	s, err := ReadStage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Pattern != "[^_]*.yaml" || s.FilesLocal != "instances" {
+		t.Errorf("ReadStage() pattern = %q and files local = %q, want [^_]*.yaml and instances", s.Pattern, s.FilesLocal)
+	}
+	want := []Key{
+		{Name: "name", Kind: Required, YAML: "name"},
+		{Name: "region", Kind: Fallback, YAML: "region", Variable: "region"},
+		{Name: "count", Kind: Optional, YAML: "count"},
+		{Name: "boot_disk.size", Kind: Fallback, YAML: "boot_disk.size", Variable: "boot_disk.size"},
+		{Name: "boot_disk.type", Kind: Fallback, YAML: "boot_disk.type", Variable: "boot_disk.type"},
+		{Name: "labels", Kind: Computed, Expression: "merge(var.labels, try(instance.labels, {}))"},
+		{Name: "project", Kind: Computed, Expression: "var.project_id"},
+	}
+	if diff := cmp.Diff(want, s.Keys); diff != "" {
+		t.Errorf("ReadStage() keys mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestResolve verifies that each selected YAML file gets the value of the file,
+the default of the variable or null, with its source, and that keys never
+read are reported.
+*/
+func TestResolve(t *testing.T) {
+	stageDir := writeFiles(t, map[string]string{"locals.tf": localsTF, "variables.tf": variablesTF})
+	s, err := ReadStage(stageDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configDir := writeFiles(t, map[string]string{
+		"a.yaml": `name: a
+region: europe-west1
+boot_disk:
+  type: pd-ssd
+  sizee: 20
+labels:
+  team: net
+zone: europe-west1-b
+`,
+		"b.yaml":         "region: null\n",
+		"_disabled.yaml": "name: disabled\n",
+		"c.yaml.example": "name: c\n",
+	})
+	selected, ignored, err := s.Files(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{filepath.Join(configDir, "_disabled.yaml")}, ignored); diff != "" {
+		t.Errorf("Files() ignored mismatch (-want +got):\n%s", diff)
+	}
+	if len(selected) != 2 {
+		t.Errorf("Files() selected = %v, want a.yaml and b.yaml", selected)
+	}
+	instances, err := s.Resolve(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := Value{Key: "labels", Source: FromExpression, Detail: "merge(var.labels, try(instance.labels, {}))"}
+	project := Value{Key: "project", Source: FromExpression, Detail: "var.project_id"}
+	want := []Instance{
+		{
+			File: filepath.Join(configDir, "a.yaml"),
+			Values: []Value{
+				{Key: "name", Value: "a", Source: FromYAML},
+				{Key: "region", Value: "europe-west1", Source: FromYAML},
+				{Key: "count", Source: Unset},
+				{Key: "boot_disk.size", Value: float64(10), Source: FromDefault, Detail: "var.boot_disk.size"},
+				{Key: "boot_disk.type", Value: "pd-ssd", Source: FromYAML},
+				labels,
+				project,
+			},
+			Unread: []string{"boot_disk.sizee", "zone"},
+		},
+		{
+			File: filepath.Join(configDir, "b.yaml"),
+			Values: []Value{
+				{Key: "name", Source: Missing},
+				{Key: "region", Source: FromYAML},
+				{Key: "count", Source: Unset},
+				{Key: "boot_disk.size", Value: float64(10), Source: FromDefault, Detail: "var.boot_disk.size"},
+				{Key: "boot_disk.type", Source: FromDefault, Detail: "var.boot_disk.type"},
+				labels,
+				project,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, instances); diff != "" {
+		t.Errorf("Resolve() mismatch (-want +got):\n%s", diff)
+	}
+	examples, err := s.Examples(configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{filepath.Join(configDir, "c.yaml.example")}, examples); diff != "" {
+		t.Errorf("Examples() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestReadStageAllStages verifies that the locals.tf of every stage with a
+configuration folder can be read, so that effectiveconfig keeps working
+when a stage changes.
+*/
+func TestReadStageAllStages(t *testing.T) {
+	for _, st := range stages.All {
+		if st.Config == "" {
+			continue
+		}
+		t.Run(st.Name, func(t *testing.T) {
+			s, err := ReadStage(st.TerraformDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Pattern == "" || len(s.Keys) == 0 {
+				t.Errorf("ReadStage() = pattern %q and %d keys, want a pattern and keys", s.Pattern, len(s.Keys))
+			}
+		})
+	}
+}
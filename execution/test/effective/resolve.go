@@ -0,0 +1,292 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package effective
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+// Source is where the effective value of a key comes from.
+type Source string
+
+const (
+	// FromYAML values are set by the YAML file.
+	FromYAML Source = "yaml"
+	// FromDefault values are the default of a variable.
+	FromDefault Source = "default"
+	// Unset values are null because neither the YAML file nor a default
+	// sets them.
+	Unset Source = "unset"
+	// Missing values are required keys the YAML file does not set, which
+	// fail the plan.
+	Missing Source = "missing"
+	// FromExpression values are computed by locals.tf and not evaluated.
+	FromExpression Source = "expression"
+)
+
+// Value is the effective value of a key of an instance.
+type Value struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source Source `json:"source"`
+	// Detail is the variable of a default, for example "var.region", or the
+	// expression of a computed value.
+	Detail string `json:"detail,omitempty"`
+	// Unknown is true when the value is only known at plan time, because the
+	// default is not a literal or the variable is required.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// Instance is the effective configuration of one YAML file.
+type Instance struct {
+	File   string  `json:"file"`
+	Values []Value `json:"values"`
+	// Unread lists the YAML keys, as dotted paths, that locals.tf never
+	// reads and so have no effect.
+	Unread []string `json:"unread,omitempty"`
+}
+
+// Files returns the YAML files of configDir that the fileset pattern of s
+// selects, in the order Terraform iterates over them, and the other YAML
+// files, which Terraform ignores.
+func (s *Stage) Files(configDir string) (selected, ignored []string, err error) {
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(configDir, e.Name())
+		ok, err := filepath.Match(s.Pattern, e.Name())
+		if err != nil {
+			return nil, nil, fmt.Errorf("fileset pattern %q: %w", s.Pattern, err)
+		}
+		switch {
+		case ok:
+			selected = append(selected, path)
+		case strings.HasSuffix(e.Name(), ".yaml") || strings.HasSuffix(e.Name(), ".yml"):
+			ignored = append(ignored, path)
+		}
+	}
+	return selected, ignored, nil
+}
+
+// Examples returns the *.yaml.example files of configDir that the fileset
+// pattern of s would select once copied without the .example suffix.
+func (s *Stage) Examples(configDir string) ([]string, error) {
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		return nil, err
+	}
+	var examples []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".example")
+		if e.IsDir() || !ok {
+			continue
+		}
+		if ok, err := filepath.Match(s.Pattern, name); err != nil {
+			return nil, fmt.Errorf("fileset pattern %q: %w", s.Pattern, err)
+		} else if ok {
+			examples = append(examples, filepath.Join(configDir, e.Name()))
+		}
+	}
+	return examples, nil
+}
+
+// Resolve returns the effective configuration of each YAML file configDir
+// selects.
+func (s *Stage) Resolve(configDir string) ([]Instance, error) {
+	files, _, err := s.Files(configDir)
+	if err != nil {
+		return nil, err
+	}
+	return s.ResolveFiles(files)
+}
+
+// ResolveFiles returns the effective configuration of each YAML file of
+// files.
+func (s *Stage) ResolveFiles(files []string) ([]Instance, error) {
+	var instances []Instance
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		instance := s.ResolveDocument(doc)
+		instance.File = file
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// ResolveDocument returns the effective configuration of a decoded YAML
+// document.
+func (s *Stage) ResolveDocument(doc map[string]any) Instance {
+	var instance Instance
+	for _, k := range s.Keys {
+		v := Value{Key: k.Name}
+		yamlValue, set := lookup(doc, k.YAML)
+		switch {
+		case k.Kind == Computed:
+			v.Source, v.Detail = FromExpression, k.Expression
+		case set:
+			v.Source, v.Value = FromYAML, yamlValue
+		case k.Kind == Required:
+			v.Source = Missing
+		case k.Kind == Optional:
+			v.Source = Unset
+		default:
+			v.Source, v.Detail = FromDefault, "var."+k.Variable
+			v.Value, v.Unknown = s.defaultValue(k.Variable)
+		}
+		instance.Values = append(instance.Values, v)
+	}
+	instance.Unread = s.unread(doc, "")
+	return instance
+}
+
+// lookup returns the value at the dotted path of doc, and whether it is
+// set. A key set to null is set, as try() returns the null.
+func lookup(doc any, path string) (any, bool) {
+	v := doc
+	for _, part := range strings.Split(path, ".") {
+		switch c := v.(type) {
+		case map[string]any:
+			next, ok := c[part]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// defaultValue returns the default of the variable at the dotted path, and
+// whether it is unknown.
+func (s *Stage) defaultValue(path string) (any, bool) {
+	parts := strings.Split(path, ".")
+	v, ok := s.Defaults[parts[0]]
+	if !ok || !v.IsWhollyKnown() {
+		return nil, true
+	}
+	for _, part := range parts[1:] {
+		if v.IsNull() {
+			return nil, false
+		}
+		switch {
+		case v.Type().IsObjectType():
+			if !v.Type().HasAttribute(part) {
+				return nil, false
+			}
+			v = v.GetAttr(part)
+		case v.Type().IsMapType():
+			key := cty.StringVal(part)
+			if v.HasIndex(key).False() {
+				return nil, false
+			}
+			v = v.Index(key)
+		case v.Type().IsTupleType() || v.Type().IsListType():
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= v.LengthInt() {
+				return nil, false
+			}
+			v = v.Index(cty.NumberIntVal(int64(i)))
+		default:
+			return nil, false
+		}
+	}
+	if v.IsNull() {
+		return nil, false
+	}
+	encoded, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		return nil, true
+	}
+	var decoded any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, true
+	}
+	return decoded, false
+}
+
+// unread returns the keys of doc under prefix that locals.tf does not read.
+func (s *Stage) unread(doc map[string]any, prefix string) []string {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var unread []string
+	for _, key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if s.read(path) {
+			continue
+		}
+		if child, ok := doc[key].(map[string]any); ok && s.readBelow(path) {
+			unread = append(unread, s.unread(child, path)...)
+			continue
+		}
+		unread = append(unread, path)
+	}
+	return unread
+}
+
+// read reports whether locals.tf reads path or a parent of it.
+func (s *Stage) read(path string) bool {
+	for _, r := range s.Reads {
+		if path == r || strings.HasPrefix(path, r+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// readBelow reports whether locals.tf reads a key below path.
+func (s *Stage) readBelow(path string) bool {
+	for _, r := range s.Reads {
+		if strings.HasPrefix(r, path+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firewall
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Severity is the severity of a Finding, named after the SARIF levels.
+type Severity string
+
+const (
+	// Error marks exposure that should not be deployed.
+	Error Severity = "error"
+	// Warning marks a rule that does something other than it appears to.
+	Warning Severity = "warning"
+	// Note marks a rule that has no effect.
+	Note Severity = "note"
+)
+
+// Checks reported in Finding.Check.
+const (
+	CheckInvalidRule   = "invalid-rule"
+	CheckAdminExposure = "admin-port-exposed"
+	CheckExcessPorts   = "excess-ports"
+	CheckShadowed      = "shadowed-rule"
+	CheckRedundant     = "redundant-rule"
+	CheckDenyOverride  = "deny-overrides-allow"
+)
+
+// CheckDescriptions describes each check, for the rules of a SARIF report.
+var CheckDescriptions = map[string]string{
+	CheckInvalidRule:   "Firewall rule cannot be expanded.",
+	CheckAdminExposure: "Administrative port open to the internet.",
+	CheckExcessPorts:   "Firewall rule opens more ports than the product needs.",
+	CheckShadowed:      "Firewall rule never applies because a rule of higher priority takes the opposite action first.",
+	CheckRedundant:     "Firewall rule has no effect because another rule already takes the same action.",
+	CheckDenyOverride:  "Deny rule overrides an allow rule of the same priority.",
+}
+
+// Finding is one risky exposure or ineffective rule.
+type Finding struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line,omitempty"`
+	Column   int      `json:"column,omitempty"`
+	Rule     string   `json:"rule,omitempty"`
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	Message  string   `json:"message"`
+}
+
+// String formats f as "file:line:column: severity: message [check]".
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", f.File, f.Line, f.Column, f.Severity, f.Message, f.Check)
+}
+
+// AdminPorts are the TCP ports of remote administration protocols that must
+// not be reachable from the internet.
+var AdminPorts = map[int]string{
+	22:   "SSH",
+	3389: "RDP",
+	5985: "WinRM",
+	5986: "WinRM over HTTPS",
+}
+
+// Product is what a 03-security stage opens the network for.
+type Product struct {
+	Name string
+	// Traffic is the protocols and ports the product needs.
+	Traffic []Traffic
+}
+
+// Products lists the products of the 03-security stages by stage name.
+// security/gce opens ports for workloads of any kind and has no product.
+var Products = map[string]Product{
+	"security/alloydb": {Name: "AlloyDB", Traffic: []Traffic{
+		{Protocol: "tcp", Ports: []PortRange{{5432, 5432}}},
+	}},
+	"security/cloudsql": {Name: "Cloud SQL", Traffic: []Traffic{
+		{Protocol: "tcp", Ports: []PortRange{{3306, 3306}, {5432, 5432}, {1433, 1433}}},
+	}},
+	"security/mrc": {Name: "Memorystore for Redis Cluster", Traffic: []Traffic{
+		{Protocol: "tcp", Ports: []PortRange{{6379, 6379}, {11000, 13047}}},
+	}},
+}
+
+// internet lists the ranges that match every address.
+var internet = []netip.Prefix{anyIPv4, netip.MustParsePrefix("::/0")}
+
+// Analyze reports admin ports open to the internet, allow rules opening
+// more than product needs, unless product is nil, rules that never apply
+// because of a rule evaluated before them and deny rules overriding allow
+// rules of the same priority. Disabled rules are ignored.
+func Analyze(rules []Rule, product *Product) []Finding {
+	var enabled []Rule
+	for _, r := range rules {
+		if !r.Disabled {
+			enabled = append(enabled, r)
+		}
+	}
+	var findings []Finding
+	for _, r := range enabled {
+		findings = append(findings, adminExposure(r)...)
+		if product != nil {
+			findings = append(findings, excessPorts(r, *product)...)
+		}
+		findings = append(findings, precedence(r, enabled)...)
+	}
+	Sort(findings)
+	return findings
+}
+
+func finding(r Rule, severity Severity, check, format string, args ...any) Finding {
+	return Finding{
+		File:     r.File,
+		Line:     r.Line,
+		Column:   r.Column,
+		Rule:     r.Name,
+		Severity: severity,
+		Check:    check,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func adminExposure(r Rule) []Finding {
+	if r.Deny || r.Direction != Ingress {
+		return nil
+	}
+	var open netip.Prefix
+	for _, p := range r.SourceRanges {
+		for _, q := range internet {
+			if p == q {
+				open = p
+			}
+		}
+	}
+	if !open.IsValid() {
+		return nil
+	}
+	var ports []int
+	for port := range AdminPorts {
+		if len(uncovered(r.Traffic, Traffic{Protocol: "tcp", Ports: []PortRange{{port, port}}})) == 0 {
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+	var findings []Finding
+	for _, port := range ports {
+		findings = append(findings, finding(r, Error, CheckAdminExposure, "%s allows %s (tcp:%d) from %s",
+			r.Name, AdminPorts[port], port, open))
+	}
+	return findings
+}
+
+func excessPorts(r Rule, product Product) []Finding {
+	if r.Deny {
+		return nil
+	}
+	var extra []string
+	for _, t := range r.Traffic {
+		for _, u := range uncovered(product.Traffic, t) {
+			extra = append(extra, u.String())
+		}
+	}
+	if len(extra) == 0 {
+		return nil
+	}
+	var needs []string
+	for _, t := range product.Traffic {
+		needs = append(needs, t.String())
+	}
+	return []Finding{finding(r, Warning, CheckExcessPorts, "%s opens %s, more than the %s %s needs",
+		r.Name, strings.Join(extra, " "), strings.Join(needs, " "), product.Name)}
+}
+
+// precedence reports r if a rule evaluated before it matches all its
+// traffic, or if a deny rule of the same priority overrides part of it.
+func precedence(r Rule, rules []Rule) []Finding {
+	var findings []Finding
+	for _, other := range rules {
+		if other.Name == r.Name || other.Direction != r.Direction {
+			continue
+		}
+		switch {
+		case other.Priority < r.Priority && covers(other, r):
+			if other.Deny == r.Deny {
+				findings = append(findings, finding(r, Note, CheckRedundant,
+					"%s is redundant: %s at priority %d already %s all its traffic",
+					r.Name, other.Name, other.Priority, other.action()))
+			} else {
+				findings = append(findings, finding(r, Warning, CheckShadowed,
+					"%s never applies: %s at priority %d %s all its traffic first",
+					r.Name, other.Name, other.Priority, other.action()))
+			}
+		case other.Priority == r.Priority && other.Deny == r.Deny && covers(other, r) &&
+			(!covers(r, other) || other.Name < r.Name):
+			// Of two identical rules only the second one is reported.
+			findings = append(findings, finding(r, Note, CheckRedundant,
+				"%s is redundant: %s at the same priority %d already %s all its traffic",
+				r.Name, other.Name, other.Priority, other.action()))
+		case other.Priority == r.Priority && other.Deny && !r.Deny && overlaps(r, other):
+			findings = append(findings, finding(r, Warning, CheckDenyOverride,
+				"%s is overridden by deny rule %s at the same priority %d for the traffic both match",
+				r.Name, other.Name, r.Priority))
+		}
+	}
+	return findings
+}
+
+// Sort sorts findings by file, position, rule, check and message.
+func Sort(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		if a.Check != b.Check {
+			return a.Check < b.Check
+		}
+		return a.Message < b.Message
+	})
+}
+
+// HasErrors reports whether any finding has severity Error.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyzeTFVars reads the rules of the tfvars file at path with ReadTFVars
+// and analyzes them with Analyze, returning the findings of both.
+func AnalyzeTFVars(path string, product *Product) ([]Finding, error) {
+	rules, findings, err := ReadTFVars(path)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, Analyze(rules, product)...)
+	Sort(findings)
+	return findings, nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firewall
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// tcp returns TCP traffic to ports.
+func tcp(ports ...PortRange) Traffic {
+	return Traffic{Protocol: "tcp", Ports: ports}
+}
+
+/*
+TestAnalyze verifies each check of Analyze on a small set of rules and the
+message it reports.
+*/
+func TestAnalyze(t *testing.T) {
+	alloydb := Products["security/alloydb"]
+	tests := []struct {
+		name    string
+		rules   []Rule
+		product *Product
+		want    []string
+	}{
+		{
+			name: "SSH and RDP open to the internet",
+			rules: []Rule{
+				{Name: "allow-admin", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "0.0.0.0/0"), Traffic: []Traffic{tcp(PortRange{22, 22}, PortRange{3389, 3389})}},
+				{Name: "allow-internal-ssh", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "10.0.0.0/8"), Traffic: []Traffic{tcp(PortRange{22, 22})}},
+			},
+			want: []string{
+				"allow-admin: error: allow-admin allows RDP (tcp:3389) from 0.0.0.0/0 [admin-port-exposed]",
+				"allow-admin: error: allow-admin allows SSH (tcp:22) from 0.0.0.0/0 [admin-port-exposed]",
+				"allow-internal-ssh: note: allow-internal-ssh is redundant: allow-admin at the same priority 1000 already allows all its traffic [redundant-rule]",
+			},
+		},
+		{
+			name: "all protocols open to the internet",
+			rules: []Rule{
+				{Name: "allow-all", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "::/0"), Traffic: []Traffic{{Protocol: "all"}}},
+			},
+			want: []string{
+				"allow-all: error: allow-all allows RDP (tcp:3389) from ::/0 [admin-port-exposed]",
+				"allow-all: error: allow-all allows SSH (tcp:22) from ::/0 [admin-port-exposed]",
+				"allow-all: error: allow-all allows WinRM (tcp:5985) from ::/0 [admin-port-exposed]",
+				"allow-all: error: allow-all allows WinRM over HTTPS (tcp:5986) from ::/0 [admin-port-exposed]",
+			},
+		},
+		{
+			name: "disabled and deny rules are not exposure",
+			rules: []Rule{
+				{Name: "disabled", Direction: Ingress, Priority: 1000, Disabled: true, SourceRanges: prefixes(t, "0.0.0.0/0"), Traffic: []Traffic{tcp(PortRange{22, 22})}},
+				{Name: "deny-ssh", Direction: Ingress, Priority: 1000, Deny: true, SourceRanges: prefixes(t, "0.0.0.0/0"), Traffic: []Traffic{tcp(PortRange{22, 22})}},
+			},
+		},
+		{
+			name: "more ports than AlloyDB needs",
+			rules: []Rule{
+				{Name: "allow-db", Direction: Egress, Priority: 1000, DestinationRanges: prefixes(t, "0.0.0.0/0"), Traffic: []Traffic{tcp(PortRange{5432, 5432}, PortRange{3306, 3306}), {Protocol: "icmp"}}},
+				{Name: "allow-postgres", Direction: Ingress, Priority: 900, SourceRanges: prefixes(t, "10.0.0.0/8"), Traffic: []Traffic{tcp(PortRange{5432, 5432})}},
+			},
+			product: &alloydb,
+			want: []string{
+				"allow-db: warning: allow-db opens tcp:3306 icmp, more than the tcp:5432 AlloyDB needs [excess-ports]",
+			},
+		},
+		{
+			name: "shadowed by a deny of higher priority",
+			rules: []Rule{
+				{Name: "deny-all", Direction: Ingress, Priority: 100, Deny: true, SourceRanges: prefixes(t, "0.0.0.0/0"), Traffic: []Traffic{{Protocol: "all"}}},
+				{Name: "allow-postgres", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "10.0.0.0/8"), Targets: []string{"db"}, Traffic: []Traffic{tcp(PortRange{5432, 5432})}},
+			},
+			want: []string{
+				"allow-postgres: warning: allow-postgres never applies: deny-all at priority 100 denies all its traffic first [shadowed-rule]",
+			},
+		},
+		{
+			name: "redundant with a broader allow",
+			rules: []Rule{
+				{Name: "allow-wide", Direction: Ingress, Priority: 500, SourceRanges: prefixes(t, "10.0.0.0/8"), Traffic: []Traffic{tcp(PortRange{5000, 6000})}},
+				{Name: "allow-narrow", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "10.1.0.0/16"), Targets: []string{"db"}, Traffic: []Traffic{tcp(PortRange{5432, 5432})}},
+				{Name: "allow-copy-a", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "192.168.0.0/16"), Traffic: []Traffic{tcp(PortRange{80, 80})}},
+				{Name: "allow-copy-b", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "192.168.0.0/16"), Traffic: []Traffic{tcp(PortRange{80, 80})}},
+			},
+			want: []string{
+				"allow-copy-b: note: allow-copy-b is redundant: allow-copy-a at the same priority 1000 already allows all its traffic [redundant-rule]",
+				"allow-narrow: note: allow-narrow is redundant: allow-wide at priority 500 already allows all its traffic [redundant-rule]",
+			},
+		},
+		{
+			name: "not covered when the broader rule targets fewer instances",
+			rules: []Rule{
+				{Name: "deny-tagged", Direction: Ingress, Priority: 100, Deny: true, SourceRanges: prefixes(t, "0.0.0.0/0"), Targets: []string{"db"}, Traffic: []Traffic{{Protocol: "all"}}},
+				{Name: "allow-postgres", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "10.0.0.0/8"), Traffic: []Traffic{tcp(PortRange{5432, 5432})}},
+			},
+		},
+		{
+			name: "deny overrides allow at the same priority",
+			rules: []Rule{
+				{Name: "allow-web", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "10.0.0.0/8"), Traffic: []Traffic{tcp(PortRange{80, 80}, PortRange{443, 443})}},
+				{Name: "deny-http", Direction: Ingress, Priority: 1000, Deny: true, SourceRanges: prefixes(t, "10.1.0.0/16"), Traffic: []Traffic{tcp(PortRange{80, 80})}},
+				{Name: "deny-other-range", Direction: Ingress, Priority: 1000, Deny: true, SourceRanges: prefixes(t, "172.16.0.0/12"), Traffic: []Traffic{tcp(PortRange{80, 80})}},
+				{Name: "deny-egress", Direction: Egress, Priority: 1000, Deny: true, DestinationRanges: prefixes(t, "0.0.0.0/0"), Traffic: []Traffic{{Protocol: "all"}}},
+			},
+			want: []string{
+				"allow-web: warning: allow-web is overridden by deny rule deny-http at the same priority 1000 for the traffic both match [deny-overrides-allow]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, f := range Analyze(tt.rules, tt.product) {
+				got = append(got, f.Rule+": "+string(f.Severity)+": "+f.Message+" ["+f.Check+"]")
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Analyze() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+/*
+TestWriteSARIF verifies that findings are written as SARIF results with the
+check as rule ID, the severity as level and the tfvars line as region.
+*/
+func TestWriteSARIF(t *testing.T) {
+	findings := []Finding{
+		{File: "configuration/security/gce.tfvars", Line: 3, Column: 3, Rule: "allow-ssh", Severity: Error, Check: CheckAdminExposure, Message: "allow-ssh allows SSH (tcp:22) from 0.0.0.0/0"},
+		{File: "plan.json#google_compute_firewall.a", Rule: "a", Severity: Note, Check: CheckRedundant, Message: "a is redundant"},
+	}
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, "firewallaudit", findings); err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string `json:"name"`
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region *struct {
+							StartLine int `json:"startLine"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("WriteSARIF() wrote invalid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || log.Runs[0].Tool.Driver.Name != "firewallaudit" {
+		t.Fatalf("WriteSARIF() = %s, want one 2.1.0 run of firewallaudit", buf.String())
+	}
+	run := log.Runs[0]
+	if got, want := len(run.Tool.Driver.Rules), len(CheckDescriptions); got != want {
+		t.Errorf("WriteSARIF() declared %d rules, want %d", got, want)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("WriteSARIF() wrote %d results, want 2", len(run.Results))
+	}
+	first, second := run.Results[0], run.Results[1]
+	if first.RuleID != CheckAdminExposure || first.Level != "error" ||
+		first.Locations[0].PhysicalLocation.ArtifactLocation.URI != "configuration/security/gce.tfvars" ||
+		first.Locations[0].PhysicalLocation.Region == nil || first.Locations[0].PhysicalLocation.Region.StartLine != 3 {
+		t.Errorf("WriteSARIF() first result = %+v", first)
+	}
+	if second.Level != "note" || second.Locations[0].PhysicalLocation.ArtifactLocation.URI != "plan.json" ||
+		second.Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("WriteSARIF() second result = %+v", second)
+	}
+}
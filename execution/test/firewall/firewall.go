@@ -0,0 +1,358 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package firewall reads the firewall rules of the 03-security stages from
+// their tfvars files or from a terraform plan, expanded the way the
+// net-vpc-firewall module of Cloud Foundation Fabric expands them, and
+// analyzes them for risky exposure: admin ports open to the internet, ports
+// beyond what the product of the stage needs, rules that never apply
+// because of another rule, and deny rules overriding allow rules of the
+// same priority.
+package firewall
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Direction is the direction of the traffic a Rule matches.
+type Direction string
+
+const (
+	Ingress Direction = "INGRESS"
+	Egress  Direction = "EGRESS"
+)
+
+// DefaultPriority is the priority of rules that do not set one.
+const DefaultPriority = 1000
+
+// Rule is one expanded firewall rule.
+type Rule struct {
+	Name      string
+	Direction Direction
+	Deny      bool
+	Priority  int64
+	Disabled  bool
+	// SourceRanges and SourceTags select the sources of the traffic. Both
+	// are empty when the rule matches any source.
+	SourceRanges []netip.Prefix
+	SourceTags   []string
+	// DestinationRanges is empty when the rule matches any destination.
+	DestinationRanges []netip.Prefix
+	// Targets are the network tags, or service accounts when
+	// UseServiceAccounts is set, of the instances the rule applies to.
+	// Targets is empty when the rule applies to all instances.
+	Targets            []string
+	UseServiceAccounts bool
+	Traffic            []Traffic
+	// File, Line and Column locate the rule in its tfvars file, or name the
+	// plan and resource address it was read from.
+	File   string
+	Line   int
+	Column int
+}
+
+// action returns "allows" or "denies".
+func (r Rule) action() string {
+	if r.Deny {
+		return "denies"
+	}
+	return "allows"
+}
+
+// Traffic is a protocol and the ports of it a rule matches.
+type Traffic struct {
+	// Protocol is a lowercase protocol name such as "tcp", or "all".
+	Protocol string
+	// Ports is empty when all ports of Protocol are matched.
+	Ports []PortRange
+}
+
+// String formats t as "tcp:22,80-81", "udp" or "all".
+func (t Traffic) String() string {
+	if len(t.Ports) == 0 {
+		return t.Protocol
+	}
+	var ports []string
+	for _, p := range t.Ports {
+		ports = append(ports, p.String())
+	}
+	return t.Protocol + ":" + strings.Join(ports, ",")
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	From, To int
+}
+
+// String formats p as "22" or "11000-13047".
+func (p PortRange) String() string {
+	if p.From == p.To {
+		return strconv.Itoa(p.From)
+	}
+	return fmt.Sprintf("%d-%d", p.From, p.To)
+}
+
+// ParsePortRange parses a port or a port range such as "11000-13047".
+func ParsePortRange(s string) (PortRange, error) {
+	from, to, found := strings.Cut(strings.TrimSpace(s), "-")
+	if !found {
+		to = from
+	}
+	f, err1 := strconv.Atoi(from)
+	t, err2 := strconv.Atoi(to)
+	if err1 != nil || err2 != nil || f < 0 || t > 65535 || f > t {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{From: f, To: t}, nil
+}
+
+// protocolNames maps the IANA protocol numbers the API accepts in place of
+// names to the names used by Traffic.
+var protocolNames = map[string]string{
+	"1": "icmp", "6": "tcp", "17": "udp", "47": "gre", "50": "esp", "51": "ah", "132": "sctp",
+}
+
+// ParseTraffic parses the protocol and ports of a rule.
+func ParseTraffic(protocol string, ports []string) (Traffic, error) {
+	protocol = strings.ToLower(strings.TrimSpace(protocol))
+	if name, ok := protocolNames[protocol]; ok {
+		protocol = name
+	}
+	if protocol == "" {
+		return Traffic{}, fmt.Errorf("empty protocol")
+	}
+	t := Traffic{Protocol: protocol}
+	for _, p := range ports {
+		r, err := ParsePortRange(p)
+		if err != nil {
+			return Traffic{}, err
+		}
+		t.Ports = append(t.Ports, r)
+	}
+	if len(t.Ports) > 0 && protocol != "tcp" && protocol != "udp" && protocol != "sctp" {
+		return Traffic{}, fmt.Errorf("protocol %s does not take ports", protocol)
+	}
+	return t, nil
+}
+
+// AnySource reports whether r matches traffic from any source.
+func (r Rule) AnySource() bool {
+	return len(r.SourceRanges) == 0 && len(r.SourceTags) == 0
+}
+
+// covers reports whether every packet a matches is matched by b.
+func covers(b, a Rule) bool {
+	return coversSources(b, a) &&
+		coversRanges(b.DestinationRanges, a.DestinationRanges) &&
+		coversTargets(b, a) &&
+		coversTraffic(b.Traffic, a.Traffic)
+}
+
+// overlaps reports whether a packet may be matched by both a and b. Sources
+// and targets selected by tags may overlap with sources selected by ranges,
+// so they are assumed to.
+func overlaps(a, b Rule) bool {
+	return overlapsSources(a, b) &&
+		overlapsRanges(a.DestinationRanges, b.DestinationRanges) &&
+		overlapsStrings(a.Targets, b.Targets, a.UseServiceAccounts != b.UseServiceAccounts) &&
+		overlapsTraffic(a.Traffic, b.Traffic)
+}
+
+func coversSources(b, a Rule) bool {
+	if b.AnySource() {
+		return true
+	}
+	if a.AnySource() {
+		return false
+	}
+	return coversPrefixes(b.SourceRanges, a.SourceRanges) && coversStrings(b.SourceTags, a.SourceTags)
+}
+
+func overlapsSources(a, b Rule) bool {
+	if a.AnySource() || b.AnySource() {
+		return true
+	}
+	if len(a.SourceTags) > 0 || len(b.SourceTags) > 0 {
+		if len(a.SourceRanges) > 0 || len(b.SourceRanges) > 0 {
+			return true
+		}
+		return overlapsStrings(a.SourceTags, b.SourceTags, false)
+	}
+	return overlapsRanges(a.SourceRanges, b.SourceRanges)
+}
+
+// coversRanges reports whether ranges b match every address ranges a match,
+// where no ranges match any address.
+func coversRanges(b, a []netip.Prefix) bool {
+	if len(b) == 0 {
+		return true
+	}
+	return len(a) > 0 && coversPrefixes(b, a)
+}
+
+// coversPrefixes reports whether each prefix of a is inside a prefix of b.
+func coversPrefixes(b, a []netip.Prefix) bool {
+	for _, p := range a {
+		inside := false
+		for _, q := range b {
+			if q.Bits() <= p.Bits() && q.Contains(p.Addr()) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return false
+		}
+	}
+	return true
+}
+
+func overlapsRanges(a, b []netip.Prefix) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, p := range a {
+		for _, q := range b {
+			if p.Overlaps(q) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func coversTargets(b, a Rule) bool {
+	if len(b.Targets) == 0 {
+		return true
+	}
+	return len(a.Targets) > 0 && a.UseServiceAccounts == b.UseServiceAccounts && coversStrings(b.Targets, a.Targets)
+}
+
+// coversStrings reports whether b contains every element of a.
+func coversStrings(b, a []string) bool {
+	for _, s := range a {
+		if !contains(b, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// overlapsStrings reports whether sets a and b, where an empty set matches
+// everything, may match the same instance. Sets of different kinds, tags
+// and service accounts, are assumed to.
+func overlapsStrings(a, b []string, differentKinds bool) bool {
+	if len(a) == 0 || len(b) == 0 || differentKinds {
+		return true
+	}
+	for _, s := range a {
+		if contains(b, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// coversTraffic reports whether b matches all the traffic a matches.
+func coversTraffic(b, a []Traffic) bool {
+	for _, t := range a {
+		if len(uncovered(b, t)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// uncovered returns the parts of t that no traffic of b matches.
+func uncovered(b []Traffic, t Traffic) []Traffic {
+	var ranges []PortRange
+	for _, u := range b {
+		if u.Protocol == "all" || (u.Protocol == t.Protocol && len(u.Ports) == 0) {
+			return nil
+		}
+		if u.Protocol == t.Protocol {
+			ranges = append(ranges, u.Ports...)
+		}
+	}
+	if t.Protocol == "all" || len(ranges) == 0 {
+		return []Traffic{t}
+	}
+	want := t.Ports
+	if len(want) == 0 {
+		want = []PortRange{{From: 0, To: 65535}}
+	}
+	var rest []PortRange
+	for _, p := range want {
+		rest = append(rest, subtract(p, ranges)...)
+	}
+	if len(rest) == 0 {
+		return nil
+	}
+	return []Traffic{{Protocol: t.Protocol, Ports: rest}}
+}
+
+// subtract returns the parts of p outside ranges.
+func subtract(p PortRange, ranges []PortRange) []PortRange {
+	rest := []PortRange{p}
+	for _, r := range ranges {
+		var next []PortRange
+		for _, q := range rest {
+			if r.To < q.From || r.From > q.To {
+				next = append(next, q)
+				continue
+			}
+			if q.From < r.From {
+				next = append(next, PortRange{From: q.From, To: r.From - 1})
+			}
+			if q.To > r.To {
+				next = append(next, PortRange{From: r.To + 1, To: q.To})
+			}
+		}
+		rest = next
+	}
+	return rest
+}
+
+func overlapsTraffic(a, b []Traffic) bool {
+	for _, t := range a {
+		for _, u := range b {
+			if t.Protocol != "all" && u.Protocol != "all" && t.Protocol != u.Protocol {
+				continue
+			}
+			if len(t.Ports) == 0 || len(u.Ports) == 0 {
+				return true
+			}
+			for _, p := range t.Ports {
+				for _, q := range u.Ports {
+					if p.From <= q.To && q.From <= p.To {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
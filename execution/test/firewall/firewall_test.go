@@ -0,0 +1,90 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firewall
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+/*
+TestParseTraffic verifies that protocols are normalized, that ports and port
+ranges are parsed and that invalid ports are rejected.
+*/
+func TestParseTraffic(t *testing.T) {
+	tests := []struct {
+		protocol string
+		ports    []string
+		want     string
+		wantErr  bool
+	}{
+		{protocol: "TCP", ports: []string{"22", "11000-13047"}, want: "tcp:22,11000-13047"},
+		{protocol: "6", ports: []string{"443"}, want: "tcp:443"},
+		{protocol: "udp", want: "udp"},
+		{protocol: "all", want: "all"},
+		{protocol: "tcp", ports: []string{"65536"}, wantErr: true},
+		{protocol: "tcp", ports: []string{"90-80"}, wantErr: true},
+		{protocol: "tcp", ports: []string{"ssh"}, wantErr: true},
+		{protocol: "icmp", ports: []string{"8"}, wantErr: true},
+		{protocol: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTraffic(tt.protocol, tt.ports)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseTraffic(%q, %q) = %v, want an error", tt.protocol, tt.ports, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseTraffic(%q, %q) returned error: %v", tt.protocol, tt.ports, err)
+		} else if got.String() != tt.want {
+			t.Errorf("ParseTraffic(%q, %q) = %s, want %s", tt.protocol, tt.ports, got, tt.want)
+		}
+	}
+}
+
+/*
+TestUncovered verifies the traffic left over when the ports of one rule are
+subtracted from another.
+*/
+func TestUncovered(t *testing.T) {
+	mrc := []Traffic{{Protocol: "tcp", Ports: []PortRange{{6379, 6379}, {11000, 13047}}}}
+	tests := []struct {
+		name string
+		b    []Traffic
+		t    Traffic
+		want []string
+	}{
+		{name: "inside", b: mrc, t: Traffic{Protocol: "tcp", Ports: []PortRange{{12000, 12100}}}},
+		{name: "partly outside", b: mrc, t: Traffic{Protocol: "tcp", Ports: []PortRange{{6379, 6380}, {10000, 11000}}}, want: []string{"tcp:6380,10000-10999"}},
+		{name: "all ports", b: mrc, t: Traffic{Protocol: "tcp"}, want: []string{"tcp:0-6378,6380-10999,13048-65535"}},
+		{name: "other protocol", b: mrc, t: Traffic{Protocol: "udp", Ports: []PortRange{{6379, 6379}}}, want: []string{"udp:6379"}},
+		{name: "all protocols", b: mrc, t: Traffic{Protocol: "all"}, want: []string{"all"}},
+		{name: "covered by all", b: []Traffic{{Protocol: "all"}}, t: Traffic{Protocol: "icmp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, u := range uncovered(tt.b, tt.t) {
+				got = append(got, u.String())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("uncovered() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// anyIPv4 is the range the module substitutes for unset source ranges of
+// ingress rules and destination ranges of egress rules.
+var anyIPv4 = netip.MustParsePrefix("0.0.0.0/0")
+
+// ruleAttributes lists the attributes of the ingress_rules and egress_rules
+// objects of the 03-security variables.
+var ruleAttributes = map[string]bool{
+	"deny": true, "description": true, "destination_ranges": true, "disabled": true,
+	"enable_logging": true, "priority": true, "source_ranges": true, "sources": true,
+	"targets": true, "use_service_accounts": true, "rules": true,
+}
+
+// ReadTFVars reads the ingress_rules and egress_rules of the tfvars file of
+// a 03-security stage and expands them. Rules that cannot be expanded, such
+// as rules with an invalid range, are left out and reported as
+// CheckInvalidRule findings.
+func ReadTFVars(path string) ([]Rule, []Finding, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+	body := f.Body.(*hclsyntax.Body)
+	var rules []Rule
+	var findings []Finding
+	for _, v := range []struct {
+		name      string
+		direction Direction
+	}{{"ingress_rules", Ingress}, {"egress_rules", Egress}} {
+		attr, ok := body.Attributes[v.name]
+		if !ok {
+			continue
+		}
+		r, fs := readRules(path, attr, v.direction)
+		rules = append(rules, r...)
+		findings = append(findings, fs...)
+	}
+	return rules, findings, nil
+}
+
+func readRules(path string, attr *hclsyntax.Attribute, direction Direction) ([]Rule, []Finding) {
+	invalid := func(rng hcl.Range, format string, args ...any) Finding {
+		return Finding{
+			File:     path,
+			Line:     rng.Start.Line,
+			Column:   rng.Start.Column,
+			Severity: Error,
+			Check:    CheckInvalidRule,
+			Message:  fmt.Sprintf(format, args...),
+		}
+	}
+	obj, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return nil, []Finding{invalid(attr.Expr.Range(), "%s must be a map of rules keyed by rule name", attr.Name)}
+	}
+	var rules []Rule
+	var findings []Finding
+	for _, item := range obj.Items {
+		rng := item.KeyExpr.Range()
+		key, diags := item.KeyExpr.Value(nil)
+		if diags.HasErrors() || key.Type() != cty.String || key.IsNull() {
+			findings = append(findings, invalid(rng, "%s has a key that is not a rule name", attr.Name))
+			continue
+		}
+		name := key.AsString()
+		value, diags := item.ValueExpr.Value(nil)
+		if diags.HasErrors() || !value.Type().IsObjectType() {
+			findings = append(findings, invalid(rng, "%s: rule must be an object of literal values", name))
+			continue
+		}
+		rule, err := ruleFromValue(name, direction, value)
+		if err != nil {
+			findings = append(findings, invalid(rng, "%s: %v", name, err))
+			continue
+		}
+		rule.File, rule.Line, rule.Column = path, rng.Start.Line, rng.Start.Column
+		rules = append(rules, rule)
+	}
+	return rules, findings
+}
+
+// ruleFromValue expands a rule of the 03-security variables, applying the
+// defaults of the variable type and of the net-vpc-firewall module.
+func ruleFromValue(name string, direction Direction, v cty.Value) (Rule, error) {
+	for attr := range v.Type().AttributeTypes() {
+		if !ruleAttributes[attr] {
+			return Rule{}, fmt.Errorf("unknown attribute %q", attr)
+		}
+	}
+	attr := func(name string) cty.Value {
+		if !v.Type().HasAttribute(name) {
+			return cty.NullVal(cty.DynamicPseudoType)
+		}
+		return v.GetAttr(name)
+	}
+	r := Rule{Name: name, Direction: direction, Deny: direction == Egress, Priority: DefaultPriority}
+	var err error
+	if r.Deny, err = boolValue(attr("deny"), r.Deny); err != nil {
+		return Rule{}, fmt.Errorf("deny: %w", err)
+	}
+	if r.Disabled, err = boolValue(attr("disabled"), false); err != nil {
+		return Rule{}, fmt.Errorf("disabled: %w", err)
+	}
+	if r.UseServiceAccounts, err = boolValue(attr("use_service_accounts"), false); err != nil {
+		return Rule{}, fmt.Errorf("use_service_accounts: %w", err)
+	}
+	if p := attr("priority"); !p.IsNull() {
+		if p.Type() != cty.Number {
+			return Rule{}, fmt.Errorf("priority must be a number")
+		}
+		r.Priority, _ = p.AsBigFloat().Int64()
+	}
+	sourceRanges, err := prefixList(attr("source_ranges"))
+	if err != nil {
+		return Rule{}, fmt.Errorf("source_ranges: %w", err)
+	}
+	if r.SourceTags, err = stringList(attr("sources")); err != nil {
+		return Rule{}, fmt.Errorf("sources: %w", err)
+	}
+	destinationRanges, err := prefixList(attr("destination_ranges"))
+	if err != nil {
+		return Rule{}, fmt.Errorf("destination_ranges: %w", err)
+	}
+	if r.Targets, err = stringList(attr("targets")); err != nil {
+		return Rule{}, fmt.Errorf("targets: %w", err)
+	}
+	r.SourceRanges, r.DestinationRanges = sourceRanges, destinationRanges
+	if direction == Ingress && attr("source_ranges").IsNull() && attr("sources").IsNull() {
+		r.SourceRanges = []netip.Prefix{anyIPv4}
+	}
+	if direction == Egress && attr("destination_ranges").IsNull() {
+		r.DestinationRanges = []netip.Prefix{anyIPv4}
+	}
+
+	protocols := attr("rules")
+	if protocols.IsNull() {
+		r.Traffic = []Traffic{{Protocol: "all"}}
+		return r, nil
+	}
+	if !protocols.CanIterateElements() {
+		return Rule{}, fmt.Errorf("rules must be a list")
+	}
+	for it := protocols.ElementIterator(); it.Next(); {
+		_, p := it.Element()
+		if !p.Type().IsObjectType() || !p.Type().HasAttribute("protocol") || p.GetAttr("protocol").Type() != cty.String {
+			return Rule{}, fmt.Errorf("rules must set a protocol")
+		}
+		var ports []string
+		if p.Type().HasAttribute("ports") {
+			if ports, err = stringList(p.GetAttr("ports")); err != nil {
+				return Rule{}, fmt.Errorf("ports: %w", err)
+			}
+		}
+		t, err := ParseTraffic(p.GetAttr("protocol").AsString(), ports)
+		if err != nil {
+			return Rule{}, err
+		}
+		r.Traffic = append(r.Traffic, t)
+	}
+	return r, nil
+}
+
+func boolValue(v cty.Value, def bool) (bool, error) {
+	switch {
+	case v.IsNull():
+		return def, nil
+	case v.Type() == cty.Bool:
+		return v.True(), nil
+	case v.Type() == cty.String && (v.AsString() == "true" || v.AsString() == "false"):
+		return v.AsString() == "true", nil
+	}
+	return false, fmt.Errorf("must be a bool")
+}
+
+func stringList(v cty.Value) ([]string, error) {
+	if v.IsNull() {
+		return nil, nil
+	}
+	if !v.CanIterateElements() || v.Type().IsMapType() || v.Type().IsObjectType() {
+		return nil, fmt.Errorf("must be a list of strings")
+	}
+	var list []string
+	for it := v.ElementIterator(); it.Next(); {
+		_, e := it.Element()
+		if e.IsNull() || e.Type() != cty.String {
+			return nil, fmt.Errorf("must be a list of strings")
+		}
+		list = append(list, e.AsString())
+	}
+	return list, nil
+}
+
+func prefixList(v cty.Value) ([]netip.Prefix, error) {
+	list, err := stringList(v)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrefixes(list)
+}
+
+func parsePrefixes(list []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range list {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			// A single address is accepted as a /32 or /128.
+			addr, err2 := netip.ParseAddr(s)
+			if err2 != nil {
+				return nil, fmt.Errorf("%q is not a CIDR range", s)
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// planFirewall is the part of a google_compute_firewall resource in the
+// JSON output of terraform show that the readers use.
+type planFirewall struct {
+	Name                  string         `json:"name"`
+	Direction             string         `json:"direction"`
+	Priority              *int64         `json:"priority"`
+	Disabled              bool           `json:"disabled"`
+	SourceRanges          []string       `json:"source_ranges"`
+	SourceTags            []string       `json:"source_tags"`
+	SourceServiceAccounts []string       `json:"source_service_accounts"`
+	DestinationRanges     []string       `json:"destination_ranges"`
+	TargetTags            []string       `json:"target_tags"`
+	TargetServiceAccounts []string       `json:"target_service_accounts"`
+	Allow                 []planProtocol `json:"allow"`
+	Deny                  []planProtocol `json:"deny"`
+}
+
+type planProtocol struct {
+	Protocol string   `json:"protocol"`
+	Ports    []string `json:"ports"`
+}
+
+// ReadPlan reads the google_compute_firewall resources a terraform plan, in
+// the JSON format of terraform show -json, creates or keeps. The File of
+// each rule is path and its resource address.
+func ReadPlan(path string) ([]Rule, error) {
+	return readTerraformJSON(path, false)
+}
+
+// ReadState reads the google_compute_firewall resources of a terraform
+// state, in the JSON format of terraform show -json, including those of
+// child modules.
+func ReadState(path string) ([]Rule, error) {
+	return readTerraformJSON(path, true)
+}
+
+// ReadTerraformJSON reads the firewall rules of the output of terraform
+// show -json for either a plan or a state, telling them apart by the
+// resource_changes a plan has.
+func ReadTerraformJSON(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		ResourceChanges json.RawMessage `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return readTerraformJSON(path, probe.ResourceChanges == nil)
+}
+
+// stateModule is a module of the values of terraform show -json.
+type stateModule struct {
+	Resources []struct {
+		Address string          `json:"address"`
+		Type    string          `json:"type"`
+		Values  json.RawMessage `json:"values"`
+	} `json:"resources"`
+	ChildModules []stateModule `json:"child_modules"`
+}
+
+// firewalls adds the values of the firewall resources of m and its child
+// modules to resources, keyed by address.
+func (m stateModule) firewalls(resources map[string]json.RawMessage) {
+	for _, r := range m.Resources {
+		if r.Type == "google_compute_firewall" {
+			resources[r.Address] = r.Values
+		}
+	}
+	for _, child := range m.ChildModules {
+		child.firewalls(resources)
+	}
+}
+
+func readTerraformJSON(path string, state bool) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Type    string `json:"type"`
+			Change  struct {
+				After json.RawMessage `json:"after"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+		Values struct {
+			RootModule stateModule `json:"root_module"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	resources := map[string]json.RawMessage{}
+	if state {
+		doc.Values.RootModule.firewalls(resources)
+	} else {
+		for _, rc := range doc.ResourceChanges {
+			if rc.Type == "google_compute_firewall" {
+				resources[rc.Address] = rc.Change.After
+			}
+		}
+	}
+	var rules []Rule
+	for address, values := range resources {
+		if len(values) == 0 || string(values) == "null" {
+			// Deleted by the plan.
+			continue
+		}
+		var fw planFirewall
+		if err := json.Unmarshal(values, &fw); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, address, err)
+		}
+		rule, err := ruleFromPlan(fw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, address, err)
+		}
+		if rule.Name == "" {
+			rule.Name = address
+		}
+		rule.File = path + "#" + address
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Name != rules[j].Name {
+			return rules[i].Name < rules[j].Name
+		}
+		return rules[i].File < rules[j].File
+	})
+	return rules, nil
+}
+
+func ruleFromPlan(fw planFirewall) (Rule, error) {
+	r := Rule{
+		Name:      fw.Name,
+		Direction: Direction(fw.Direction),
+		Priority:  DefaultPriority,
+		Disabled:  fw.Disabled,
+		Targets:   fw.TargetTags,
+	}
+	if r.Direction == "" {
+		r.Direction = Ingress
+	}
+	if fw.Priority != nil {
+		r.Priority = *fw.Priority
+	}
+	if len(fw.TargetServiceAccounts) > 0 {
+		r.Targets, r.UseServiceAccounts = fw.TargetServiceAccounts, true
+	}
+	r.SourceTags = append(append([]string(nil), fw.SourceTags...), fw.SourceServiceAccounts...)
+	var err error
+	if r.SourceRanges, err = parsePrefixes(fw.SourceRanges); err != nil {
+		return Rule{}, fmt.Errorf("source_ranges: %w", err)
+	}
+	if r.DestinationRanges, err = parsePrefixes(fw.DestinationRanges); err != nil {
+		return Rule{}, fmt.Errorf("destination_ranges: %w", err)
+	}
+	protocols := fw.Allow
+	if len(fw.Deny) > 0 {
+		r.Deny, protocols = true, fw.Deny
+	}
+	for _, p := range protocols {
+		t, err := ParseTraffic(p.Protocol, p.Ports)
+		if err != nil {
+			return Rule{}, err
+		}
+		r.Traffic = append(r.Traffic, t)
+	}
+	return r, nil
+}
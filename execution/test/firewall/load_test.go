@@ -0,0 +1,240 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firewall
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// writeFile writes content to name in a temporary directory and returns its
+// path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func prefixes(t *testing.T, list ...string) []netip.Prefix {
+	t.Helper()
+	var ps []netip.Prefix
+	for _, s := range list {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+/*
+TestReadTFVars verifies that ingress and egress rules are expanded with the
+defaults of the 03-security variables and the net-vpc-firewall module, and
+that rules that cannot be expanded are reported where they are declared.
+*/
+func TestReadTFVars(t *testing.T) {
+	path := writeFile(t, "security.tfvars", `project_id = "p"
+ingress_rules = {
+  allow-ssh = {
+    rules = [{ protocol = "tcp", ports = ["22"] }]
+  }
+  allow-tagged = {
+    sources  = ["web"]
+    targets  = ["db"]
+    priority = 900
+  }
+  bad-range = {
+    source_ranges = [""]
+  }
+}
+egress_rules = {
+  allow-egress = {
+    deny  = false
+    rules = [{ protocol = "tcp", ports = ["5432"] }]
+  }
+  deny-all = {}
+}
+`)
+	rules, findings, err := ReadTFVars(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{
+		{Name: "allow-ssh", Direction: Ingress, Priority: 1000, SourceRanges: prefixes(t, "0.0.0.0/0"),
+			Traffic: []Traffic{{Protocol: "tcp", Ports: []PortRange{{22, 22}}}}, File: path, Line: 3, Column: 3},
+		{Name: "allow-tagged", Direction: Ingress, Priority: 900, SourceTags: []string{"web"}, Targets: []string{"db"},
+			Traffic: []Traffic{{Protocol: "all"}}, File: path, Line: 6, Column: 3},
+		{Name: "allow-egress", Direction: Egress, Priority: 1000, DestinationRanges: prefixes(t, "0.0.0.0/0"),
+			Traffic: []Traffic{{Protocol: "tcp", Ports: []PortRange{{5432, 5432}}}}, File: path, Line: 16, Column: 3},
+		{Name: "deny-all", Direction: Egress, Deny: true, Priority: 1000, DestinationRanges: prefixes(t, "0.0.0.0/0"),
+			Traffic: []Traffic{{Protocol: "all"}}, File: path, Line: 20, Column: 3},
+	}
+	if diff := cmp.Diff(want, rules, cmpopts.EquateComparable(netip.Prefix{})); diff != "" {
+		t.Errorf("ReadTFVars() rules mismatch (-want +got):\n%s", diff)
+	}
+	wantFindings := []Finding{{File: path, Line: 11, Column: 3, Severity: Error, Check: CheckInvalidRule,
+		Message: `bad-range: source_ranges: "" is not a CIDR range`}}
+	if diff := cmp.Diff(wantFindings, findings); diff != "" {
+		t.Errorf("ReadTFVars() findings mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestReadTFVarsList verifies that a list of rules, instead of the map the
+variables declare, is reported rather than silently ignored.
+*/
+func TestReadTFVarsList(t *testing.T) {
+	path := writeFile(t, "gce.tfvars", `ingress_rules = [
+  {
+    name  = "allow-ssh"
+    allow = [{ protocol = "tcp", ports = ["22"] }]
+  }
+]
+`)
+	rules, findings, err := ReadTFVars(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("ReadTFVars() rules = %v, want none", rules)
+	}
+	want := []string{path + ":1:17: error: ingress_rules must be a map of rules keyed by rule name [invalid-rule]"}
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.String())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ReadTFVars() findings mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestReadPlan verifies that the google_compute_firewall resources of a plan
+are read and that deleted resources and other types are skipped.
+*/
+func TestReadPlan(t *testing.T) {
+	path := writeFile(t, "plan.json", `{
+  "resource_changes": [
+    {
+      "address": "module.ssh_firewall.google_compute_firewall.custom-rules[\"allow-ssh\"]",
+      "type": "google_compute_firewall",
+      "change": {
+        "actions": ["create"],
+        "after": {
+          "name": "allow-ssh",
+          "direction": "INGRESS",
+          "priority": 1000,
+          "source_ranges": ["0.0.0.0/0"],
+          "target_tags": ["ssh"],
+          "allow": [{"protocol": "tcp", "ports": ["22"]}],
+          "deny": []
+        }
+      }
+    },
+    {
+      "address": "module.ssh_firewall.google_compute_firewall.custom-rules[\"old\"]",
+      "type": "google_compute_firewall",
+      "change": {"actions": ["delete"], "after": null}
+    },
+    {
+      "address": "google_compute_network.vpc",
+      "type": "google_compute_network",
+      "change": {"actions": ["create"], "after": {"name": "vpc"}}
+    }
+  ]
+}`)
+	rules, err := ReadPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rule{{
+		Name:         "allow-ssh",
+		Direction:    Ingress,
+		Priority:     1000,
+		SourceRanges: prefixes(t, "0.0.0.0/0"),
+		Targets:      []string{"ssh"},
+		Traffic:      []Traffic{{Protocol: "tcp", Ports: []PortRange{{22, 22}}}},
+		File:         path + `#module.ssh_firewall.google_compute_firewall.custom-rules["allow-ssh"]`,
+	}}
+	if diff := cmp.Diff(want, rules, cmpopts.EquateComparable(netip.Prefix{}), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("ReadPlan() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestReadState verifies that the google_compute_firewall resources of a
+state are read from the root module and its child modules, and that
+ReadTerraformJSON tells a state from a plan.
+*/
+func TestReadState(t *testing.T) {
+	path := writeFile(t, "state.json", `{
+  "values": {
+    "root_module": {
+      "resources": [
+        {"address": "google_compute_network.vpc", "type": "google_compute_network", "values": {"name": "vpc"}}
+      ],
+      "child_modules": [
+        {
+          "resources": [
+            {
+              "address": "module.alloydb_firewall.google_compute_firewall.custom-rules[\"allow-egress-alloydb\"]",
+              "type": "google_compute_firewall",
+              "values": {
+                "name": "allow-egress-alloydb",
+                "direction": "EGRESS",
+                "priority": 1000,
+                "destination_ranges": ["0.0.0.0/0"],
+                "target_service_accounts": ["app@p.iam.gserviceaccount.com"],
+                "allow": [{"protocol": "tcp", "ports": ["5432"]}]
+              }
+            }
+          ]
+        }
+      ]
+    }
+  }
+}`)
+	want := []Rule{{
+		Name:               "allow-egress-alloydb",
+		Direction:          Egress,
+		Priority:           1000,
+		DestinationRanges:  prefixes(t, "0.0.0.0/0"),
+		Targets:            []string{"app@p.iam.gserviceaccount.com"},
+		UseServiceAccounts: true,
+		Traffic:            []Traffic{{Protocol: "tcp", Ports: []PortRange{{5432, 5432}}}},
+		File:               path + `#module.alloydb_firewall.google_compute_firewall.custom-rules["allow-egress-alloydb"]`,
+	}}
+	for name, read := range map[string]func(string) ([]Rule, error){
+		"ReadState":         ReadState,
+		"ReadTerraformJSON": ReadTerraformJSON,
+	} {
+		rules, err := read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, rules, cmpopts.EquateComparable(netip.Prefix{}), cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("%s() mismatch (-want +got):\n%s", name, diff)
+		}
+	}
+}
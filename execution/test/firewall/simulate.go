@@ -0,0 +1,295 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firewall
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// ImpliedPriority is the priority of the implied rules of every VPC
+// network, evaluated after all other rules.
+const ImpliedPriority = 65535
+
+// Implied rules of every VPC network: ingress is denied and egress is
+// allowed unless a rule of higher priority decides otherwise. They match
+// any source and destination.
+var (
+	ImpliedDenyIngress = Rule{
+		Name:      "implied-deny-ingress",
+		Direction: Ingress,
+		Deny:      true,
+		Priority:  ImpliedPriority,
+		Traffic:   []Traffic{{Protocol: "all"}},
+	}
+	ImpliedAllowEgress = Rule{
+		Name:      "implied-allow-egress",
+		Direction: Egress,
+		Priority:  ImpliedPriority,
+		Traffic:   []Traffic{{Protocol: "all"}},
+	}
+)
+
+// Endpoint is one side of a Flow: an address range and, for VM instances in
+// the network, their network tags and service account.
+type Endpoint struct {
+	// Range is the address, as a /32, or the range of addresses of the
+	// endpoint.
+	Range          netip.Prefix
+	Tags           []string
+	ServiceAccount string
+}
+
+// String formats e as its range followed by its tags and service account.
+func (e Endpoint) String() string {
+	s := e.Range.String()
+	if len(e.Tags) > 0 {
+		s += " tags=" + strings.Join(e.Tags, ",")
+	}
+	if e.ServiceAccount != "" {
+		s += " sa=" + e.ServiceAccount
+	}
+	return s
+}
+
+// Flow is a connection attempt evaluated against the firewall rules of the
+// network of the instance the Direction applies to: the destination for
+// Ingress and the source for Egress.
+type Flow struct {
+	Direction   Direction
+	Source      Endpoint
+	Destination Endpoint
+	// Protocol is a protocol name such as "tcp", and Port is ignored for
+	// protocols without ports.
+	Protocol string
+	Port     int
+}
+
+// String formats f as "INGRESS tcp from 10.0.0.2/32 to 10.1.0.5/32 port 5432".
+func (f Flow) String() string {
+	s := fmt.Sprintf("%s %s from %s to %s", f.Direction, f.Protocol, f.Source, f.Destination)
+	if portProtocol(f.Protocol) {
+		s += fmt.Sprintf(" port %d", f.Port)
+	}
+	return s
+}
+
+func portProtocol(protocol string) bool {
+	return protocol == "tcp" || protocol == "udp" || protocol == "sctp"
+}
+
+// Decision is the outcome of Evaluate.
+type Decision struct {
+	Allowed bool
+	// Rule is the rule that decided the flow, possibly an implied rule.
+	Rule Rule
+	// Partial lists the rules evaluated before Rule that match part, but
+	// not all, of the source or destination range of the flow, and so decide
+	// the flow for some of its addresses.
+	Partial []Rule
+}
+
+// Implied reports whether the flow was decided by an implied rule.
+func (d Decision) Implied() bool {
+	return d.Rule.Priority == ImpliedPriority && (d.Rule.Name == ImpliedDenyIngress.Name || d.Rule.Name == ImpliedAllowEgress.Name)
+}
+
+// String formats d as "ALLOW by allow-ssh (priority 1000)" followed by the
+// location of the rule and the partially matching rules.
+func (d Decision) String() string {
+	verdict := "DENY"
+	if d.Allowed {
+		verdict = "ALLOW"
+	}
+	s := fmt.Sprintf("%s by %s (priority %d)", verdict, d.Rule.Name, d.Rule.Priority)
+	if d.Rule.File != "" {
+		if d.Rule.Line > 0 {
+			s += fmt.Sprintf(" at %s:%d", d.Rule.File, d.Rule.Line)
+		} else {
+			s += " at " + d.Rule.File
+		}
+	}
+	for _, r := range d.Partial {
+		s += fmt.Sprintf("\n  note: %s (priority %d) %s part of the flow's addresses first", r.Name, r.Priority, r.action())
+	}
+	return s
+}
+
+// match is how much of a flow a rule matches.
+type match int
+
+const (
+	matchNone match = iota
+	matchPartial
+	matchAll
+)
+
+// Evaluate returns the decision of the VPC firewall on flow: rules are
+// evaluated by ascending priority, deny before allow at the same priority,
+// and the first rule matching the whole flow decides it, falling back to
+// the implied rules. Disabled rules are ignored.
+func Evaluate(rules []Rule, flow Flow) (Decision, error) {
+	if flow.Direction != Ingress && flow.Direction != Egress {
+		return Decision{}, fmt.Errorf("invalid direction %q", flow.Direction)
+	}
+	if !flow.Source.Range.IsValid() || !flow.Destination.Range.IsValid() {
+		return Decision{}, fmt.Errorf("flow needs a source and a destination range")
+	}
+	protocol := strings.ToLower(flow.Protocol)
+	if name, ok := protocolNames[protocol]; ok {
+		protocol = name
+	}
+	if protocol == "" || protocol == "all" {
+		return Decision{}, fmt.Errorf("flow needs a protocol")
+	}
+	if portProtocol(protocol) && (flow.Port < 0 || flow.Port > 65535) {
+		return Decision{}, fmt.Errorf("invalid port %d", flow.Port)
+	}
+	flow.Protocol = protocol
+
+	ordered := append([]Rule(nil), rules...)
+	ordered = append(ordered, ImpliedDenyIngress, ImpliedAllowEgress)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Deny && !b.Deny
+	})
+	var d Decision
+	for _, r := range ordered {
+		switch matchFlow(r, flow) {
+		case matchAll:
+			d.Allowed, d.Rule = !r.Deny, r
+			return d, nil
+		case matchPartial:
+			d.Partial = append(d.Partial, r)
+		}
+	}
+	// Unreachable: the implied rules match every flow of their direction.
+	return Decision{}, fmt.Errorf("no rule matched %s", flow)
+}
+
+// matchFlow returns how much of flow r matches.
+func matchFlow(r Rule, flow Flow) match {
+	if r.Disabled || r.Direction != flow.Direction || !matchTraffic(r.Traffic, flow) {
+		return matchNone
+	}
+	instance := flow.Destination
+	if flow.Direction == Egress {
+		instance = flow.Source
+	}
+	if !matchTargets(r, instance) {
+		return matchNone
+	}
+	m := matchAll
+	if flow.Direction == Ingress {
+		m = min(m, matchSource(r, flow.Source))
+	} else if len(r.SourceRanges) > 0 {
+		m = min(m, matchRange(r.SourceRanges, flow.Source.Range))
+	}
+	if len(r.DestinationRanges) > 0 {
+		m = min(m, matchRange(r.DestinationRanges, flow.Destination.Range))
+	}
+	return m
+}
+
+func matchTraffic(traffic []Traffic, flow Flow) bool {
+	for _, t := range traffic {
+		if t.Protocol != "all" && t.Protocol != flow.Protocol {
+			continue
+		}
+		if len(t.Ports) == 0 || !portProtocol(flow.Protocol) {
+			return true
+		}
+		for _, p := range t.Ports {
+			if flow.Port >= p.From && flow.Port <= p.To {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchTargets reports whether r applies to instance.
+func matchTargets(r Rule, instance Endpoint) bool {
+	if len(r.Targets) == 0 {
+		return true
+	}
+	if r.UseServiceAccounts {
+		return instance.ServiceAccount != "" && contains(r.Targets, instance.ServiceAccount)
+	}
+	for _, tag := range instance.Tags {
+		if contains(r.Targets, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSource matches the source of an ingress flow, selected by range or
+// by the tags or service account of the source instance.
+func matchSource(r Rule, source Endpoint) match {
+	if r.AnySource() {
+		return matchAll
+	}
+	for _, tag := range append(append([]string(nil), source.Tags...), source.ServiceAccount) {
+		if tag != "" && contains(r.SourceTags, tag) {
+			return matchAll
+		}
+	}
+	if len(r.SourceRanges) == 0 {
+		return matchNone
+	}
+	return matchRange(r.SourceRanges, source.Range)
+}
+
+// matchRange returns matchAll if one of ranges contains p, matchPartial if
+// one overlaps it and matchNone otherwise.
+func matchRange(ranges []netip.Prefix, p netip.Prefix) match {
+	m := matchNone
+	for _, q := range ranges {
+		if q.Bits() <= p.Bits() && q.Contains(p.Addr()) {
+			return matchAll
+		}
+		if q.Overlaps(p) {
+			m = matchPartial
+		}
+	}
+	return m
+}
+
+// ParseEndpoint parses an address or CIDR range, with optional
+// comma-separated tags and a service account.
+func ParseEndpoint(addr, tags, serviceAccount string) (Endpoint, error) {
+	var e Endpoint
+	if addr == "" {
+		addr = "0.0.0.0/0"
+	}
+	ps, err := parsePrefixes([]string{addr})
+	if err != nil {
+		return Endpoint{}, err
+	}
+	e.Range = ps[0]
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			e.Tags = append(e.Tags, tag)
+		}
+	}
+	e.ServiceAccount = serviceAccount
+	return e, nil
+}
@@ -0,0 +1,418 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package firewall
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// endpoint returns an Endpoint for addr with tags, failing t on a bad addr.
+func endpoint(t *testing.T, addr string, tags ...string) Endpoint {
+	t.Helper()
+	e, err := ParseEndpoint(addr, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Tags = tags
+	return e
+}
+
+// saEndpoint returns an Endpoint for addr running as serviceAccount.
+func saEndpoint(t *testing.T, addr, serviceAccount string) Endpoint {
+	t.Helper()
+	e := endpoint(t, addr)
+	e.ServiceAccount = serviceAccount
+	return e
+}
+
+func ingress(name string, priority int64, deny bool, sources []string, traffic ...Traffic) Rule {
+	r := Rule{Name: name, Direction: Ingress, Priority: priority, Deny: deny, Traffic: traffic}
+	for _, s := range sources {
+		ps, _ := parsePrefixes([]string{s})
+		r.SourceRanges = append(r.SourceRanges, ps...)
+	}
+	return r
+}
+
+func egress(name string, priority int64, deny bool, destinations []string, traffic ...Traffic) Rule {
+	r := Rule{Name: name, Direction: Egress, Priority: priority, Deny: deny, Traffic: traffic}
+	for _, s := range destinations {
+		ps, _ := parsePrefixes([]string{s})
+		r.DestinationRanges = append(r.DestinationRanges, ps...)
+	}
+	return r
+}
+
+func withTargets(r Rule, targets ...string) Rule {
+	r.Targets = targets
+	return r
+}
+
+func withServiceAccounts(r Rule, accounts ...string) Rule {
+	r.Targets, r.UseServiceAccounts = accounts, true
+	return r
+}
+
+func withSourceTags(r Rule, tags ...string) Rule {
+	r.SourceTags = tags
+	return r
+}
+
+func withDestinations(r Rule, ranges ...string) Rule {
+	r.DestinationRanges, _ = parsePrefixes(ranges)
+	return r
+}
+
+func withSources(r Rule, ranges ...string) Rule {
+	r.SourceRanges, _ = parsePrefixes(ranges)
+	return r
+}
+
+func disabled(r Rule) Rule {
+	r.Disabled = true
+	return r
+}
+
+/*
+TestEvaluate verifies the VPC firewall semantics of Evaluate: implied rules,
+priorities, deny before allow at the same priority, targets by tag and
+service account, sources by range, tag and service account, destination
+ranges, protocols and ports, disabled rules and partially matching ranges.
+*/
+func TestEvaluate(t *testing.T) {
+	all := Traffic{Protocol: "all"}
+	postgres := tcp(PortRange{5432, 5432})
+	ssh := tcp(PortRange{22, 22})
+	anywhere := []string{"0.0.0.0/0"}
+
+	tests := []struct {
+		name        string
+		rules       []Rule
+		flow        Flow
+		wantAllowed bool
+		wantRule    string
+		wantPartial []string
+	}{
+		{
+			name:     "implied deny ingress",
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 22},
+			wantRule: "implied-deny-ingress",
+		},
+		{
+			name:        "implied allow egress",
+			flow:        Flow{Direction: Egress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "8.8.8.8"), Protocol: "udp", Port: 53},
+			wantAllowed: true,
+			wantRule:    "implied-allow-egress",
+		},
+		{
+			name:        "implied rules match IPv6",
+			flow:        Flow{Direction: Egress, Source: endpoint(t, "fd20::2"), Destination: endpoint(t, "2001:db8::1"), Protocol: "tcp", Port: 443},
+			wantAllowed: true,
+			wantRule:    "implied-allow-egress",
+		},
+		{
+			name:        "allow from range",
+			rules:       []Rule{ingress("allow-ssh", 1000, false, []string{"10.0.0.0/8"}, ssh)},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.1.2.3"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 22},
+			wantAllowed: true,
+			wantRule:    "allow-ssh",
+		},
+		{
+			name:     "source outside range",
+			rules:    []Rule{ingress("allow-ssh", 1000, false, []string{"10.0.0.0/8"}, ssh)},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "192.168.0.1"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 22},
+			wantRule: "implied-deny-ingress",
+		},
+		{
+			name:     "other port",
+			rules:    []Rule{ingress("allow-ssh", 1000, false, anywhere, ssh)},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 23},
+			wantRule: "implied-deny-ingress",
+		},
+		{
+			name:     "other protocol",
+			rules:    []Rule{ingress("allow-ssh", 1000, false, anywhere, ssh)},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "udp", Port: 22},
+			wantRule: "implied-deny-ingress",
+		},
+		{
+			name:        "port range",
+			rules:       []Rule{ingress("allow-mrc", 1000, false, anywhere, tcp(PortRange{6379, 6379}, PortRange{11000, 13047}))},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 13047},
+			wantAllowed: true,
+			wantRule:    "allow-mrc",
+		},
+		{
+			name:        "protocol without ports",
+			rules:       []Rule{ingress("allow-tcp", 1000, false, anywhere, Traffic{Protocol: "tcp"})},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 8080},
+			wantAllowed: true,
+			wantRule:    "allow-tcp",
+		},
+		{
+			name:        "all protocols",
+			rules:       []Rule{ingress("allow-all", 1000, false, anywhere, all)},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "icmp"},
+			wantAllowed: true,
+			wantRule:    "allow-all",
+		},
+		{
+			name:        "protocol number",
+			rules:       []Rule{ingress("allow-ssh", 1000, false, anywhere, ssh)},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "6", Port: 22},
+			wantAllowed: true,
+			wantRule:    "allow-ssh",
+		},
+		{
+			name: "higher priority deny wins",
+			rules: []Rule{
+				ingress("allow-ssh", 1000, false, anywhere, ssh),
+				ingress("deny-ssh", 100, true, anywhere, ssh),
+			},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 22},
+			wantRule: "deny-ssh",
+		},
+		{
+			name: "higher priority allow wins",
+			rules: []Rule{
+				ingress("deny-all", 2000, true, anywhere, all),
+				ingress("allow-ssh", 1000, false, anywhere, ssh),
+			},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 22},
+			wantAllowed: true,
+			wantRule:    "allow-ssh",
+		},
+		{
+			name: "deny wins at the same priority",
+			rules: []Rule{
+				ingress("allow-ssh", 1000, false, anywhere, ssh),
+				ingress("deny-ssh", 1000, true, anywhere, ssh),
+			},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 22},
+			wantRule: "deny-ssh",
+		},
+		{
+			name: "deny at lower priority does not apply",
+			rules: []Rule{
+				ingress("allow-ssh", 1000, false, anywhere, ssh),
+				ingress("deny-ssh", 1001, true, anywhere, ssh),
+			},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 22},
+			wantAllowed: true,
+			wantRule:    "allow-ssh",
+		},
+		{
+			name:        "target tag matches",
+			rules:       []Rule{withTargets(ingress("allow-ssh", 1000, false, anywhere, ssh), "ssh")},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2", "web", "ssh"), Protocol: "tcp", Port: 22},
+			wantAllowed: true,
+			wantRule:    "allow-ssh",
+		},
+		{
+			name:     "target tag missing",
+			rules:    []Rule{withTargets(ingress("allow-ssh", 1000, false, anywhere, ssh), "ssh")},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2", "web"), Protocol: "tcp", Port: 22},
+			wantRule: "implied-deny-ingress",
+		},
+		{
+			name:        "target service account matches",
+			rules:       []Rule{withServiceAccounts(ingress("allow-db", 1000, false, anywhere, postgres), "db@p.iam.gserviceaccount.com")},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: saEndpoint(t, "10.0.1.2", "db@p.iam.gserviceaccount.com"), Protocol: "tcp", Port: 5432},
+			wantAllowed: true,
+			wantRule:    "allow-db",
+		},
+		{
+			name:     "target service account does not match tags",
+			rules:    []Rule{withServiceAccounts(ingress("allow-db", 1000, false, anywhere, postgres), "db@p.iam.gserviceaccount.com")},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2", "db@p.iam.gserviceaccount.com"), Protocol: "tcp", Port: 5432},
+			wantRule: "implied-deny-ingress",
+		},
+		{
+			name:        "source tag matches",
+			rules:       []Rule{withSourceTags(ingress("allow-app", 1000, false, nil, postgres), "app")},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2", "app"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 5432},
+			wantAllowed: true,
+			wantRule:    "allow-app",
+		},
+		{
+			name:     "source tag missing",
+			rules:    []Rule{withSourceTags(ingress("allow-app", 1000, false, nil, postgres), "app")},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2", "web"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 5432},
+			wantRule: "implied-deny-ingress",
+		},
+		{
+			name:        "source service account matches",
+			rules:       []Rule{withSourceTags(ingress("allow-app", 1000, false, nil, postgres), "app@p.iam.gserviceaccount.com")},
+			flow:        Flow{Direction: Ingress, Source: saEndpoint(t, "10.0.0.2", "app@p.iam.gserviceaccount.com"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 5432},
+			wantAllowed: true,
+			wantRule:    "allow-app",
+		},
+		{
+			name:        "source tag or range",
+			rules:       []Rule{withSourceTags(ingress("allow-app", 1000, false, []string{"192.168.0.0/16"}, postgres), "app")},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "192.168.1.1"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 5432},
+			wantAllowed: true,
+			wantRule:    "allow-app",
+		},
+		{
+			name:        "ingress destination range matches",
+			rules:       []Rule{withDestinations(ingress("allow-db", 1000, false, anywhere, postgres), "10.10.0.0/24")},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.10.0.5"), Protocol: "tcp", Port: 5432},
+			wantAllowed: true,
+			wantRule:    "allow-db",
+		},
+		{
+			name:     "ingress destination range misses",
+			rules:    []Rule{withDestinations(ingress("allow-db", 1000, false, anywhere, postgres), "10.10.0.0/24")},
+			flow:     Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.11.0.5"), Protocol: "tcp", Port: 5432},
+			wantRule: "implied-deny-ingress",
+		},
+		{
+			name:     "egress deny to range",
+			rules:    []Rule{egress("deny-egress", 1000, true, anywhere, all)},
+			flow:     Flow{Direction: Egress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.10.0.5"), Protocol: "tcp", Port: 5432},
+			wantRule: "deny-egress",
+		},
+		{
+			name: "egress allow of the product port before a deny",
+			rules: []Rule{
+				egress("allow-egress-alloydb", 900, false, []string{"10.10.0.0/16"}, postgres),
+				egress("deny-egress", 1000, true, anywhere, all),
+			},
+			flow:        Flow{Direction: Egress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.10.0.5"), Protocol: "tcp", Port: 5432},
+			wantAllowed: true,
+			wantRule:    "allow-egress-alloydb",
+		},
+		{
+			name:     "egress target is the source instance",
+			rules:    []Rule{withTargets(egress("deny-app", 1000, true, anywhere, all), "app")},
+			flow:     Flow{Direction: Egress, Source: endpoint(t, "10.0.0.2", "app"), Destination: endpoint(t, "10.0.1.2", "other"), Protocol: "tcp", Port: 80},
+			wantRule: "deny-app",
+		},
+		{
+			name:        "egress target on the destination does not match",
+			rules:       []Rule{withTargets(egress("deny-app", 1000, true, anywhere, all), "app")},
+			flow:        Flow{Direction: Egress, Source: endpoint(t, "10.0.0.2", "other"), Destination: endpoint(t, "10.0.1.2", "app"), Protocol: "tcp", Port: 80},
+			wantAllowed: true,
+			wantRule:    "implied-allow-egress",
+		},
+		{
+			name:        "egress source range",
+			rules:       []Rule{withSources(egress("deny-subnet", 1000, true, anywhere, all), "10.5.0.0/16")},
+			flow:        Flow{Direction: Egress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 80},
+			wantAllowed: true,
+			wantRule:    "implied-allow-egress",
+		},
+		{
+			name:     "ingress rules do not apply to egress",
+			rules:    []Rule{ingress("deny-all", 1, true, anywhere, all)},
+			flow:     Flow{Direction: Egress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 80},
+			wantRule: "implied-allow-egress", wantAllowed: true,
+		},
+		{
+			name: "disabled rule is ignored",
+			rules: []Rule{
+				disabled(ingress("deny-ssh", 100, true, anywhere, ssh)),
+				ingress("allow-ssh", 1000, false, anywhere, ssh),
+			},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.2"), Destination: endpoint(t, "10.0.1.2"), Protocol: "tcp", Port: 22},
+			wantAllowed: true,
+			wantRule:    "allow-ssh",
+		},
+		{
+			name: "source range partly matched by a deny",
+			rules: []Rule{
+				ingress("deny-lab", 100, true, []string{"10.1.0.0/16"}, all),
+				ingress("allow-corp", 1000, false, []string{"10.0.0.0/8"}, ssh),
+			},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.0/14"), Destination: endpoint(t, "10.20.0.2"), Protocol: "tcp", Port: 22},
+			wantAllowed: true,
+			wantRule:    "allow-corp",
+			wantPartial: []string{"deny-lab"},
+		},
+		{
+			name:        "source range partly matched by an allow",
+			rules:       []Rule{ingress("allow-lab", 1000, false, []string{"10.1.0.0/16"}, ssh)},
+			flow:        Flow{Direction: Ingress, Source: endpoint(t, "10.0.0.0/8"), Destination: endpoint(t, "10.20.0.2"), Protocol: "tcp", Port: 22},
+			wantRule:    "implied-deny-ingress",
+			wantPartial: []string{"allow-lab"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Evaluate(tt.rules, tt.flow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Allowed != tt.wantAllowed || d.Rule.Name != tt.wantRule {
+				t.Errorf("Evaluate() = %s, want allowed %v by %s", d, tt.wantAllowed, tt.wantRule)
+			}
+			var partial []string
+			for _, r := range d.Partial {
+				partial = append(partial, r.Name)
+			}
+			if diff := cmp.Diff(tt.wantPartial, partial); diff != "" {
+				t.Errorf("Evaluate() partial rules mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+/*
+TestEvaluateInvalidFlow verifies that flows Evaluate cannot decide are
+rejected.
+*/
+func TestEvaluateInvalidFlow(t *testing.T) {
+	src, dst := endpoint(t, "10.0.0.2"), endpoint(t, "10.0.1.2")
+	tests := []struct {
+		name string
+		flow Flow
+	}{
+		{"no direction", Flow{Source: src, Destination: dst, Protocol: "tcp", Port: 22}},
+		{"no protocol", Flow{Direction: Ingress, Source: src, Destination: dst, Port: 22}},
+		{"all protocols", Flow{Direction: Ingress, Source: src, Destination: dst, Protocol: "all"}},
+		{"port out of range", Flow{Direction: Ingress, Source: src, Destination: dst, Protocol: "tcp", Port: 70000}},
+		{"no source", Flow{Direction: Ingress, Destination: dst, Protocol: "tcp", Port: 22}},
+	}
+	for _, tt := range tests {
+		if d, err := Evaluate(nil, tt.flow); err == nil {
+			t.Errorf("Evaluate(%s) = %s, want an error", tt.name, d)
+		}
+	}
+}
+
+/*
+TestDecisionString verifies that the decision names the deciding rule, its
+location and the rules that decide part of the flow.
+*/
+func TestDecisionString(t *testing.T) {
+	rule := ingress("allow-ssh", 1000, false, []string{"10.0.0.0/8"}, tcp(PortRange{22, 22}))
+	rule.File, rule.Line = "configuration/security/gce.tfvars", 3
+	d := Decision{Allowed: true, Rule: rule, Partial: []Rule{ingress("deny-lab", 100, true, nil)}}
+	want := "ALLOW by allow-ssh (priority 1000) at configuration/security/gce.tfvars:3\n" +
+		"  note: deny-lab (priority 100) denies part of the flow's addresses first"
+	if got := d.String(); got != want {
+		t.Errorf("Decision.String() = %q, want %q", got, want)
+	}
+	if d.Implied() {
+		t.Errorf("Decision.Implied() = true for %s", rule.Name)
+	}
+	implied := Decision{Rule: ImpliedDenyIngress}
+	if got, want := implied.String(), "DENY by implied-deny-ingress (priority 65535)"; got != want || !implied.Implied() {
+		t.Errorf("Decision.String() = %q, Implied() = %v, want %q, true", got, implied.Implied(), want)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FakeRunner is a Runner that records every command instead of running it,
+// so that fixture logic can be tested without gcloud or a project.
+//
+// Errors and Outputs script the responses of a command, written as its
+// arguments up to the first flag, for example "compute networks create
+// my-vpc". The nth call of a command gets the nth entry, and the last entry
+// repeats once the list is used up; a nil error means success.
+type FakeRunner struct {
+	Errors  map[string][]error
+	Outputs map[string][]string
+
+	mu     sync.Mutex
+	calls  []string
+	counts map[string]int
+}
+
+// Run implements Runner.
+func (r *FakeRunner) Run(t testing.TB, args ...string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, strings.Join(args, " "))
+	name := commandName(args)
+	if r.counts == nil {
+		r.counts = map[string]int{}
+	}
+	n := r.counts[name]
+	r.counts[name]++
+	return scripted(r.Outputs[name], n), scripted(r.Errors[name], n)
+}
+
+// scripted returns the nth response, repeating the last one.
+func scripted[T any](responses []T, n int) T {
+	var zero T
+	if len(responses) == 0 {
+		return zero
+	}
+	return responses[min(n, len(responses)-1)]
+}
+
+// Calls returns the recorded commands, each joined with spaces, in the order
+// they ran.
+func (r *FakeRunner) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+// commandName returns the arguments before the first flag.
+func commandName(args []string) string {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			return strings.Join(args[:i], " ")
+		}
+	}
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fixtures creates the networking prerequisites the integration tests
+// deploy a stage into, such as a VPC network, subnets, a PSA range or a
+// service connection policy, using gcloud.
+//
+// Every fixture registers its teardown with t.Cleanup as soon as it is
+// created. Because cleanups run last-in first-out and a fixture can only be
+// created from the fixtures it depends on, resources are always deleted in
+// reverse dependency order, after any deferred terraform.Destroy in the test.
+// A delete that fails, typically because a dependant is still detaching, is
+// retried with backoff until it succeeds or the resource is gone.
+//
+// Every fixture is labeled with the run, test and creation time returned by
+// naming.Labels, so that leaked ones can be traced and cleaned up. Networks,
+// subnets and addresses, which have no labels, carry them as description.
+//
+// When a Recorder is set, every fixture is recorded before it is created and
+// marked done once deleted, so that a teardown.Supervisor can delete it even
+// when the test is interrupted before its cleanups run.
+//
+// Each fixture has two forms: Network fails the test when gcloud returns an
+// error, while NetworkE returns the error to the caller.
+package fixtures
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
+)
+
+// DefaultTeardownTimeout bounds the retries of a single teardown.
+const DefaultTeardownTimeout = 5 * time.Minute
+
+// Runner runs a gcloud command and returns its trimmed output.
+type Runner interface {
+	Run(t testing.TB, args ...string) (string, error)
+}
+
+// GcloudRunner runs commands with the gcloud binary found in PATH.
+type GcloudRunner struct{}
+
+// Run implements Runner.
+func (GcloudRunner) Run(t testing.TB, args ...string) (string, error) {
+	t.Helper()
+	t.Logf("Running command gcloud with args %v", args)
+	out, err := exec.Command("gcloud", args...).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		return output, fmt.Errorf("gcloud %s: %w: %s", strings.Join(args, " "), err, output)
+	}
+	return output, nil
+}
+
+// Recorder records a resource before a fixture creates it, and returns the
+// function that marks it done once the fixture deleted it.
+type Recorder interface {
+	Record(t testing.TB, r janitor.Resource) (done func())
+}
+
+// Fixtures creates resources in a single project and region.
+type Fixtures struct {
+	ProjectID string
+	Region    string
+	Runner    Runner
+
+	// Teardown retries failed deletes until its Timeout passes.
+	Teardown *wait.Waiter
+
+	// Labels returns the labels of the fixtures a test creates.
+	Labels func(t testing.TB) map[string]string
+
+	// Recorder, when set, records the fixtures until they are deleted.
+	Recorder Recorder
+}
+
+// New returns Fixtures that run gcloud against projectID and region.
+func New(projectID string, region string) *Fixtures {
+	teardown := wait.New()
+	teardown.Timeout = DefaultTeardownTimeout
+	return &Fixtures{
+		ProjectID: projectID,
+		Region:    region,
+		Runner:    GcloudRunner{},
+		Teardown:  teardown,
+		Labels:    naming.Labels,
+	}
+}
+
+// run runs a gcloud command that creates a resource.
+func (f *Fixtures) run(t testing.TB, args ...string) error {
+	t.Helper()
+	_, err := f.Runner.Run(t, args...)
+	return err
+}
+
+// labelFlag returns flag, --labels or --description, set to the labels of a
+// fixture t creates, or no flag when Labels is not set.
+func (f *Fixtures) labelFlag(t testing.TB, flag string) []string {
+	if f.Labels == nil {
+		return nil
+	}
+	return []string{flag + "=" + naming.Format(f.Labels(t))}
+}
+
+// record records r with the Recorder, if any, and returns the function that
+// marks it done.
+func (f *Fixtures) record(t testing.TB, r janitor.Resource) (done func()) {
+	t.Helper()
+	if f.Recorder == nil {
+		return nil
+	}
+	return f.Recorder.Record(t, r)
+}
+
+// teardown registers a gcloud command that deletes what and then calls done,
+// unless it is nil. A failed delete is retried, and reported with t.Errorf
+// once retries run out so that the remaining teardowns still run. A resource
+// that no longer exists counts as deleted.
+func (f *Fixtures) teardown(t testing.TB, what string, done func(), args ...string) {
+	t.Helper()
+	t.Cleanup(func() {
+		result, err := f.Teardown.UntilE("deleting "+what, func() (bool, error) {
+			_, err := f.Runner.Run(t, args...)
+			if err != nil && !isNotFound(err) {
+				return false, err
+			}
+			return true, nil
+		})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		t.Logf("Finished %s", result)
+		if done != nil {
+			done()
+		}
+	})
+}
+
+// isNotFound reports whether err is gcloud failing because the resource does
+// not exist.
+func isNotFound(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "was not found") || strings.Contains(msg, "NOT_FOUND")
+}
@@ -0,0 +1,330 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
+	"github.com/google/go-cmp/cmp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	projectID = "dummy-project-id"
+	region    = "us-central1"
+)
+
+func newFakeFixtures() (*Fixtures, *FakeRunner, *wait.FakeClock) {
+	runner := &FakeRunner{Errors: map[string][]error{}, Outputs: map[string][]string{}}
+	clock := wait.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	teardown := wait.NewFake(clock)
+	teardown.Timeout = DefaultTeardownTimeout
+	return &Fixtures{ProjectID: projectID, Region: region, Runner: runner, Teardown: teardown}, runner, clock
+}
+
+/*
+TestTeardownRunsInReverseDependencyOrder verifies that every fixture runs its
+create command, with the labels of the test, when called and its delete
+command once the test finishes, with dependants deleted before the resources
+they depend on.
+*/
+func TestTeardownRunsInReverseDependencyOrder(t *testing.T) {
+	f, runner, clock := newFakeFixtures()
+	f.Labels = func(testing.TB) map[string]string {
+		return naming.Run{ID: "k3f9q2"}.Labels("TestFixtures", clock.Now())
+	}
+	t.Run("fixtures", func(t *testing.T) {
+		network := f.Network(t, "vpc")
+		subnet := f.Subnet(t, network, "subnet", "10.0.0.0/24", "--enable-private-ip-google-access")
+		f.SecondaryRanges(t, subnet, map[string]string{"services": "10.2.0.0/16", "pods": "10.1.0.0/16"})
+		f.PSARange(t, network, "psa", "10.0.64.0/20")
+		f.ServiceConnectionPolicy(t, network, "policy", "gcp-memorystore-redis", []*Subnet{subnet}, 5)
+	})
+	want := []string{
+		"compute networks create vpc --project=dummy-project-id --format=json --bgp-routing-mode=global --subnet-mode=custom --verbosity=none --description=cncs-created=1704067200,cncs-run=k3f9q2,cncs-test=testfixtures",
+		"compute networks subnets create subnet --project=dummy-project-id --network=vpc --region=us-central1 --range=10.0.0.0/24 --description=cncs-created=1704067200,cncs-run=k3f9q2,cncs-test=testfixtures --enable-private-ip-google-access",
+		"compute networks subnets update subnet --project=dummy-project-id --region=us-central1 --add-secondary-ranges=pods=10.1.0.0/16 --add-secondary-ranges=services=10.2.0.0/16",
+		"compute addresses create psa --purpose=VPC_PEERING --addresses=10.0.64.0 --prefix-length=20 --project=dummy-project-id --network=vpc --global --verbosity=none --format=json --description=cncs-created=1704067200,cncs-run=k3f9q2,cncs-test=testfixtures",
+		"services vpc-peerings connect --service=servicenetworking.googleapis.com --ranges=psa --project=dummy-project-id --network=vpc --verbosity=none --format=json",
+		"network-connectivity service-connection-policies create policy --project=dummy-project-id --region=us-central1 --network=vpc --service-class=gcp-memorystore-redis --subnets=https://www.googleapis.com/compute/v1/projects/dummy-project-id/regions/us-central1/subnetworks/subnet --psc-connection-limit=5 --quiet --labels=cncs-created=1704067200,cncs-run=k3f9q2,cncs-test=testfixtures",
+		"network-connectivity service-connection-policies delete policy --project=dummy-project-id --region=us-central1 --quiet",
+		"services vpc-peerings delete --service=servicenetworking.googleapis.com --project=dummy-project-id --network=vpc --verbosity=none --format=json --quiet",
+		"compute addresses delete psa --project=dummy-project-id --global --verbosity=none --format=json --quiet",
+		"compute networks subnets update subnet --project=dummy-project-id --region=us-central1 --remove-secondary-ranges=pods,services",
+		"compute networks subnets delete subnet --project=dummy-project-id --region=us-central1 --quiet",
+		"compute networks delete vpc --project=dummy-project-id --quiet",
+	}
+	if diff := cmp.Diff(want, runner.Calls()); diff != "" {
+		t.Errorf("gcloud commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestFailedCreateRegistersNoTeardown verifies that a fixture whose create
+command fails returns the error and only the fixtures created before it are
+deleted.
+*/
+func TestFailedCreateRegistersNoTeardown(t *testing.T) {
+	f, runner, _ := newFakeFixtures()
+	runner.Errors["compute networks subnets create subnet"] = []error{errors.New("quota exceeded")}
+	t.Run("fixtures", func(t *testing.T) {
+		network := f.Network(t, "vpc")
+		_, err := f.SubnetE(t, network, "subnet", "10.0.0.0/24")
+		if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+			t.Errorf("SubnetE() = %v, want error wrapping quota exceeded", err)
+		}
+	})
+	want := []string{
+		"compute networks create vpc --project=dummy-project-id --format=json --bgp-routing-mode=global --subnet-mode=custom --verbosity=none",
+		"compute networks subnets create subnet --project=dummy-project-id --network=vpc --region=us-central1 --range=10.0.0.0/24",
+		"compute networks delete vpc --project=dummy-project-id --quiet",
+	}
+	if diff := cmp.Diff(want, runner.Calls()); diff != "" {
+		t.Errorf("gcloud commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// fakeRecorder records resources as a teardown.Supervisor does.
+type fakeRecorder struct {
+	recorded []string
+	done     map[string]bool
+}
+
+func (r *fakeRecorder) Record(t testing.TB, res janitor.Resource) func() {
+	r.recorded = append(r.recorded, res.String())
+	return func() { r.done[res.String()] = true }
+}
+
+/*
+TestRecorderTracksFixtures verifies that every fixture is recorded before it
+is created and marked done once deleted, and that a fixture whose create
+failed stays pending for the recorder to check.
+*/
+func TestRecorderTracksFixtures(t *testing.T) {
+	f, runner, _ := newFakeFixtures()
+	recorder := &fakeRecorder{done: map[string]bool{}}
+	f.Recorder = recorder
+	runner.Errors["network-connectivity service-connection-policies create policy"] = []error{errors.New("quota exceeded")}
+	t.Run("fixtures", func(t *testing.T) {
+		network := f.Network(t, "vpc")
+		subnet := f.Subnet(t, network, "subnet", "10.0.0.0/24")
+		f.PSARange(t, network, "psa", "10.0.64.0/20")
+		if _, err := f.ServiceConnectionPolicyE(t, network, "policy", "gcp-memorystore-redis", []*Subnet{subnet}, 5); err == nil {
+			t.Error("ServiceConnectionPolicyE() = nil, want error")
+		}
+		if len(recorder.done) != 0 {
+			t.Errorf("done before the test finished: %v", recorder.done)
+		}
+	})
+	want := []string{
+		"network vpc (global)",
+		"subnet subnet (us-central1)",
+		"address psa (global)",
+		"psa-peering servicenetworking-googleapis-com of network vpc",
+		"service-connection-policy policy (us-central1)",
+	}
+	if diff := cmp.Diff(want, recorder.recorded); diff != "" {
+		t.Errorf("recorded resources mismatch (-want +got):\n%s", diff)
+	}
+	wantDone := map[string]bool{
+		"network vpc (global)":        true,
+		"subnet subnet (us-central1)": true,
+		"address psa (global)":        true,
+		"psa-peering servicenetworking-googleapis-com of network vpc": true,
+	}
+	if diff := cmp.Diff(wantDone, recorder.done); diff != "" {
+		t.Errorf("done resources mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestTeardownRetriesUntilDeleted verifies that a delete failing because the
+resource is still in use is retried with backoff until it succeeds.
+*/
+func TestTeardownRetriesUntilDeleted(t *testing.T) {
+	f, runner, clock := newFakeFixtures()
+	inUse := errors.New("resource is in use by another resource")
+	runner.Errors["compute networks delete vpc"] = []error{inUse, inUse, nil}
+	t.Run("fixtures", func(t *testing.T) {
+		f.Network(t, "vpc")
+	})
+	deletes := 0
+	for _, call := range runner.Calls() {
+		if strings.HasPrefix(call, "compute networks delete vpc") {
+			deletes++
+		}
+	}
+	if deletes != 3 {
+		t.Errorf("network deleted %d times, want 3", deletes)
+	}
+	if diff := cmp.Diff([]time.Duration{5 * time.Second, 10 * time.Second}, clock.Sleeps()); diff != "" {
+		t.Errorf("sleeps mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestTeardownTreatsNotFoundAsDeleted verifies that a resource already deleted,
+for example by terraform destroy, is not retried.
+*/
+func TestTeardownTreatsNotFoundAsDeleted(t *testing.T) {
+	f, runner, clock := newFakeFixtures()
+	runner.Errors["compute networks delete vpc"] = []error{errors.New("The resource 'projects/dummy-project-id/global/networks/vpc' was not found")}
+	t.Run("fixtures", func(t *testing.T) {
+		f.Network(t, "vpc")
+	})
+	if got := len(runner.Calls()); got != 2 {
+		t.Errorf("ran %d commands, want 2", got)
+	}
+	if len(clock.Sleeps()) != 0 {
+		t.Errorf("sleeps = %v, want none", clock.Sleeps())
+	}
+}
+
+/*
+TestFailedTeardownIsReported verifies that a delete still failing at the
+deadline is reported as a test error and does not stop the remaining
+teardowns.
+*/
+func TestFailedTeardownIsReported(t *testing.T) {
+	f, runner, _ := newFakeFixtures()
+	runner.Errors["compute networks subnets delete subnet"] = []error{errors.New("resource in use")}
+	tb := &recordingTB{TB: t}
+	network := f.Network(tb, "vpc")
+	f.Subnet(tb, network, "subnet", "10.0.0.0/24")
+	tb.runCleanups()
+
+	if len(tb.errors) != 1 || !strings.Contains(tb.errors[0], "timed out waiting for deleting subnet subnet") || !strings.Contains(tb.errors[0], "resource in use") {
+		t.Errorf("reported errors = %q, want one timeout error for the subnet", tb.errors)
+	}
+	calls := runner.Calls()
+	if got, want := calls[len(calls)-1], "compute networks delete vpc --project=dummy-project-id --quiet"; got != want {
+		t.Errorf("last command = %q, want %q", got, want)
+	}
+}
+
+/*
+TestReadinessConditions verifies the gcloud commands and JSON paths used by
+the readiness conditions.
+*/
+func TestReadinessConditions(t *testing.T) {
+	f, runner, _ := newFakeFixtures()
+	runner.Outputs["sql instances describe db"] = []string{`{"state": "PENDING_CREATE"}`, `{"state": "RUNNABLE"}`}
+	runner.Outputs["compute networks peerings list"] = []string{`[{"name": "vpc", "peerings": [{"name": "servicenetworking-googleapis-com", "state": "ACTIVE"}]}]`}
+	runner.Errors["compute firewall-rules describe allow-ssh"] = []error{errors.New("was not found")}
+	runner.Outputs["compute networks subnets describe subnet"] = []string{`{"secondaryIpRanges": [{"rangeName": "pods"}, {"rangeName": "services"}]}`}
+	runner.Outputs["network-connectivity service-connection-policies describe policy"] = []string{`{"serviceClass": "gcp-memorystore-redis"}`}
+	runner.Errors["compute addresses describe psa"] = []error{nil, errors.New("NOT_FOUND")}
+
+	sql := f.CloudSQLInstanceState(t, "db", "RUNNABLE")
+	if done, err := sql(); done || err == nil {
+		t.Errorf("CloudSQLInstanceState() on PENDING_CREATE = %v, %v, want false with error", done, err)
+	}
+	if done, err := sql(); !done || err != nil {
+		t.Errorf("CloudSQLInstanceState() on RUNNABLE = %v, %v, want true", done, err)
+	}
+	if done, err := f.PSAPeeringActive(t, "vpc")(); !done || err != nil {
+		t.Errorf("PSAPeeringActive() = %v, %v, want true", done, err)
+	}
+	if done, _ := f.FirewallRuleVisible(t, "allow-ssh")(); done {
+		t.Errorf("FirewallRuleVisible() on missing rule = true, want false")
+	}
+	subnet := &Subnet{Name: "subnet", Region: "us-central1"}
+	if done, err := f.SecondaryRangeVisible(t, subnet, "services")(); !done || err != nil {
+		t.Errorf("SecondaryRangeVisible() = %v, %v, want true", done, err)
+	}
+	policy := &ServiceConnectionPolicy{Name: "policy", ServiceClass: "gcp-memorystore-redis"}
+	if done, err := f.ServiceConnectionPolicyVisible(t, policy)(); !done || err != nil {
+		t.Errorf("ServiceConnectionPolicyVisible() = %v, %v, want true", done, err)
+	}
+	gone := f.GlobalAddressGone(t, "psa")
+	if done, err := gone(); done || err == nil {
+		t.Errorf("GlobalAddressGone() on existing address = %v, %v, want false with error", done, err)
+	}
+	if done, err := gone(); !done || err != nil {
+		t.Errorf("GlobalAddressGone() on deleted address = %v, %v, want true", done, err)
+	}
+	want := []string{
+		"sql instances describe db --project=dummy-project-id --format=json",
+		"sql instances describe db --project=dummy-project-id --format=json",
+		"compute networks peerings list --network=vpc --project=dummy-project-id --format=json",
+		"compute firewall-rules describe allow-ssh --project=dummy-project-id --format=json",
+		"compute networks subnets describe subnet --region=us-central1 --project=dummy-project-id --format=json",
+		"network-connectivity service-connection-policies describe policy --region=us-central1 --project=dummy-project-id --format=json",
+		"compute addresses describe psa --global --project=dummy-project-id --format=json",
+		"compute addresses describe psa --global --project=dummy-project-id --format=json",
+	}
+	if diff := cmp.Diff(want, runner.Calls()); diff != "" {
+		t.Errorf("gcloud commands mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestPSAAddressFlags verifies how the PSA range CIDR is turned into gcloud
+flags.
+*/
+func TestPSAAddressFlags(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		want    []string
+		wantErr bool
+	}{
+		{cidr: "10.0.64.0/20", want: []string{"--addresses=10.0.64.0", "--prefix-length=20"}},
+		{cidr: "/24", want: []string{"--prefix-length=24"}},
+		{cidr: "/32", wantErr: true},
+		{cidr: "10.0.64.0", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := psaAddressFlags(tc.cidr)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("psaAddressFlags(%q) error = %v, wantErr %v", tc.cidr, err, tc.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tc.want, got); diff != "" {
+			t.Errorf("psaAddressFlags(%q) mismatch (-want +got):\n%s", tc.cidr, diff)
+		}
+	}
+}
+
+// recordingTB collects errors and cleanups instead of acting on them.
+type recordingTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Cleanup(f func()) {
+	r.cleanups = append(r.cleanups, f)
+}
+
+func (r *recordingTB) Error(args ...any) {
+	r.errors = append(r.errors, fmt.Sprint(args...))
+}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingTB) runCleanups() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+)
+
+// Network is a custom mode VPC network.
+type Network struct {
+	Name      string
+	ProjectID string
+}
+
+// ID returns the network in the projects/{project}/global/networks/{name}
+// form the stages expect as network_id.
+func (n *Network) ID() string {
+	return fmt.Sprintf("projects/%s/global/networks/%s", n.ProjectID, n.Name)
+}
+
+// Network creates a custom mode VPC network with global routing.
+func (f *Fixtures) Network(t testing.TB, name string) *Network {
+	t.Helper()
+	v, err := f.NetworkE(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// NetworkE is like Network but returns an error instead of failing the test.
+func (f *Fixtures) NetworkE(t testing.TB, name string) (*Network, error) {
+	t.Helper()
+	done := f.record(t, janitor.Resource{Kind: janitor.Network, Name: name})
+	args := []string{"compute", "networks", "create", name, "--project=" + f.ProjectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=none"}
+	if err := f.run(t, append(args, f.labelFlag(t, "--description")...)...); err != nil {
+		return nil, fmt.Errorf("creating network %s: %w", name, err)
+	}
+	f.teardown(t, "network "+name, done, "compute", "networks", "delete", name, "--project="+f.ProjectID, "--quiet")
+	return &Network{Name: name, ProjectID: f.ProjectID}, nil
+}
+
+// Subnet is a subnetwork of a Network in the fixture region.
+type Subnet struct {
+	Name      string
+	Network   *Network
+	Region    string
+	CIDR      string
+	ProjectID string
+}
+
+// ID returns the subnet in the projects/{project}/regions/{region}/subnetworks/{name} form.
+func (s *Subnet) ID() string {
+	return fmt.Sprintf("projects/%s/regions/%s/subnetworks/%s", s.ProjectID, s.Region, s.Name)
+}
+
+// SelfLink returns the full compute API URL of the subnet.
+func (s *Subnet) SelfLink() string {
+	return "https://www.googleapis.com/compute/v1/" + s.ID()
+}
+
+// Subnet creates a subnet of network with the primary range cidr. Extra
+// gcloud flags, such as --enable-private-ip-google-access, are passed through.
+func (f *Fixtures) Subnet(t testing.TB, network *Network, name string, cidr string, flags ...string) *Subnet {
+	t.Helper()
+	v, err := f.SubnetE(t, network, name, cidr, flags...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// SubnetE is like Subnet but returns an error instead of failing the test.
+func (f *Fixtures) SubnetE(t testing.TB, network *Network, name string, cidr string, flags ...string) (*Subnet, error) {
+	t.Helper()
+	done := f.record(t, janitor.Resource{Kind: janitor.Subnet, Name: name, Location: f.Region, Network: network.Name})
+	args := []string{"compute", "networks", "subnets", "create", name, "--project=" + f.ProjectID, "--network=" + network.Name, "--region=" + f.Region, "--range=" + cidr}
+	args = append(args, f.labelFlag(t, "--description")...)
+	if err := f.run(t, append(args, flags...)...); err != nil {
+		return nil, fmt.Errorf("creating subnet %s: %w", name, err)
+	}
+	f.teardown(t, "subnet "+name, done, "compute", "networks", "subnets", "delete", name, "--project="+f.ProjectID, "--region="+f.Region, "--quiet")
+	return &Subnet{Name: name, Network: network, Region: f.Region, CIDR: cidr, ProjectID: f.ProjectID}, nil
+}
+
+// SecondaryRanges adds named secondary ranges, such as the GKE pod and
+// service ranges, to subnet. ranges maps each range name to its CIDR.
+func (f *Fixtures) SecondaryRanges(t testing.TB, subnet *Subnet, ranges map[string]string) {
+	t.Helper()
+	if err := f.SecondaryRangesE(t, subnet, ranges); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// SecondaryRangesE is like SecondaryRanges but returns an error instead of
+// failing the test.
+func (f *Fixtures) SecondaryRangesE(t testing.TB, subnet *Subnet, ranges map[string]string) error {
+	t.Helper()
+	names := make([]string, 0, len(ranges))
+	for name := range ranges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := []string{"compute", "networks", "subnets", "update", subnet.Name, "--project=" + f.ProjectID, "--region=" + subnet.Region}
+	for _, name := range names {
+		args = append(args, "--add-secondary-ranges="+name+"="+ranges[name])
+	}
+	if err := f.run(t, args...); err != nil {
+		return fmt.Errorf("adding secondary ranges to subnet %s: %w", subnet.Name, err)
+	}
+	f.teardown(t, "secondary ranges of subnet "+subnet.Name, nil, "compute", "networks", "subnets", "update", subnet.Name, "--project="+f.ProjectID, "--region="+subnet.Region, "--remove-secondary-ranges="+strings.Join(names, ","))
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+)
+
+const serviceNetworkingService = "servicenetworking.googleapis.com"
+
+// PSARange is a global address range allocated for private services access
+// and peered with the service networking producer network.
+type PSARange struct {
+	Name    string
+	Network *Network
+	CIDR    string
+}
+
+// PSARange allocates the range name in network and connects it to service
+// networking. cidr is either a full prefix such as "10.0.64.0/20", or only a
+// prefix length such as "/24" to let Google choose the addresses.
+func (f *Fixtures) PSARange(t testing.TB, network *Network, name string, cidr string) *PSARange {
+	t.Helper()
+	v, err := f.PSARangeE(t, network, name, cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// PSARangeE is like PSARange but returns an error instead of failing the test.
+func (f *Fixtures) PSARangeE(t testing.TB, network *Network, name string, cidr string) (*PSARange, error) {
+	t.Helper()
+	addressFlags, err := psaAddressFlags(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("creating PSA range %s: %w", name, err)
+	}
+	done := f.record(t, janitor.Resource{Kind: janitor.Address, Name: name, Network: network.Name})
+	args := append([]string{"compute", "addresses", "create", name, "--purpose=VPC_PEERING"}, addressFlags...)
+	args = append(args, "--project="+f.ProjectID, "--network="+network.Name, "--global", "--verbosity=none", "--format=json")
+	args = append(args, f.labelFlag(t, "--description")...)
+	if err := f.run(t, args...); err != nil {
+		return nil, fmt.Errorf("creating PSA range %s: %w", name, err)
+	}
+	f.teardown(t, "PSA range "+name, done, "compute", "addresses", "delete", name, "--project="+f.ProjectID, "--global", "--verbosity=none", "--format=json", "--quiet")
+
+	done = f.record(t, janitor.Resource{Kind: janitor.PSAPeering, Name: janitor.PSAPeeringName, Network: network.Name})
+	if err := f.run(t, "services", "vpc-peerings", "connect", "--service="+serviceNetworkingService, "--ranges="+name, "--project="+f.ProjectID, "--network="+network.Name, "--verbosity=none", "--format=json"); err != nil {
+		return nil, fmt.Errorf("connecting PSA range %s: %w", name, err)
+	}
+	f.teardown(t, "PSA connection of network "+network.Name, done, "services", "vpc-peerings", "delete", "--service="+serviceNetworkingService, "--project="+f.ProjectID, "--network="+network.Name, "--verbosity=none", "--format=json", "--quiet")
+	return &PSARange{Name: name, Network: network, CIDR: cidr}, nil
+}
+
+// psaAddressFlags converts cidr into the --addresses and --prefix-length
+// flags of gcloud compute addresses create.
+func psaAddressFlags(cidr string) ([]string, error) {
+	if length, ok := strings.CutPrefix(cidr, "/"); ok {
+		if n, err := strconv.Atoi(length); err != nil || n < 8 || n > 29 {
+			return nil, fmt.Errorf("invalid prefix length %q", cidr)
+		}
+		return []string{"--prefix-length=" + length}, nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"--addresses=" + prefix.Addr().String(), "--prefix-length=" + strconv.Itoa(prefix.Bits())}, nil
+}
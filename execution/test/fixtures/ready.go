@@ -0,0 +1,96 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
+	"github.com/tidwall/gjson"
+)
+
+// servicePeeringName is the VPC peering private services access creates.
+const servicePeeringName = "servicenetworking-googleapis-com"
+
+// JSONField returns a readiness condition that runs a gcloud describe or
+// list command with --format=json and is met once the value at path, in
+// gjson syntax, equals one of want.
+func (f *Fixtures) JSONField(t testing.TB, path string, want []string, args ...string) wait.Condition {
+	args = append(args, "--project="+f.ProjectID, "--format=json")
+	return func() (bool, error) {
+		output, err := f.Runner.Run(t, args...)
+		if err != nil {
+			return false, err
+		}
+		if !gjson.Valid(output) {
+			return false, fmt.Errorf("invalid json: %s", output)
+		}
+		got := gjson.Get(output, path).String()
+		if !slices.Contains(want, got) {
+			return false, fmt.Errorf("%s is %q, want one of %q", path, got, want)
+		}
+		return true, nil
+	}
+}
+
+// CloudSQLInstanceState returns a condition met once the Cloud SQL instance
+// is in state, for example "RUNNABLE".
+func (f *Fixtures) CloudSQLInstanceState(t testing.TB, instance string, state string) wait.Condition {
+	return f.JSONField(t, "state", []string{state}, "sql", "instances", "describe", instance)
+}
+
+// PSAPeeringActive returns a condition met once the private services access
+// peering of network is ACTIVE.
+func (f *Fixtures) PSAPeeringActive(t testing.TB, network string) wait.Condition {
+	path := fmt.Sprintf(`0.peerings.#(name=="%s").state`, servicePeeringName)
+	return f.JSONField(t, path, []string{"ACTIVE"}, "compute", "networks", "peerings", "list", "--network="+network)
+}
+
+// FirewallRuleVisible returns a condition met once the firewall rule can be
+// described.
+func (f *Fixtures) FirewallRuleVisible(t testing.TB, rule string) wait.Condition {
+	return f.JSONField(t, "name", []string{rule}, "compute", "firewall-rules", "describe", rule)
+}
+
+// SecondaryRangeVisible returns a condition met once the secondary range
+// rangeName of subnet is listed.
+func (f *Fixtures) SecondaryRangeVisible(t testing.TB, subnet *Subnet, rangeName string) wait.Condition {
+	path := fmt.Sprintf(`secondaryIpRanges.#(rangeName=="%s").rangeName`, rangeName)
+	return f.JSONField(t, path, []string{rangeName}, "compute", "networks", "subnets", "describe", subnet.Name, "--region="+subnet.Region)
+}
+
+// ServiceConnectionPolicyVisible returns a condition met once the service
+// connection policy can be described.
+func (f *Fixtures) ServiceConnectionPolicyVisible(t testing.TB, policy *ServiceConnectionPolicy) wait.Condition {
+	return f.JSONField(t, "serviceClass", []string{policy.ServiceClass}, "network-connectivity", "service-connection-policies", "describe", policy.Name, "--region="+f.Region)
+}
+
+// GlobalAddressGone returns a condition met once the global address, for
+// example a PSA range an earlier test shares, no longer exists.
+func (f *Fixtures) GlobalAddressGone(t testing.TB, name string) wait.Condition {
+	args := []string{"compute", "addresses", "describe", name, "--global", "--project=" + f.ProjectID, "--format=json"}
+	return func() (bool, error) {
+		_, err := f.Runner.Run(t, args...)
+		switch {
+		case err == nil:
+			return false, fmt.Errorf("global address %s still exists", name)
+		case isNotFound(err):
+			return true, nil
+		}
+		return false, err
+	}
+}
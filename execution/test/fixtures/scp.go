@@ -0,0 +1,61 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fixtures
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+)
+
+// ServiceConnectionPolicy lets a producer service, such as Memorystore for
+// Redis Cluster, create PSC endpoints in the listed subnets of a network.
+type ServiceConnectionPolicy struct {
+	Name         string
+	Network      *Network
+	ServiceClass string
+	Subnets      []*Subnet
+}
+
+// ServiceConnectionPolicy creates a policy for serviceClass, for example
+// "gcp-memorystore-redis", in the fixture region.
+func (f *Fixtures) ServiceConnectionPolicy(t testing.TB, network *Network, name string, serviceClass string, subnets []*Subnet, connectionLimit int) *ServiceConnectionPolicy {
+	t.Helper()
+	v, err := f.ServiceConnectionPolicyE(t, network, name, serviceClass, subnets, connectionLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// ServiceConnectionPolicyE is like ServiceConnectionPolicy but returns an
+// error instead of failing the test.
+func (f *Fixtures) ServiceConnectionPolicyE(t testing.TB, network *Network, name string, serviceClass string, subnets []*Subnet, connectionLimit int) (*ServiceConnectionPolicy, error) {
+	t.Helper()
+	selfLinks := make([]string, len(subnets))
+	for i, subnet := range subnets {
+		selfLinks[i] = subnet.SelfLink()
+	}
+	done := f.record(t, janitor.Resource{Kind: janitor.ServiceConnectionPolicy, Name: name, Location: f.Region, Network: network.Name})
+	args := []string{"network-connectivity", "service-connection-policies", "create", name, "--project=" + f.ProjectID, "--region=" + f.Region, "--network=" + network.Name, "--service-class=" + serviceClass, "--subnets=" + strings.Join(selfLinks, ","), "--psc-connection-limit=" + strconv.Itoa(connectionLimit), "--quiet"}
+	if err := f.run(t, append(args, f.labelFlag(t, "--labels")...)...); err != nil {
+		return nil, fmt.Errorf("creating service connection policy %s: %w", name, err)
+	}
+	f.teardown(t, "service connection policy "+name, done, "network-connectivity", "service-connection-policies", "delete", name, "--project="+f.ProjectID, "--region="+f.Region, "--quiet")
+	return &ServiceConnectionPolicy{Name: name, Network: network, ServiceClass: serviceClass, Subnets: subnets}, nil
+}
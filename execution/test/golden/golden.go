@@ -0,0 +1,97 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package golden compares test output against golden files checked in next
+// to the tests, and regenerates them when the tests run with -update:
+//
+//	go test ./unit/... -update
+//
+// Only test packages that import golden define the flag, so pass -update to
+// those packages rather than to ./... as a whole.
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "regenerate golden files instead of comparing against them")
+
+// Updating reports whether the tests run with -update.
+func Updating() bool {
+	return *update
+}
+
+// File compares got with the contents of the golden file at path and fails
+// the test with a diff if they differ. With -update it writes got to path
+// instead, creating the directory if needed.
+func File(t testing.TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := write(path, got); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("Updated golden file %s", path)
+		return
+	}
+	if err := CompareE(path, got); err != nil {
+		t.Error(err)
+	}
+}
+
+// CompareE compares got with the golden file at path. JSON content is
+// compared structurally, so the diff names the changed keys; anything else
+// is compared line by line.
+func CompareE(path string, got []byte) error {
+	want, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("golden file %s does not exist, run go test -update to create it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(want, got) {
+		return nil
+	}
+	var diff string
+	var wantJSON, gotJSON any
+	if json.Unmarshal(want, &wantJSON) == nil && json.Unmarshal(got, &gotJSON) == nil {
+		diff = cmp.Diff(wantJSON, gotJSON)
+	}
+	if diff == "" {
+		// Not JSON, or only the formatting differs.
+		diff = cmp.Diff(lines(want), lines(got))
+	}
+	return fmt.Errorf("output does not match golden file %s, run the test with -update if the change is intended (-want +got):\n%s", path, diff)
+}
+
+func write(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+func lines(b []byte) []string {
+	return strings.Split(string(b), "\n")
+}
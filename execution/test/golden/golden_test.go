@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golden
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+const planJSON = `{
+  "format_version": "1.2",
+  "terraform_version": "1.9.5",
+  "configuration": {"provider_config": {"google": {"name": "google", "version_constraint": ">= 5.0.0"}}},
+  "resource_changes": [
+    {
+      "address": "module.vpc.google_compute_subnetwork.subnet[\"us-central1/subnet\"]",
+      "provider_name": "registry.terraform.io/hashicorp/google",
+      "change": {
+        "actions": ["create"],
+        "after": {"name": "subnet", "ip_cidr_range": "10.0.0.0/24", "secondary_ip_range": [{"range_name": "pods"}]},
+        "after_unknown": {"id": true, "secondary_ip_range": [{"ip_cidr_range": true}]},
+        "after_sensitive": {}
+      }
+    },
+    {
+      "address": "google_sql_user.root",
+      "provider_name": "registry.terraform.io/hashicorp/google",
+      "change": {
+        "actions": ["create"],
+        "after": {"name": "root", "password": "secret"},
+        "after_unknown": {},
+        "after_sensitive": {"password": true}
+      }
+    },
+    {
+      "address": "google_compute_network.old",
+      "change": {
+        "actions": ["delete"],
+        "before": {"name": "old"},
+        "after": null,
+        "after_unknown": {},
+        "after_sensitive": false
+      }
+    }
+  ],
+  "output_changes": {
+    "network_id": {"actions": ["create"], "after_unknown": true, "after_sensitive": false}
+  }
+}`
+
+const wantSnapshot = `{
+  "resource_changes": [
+    {
+      "address": "google_compute_network.old",
+      "actions": [
+        "delete"
+      ],
+      "after": null
+    },
+    {
+      "address": "google_sql_user.root",
+      "actions": [
+        "create"
+      ],
+      "after": {
+        "name": "root",
+        "password": "(sensitive value)"
+      }
+    },
+    {
+      "address": "module.vpc.google_compute_subnetwork.subnet[\"us-central1/subnet\"]",
+      "actions": [
+        "create"
+      ],
+      "after": {
+        "id": "(known after apply)",
+        "ip_cidr_range": "10.0.0.0/24",
+        "name": "subnet",
+        "secondary_ip_range": [
+          {
+            "ip_cidr_range": "(known after apply)",
+            "range_name": "pods"
+          }
+        ]
+      }
+    }
+  ],
+  "outputs": {
+    "network_id": "(known after apply)"
+  }
+}
+`
+
+/*
+TestNormalizePlan verifies that resources are sorted, unknown and sensitive
+values are replaced with placeholders and run-specific fields are dropped.
+*/
+func TestNormalizePlan(t *testing.T) {
+	var plan tfjson.Plan
+	if err := json.Unmarshal([]byte(planJSON), &plan); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NormalizePlan(&plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(wantSnapshot, string(got)); diff != "" {
+		t.Errorf("NormalizePlan() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestFileUpdateAndCompare verifies that -update writes the golden file and
+that later comparisons report missing files and structured differences.
+*/
+func TestFileUpdateAndCompare(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "plan.golden.json")
+	if err := CompareE(path, []byte("{}")); err == nil || !strings.Contains(err.Error(), "run go test -update to create it") {
+		t.Errorf("CompareE() on missing file = %v, want a hint to use -update", err)
+	}
+
+	*update = true
+	File(t, path, []byte(`{"resource_changes": [{"address": "a", "after": {"ipv4_enabled": false}}]}`))
+	*update = false
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("golden file not written: %v", err)
+	}
+
+	if err := CompareE(path, []byte(`{"resource_changes": [{"address": "a", "after": {"ipv4_enabled": false}}]}`)); err != nil {
+		t.Errorf("CompareE() on identical content = %v, want nil", err)
+	}
+	err := CompareE(path, []byte(`{"resource_changes": [{"address": "a", "after": {"ipv4_enabled": true}}]}`))
+	if err == nil {
+		t.Fatal("CompareE() on changed content = nil, want diff")
+	}
+	// cmp.Diff randomly mixes spaces and non-breaking spaces.
+	if got := strings.Join(strings.Fields(err.Error()), " "); !strings.Contains(got, `+ "after": map[string]any{"ipv4_enabled": bool(true)}`) {
+		t.Errorf("CompareE() = %v, want a structured diff of the changed value", err)
+	}
+}
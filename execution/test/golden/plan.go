@@ -0,0 +1,155 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golden
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Placeholders written into a normalized plan for values the plan does not
+// know or must not show.
+const (
+	Unknown   = "(known after apply)"
+	Sensitive = "(sensitive value)"
+)
+
+// PlanSnapshot is the normalized form of a plan that is stored in golden
+// files. It keeps what a configuration change can affect, the planned
+// actions and values of every resource and output, and drops what varies
+// between runs, such as the Terraform and provider versions and the prior
+// state.
+type PlanSnapshot struct {
+	ResourceChanges []ResourceSnapshot `json:"resource_changes"`
+	Outputs         map[string]any     `json:"outputs,omitempty"`
+}
+
+// ResourceSnapshot is the normalized change of one resource.
+type ResourceSnapshot struct {
+	Address string   `json:"address"`
+	Actions []string `json:"actions"`
+	After   any      `json:"after"`
+}
+
+// Plan compares the normalized plan with the golden file at path, or
+// rewrites the golden file with -update. plan is typically the result of
+// terraform.InitAndPlanAndShowWithStruct. A missing golden file fails the
+// test like a changed one.
+func Plan(t testing.TB, plan *terraform.PlanStruct, path string) {
+	t.Helper()
+	if plan == nil {
+		t.Fatal("golden: nil plan")
+	}
+	got, err := NormalizePlan(&plan.RawPlan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	File(t, path, got)
+}
+
+// NormalizePlan returns the indented JSON encoding of the PlanSnapshot of
+// plan. Resources are sorted by address and object keys are sorted, values
+// known only after apply are replaced with Unknown and sensitive values with
+// Sensitive.
+func NormalizePlan(plan *tfjson.Plan) ([]byte, error) {
+	snapshot := PlanSnapshot{ResourceChanges: []ResourceSnapshot{}}
+	for _, rc := range plan.ResourceChanges {
+		if rc.Change == nil {
+			continue
+		}
+		actions := make([]string, len(rc.Change.Actions))
+		for i, action := range rc.Change.Actions {
+			actions[i] = string(action)
+		}
+		snapshot.ResourceChanges = append(snapshot.ResourceChanges, ResourceSnapshot{
+			Address: rc.Address,
+			Actions: actions,
+			After:   after(rc.Change),
+		})
+	}
+	sort.Slice(snapshot.ResourceChanges, func(i, j int) bool {
+		return snapshot.ResourceChanges[i].Address < snapshot.ResourceChanges[j].Address
+	})
+	if len(plan.OutputChanges) > 0 {
+		snapshot.Outputs = map[string]any{}
+		for name, change := range plan.OutputChanges {
+			snapshot.Outputs[name] = after(change)
+		}
+	}
+	out, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding plan snapshot: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// after returns the planned value of change with the unknown and sensitive
+// placeholders applied.
+func after(change *tfjson.Change) any {
+	value := mark(change.After, change.AfterUnknown, Unknown)
+	return mark(value, change.AfterSensitive, Sensitive)
+}
+
+// mark replaces the parts of value that marks flags as true with
+// placeholder. marks mirrors the structure of value, as after_unknown and
+// after_sensitive do in the plan JSON, and may name keys that value lacks.
+func mark(value, marks any, placeholder string) any {
+	switch m := marks.(type) {
+	case bool:
+		if m {
+			return placeholder
+		}
+	case map[string]any:
+		object, ok := value.(map[string]any)
+		if !ok && value != nil {
+			return value
+		}
+		marked := make(map[string]any, len(object))
+		for k, v := range object {
+			marked[k] = v
+		}
+		for k, km := range m {
+			if v := mark(object[k], km, placeholder); v != nil {
+				marked[k] = v
+			}
+		}
+		if value == nil && len(marked) == 0 {
+			return nil
+		}
+		return marked
+	case []any:
+		list, ok := value.([]any)
+		if !ok && value != nil {
+			return value
+		}
+		marked := append([]any(nil), list...)
+		for i, im := range m {
+			if i >= len(marked) {
+				marked = append(marked, nil)
+			}
+			marked[i] = mark(marked[i], im, placeholder)
+		}
+		if value == nil && len(marked) == 0 {
+			return nil
+		}
+		return marked
+	}
+	return value
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// Defaults of the HA VPN variables of 02-networking, used by HAVPNFromVars
+// for the variables a test leaves unset.
+const (
+	DefaultRouterASN           = 64513
+	DefaultTunnel1SessionRange = "169.254.1.2/30"
+	DefaultTunnel2SessionRange = "169.254.2.2/30"
+)
+
+// VPNTunnel is one of the tunnels of havpn.tf.
+type VPNTunnel struct {
+	// Name identifies the tunnel in errors, for example "tunnel_1".
+	Name string
+	// SessionRange is the Cloud Router side of the BGP session, a host
+	// address of a link-local /30 such as 169.254.1.2/30.
+	SessionRange string
+	// PeerIP is the peer side of the BGP session.
+	PeerIP  string
+	PeerASN int64
+}
+
+// HAVPN is the Cloud Router and tunnels of havpn.tf.
+type HAVPN struct {
+	RouterASN int64
+	Tunnels   []VPNTunnel
+}
+
+// HAVPNFromVars reads the HA VPN inputs from the variables passed to
+// 02-networking, such as the tfVars of its unit tests, applying the
+// defaults of variables.tf to router1_asn and the session ranges.
+func HAVPNFromVars(vars map[string]any) (HAVPN, error) {
+	var errs []error
+	str := func(name, def string) string {
+		v, err := stringVar(vars, name)
+		errs = append(errs, err)
+		if _, ok := vars[name]; !ok {
+			return def
+		}
+		return v
+	}
+	num := func(name string, def int64) int64 {
+		v, err := intVar(vars, name)
+		errs = append(errs, err)
+		if _, ok := vars[name]; !ok {
+			return def
+		}
+		return v
+	}
+	vpn := HAVPN{RouterASN: num("router1_asn", DefaultRouterASN)}
+	for _, t := range []struct{ name, sessionRange string }{
+		{"tunnel_1", DefaultTunnel1SessionRange},
+		{"tunnel_2", DefaultTunnel2SessionRange},
+	} {
+		vpn.Tunnels = append(vpn.Tunnels, VPNTunnel{
+			Name:         t.name,
+			SessionRange: str(t.name+"_router_bgp_session_range", t.sessionRange),
+			PeerIP:       str(t.name+"_bgp_peer_ip_address", ""),
+			PeerASN:      num(t.name+"_bgp_peer_asn", 0),
+		})
+	}
+	return vpn, errors.Join(errs...)
+}
+
+// ValidateHAVPN checks that the Cloud Router ASN is private, that each peer
+// ASN is a valid public or private ASN that differs from it, that each
+// session range is a usable host of a /30 inside 169.254.0.0/16 that no
+// other tunnel uses, and that each peer IP is the other usable host of its
+// tunnel's /30.
+func ValidateHAVPN(vpn HAVPN) error {
+	errs := []error{checkPrivateASN("Cloud Router ASN", vpn.RouterASN)}
+	ranges := map[string]netip.Prefix{}
+	for _, tunnel := range vpn.Tunnels {
+		errs = append(errs, validateSession(tunnel, ranges)...)
+		if err := checkPeerASN("peer ASN", tunnel.PeerASN); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tunnel.Name, err))
+		} else if tunnel.PeerASN == vpn.RouterASN {
+			errs = append(errs, fmt.Errorf("%s: peer ASN %d equals the Cloud Router ASN", tunnel.Name, tunnel.PeerASN))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateSession checks the BGP session addresses of tunnel and records
+// its /30 in ranges, keyed by tunnel name.
+func validateSession(tunnel VPNTunnel, ranges map[string]netip.Prefix) []error {
+	session, err := parseLinkLocal("BGP session range", tunnel.SessionRange, 30, false)
+	if err != nil {
+		return []error{fmt.Errorf("%s: %w", tunnel.Name, err)}
+	}
+	var errs []error
+	network := session.Masked()
+	hosts := [2]netip.Addr{network.Addr().Next(), network.Addr().Next().Next()}
+	router := session.Addr()
+	if router != hosts[0] && router != hosts[1] {
+		errs = append(errs, fmt.Errorf("%s: BGP session range %s must use one of the usable hosts %s and %s of %s",
+			tunnel.Name, session, hosts[0], hosts[1], network))
+	}
+	for other, p := range ranges {
+		if p == network {
+			errs = append(errs, fmt.Errorf("%s: BGP session range %s reuses %s of %s", tunnel.Name, session, network, other))
+		}
+	}
+	ranges[tunnel.Name] = network
+
+	want := hosts[0]
+	if router == hosts[0] {
+		want = hosts[1]
+	}
+	peer, err := netip.ParseAddr(tunnel.PeerIP)
+	switch {
+	case err != nil || !peer.Is4():
+		errs = append(errs, fmt.Errorf("%s: BGP peer IP address %q is not an IPv4 address", tunnel.Name, tunnel.PeerIP))
+	case peer == router:
+		errs = append(errs, fmt.Errorf("%s: BGP peer IP address %s is the Cloud Router address of BGP session range %s",
+			tunnel.Name, peer, session))
+	case !network.Contains(peer) || (peer != hosts[0] && peer != hosts[1]):
+		errs = append(errs, fmt.Errorf("%s: BGP peer IP address %s must be %s, the other usable host of BGP session range %s",
+			tunnel.Name, peer, want, session))
+	}
+	return errs
+}
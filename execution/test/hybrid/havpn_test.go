@@ -0,0 +1,199 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// validHAVPN returns the two tunnels of the 02-networking defaults with a
+// peer ASN that differs from the Cloud Router ASN.
+func validHAVPN() HAVPN {
+	return HAVPN{
+		RouterASN: 64513,
+		Tunnels: []VPNTunnel{
+			{Name: "tunnel_1", SessionRange: "169.254.1.2/30", PeerIP: "169.254.1.1", PeerASN: 64514},
+			{Name: "tunnel_2", SessionRange: "169.254.2.2/30", PeerIP: "169.254.2.1", PeerASN: 64514},
+		},
+	}
+}
+
+/*
+TestValidateHAVPN verifies each rule of ValidateHAVPN against a variation of
+a valid configuration and the message it reports.
+*/
+func TestValidateHAVPN(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(vpn *HAVPN)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(vpn *HAVPN) {},
+		},
+		{
+			name: "valid with the router on the first host and 4-byte ASNs",
+			modify: func(vpn *HAVPN) {
+				vpn.RouterASN = 4200000001
+				vpn.Tunnels[0].SessionRange = "169.254.1.1/30"
+				vpn.Tunnels[0].PeerIP = "169.254.1.2"
+				vpn.Tunnels[1].PeerASN = 4200000002
+			},
+		},
+		{
+			name: "session range not a /30",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].SessionRange = "169.254.1.2/29"
+			},
+			want: []string{"tunnel_1: BGP session range 169.254.1.2/29 must be a /30 inside 169.254.0.0/16"},
+		},
+		{
+			name: "session range outside link-local",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].SessionRange = "10.0.0.2/30"
+			},
+			want: []string{"tunnel_1: BGP session range 10.0.0.2/30 must be a /30 inside 169.254.0.0/16"},
+		},
+		{
+			name: "session range not a CIDR",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[1].SessionRange = "169.254.2.2"
+			},
+			want: []string{`tunnel_2: BGP session range "169.254.2.2" is not an IPv4 CIDR range`},
+		},
+		{
+			name: "session range on the network address",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].SessionRange = "169.254.1.0/30"
+			},
+			want: []string{"tunnel_1: BGP session range 169.254.1.0/30 must use one of the usable hosts 169.254.1.1 and 169.254.1.2 of 169.254.1.0/30"},
+		},
+		{
+			name: "session range on the broadcast address",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].SessionRange = "169.254.1.3/30"
+			},
+			want: []string{"tunnel_1: BGP session range 169.254.1.3/30 must use one of the usable hosts 169.254.1.1 and 169.254.1.2 of 169.254.1.0/30"},
+		},
+		{
+			name: "peer IP outside the session range",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].PeerIP = "169.254.2.1"
+			},
+			want: []string{"tunnel_1: BGP peer IP address 169.254.2.1 must be 169.254.1.1, the other usable host of BGP session range 169.254.1.2/30"},
+		},
+		{
+			name: "peer IP on the broadcast address",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[1].PeerIP = "169.254.2.3"
+			},
+			want: []string{"tunnel_2: BGP peer IP address 169.254.2.3 must be 169.254.2.1, the other usable host of BGP session range 169.254.2.2/30"},
+		},
+		{
+			name: "peer IP equals the router address",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].PeerIP = "169.254.1.2"
+			},
+			want: []string{"tunnel_1: BGP peer IP address 169.254.1.2 is the Cloud Router address of BGP session range 169.254.1.2/30"},
+		},
+		{
+			name: "peer IP not an address",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[1].PeerIP = ""
+			},
+			want: []string{`tunnel_2: BGP peer IP address "" is not an IPv4 address`},
+		},
+		{
+			name: "tunnels reuse a session range",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[1].SessionRange = "169.254.1.1/30"
+				vpn.Tunnels[1].PeerIP = "169.254.1.2"
+			},
+			want: []string{"tunnel_2: BGP session range 169.254.1.1/30 reuses 169.254.1.0/30 of tunnel_1"},
+		},
+		{
+			name: "peer ASN equals router ASN",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].PeerASN = 64513
+			},
+			want: []string{"tunnel_1: peer ASN 64513 equals the Cloud Router ASN"},
+		},
+		{
+			name: "public router ASN",
+			modify: func(vpn *HAVPN) {
+				vpn.RouterASN = 64511
+			},
+			want: []string{
+				"Cloud Router ASN 64511 is not a private ASN, want 64512-65534 or 4200000000-4294967294",
+			},
+		},
+		{
+			name: "public peer ASNs",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].PeerASN = 15169
+				vpn.Tunnels[1].PeerASN = 396982
+			},
+		},
+		{
+			name: "reserved and invalid peer ASNs",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].PeerASN = 65535
+				vpn.Tunnels[1].PeerASN = 4294967296
+			},
+			want: []string{
+				"tunnel_1: peer ASN 65535 is not a private ASN, want 64512-65534 or 4200000000-4294967294",
+				"tunnel_2: peer ASN 4294967296 is not a 2- or 4-byte ASN, want 1-4294967295",
+			},
+		},
+		{
+			name: "peer ASN unset",
+			modify: func(vpn *HAVPN) {
+				vpn.Tunnels[0].PeerASN = 0
+			},
+			want: []string{"tunnel_1: peer ASN 0 is not a 2- or 4-byte ASN, want 1-4294967295"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vpn := validHAVPN()
+			tt.modify(&vpn)
+			if diff := cmp.Diff(tt.want, errorLines(ValidateHAVPN(vpn))); diff != "" {
+				t.Errorf("ValidateHAVPN() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+/*
+TestHAVPNFromVars verifies that the HA VPN variables of 02-networking are
+read with the defaults of variables.tf for the variables left unset.
+*/
+func TestHAVPNFromVars(t *testing.T) {
+	got, err := HAVPNFromVars(map[string]any{
+		"tunnel_1_bgp_peer_asn":        64514,
+		"tunnel_2_bgp_peer_asn":        "64514",
+		"tunnel_1_bgp_peer_ip_address": "169.254.1.1",
+		"tunnel_2_bgp_peer_ip_address": "169.254.2.1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(validHAVPN(), got); diff != "" {
+		t.Errorf("HAVPNFromVars() mismatch (-want +got):\n%s", diff)
+	}
+}
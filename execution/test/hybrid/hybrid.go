@@ -0,0 +1,126 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hybrid validates the hybrid connectivity inputs of 02-networking,
+// the Dedicated Interconnect VLAN attachments of interconnect.tf and the HA
+// VPN tunnels of havpn.tf, against the rules the Compute Engine API enforces
+// only when the resources are created, so that tests catch invalid
+// combinations before terraform plan.
+//
+// Validators return nil for a valid configuration, or an error joining one
+// error per violated rule.
+package hybrid
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// RFC 6996 private ASN ranges, the only ASNs a Cloud Router accepts.
+const (
+	MinPrivateASN16 = 64512
+	MaxPrivateASN16 = 65534
+	MinPrivateASN32 = 4200000000
+	MaxPrivateASN32 = 4294967294
+)
+
+// MaxASN is the largest 4-byte ASN.
+const MaxASN = 4294967295
+
+// linkLocal is the range BGP sessions of Cloud Router must use.
+var linkLocal = netip.MustParsePrefix("169.254.0.0/16")
+
+// IsPrivateASN reports whether asn is in one of the RFC 6996 private ranges.
+func IsPrivateASN(asn int64) bool {
+	return (asn >= MinPrivateASN16 && asn <= MaxPrivateASN16) || (asn >= MinPrivateASN32 && asn <= MaxPrivateASN32)
+}
+
+// checkPrivateASN returns an error naming what if asn is not private.
+func checkPrivateASN(what string, asn int64) error {
+	if IsPrivateASN(asn) {
+		return nil
+	}
+	return fmt.Errorf("%s %d is not a private ASN, want %d-%d or %d-%d",
+		what, asn, MinPrivateASN16, MaxPrivateASN16, MinPrivateASN32, MaxPrivateASN32)
+}
+
+// checkPeerASN returns an error naming what if asn is not a valid BGP peer
+// ASN. Peers may use public ASNs, so only an ASN in a private block is held
+// to its usable range, which excludes the reserved 65535 and 4294967295.
+func checkPeerASN(what string, asn int64) error {
+	switch {
+	case asn <= 0 || asn > MaxASN:
+		return fmt.Errorf("%s %d is not a 2- or 4-byte ASN, want 1-%d", what, asn, int64(MaxASN))
+	case asn > MaxPrivateASN16 && asn <= 65535, asn > MaxPrivateASN32:
+		return checkPrivateASN(what, asn)
+	}
+	return nil
+}
+
+// parseLinkLocal parses a BGP range, which must be a /bits inside
+// 169.254.0.0/16. The address may be a host of the range, as in the
+// 169.254.1.2/30 session ranges of HA VPN, unless network is true.
+func parseLinkLocal(what, value string, bits int, network bool) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil || !prefix.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("%s %q is not an IPv4 CIDR range", what, value)
+	}
+	if prefix.Bits() != bits || !linkLocal.Contains(prefix.Addr()) {
+		return netip.Prefix{}, fmt.Errorf("%s %s must be a /%d inside %s", what, value, bits, linkLocal)
+	}
+	if network && prefix.Masked() != prefix {
+		return netip.Prefix{}, fmt.Errorf("%s %s must start at its network address %s", what, value, prefix.Masked())
+	}
+	return prefix, nil
+}
+
+// intVar reads a number variable that tests set as an int or a string, as
+// the 02-networking ASN variables are declared as strings.
+func intVar(vars map[string]any, name string) (int64, error) {
+	switch v := vars[name].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return 0, nil
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s = %q is not a number", name, v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%s has type %T, want a number", name, v)
+	}
+}
+
+// stringVar reads a string variable, returning "" if it is unset.
+func stringVar(vars map[string]any, name string) (string, error) {
+	switch v := vars[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("%s has type %T, want a string", name, v)
+	}
+}
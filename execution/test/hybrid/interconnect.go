@@ -0,0 +1,150 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// MinVLANTag and MaxVLANTag bound the IEEE 802.1Q tags of VLAN attachments.
+const (
+	MinVLANTag = 2
+	MaxVLANTag = 4094
+)
+
+// Bandwidths lists the bandwidth values the API accepts for a Dedicated
+// Interconnect VLAN attachment.
+var Bandwidths = []string{
+	"BPS_50M", "BPS_100M", "BPS_200M", "BPS_300M", "BPS_400M", "BPS_500M",
+	"BPS_1G", "BPS_2G", "BPS_5G", "BPS_10G", "BPS_20G", "BPS_50G", "BPS_100G",
+}
+
+// VLANAttachment is one of the VLAN attachments of interconnect.tf.
+type VLANAttachment struct {
+	// Name identifies the attachment in errors, for example "first".
+	Name string
+	// InterconnectProject and Interconnect identify the Dedicated
+	// Interconnect the attachment uses.
+	InterconnectProject string
+	Interconnect        string
+	VLANTag             int64
+	// BGPRange is the link-local /29 of the BGP session.
+	BGPRange  string
+	PeerASN   int64
+	Bandwidth string
+}
+
+// Interconnect is the Cloud Router and VLAN attachments of interconnect.tf.
+type Interconnect struct {
+	RouterASN   int64
+	Attachments []VLANAttachment
+}
+
+// InterconnectFromVars reads the interconnect inputs from the variables
+// passed to 02-networking, such as the tfVars of its unit tests. Unset
+// variables are left empty, which fails validation.
+func InterconnectFromVars(vars map[string]any) (Interconnect, error) {
+	var errs []error
+	str := func(name string) string {
+		v, err := stringVar(vars, name)
+		errs = append(errs, err)
+		return v
+	}
+	num := func(name string) int64 {
+		v, err := intVar(vars, name)
+		errs = append(errs, err)
+		return v
+	}
+	ic := Interconnect{RouterASN: num("ic_router_bgp_asn")}
+	for _, name := range []string{"first", "second"} {
+		ic.Attachments = append(ic.Attachments, VLANAttachment{
+			Name:                name,
+			InterconnectProject: str("interconnect_project_id"),
+			Interconnect:        str(name + "_interconnect_name"),
+			VLANTag:             num(name + "_vlan_tag"),
+			BGPRange:            str(name + "_va_bgp_range"),
+			PeerASN:             num(name + "_va_asn"),
+			Bandwidth:           str(name + "_va_bandwidth"),
+		})
+	}
+	return ic, errors.Join(errs...)
+}
+
+// ValidateInterconnect checks that the Cloud Router ASN is private, that each
+// peer ASN is a valid public or private ASN that differs from it, that VLAN
+// tags are in 2-4094 and unique per interconnect, that BGP ranges are /29
+// networks inside 169.254.0.0/16 that do not overlap, and that bandwidths
+// are values the API accepts.
+func ValidateInterconnect(ic Interconnect) error {
+	errs := []error{checkPrivateASN("Cloud Router ASN", ic.RouterASN)}
+	type tagKey struct {
+		project, interconnect string
+		tag                   int64
+	}
+	tags := map[tagKey]string{}
+	ranges := map[string]netip.Prefix{}
+	for _, va := range ic.Attachments {
+		what := va.Name + " VLAN attachment"
+		if va.VLANTag < MinVLANTag || va.VLANTag > MaxVLANTag {
+			errs = append(errs, fmt.Errorf("%s: VLAN tag %d is outside %d-%d", what, va.VLANTag, MinVLANTag, MaxVLANTag))
+		} else {
+			key := tagKey{va.InterconnectProject, va.Interconnect, va.VLANTag}
+			if other, ok := tags[key]; ok {
+				errs = append(errs, fmt.Errorf("%s: VLAN tag %d is already used by the %s VLAN attachment on interconnect %s",
+					what, va.VLANTag, other, interconnectName(va)))
+			} else {
+				tags[key] = va.Name
+			}
+		}
+
+		if prefix, err := parseLinkLocal("BGP range", va.BGPRange, 29, true); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", what, err))
+		} else {
+			for other, p := range ranges {
+				if p.Overlaps(prefix) {
+					errs = append(errs, fmt.Errorf("%s: BGP range %s overlaps %s of the %s VLAN attachment", what, prefix, p, other))
+				}
+			}
+			ranges[va.Name] = prefix
+		}
+
+		if err := checkPeerASN("peer ASN", va.PeerASN); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", what, err))
+		} else if va.PeerASN == ic.RouterASN {
+			errs = append(errs, fmt.Errorf("%s: peer ASN %d equals the Cloud Router ASN", what, va.PeerASN))
+		}
+
+		if !validBandwidth(va.Bandwidth) {
+			errs = append(errs, fmt.Errorf("%s: bandwidth %q is not one of %s", what, va.Bandwidth, strings.Join(Bandwidths, ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func interconnectName(va VLANAttachment) string {
+	return fmt.Sprintf("projects/%s/global/interconnects/%s", va.InterconnectProject, va.Interconnect)
+}
+
+func validBandwidth(bandwidth string) bool {
+	for _, b := range Bandwidths {
+		if b == bandwidth {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,238 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hybrid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// validInterconnect returns two VLAN attachments on different interconnects
+// that pass ValidateInterconnect.
+func validInterconnect() Interconnect {
+	return Interconnect{
+		RouterASN: 65004,
+		Attachments: []VLANAttachment{
+			{Name: "first", InterconnectProject: "p", Interconnect: "ic-1", VLANTag: 601, BGPRange: "169.254.61.0/29", PeerASN: 65418, Bandwidth: "BPS_1G"},
+			{Name: "second", InterconnectProject: "p", Interconnect: "ic-2", VLANTag: 601, BGPRange: "169.254.61.8/29", PeerASN: 65418, Bandwidth: "BPS_1G"},
+		},
+	}
+}
+
+// errorLines splits a joined error into its messages.
+func errorLines(err error) []string {
+	if err == nil {
+		return nil
+	}
+	return strings.Split(err.Error(), "\n")
+}
+
+/*
+TestIsPrivateASN verifies the boundaries of the 16-bit and 32-bit private
+ASN ranges.
+*/
+func TestIsPrivateASN(t *testing.T) {
+	tests := []struct {
+		asn  int64
+		want bool
+	}{
+		{64511, false},
+		{64512, true},
+		{65534, true},
+		{65535, false},
+		{4199999999, false},
+		{4200000000, true},
+		{4294967294, true},
+		{4294967295, false},
+		{0, false},
+	}
+	for _, tt := range tests {
+		if got := IsPrivateASN(tt.asn); got != tt.want {
+			t.Errorf("IsPrivateASN(%d) = %v, want %v", tt.asn, got, tt.want)
+		}
+	}
+}
+
+/*
+TestValidateInterconnect verifies each rule of ValidateInterconnect against
+a variation of a valid configuration and the message it reports.
+*/
+func TestValidateInterconnect(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(ic *Interconnect)
+		want   []string
+	}{
+		{
+			name:   "valid",
+			modify: func(ic *Interconnect) {},
+		},
+		{
+			name: "valid 4-byte ASNs and same tag on another project",
+			modify: func(ic *Interconnect) {
+				ic.RouterASN = 4200000000
+				ic.Attachments[1].Interconnect = "ic-1"
+				ic.Attachments[1].InterconnectProject = "other"
+				ic.Attachments[1].PeerASN = 4294967294
+			},
+		},
+		{
+			name: "duplicate VLAN tag on the same interconnect",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[1].Interconnect = "ic-1"
+			},
+			want: []string{"second VLAN attachment: VLAN tag 601 is already used by the first VLAN attachment on interconnect projects/p/global/interconnects/ic-1"},
+		},
+		{
+			name: "VLAN tags out of range",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[0].VLANTag = 1
+				ic.Attachments[1].VLANTag = 4095
+			},
+			want: []string{
+				"first VLAN attachment: VLAN tag 1 is outside 2-4094",
+				"second VLAN attachment: VLAN tag 4095 is outside 2-4094",
+			},
+		},
+		{
+			name: "BGP range not a /29",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[0].BGPRange = "169.254.61.0/30"
+			},
+			want: []string{"first VLAN attachment: BGP range 169.254.61.0/30 must be a /29 inside 169.254.0.0/16"},
+		},
+		{
+			name: "BGP range outside link-local",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[0].BGPRange = "10.0.0.0/29"
+			},
+			want: []string{"first VLAN attachment: BGP range 10.0.0.0/29 must be a /29 inside 169.254.0.0/16"},
+		},
+		{
+			name: "BGP range not a network address",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[0].BGPRange = "169.254.61.1/29"
+			},
+			want: []string{"first VLAN attachment: BGP range 169.254.61.1/29 must start at its network address 169.254.61.0/29"},
+		},
+		{
+			name: "BGP range not a CIDR",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[0].BGPRange = ""
+			},
+			want: []string{`first VLAN attachment: BGP range "" is not an IPv4 CIDR range`},
+		},
+		{
+			name: "overlapping BGP ranges",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[1].BGPRange = "169.254.61.0/29"
+			},
+			want: []string{"second VLAN attachment: BGP range 169.254.61.0/29 overlaps 169.254.61.0/29 of the first VLAN attachment"},
+		},
+		{
+			name: "public ASNs",
+			modify: func(ic *Interconnect) {
+				ic.RouterASN = 15169
+				ic.Attachments[0].PeerASN = 65535
+			},
+			want: []string{
+				"Cloud Router ASN 15169 is not a private ASN, want 64512-65534 or 4200000000-4294967294",
+				"first VLAN attachment: peer ASN 65535 is not a private ASN, want 64512-65534 or 4200000000-4294967294",
+			},
+		},
+		{
+			name: "public peer ASNs",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[0].PeerASN = 15169
+				ic.Attachments[1].PeerASN = 396982
+			},
+		},
+		{
+			name: "reserved and invalid peer ASNs",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[0].PeerASN = 4294967295
+				ic.Attachments[1].PeerASN = 0
+			},
+			want: []string{
+				"first VLAN attachment: peer ASN 4294967295 is not a private ASN, want 64512-65534 or 4200000000-4294967294",
+				"second VLAN attachment: peer ASN 0 is not a 2- or 4-byte ASN, want 1-4294967295",
+			},
+		},
+		{
+			name: "peer ASN equals router ASN",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[1].PeerASN = 65004
+			},
+			want: []string{"second VLAN attachment: peer ASN 65004 equals the Cloud Router ASN"},
+		},
+		{
+			name: "unsupported bandwidth",
+			modify: func(ic *Interconnect) {
+				ic.Attachments[0].Bandwidth = "BPS_3G"
+			},
+			want: []string{`first VLAN attachment: bandwidth "BPS_3G" is not one of BPS_50M, BPS_100M, BPS_200M, BPS_300M, BPS_400M, BPS_500M, BPS_1G, BPS_2G, BPS_5G, BPS_10G, BPS_20G, BPS_50G, BPS_100G`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic := validInterconnect()
+			tt.modify(&ic)
+			if diff := cmp.Diff(tt.want, errorLines(ValidateInterconnect(ic))); diff != "" {
+				t.Errorf("ValidateInterconnect() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+/*
+TestInterconnectFromVars verifies that the interconnect variables of
+02-networking are read whether numbers are given as ints or strings.
+*/
+func TestInterconnectFromVars(t *testing.T) {
+	vars := map[string]any{
+		"interconnect_project_id":  "p",
+		"first_interconnect_name":  "ic-1",
+		"second_interconnect_name": "ic-2",
+		"ic_router_bgp_asn":        65004,
+		"first_va_asn":             "65418",
+		"first_va_bandwidth":       "BPS_1G",
+		"first_va_bgp_range":       "169.254.61.0/29",
+		"first_vlan_tag":           601,
+		"second_va_asn":            "65418",
+		"second_va_bandwidth":      "BPS_1G",
+		"second_va_bgp_range":      "169.254.61.8/29",
+		"second_vlan_tag":          "601",
+	}
+	got, err := InterconnectFromVars(vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(validInterconnect(), got); diff != "" {
+		t.Errorf("InterconnectFromVars() mismatch (-want +got):\n%s", diff)
+	}
+
+	vars["first_vlan_tag"] = "six"
+	vars["first_va_bandwidth"] = 1
+	_, err = InterconnectFromVars(vars)
+	want := []string{
+		`first_vlan_tag = "six" is not a number`,
+		"first_va_bandwidth has type int, want a string",
+	}
+	if diff := cmp.Diff(want, errorLines(err)); diff != "" {
+		t.Errorf("InterconnectFromVars() errors mismatch (-want +got):\n%s", diff)
+	}
+}
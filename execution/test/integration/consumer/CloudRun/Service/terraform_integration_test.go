@@ -18,46 +18,35 @@ package integrationtest
 
 import (
 	"fmt"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configschema"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/tidwall/gjson"
-	"gopkg.in/yaml.v2"
-	"math/rand"
 
 	"os"
 	"testing"
-	"time"
 )
 
 const (
-	terraformDirectoryPath = "../../../../../06-consumer/CloudRun/Service"
-	region                 = "us-central1"
-	configFolderPath       = "../../../test/integration/consumer/CloudRun/Service/config"
-	image                  = "us-docker.pkg.dev/cloudrun/container/hello"
+	region           = "us-central1"
+	configFolderPath = "../../../test/integration/consumer/CloudRun/Service/config"
+	image            = "us-docker.pkg.dev/cloudrun/container/hello"
 )
 
 var (
-	projectID   = os.Getenv("TF_VAR_project_id")
-	serviceName = fmt.Sprintf("test-%d", rand.Int())
-	tfVars      = map[string]any{
+	terraformDirectoryPath = stages.MustGet("consumer/cloudrun/service").TerraformDir()
+	projectID              = os.Getenv("TF_VAR_project_id")
+	names                  = naming.New("consumer/cloudrun/service", "TestCreateCloudRunService")
+	serviceName            = names.Name(naming.CloudRun, "")
+	tfVars                 = map[string]any{
 		"config_folder_path": configFolderPath,
 	}
 )
 
-type ContainerNameStruct struct {
-	Image string `yaml:"image"`
-}
-
-type ContainersStruct struct {
-	ContainerName ContainerNameStruct `yaml:"container-name"`
-}
-
-type CloudRunServiceStruct struct {
-	ProjectID  string           `yaml:"project_id"`
-	Region     string           `yaml:"region"`
-	Name       string           `yaml:"name"`
-	Containers ContainersStruct `yaml:"containers"`
-}
-
 func TestCreateCloudRunService(t *testing.T) {
 	createConfigYAML(t)
 	var (
@@ -76,14 +65,18 @@ func TestCreateCloudRunService(t *testing.T) {
 		SetVarsAfterVarFiles: true,
 	})
 
+	// Record the Terraform directory in a ledger, so that it is destroyed even
+	// when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, region)
 	// Clean up resources with "terraform destroy" at the end of the test.
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
-	terraform.InitAndApply(t, terraformOptions)
+	sup.InitAndApply(t, terraformOptions)
 
-	// Wait for 60 seconds to let resource acheive stable state.
-	time.Sleep(60 * time.Second)
+	// Wait for the service to report the Ready condition.
+	ready := fixtures.New(projectID, region).JSONField(t, `status.conditions.#(type=="Ready").status`, []string{"True"}, "run", "services", "describe", serviceName, "--region="+region)
+	wait.Until(t, "Cloud Run service "+serviceName+" ready", ready)
 
 	// Run `terraform output` to get the values of output variables and check they have the expected values.
 	cloudRunServiceOutputValue := terraform.OutputJson(t, terraformOptions, "cloud_run_service_details")
@@ -121,20 +114,18 @@ createConfigYAML is a helper function which creates the configuration YAML file.
 func createConfigYAML(t *testing.T) {
 	t.Log("========= YAML File =========")
 
-	containerNameList := ContainerNameStruct{
-		Image: image,
-	}
-
-	containersStructList := ContainersStruct{
-		ContainerName: containerNameList,
-	}
-	instance1 := CloudRunServiceStruct{
-		Name:       serviceName,
-		ProjectID:  projectID,
-		Region:     region,
-		Containers: containersStructList,
+	instance1 := configschema.CloudRun{
+		Name:      serviceName,
+		ProjectID: projectID,
+		Region:    region,
+		Labels:    naming.Labels(t),
+		Containers: map[string]configschema.CloudRunContainer{
+			"container-name": {
+				Image: image,
+			},
+		},
 	}
-	yamlData, err := yaml.Marshal(&instance1)
+	yamlData, err := configschema.Marshal(&instance1)
 	if err != nil {
 		t.Errorf("Error while marshallaing %v", err)
 	}
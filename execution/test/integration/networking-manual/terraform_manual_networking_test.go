@@ -21,17 +21,19 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
 	"github.com/google/go-cmp/cmp"                        // For deep comparison of slices
 	"github.com/gruntwork-io/terratest/modules/terraform" // Terraform testing library
 	"github.com/stretchr/testify/assert"                  // Assertion library
 )
 
-// Constants for the Terraform directory path and plan file path.
+// Constants for the plan file path.
 const (
-	terraformDirectoryPath = "../../../05-networking-manual/" // Replace with the actual path to your Terraform code directory
-	planFilePath           = "./plan"                         // Path where Terraform will save the execution plan
+	planFilePath = "./plan" // Path where Terraform will save the execution plan
 )
 
+var terraformDirectoryPath = stages.MustGet("networking-manual").TerraformDir()
+
 // Define the names of the producer SQL instances to be tested with their Service Attachments
 
 var (
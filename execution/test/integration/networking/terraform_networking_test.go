@@ -17,12 +17,15 @@ package integrationtest
 import (
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
 	"strconv"
 	"testing"
-	"time"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/google/go-cmp/cmp"
 	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
@@ -30,9 +33,8 @@ import (
 )
 
 const (
-	terraformDirectoryPath   = "../../../02-networking"
 	region                   = "us-west2"
-	peerASN                  = 64513
+	peerASN                  = 64514
 	psaRangeName             = "testpsarange"
 	psaRange                 = "10.0.64.0/20"
 	tunnel1BGPPeerASNAddress = "169.254.1.1"
@@ -42,12 +44,13 @@ const (
 )
 
 var (
-	projectID          = os.Getenv("TF_VAR_project_id")
-	uniqueID           = rand.Int() //included as a suffix to the VPC and subnet names.
-	networkName        = fmt.Sprintf("test-vpc-existing-%d", uniqueID)
-	subnetworkName     = fmt.Sprintf("test-subnet-existing-%d", uniqueID)
-	subnetworkIPCIDR   = "10.0.0.0/24"
-	createInterconnect = true
+	terraformDirectoryPath = stages.MustGet("networking").TerraformDir()
+	projectID              = os.Getenv("TF_VAR_project_id")
+	names                  = naming.New("networking", "")
+	networkName            = names.Name(naming.Compute, "vpc-existing")
+	subnetworkName         = names.Name(naming.Compute, "subnet-existing")
+	subnetworkIPCIDR       = "10.0.0.0/24"
+	createInterconnect     = true
 )
 
 // Name of the deployed dedicated interconnect received after deploying the resource in the test lab
@@ -85,12 +88,12 @@ It then validates if
 3. PSA range is created
 */
 func TestCreateVPCNetworkModule(t *testing.T) {
-	//wait for 60 seconds to allow resources to be available
-	time.Sleep(60 * time.Second)
+	// Wait for the PSA range of an earlier test to be released.
+	wait.Until(t, "PSA range "+psaRangeName+" released", fixtures.New(projectID, region).GlobalAddressGone(t, psaRangeName))
 
 	var (
-		networkName    = fmt.Sprintf("test-vpc-new-%d", uniqueID)
-		subnetworkName = fmt.Sprintf("test-subnet-new-%d", uniqueID)
+		networkName    = names.Name(naming.Compute, "vpc-new")
+		subnetworkName = names.Name(naming.Compute, "subnet-new")
 		tfVars         = map[string]any{
 			"project_id":             projectID,
 			"region":                 region,
@@ -105,6 +108,7 @@ func TestCreateVPCNetworkModule(t *testing.T) {
 					"ip_cidr_range": subnetworkIPCIDR,
 					"name":          subnetworkName,
 					"region":        region,
+					"description":   naming.Format(naming.Labels(t)),
 				},
 			},
 			"network_name":                 networkName,
@@ -129,14 +133,17 @@ func TestCreateVPCNetworkModule(t *testing.T) {
 		SetVarsAfterVarFiles: true,
 	})
 
+	// Record the Terraform directory in a ledger, so that it is destroyed even
+	// when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, region)
 	// Clean up resources with "terraform destroy" at the end of the test.
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
-	terraform.InitAndApply(t, terraformOptions)
+	sup.InitAndApply(t, terraformOptions)
 
-	// Wait for 60 seconds to let resource acheive stable state
-	time.Sleep(60 * time.Second)
+	// Wait for the PSA peering created by the module to become ACTIVE.
+	wait.Until(t, "PSA peering of "+networkName, fixtures.New(projectID, region).PSAPeeringActive(t, networkName))
 
 	// Run `terraform output` to get the values of output variables and check they have the expected values.
 	want := networkName
@@ -198,8 +205,8 @@ It then validates if
 3. PSA range is created.
 */
 func TestExistingVPCNetworkModule(t *testing.T) {
-	// wait for 60 seconds to allow resources to be available.
-	time.Sleep(60 * time.Second)
+	// Wait for the PSA range of an earlier test to be released.
+	wait.Until(t, "PSA range "+psaRangeName+" released", fixtures.New(projectID, region).GlobalAddressGone(t, psaRangeName))
 	var (
 		tfVars = map[string]any{
 			"project_id":             projectID,
@@ -239,20 +246,24 @@ func TestExistingVPCNetworkModule(t *testing.T) {
 		SetVarsAfterVarFiles: true,
 	})
 
-	// Create VPC and subnet outside of the terraform module.
-	createVPCSubnets(t, projectID, networkName, subnetworkName, region)
-
-	// Delete VPC and subnet created outside of the terraform module.
-	defer deleteVPCSubnets(t, projectID, networkName, subnetworkName, region)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, region)
+	// Create VPC and subnet outside of the terraform module. They are deleted
+	// once the test completes, after "terraform destroy".
+	gcloud := fixtures.New(projectID, region)
+	gcloud.Recorder = sup
+	network := gcloud.Network(t, networkName)
+	subnet := gcloud.Subnet(t, network, subnetworkName, subnetworkIPCIDR, "--format=json", "--enable-private-ip-google-access", "--enable-flow-logs", "--verbosity=none")
 
 	// Clean up resources with "terraform destroy" at the end of the test.
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
-	terraform.InitAndApply(t, terraformOptions)
+	sup.InitAndApply(t, terraformOptions)
 
-	// wait for 60 seconds to let resource acheive stable state.
-	time.Sleep(60 * time.Second)
+	// Wait for the PSA peering created by the module to become ACTIVE.
+	wait.Until(t, "PSA peering of "+networkName, gcloud.PSAPeeringActive(t, networkName))
 
 	// Run `terraform output` to get the values of output variables and check they have the expected values.
 	want := networkName
@@ -274,7 +285,7 @@ func TestExistingVPCNetworkModule(t *testing.T) {
 	// Create SCP outside of terraform
 	defaultServiceClass := "gcp-memorystore-redis"
 	policyName := fmt.Sprintf("SCP-%s-%s", networkName, defaultServiceClass)
-	createServiceConnectionPolicy(t, projectID, region, networkName, policyName, subnetworkName, defaultServiceClass, 5) //Pass the correct parameters
+	gcloud.ServiceConnectionPolicy(t, network, policyName, defaultServiceClass, []*fixtures.Subnet{subnet}, 5)
 
 	t.Logf("======= Verify Service Connection Policy (Terraform Output) =======")
 	output := gjson.Parse(terraform.OutputJson(t, terraformOptions, "service_connection_policy_details"))
@@ -350,85 +361,6 @@ func TestExistingVPCNetworkModule(t *testing.T) {
 
 }
 
-/*
-deleteVPCSubnets is a helper function which deletes the VPC and subnets after
-completion of the test expecting to use existing VPC and subnets.
-*/
-func deleteVPCSubnets(t *testing.T, projectID string, networkName string, subnetworkName string, region string) {
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "subnets", "delete", subnetworkName, "--region=" + region, "--project=" + projectID, "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-
-	// Sleep for 60 seconds to ensure the deleted subnets is reliably reflected.
-	time.Sleep(60 * time.Second)
-
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "delete", networkName, "--project=" + projectID, "--quiet"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-/*
-createVPCSubnets is a helper function which creates the VPC and subnets before
-execution of the test expecting to use existing VPC and subnets.
-*/
-
-func createVPCSubnets(t *testing.T, projectID string, networkName string, subnetworkName string, region string) {
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "create", networkName, "--project=" + projectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=none"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "subnets", "create", subnetworkName, "--network=" + networkName, "--project=" + projectID, "--range=" + subnetworkIPCIDR, "--region=" + region, "--format=json", "--enable-private-ip-google-access", "--enable-flow-logs", "--verbosity=none"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-// Function to create Service Connection Policy
-func createServiceConnectionPolicy(t *testing.T, projectID string, region string, networkName string, policyName string, subnetworkName string, serviceClass string, connectionLimit int) {
-	// Get subnet self link from subnet ID using gcloud command
-	subnetSelfLink := fmt.Sprintf("https://www.googleapis.com/compute/v1/projects/%s/regions/%s/subnetworks/%s", projectID, region, subnetworkName)
-
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"network-connectivity", "service-connection-policies", "create",
-			policyName, // Add the policyName here as the first argument after "create"
-			"--project", projectID,
-			"--region", region,
-			"--network", networkName,
-			"--service-class", serviceClass,
-			"--subnets", subnetSelfLink,
-			"--psc-connection-limit", fmt.Sprintf("%d", connectionLimit),
-			"--quiet",
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error creating Service Connection Policy: %s", err)
-	}
-}
-
 /*
 	TestInterconnectWithVPCCreation tests the creation of
 
@@ -607,8 +539,11 @@ func initiateTestForNetworkResource(t *testing.T, terraformOptions *terraform.Op
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
 	terraform.InitAndApply(t, terraformOptions)
 
-	// Wait for 60 seconds to let resource achieve stable state.
-	time.Sleep(60 * time.Second)
+	// Wait for both VLAN attachments to become operational.
+	gcloud := fixtures.New(projectID, region)
+	for _, name := range []string{firstVlanAttachmentName, secondVlanAttachmentName} {
+		wait.Until(t, "VLAN attachment "+name+" OS_ACTIVE", gcloud.JSONField(t, "operationalStatus", []string{"OS_ACTIVE"}, "compute", "interconnects", "attachments", "describe", name, "--region="+region))
+	}
 
 	log.Println(" ========= Verify Subnet Name ========= ")
 	want := networkName
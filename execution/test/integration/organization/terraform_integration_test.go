@@ -19,8 +19,10 @@ import (
 	"fmt"
 	"os"
 	"testing"
-	"time"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/gruntwork-io/terratest/modules/terraform"
@@ -29,7 +31,7 @@ import (
 
 var (
 	projectID              = os.Getenv("TF_VAR_project_id")
-	terraformDirectoryPath = "../../../01-organization"
+	terraformDirectoryPath = stages.MustGet("organization").TerraformDir()
 	apisList               = []string{"aiplatform.googleapis.com", "alloydb.googleapis.com", "compute.googleapis.com", "container.googleapis.com", "iam.googleapis.com", "run.googleapis.com", "servicenetworking.googleapis.com", "sqladmin.googleapis.com"}
 	tfVars                 = map[string]any{
 		"activate_api_identities": map[string]any{
@@ -63,8 +65,11 @@ func TestEnableAPI(t *testing.T) {
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
 	terraform.InitAndApply(t, terraformOptions)
 
-	// Wait for 60 seconds to let resource acheive stable state.
-	time.Sleep(60 * time.Second)
+	// Wait for every API to be listed as enabled.
+	gcloud := fixtures.New(projectID, "")
+	for _, api := range apisList {
+		wait.Until(t, "API "+api+" enabled", gcloud.JSONField(t, "0.config.name", []string{api}, "services", "list", "--enabled", "--filter=config.name="+api))
+	}
 
 	// Run `terraform output` to get the values of output variables and check they have the expected values.
 	activateAPIOutputValue := terraform.OutputJson(t, terraformOptions, "activated_api_identities")
@@ -15,43 +15,32 @@ package integrationtest
 
 import (
 	"fmt"
-	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configschema"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/tidwall/gjson"
-	"gopkg.in/yaml.v2"
-	"math/rand"
 	"os"
 	"testing"
-	"time"
 )
 
 var (
 	projectID              = os.Getenv("TF_VAR_project_id")
 	region                 = "us-central1"
-	terraformDirectoryPath = "../../../../04-producer/AlloyDB"
+	terraformDirectoryPath = stages.MustGet("producer/alloydb").TerraformDir()
 	configFolderPath       = "../../test/integration/producer/AlloyDB/config"
-	rangeName              = "psatestrangealloydb"
-	clusterDisplayName     = fmt.Sprint(rand.Int())
-	networkName            = fmt.Sprintf("vpc-%s-test", clusterDisplayName)
-	alloyDBClusterId       = fmt.Sprintf("cid-%s-test", clusterDisplayName)
-	instanceID             = fmt.Sprintf("id-%s-test", clusterDisplayName)
+	names                  = naming.New("producer/alloydb", "TestCreateAlloyDB")
+	rangeName              = names.Name(naming.Compute, "psa")
+	clusterDisplayName     = names.Name(naming.AlloyDB, "")
+	networkName            = names.Name(naming.Compute, "vpc")
+	alloyDBClusterId       = names.Name(naming.AlloyDB, "cluster")
+	instanceID             = names.Name(naming.AlloyDB, "instance")
 	networkID              = fmt.Sprintf("projects/%s/global/networks/%s", projectID, networkName)
 )
 
-type PrimaryInstanceStruct struct {
-	InstanceID string `yaml:"instance_id"`
-}
-
-type AlloyDBStruct struct {
-	ClusterID          string                `yaml:"cluster_id"`
-	ClusterDisplayName string                `yaml:"cluster_display_name"`
-	ProjectID          string                `yaml:"project_id"`
-	Region             string                `yaml:"region"`
-	NetworkID          string                `yaml:"network_id"`
-	PrimaryInstance    PrimaryInstanceStruct `yaml:"primary_instance"`
-	AllocatedIPRange   string                `yaml:"allocated_ip_range"`
-}
-
 /*
 This test creates all the pre-requsite resources including the vpc network, subnetwork along with a PSA range.
 It then validates if
@@ -77,28 +66,24 @@ func TestCreateAlloyDB(t *testing.T) {
 		NoColor:              true,
 		SetVarsAfterVarFiles: true,
 	})
-	// Create VPC outside of the terraform module.
-	err := createVPC(t, projectID, networkName)
-	if err != nil {
-		t.Fatal(err)
-	}
-	// Create PSA in the VPC.
-	createPSA(t, projectID, networkName, rangeName)
-
-	// Delete VPC created outside of the terraform module.
-	defer deleteVPC(t, projectID, networkName)
-
-	// Remove PSA from the VPC.
-	defer deletePSA(t, projectID, networkName, rangeName)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, region)
+	// Create the VPC and PSA range outside of the terraform module. They are
+	// deleted once the test completes, after "terraform destroy".
+	gcloud := fixtures.New(projectID, region)
+	gcloud.Recorder = sup
+	network := gcloud.Network(t, networkName)
+	gcloud.PSARange(t, network, rangeName, "10.0.64.0/20")
 
 	// Clean up resources with "terraform destroy" at the end of the test.
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
-	terraform.InitAndApply(t, terraformOptions)
+	sup.InitAndApply(t, terraformOptions)
 
-	// Wait for 60 seconds to let resource acheive stable state.
-	time.Sleep(60 * time.Second)
+	// Wait for the cluster to become READY.
+	wait.Until(t, "AlloyDB cluster "+alloyDBClusterId+" READY", gcloud.JSONField(t, "state", []string{"READY"}, "alloydb", "clusters", "describe", alloyDBClusterId, "--region="+region))
 
 	// Run `terraform output` to get the values of output variables and check they have the expected values.
 	alloyDBOutputValue := terraform.OutputJson(t, terraformOptions, "cluster_details")
@@ -130,117 +115,25 @@ func TestCreateAlloyDB(t *testing.T) {
 	}
 }
 
-/*
-deleteVPC is a helper function which deletes the VPC after
-completion of the test.
-*/
-func deleteVPC(t *testing.T, projectID string, networkName string) {
-	time.Sleep(60 * time.Second)
-	text := "compute"
-	time.Sleep(60 * time.Second)
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "delete", networkName, "--project=" + projectID, "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-/*
-deletePSA is a helper function which deletes the PSA range after the
-execution of the test.
-*/
-func deletePSA(t *testing.T, projectID string, networkName string, rangeName string) {
-	// Delete PSA IP range
-	time.Sleep(60 * time.Second)
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "addresses", "delete", rangeName, "--project=" + projectID, "--global", "--verbosity=none", "--format=json", "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
-	// Delete PSA range
-	text = "services"
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "vpc-peerings", "delete", "--service=servicenetworking.googleapis.com", "--project=" + projectID, "--network=" + networkName, "--verbosity=none", "--format=json", "--quiet"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-/*
-createVPC is a helper function which creates the VPC before the
-execution of the test.
-*/
-func createVPC(t *testing.T, projectID string, networkName string) error {
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "create", networkName, "--project=" + projectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=none"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	return err
-}
-
-/*
-createPSA is a helper function which creates the PSA range before the
-execution of the test.
-*/
-func createPSA(t *testing.T, projectID string, networkName string, rangeName string) {
-	// Create an IP range
-
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "addresses", "create", rangeName, "--purpose=VPC_PEERING", "--addresses=10.0.64.0", "--prefix-length=20", "--project=" + projectID, "--network=" + networkName, "--global", "--verbosity=none", "--format=json"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-
-	// Create PSA range
-	text = "services"
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "vpc-peerings", "connect", "--service=servicenetworking.googleapis.com", "--ranges=" + rangeName, "--project=" + projectID, "--network=" + networkName, "--verbosity=none", "--format=json"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
 /*
 createConfigYAML is a helper function which creates the configigration YAML file
 for an alloydb instance range before the.
 */
 func createConfigYAML(t *testing.T) {
 	t.Log("========= YAML File =========")
-	instance1 := AlloyDBStruct{
+	instance1 := configschema.AlloyDB{
 		ClusterID:          alloyDBClusterId,
 		ClusterDisplayName: clusterDisplayName,
 		ProjectID:          projectID,
 		Region:             region,
 		NetworkID:          networkID,
-		PrimaryInstance: PrimaryInstanceStruct{
+		PrimaryInstance: configschema.AlloyDBPrimaryInstance{
 			InstanceID: instanceID,
 		},
-		AllocatedIPRange: rangeName,
+		AllocatedIPRange: configschema.String(rangeName),
+		ClusterLabels:    naming.Labels(t),
 	}
-	yamlData, err := yaml.Marshal(&instance1)
+	yamlData, err := configschema.Marshal(&instance1)
 	if err != nil {
 		t.Errorf("Error while marshallaing %v", err)
 	}
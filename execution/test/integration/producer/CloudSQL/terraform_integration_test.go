@@ -15,67 +15,31 @@ package integrationtest
 
 import (
 	"fmt"
-	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configschema"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/tidwall/gjson"
-	"gopkg.in/yaml.v2"
-	"math/rand"
 	"os"
 	"testing"
-	"time"
 )
 
 var (
 	projectID              = os.Getenv("TF_VAR_project_id")
 	region                 = "us-central1"
-	terraformDirectoryPath = "../../../../04-producer/CloudSQL"
+	terraformDirectoryPath = stages.MustGet("producer/cloudsql").TerraformDir()
 	configFolderPath       = "../../test/integration/producer/CloudSQL/config"
-	rangeName              = "psatestrangecloudsql"
+	names                  = naming.New("producer/cloudsql", "TestCreateCloudSQL")
+	rangeName              = names.Name(naming.Compute, "psa")
 	databaseVersion        = "POSTGRES_15"
-	name                   = fmt.Sprintf("cloudsql-%d", rand.Int())
-	networkName            = fmt.Sprintf("vpc-%s-test", name)
+	name                   = names.Name(naming.CloudSQL, "")
+	networkName            = names.Name(naming.Compute, "vpc")
 	networkID              = fmt.Sprintf("projects/%s/global/networks/%s", projectID, networkName)
 )
 
-// AllocatedIPRangesStruct represents the allocated IP Ranges in the PSA Configuration(PSAConfigStruct).
-type AllocatedIPRangesStruct struct {
-	Primary string `yaml:"primary,omitempty"`
-	Replica string `yaml:"replica,omitempty"`
-}
-
-// PSAConfigStruct represents the PSA configurations in the Connectivity Struct.
-type PSAConfigStruct struct {
-	PrivateNetwork    string                  `yaml:"private_network"`
-	AllocatedIPRanges AllocatedIPRangesStruct `yaml:"allocated_ip_ranges,omitempty"`
-}
-
-// ConnectivityStruct represents the Connectivity in the network configuration.
-type ConnectivityStruct struct {
-	PublicIPV4                 bool            `yaml:"public_ipv4,omitempty"`
-	PSAConfig                  PSAConfigStruct `yaml:"psa_config,omitempty"`
-	PSCAllowedConsumerProjects []string        `yaml:"psc_allowed_consumer_projects,omitempty"`
-}
-
-// NetworkConfigStruct represent the Network Config in the CloudSQLStruct.
-type NetworkConfigStruct struct {
-	AuthorizedNetwork map[string]string  `yaml:"authorized_networks,omitempty"`
-	Connectivity      ConnectivityStruct `yaml:"connectivity"`
-}
-
-// CloudSQLStruct defines the structure to parse configuration data for a YAML file
-// for creating Cloud SQL instances. This structure maps directly to the expected format
-// of the YAML file and uses struct tags for unmarshalling.
-
-type CloudSQLStruct struct {
-	Name                        string              `yaml:"name"`
-	ProjectID                   string              `yaml:"project_id"`
-	Region                      string              `yaml:"region"`
-	DatabaseVersion             string              `yaml:"database_version"`
-	NetworkConfig               NetworkConfigStruct `yaml:"network_config"`
-	TerraformDeletionProtection bool                `yaml:"terraform_deletion_protection"`
-	GCPDeletionProtection       bool                `yaml:"gcp_deletion_protection"`
-}
-
 /*
 This test creates all the pre-requsite resources including the vpc network, subnetwork along with a PSA range.
 It then validates if
@@ -100,23 +64,21 @@ func TestCreateCloudSQL(t *testing.T) {
 		NoColor:              true,
 		SetVarsAfterVarFiles: true,
 	})
-	// Create VPC outside of the terraform module.
-	err := createVPC(t, projectID, networkName)
-	if err != nil {
-		t.Fatal(err)
-	}
-	// Create PSA in the VPC.
-	createPSA(t, projectID, networkName, rangeName)
-	// Delete VPC created outside of the terraform module.
-	defer deleteVPC(t, projectID, networkName)
-	// Remove PSA from the VPC.
-	defer deletePSA(t, projectID, networkName, rangeName)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, region)
+	// Create the VPC and PSA range outside of the terraform module. They are
+	// deleted once the test completes, after "terraform destroy".
+	gcloud := fixtures.New(projectID, region)
+	gcloud.Recorder = sup
+	network := gcloud.Network(t, networkName)
+	gcloud.PSARange(t, network, rangeName, "10.0.64.0/20")
 	// Clean up resources with "terraform destroy" at the end of the test.
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
-	terraform.InitAndApply(t, terraformOptions)
-	// Wait for 60 seconds to let resource acheive stable state.
-	time.Sleep(60 * time.Second)
+	sup.InitAndApply(t, terraformOptions)
+	// Wait for the instance to accept connections.
+	wait.Until(t, "Cloud SQL instance "+name+" RUNNABLE", gcloud.CloudSQLInstanceState(t, name, "RUNNABLE"))
 	// Run `terraform output` to get the values of output variables and check they have the expected values.
 	cloudSQLOutputValue := terraform.OutputJson(t, terraformOptions, "cloudsql_instance_details")
 	t.Log(" ========= Terraform resource creation completed ========= ")
@@ -161,123 +123,32 @@ func TestCreateCloudSQL(t *testing.T) {
 	}
 }
 
-/*
-deleteVPC is a helper function which deletes the VPC after
-completion of the test.
-*/
-func deleteVPC(t *testing.T, projectID string, networkName string) {
-	time.Sleep(60 * time.Second)
-	text := "compute"
-	time.Sleep(60 * time.Second)
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "delete", networkName, "--project=" + projectID, "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-/*
-deletePSA is a helper function which deletes the PSA range after the
-execution of the test.
-*/
-func deletePSA(t *testing.T, projectID string, networkName string, rangeName string) {
-	// Delete PSA IP range
-	time.Sleep(60 * time.Second)
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "addresses", "delete", rangeName, "--project=" + projectID, "--global", "--verbosity=info", "--format=json", "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Logf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
-	// Delete PSA range
-	text = "services"
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "vpc-peerings", "delete", "--service=servicenetworking.googleapis.com", "--project=" + projectID, "--network=" + networkName, "--verbosity=info", "--format=json", "--quiet"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Logf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-/*
-createVPC is a helper function which creates the VPC before the
-execution of the test.
-*/
-func createVPC(t *testing.T, projectID string, networkName string) error {
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "create", networkName, "--project=" + projectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=info"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	return err
-}
-
-/*
-createPSA is a helper function which creates the PSA range before the
-execution of the test.
-*/
-func createPSA(t *testing.T, projectID string, networkName string, rangeName string) {
-	// Create an IP range
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "addresses", "create", rangeName, "--purpose=VPC_PEERING", "--addresses=10.0.64.0", "--prefix-length=20", "--project=" + projectID, "--network=" + networkName, "--global", "--verbosity=info", "--format=json"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	// Create PSA range
-	text = "services"
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "vpc-peerings", "connect", "--service=servicenetworking.googleapis.com", "--ranges=" + rangeName, "--project=" + projectID, "--network=" + networkName, "--verbosity=info", "--format=json"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
-}
-
 /*
 createConfigYAML is a helper function which creates the configigration YAML file
 for a cloudsql instance.
 */
 func createConfigYAML(t *testing.T) {
 	t.Log("========= YAML File =========")
-	instance1 := CloudSQLStruct{
+	instance1 := configschema.CloudSQL{
 		Name:                        name,
 		ProjectID:                   projectID,
 		Region:                      region,
 		DatabaseVersion:             databaseVersion,
-		TerraformDeletionProtection: false,
-		GCPDeletionProtection:       false,
-		NetworkConfig: NetworkConfigStruct{
-			Connectivity: ConnectivityStruct{
-				PSAConfig: PSAConfigStruct{
+		TerraformDeletionProtection: configschema.Bool(false),
+		GCPDeletionProtection:       configschema.Bool(false),
+		Labels:                      naming.Labels(t),
+		NetworkConfig: configschema.CloudSQLNetworkConfig{
+			Connectivity: configschema.CloudSQLConnectivity{
+				PSAConfig: &configschema.CloudSQLPSAConfig{
 					PrivateNetwork: networkID,
-					AllocatedIPRanges: AllocatedIPRangesStruct{
+					AllocatedIPRanges: &configschema.CloudSQLAllocatedIPRanges{
 						Primary: rangeName,
 					},
 				},
 			},
 		},
 	}
-	yamlData, err := yaml.Marshal(&instance1)
+	yamlData, err := configschema.Marshal(&instance1)
 	if err != nil {
 		t.Errorf("Error while marshallaing %v", err)
 	}
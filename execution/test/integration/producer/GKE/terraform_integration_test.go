@@ -17,34 +17,37 @@ package integrationtest
 import (
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
 	"testing"
-	"time"
 
 	// for sorting slices
 	// for comparison operations
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configschema"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/google/go-cmp/cmp"
-	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/tidwall/gjson"
-	"gopkg.in/yaml.v2"
 )
 
 var (
 	projectRoot, _ = filepath.Abs("../../../../")
 	// Path to the Terraform module directory.
-	terraformDirectoryPath = filepath.Join(projectRoot, "04-producer/GKE")
+	terraformDirectoryPath = stages.MustGet("producer/gke").TerraformDir()
 	// Path to the folder containing YAML configuration files.
 	configFolderPath   = filepath.Join(projectRoot, "test/integration/producer/GKE/config")
 	projectID          = os.Getenv("TF_VAR_project_id")
 	region             = "us-central1"
 	kubernetesVersion  = "1.27.16-gke.1287000"
-	instanceName       = fmt.Sprintf("gke-%d", rand.Int())
-	networkName        = fmt.Sprintf("gke-cluster-vpc-%d", rand.Int())
-	subnetName         = fmt.Sprintf("gke-cluster-subnetwork-%d", rand.Int())
+	names              = naming.New("producer/gke", "TestCreateGKECluster")
+	instanceName       = names.Name(naming.GKE, "")
+	networkName        = names.Name(naming.Compute, "vpc")
+	subnetName         = names.Name(naming.Compute, "subnet")
 	subnetIPRange      = "10.0.0.0/16"
 	ipRangePods        = "pods"
 	ipRangeServices    = "services"
@@ -60,18 +63,6 @@ var (
 	}
 )
 
-type GKEConfig struct {
-	Name               string `yaml:"name"`
-	ProjectID          string `yaml:"project_id"`
-	KubernetesVersion  string `yaml:"kubernetes_version"`
-	Network            string `yaml:"network"`
-	Subnetwork         string `yaml:"subnetwork"`
-	IPRangePods        string `yaml:"ip_range_pods"`
-	IPRangeServices    string `yaml:"ip_range_services"`
-	Region             string `yaml:"region"`
-	DeletionProtection bool   `yaml:"deletion_protection"`
-}
-
 // TestCreateGKECluster tests the creation of a GKE cluster.
 func TestCreateGKECluster(t *testing.T) {
 	// Initialize a GKE config YAML file to be tested.
@@ -92,78 +83,72 @@ func TestCreateGKECluster(t *testing.T) {
 		SetVarsAfterVarFiles: true,
 	})
 
-	// Create network, subnet, and IP ranges
-	createNetwork(t, projectID, networkName)
-	createSubnet(t, projectID, networkName, subnetName)
-	createIPRanges(t, projectID, region, subnetName)
-	time.Sleep(60 * time.Second)
-
-	// Delete network, subnet, and IP ranges
-	defer deleteNetwork(t, projectID, networkName)
-	defer deleteSubnet(t, projectID, subnetName)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, region)
+	// Create network, subnet, and IP ranges. They are deleted once the test
+	// completes, after "terraform destroy".
+	gcloud := fixtures.New(projectID, region)
+	gcloud.Recorder = sup
+	network := gcloud.Network(t, networkName)
+	subnet := gcloud.Subnet(t, network, subnetName, subnetIPRange)
+	gcloud.SecondaryRanges(t, subnet, map[string]string{
+		ipRangePods:     podIPRange,
+		ipRangeServices: servicesIPRange,
+	})
+	// Wait for the secondary ranges the cluster allocates pods and services from.
+	for _, name := range []string{ipRangePods, ipRangeServices} {
+		wait.Until(t, "secondary range "+name, gcloud.SecondaryRangeVisible(t, subnet, name))
+	}
 
 	// Clean up resources with "terraform destroy" at the end of the test.
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
-	terraform.InitAndApply(t, terraformOptions)
+	sup.InitAndApply(t, terraformOptions)
 
-	// Wait for the GKE cluster to become available with retries
-	maxRetries := 10
-	retryInterval := 10 * time.Second
-	var clusterID string
+	// Wait for the GKE cluster to become available.
+	wait.Until(t, "GKE cluster "+instanceName+" RUNNING", gcloud.JSONField(t, "status", []string{"RUNNING"}, "container", "clusters", "describe", instanceName, "--region="+region))
 
-	for i := 0; i < maxRetries; i++ {
-		clusterOutput := terraform.OutputJson(t, terraformOptions, "gke_clusters")
+	clusterOutput := terraform.OutputJson(t, terraformOptions, "gke_clusters")
+	if !gjson.Valid(clusterOutput) {
+		t.Fatalf("Error parsing output, invalid json: %s", clusterOutput)
+	}
 
-		if !gjson.Valid(clusterOutput) {
-			t.Errorf("Error parsing output, invalid json: %s", clusterOutput)
-			continue // Skip to next retry if output is invalid
+	result := gjson.Parse(clusterOutput)
+	if len(result.Map()) == 0 {
+		t.Errorf("GKE cluster not found in output: %s", clusterOutput)
+	}
+
+	result.ForEach(func(key, value gjson.Result) bool {
+		clusterData := value
+
+		// Verify GKE Cluster Properties
+		name := clusterData.Get("name").String()
+		if name != instanceName {
+			t.Errorf("GKE Cluster name is invalid: got %s, want %s", name, instanceName)
+		} else {
+			t.Logf("GKE Cluster name is valid: %s", name) // Success message
 		}
 
-		result := gjson.Parse(clusterOutput)
-
-		result.ForEach(func(key, value gjson.Result) bool {
-			clusterID = key.String()
-			clusterData := value
-
-			// Verify GKE Cluster Properties
-			name := clusterData.Get("name").String()
-			if name != instanceName {
-				t.Errorf("GKE Cluster name is invalid: got %s, want %s", name, instanceName)
-			} else {
-				t.Logf("GKE Cluster name is valid: %s", name) // Success message
-			}
-
-			// Verify Kubernetes Version
-			kubernetesVersion := clusterData.Get("master_version").String()
-			if kubernetesVersion != "1.27.16-gke.1287000" {
-				t.Errorf("GKE Cluster Kubernetes version is invalid: got %s, want 1.27.16-gke.1287000", kubernetesVersion)
-			} else {
-				t.Logf("GKE Cluster Kubernetes version is valid: %s", kubernetesVersion) // Success message
-			}
-
-			// Verify Region
-			regionInLogs := clusterData.Get("region").String()
-			if regionInLogs != region {
-				t.Errorf("GKE Cluster region is invalid: got %s, want %s", regionInLogs, region)
-			} else {
-				t.Logf("GKE Cluster region is valid: %s", regionInLogs) // Success message
-			}
-
-			return false // Break out of the iteration
-		})
-
-		if clusterID != "" {
-			break
+		// Verify Kubernetes Version
+		kubernetesVersion := clusterData.Get("master_version").String()
+		if kubernetesVersion != "1.27.16-gke.1287000" {
+			t.Errorf("GKE Cluster Kubernetes version is invalid: got %s, want 1.27.16-gke.1287000", kubernetesVersion)
 		} else {
-			time.Sleep(retryInterval)
+			t.Logf("GKE Cluster Kubernetes version is valid: %s", kubernetesVersion) // Success message
 		}
-	}
 
-	if clusterID == "" {
-		t.Errorf("GKE cluster ID not found after %d retries", maxRetries)
-	}
+		// Verify Region
+		regionInLogs := clusterData.Get("region").String()
+		if regionInLogs != region {
+			t.Errorf("GKE Cluster region is invalid: got %s, want %s", regionInLogs, region)
+		} else {
+			t.Logf("GKE Cluster region is valid: %s", regionInLogs) // Success message
+		}
+
+		return false // Break out of the iteration
+	})
 }
 
 // TestTerraformModuleResourceAddressListMatch compares and verifies the list of resources,
@@ -175,9 +160,9 @@ func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Unmarshal into a GKEConfig struct
-	var gkeConfig GKEConfig
-	err = yaml.Unmarshal(yamlFile, &gkeConfig)
+	// Unmarshal into a configschema.GKE struct
+	var gkeConfig configschema.GKE
+	err = configschema.Unmarshal(yamlFile, &gkeConfig, true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -314,19 +299,20 @@ createGKEConfigYAML creates the YAML configuration file for GKE.
 */
 func createGKEConfigYAML(t *testing.T) {
 	t.Log("========= YAML File =========")
-	gkeConfig := GKEConfig{
-		Name:               instanceName,
-		ProjectID:          projectID,
-		KubernetesVersion:  kubernetesVersion,
-		Network:            networkName,
-		Subnetwork:         subnetName,
-		IPRangePods:        ipRangePods,
-		IPRangeServices:    ipRangeServices,
-		Region:             region,
-		DeletionProtection: deletionProtection,
+	gkeConfig := configschema.GKE{
+		Name:                  instanceName,
+		ProjectID:             projectID,
+		KubernetesVersion:     kubernetesVersion,
+		Network:               networkName,
+		Subnetwork:            subnetName,
+		IPRangePods:           ipRangePods,
+		IPRangeServices:       ipRangeServices,
+		Region:                region,
+		DeletionProtection:    configschema.Bool(deletionProtection),
+		ClusterResourceLabels: naming.Labels(t),
 	}
 
-	yamlData, err := yaml.Marshal(&gkeConfig)
+	yamlData, err := configschema.Marshal(&gkeConfig)
 	if err != nil {
 		t.Errorf("Error while marshalling YAML: %v", err)
 	}
@@ -338,100 +324,3 @@ func createGKEConfigYAML(t *testing.T) {
 		t.Errorf("Unable to write data into the file: %v", err)
 	}
 }
-
-/*
-createNetwork creates the VPC network required for the GKE cluster.
-*/
-func createNetwork(t *testing.T, projectID string, networkName string) {
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "create", networkName,
-			"--project=" + projectID,
-			"--bgp-routing-mode=global",
-			"--subnet-mode=custom",
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error creating network: %s", err)
-	}
-}
-
-/*
-createSubnet creates the subnet required for the GKE cluster.
-*/
-func createSubnet(t *testing.T, projectID string, networkName string, subnetName string) {
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "subnets", "create", subnetName,
-			"--project=" + projectID,
-			"--network=" + networkName,
-			"--region=" + region,
-			"--range=" + subnetIPRange,
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error creating subnet: %s", err)
-	}
-}
-
-/*
-createIPRanges creates the IP ranges required for the GKE cluster.
-*/
-func createIPRanges(t *testing.T, projectID string, region string, subnetName string) {
-	// Create IP range for pods
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "subnets", "update", subnetName,
-			"--project=" + projectID,
-			"--region=" + region,
-			"--add-secondary-ranges=" + "pods=" + podIPRange,
-			"--add-secondary-ranges=" + "services=" + servicesIPRange,
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error creating IP range for pods/services: %s", err)
-	}
-}
-
-/*
-deleteSubnet deletes the subnet.
-*/
-func deleteSubnet(t *testing.T, projectID string, subnetName string) {
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "subnets", "delete", subnetName,
-			"--project=" + projectID,
-			"--region=" + region,
-			"--quiet",
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error deleting subnet: %s", err)
-	}
-}
-
-/*
-deleteNetwork deletes the VPC network.
-*/
-func deleteNetwork(t *testing.T, projectID string, networkName string) {
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "networks", "delete", networkName,
-			"--project=" + projectID,
-			"--quiet",
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error deleting network: %s", err)
-	}
-}
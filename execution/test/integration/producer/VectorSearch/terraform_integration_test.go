@@ -15,46 +15,35 @@ package integrationtest
 
 import (
 	"fmt"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configschema"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/tidwall/gjson"
-	"gopkg.in/yaml.v2"
 	"io"
-	"math/rand"
 	"os"
 	"testing"
-	"time"
 )
 // Test configuration (adjust as needed)
 var (
 	projectID                 = os.Getenv("TF_VAR_project_id")
 	region                    = "us-central1"
-	terraformDirectoryPath    = "../../../../04-producer/VectorSearch"
+	terraformDirectoryPath    = stages.MustGet("producer/vectorsearch").TerraformDir()
 	configFolderPath          = "../../test/integration/producer/VectorSearch/config"
 	indexUpdateMethod         = "BATCH_UPDATE"
-	indexDisplayName          = fmt.Sprintf("vectorsearch%d", rand.Int())
-	rangeName                 = fmt.Sprintf("psa-%s", indexDisplayName)
-	indexEndpointDisplayName  = fmt.Sprintf("indexendpoint-%s", indexDisplayName)
-	deployedIndexID           = fmt.Sprintf("deployedindexid_%s", indexDisplayName)
-	networkName               = fmt.Sprintf("vpc-%s-test", indexDisplayName)
-	dimension                 = 2
+	names                     = naming.New("producer/vectorsearch", "TestCreateVectorSearch")
+	indexDisplayName          = names.Name(naming.VertexDisplayName, "index")
+	rangeName                 = names.Name(naming.Compute, "psa")
+	indexEndpointDisplayName  = names.Name(naming.VertexDisplayName, "index-endpoint")
+	deployedIndexID           = names.Name(naming.VertexDeployedIndexID, "deployed-index")
+	networkName               = names.Name(naming.Compute, "vpc")
 	approximateNeighborsCount = 150
 )
 
-type VectorSearchStruct struct {
-	ProjectID                 string `yaml:"project_id"`
-	Region                    string `yaml:"region"`
-	IndexDisplayName          string `yaml:"index_display_name"`
-	IndexDescription          string `yaml:"index_description"`
-	Dimension                 int    `yaml:"dimension"`
-	ApproximateNeighborsCount int    `yaml:"approximate_neighbors_count"`
-	IndexUpdateMethod         string `yaml:"index_update_method"`
-	IndexEndpointDisplayname  string `yaml:"index_endpoint_display_name"`
-	IndexEndpointNetwork      string `yaml:"index_endpoint_network"`
-	BruteForceConfig          string `yaml:"brute_force_config"`
-	DeployedIndexId           string `yaml:"deployed_index_id"`
-}
-
 /*
 TestCreateVectorSearch creates a vector search index, index endpoint and deploys the index endpoint to this index,
 performs verification on successfull creation of the vector search resources.
@@ -101,23 +90,19 @@ func TestCreateVectorSearch(t *testing.T) {
 		NoColor:              true,
 		SetVarsAfterVarFiles: true,
 	})
-	// Create VPC outside of the terraform module.
-	err := createVPC(t, projectID, networkName)
-	if err != nil {
-		t.Error(err)
-	}
-	// Create PSA in the VPC.
-	createPSA(t, projectID, networkName, rangeName)
-	// Delete VPC created outside of the terraform module.
-	defer deleteVPC(t, projectID, networkName)
-	// Remove PSA from the VPC.
-	defer deletePSA(t, projectID, networkName, rangeName)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, region)
+	// Create the VPC and PSA range outside of the terraform module. They are
+	// deleted once the test completes, after "terraform destroy".
+	gcloud := fixtures.New(projectID, region)
+	gcloud.Recorder = sup
+	network := gcloud.Network(t, networkName)
+	gcloud.PSARange(t, network, rangeName, "10.0.64.0/20")
 	// Clean up resources with "terraform destroy" at the end of the test.
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
-	terraform.InitAndApply(t, terraformOptions)
-	// Wait for 60 seconds to let resource acheive stable state.
-	time.Sleep(60 * time.Second)
+	sup.InitAndApply(t, terraformOptions)
 	// Run `terraform output` to get the values of output variables and check they have the expected values.
 	vectorSearchOutputValue := terraform.OutputJson(t, terraformOptions, "vector_search_instance_details")
 	t.Log(" ========= Terraform resource creation completed ========= ")
@@ -129,6 +114,9 @@ func TestCreateVectorSearch(t *testing.T) {
 	indexEndpointNamePath := fmt.Sprintf("%s.index_endpoint_name", indexDisplayName)
 	indexID := gjson.Get(result.String(), indexNamePath).String()
 	indexEndpointID := gjson.Get(result.String(), indexEndpointNamePath).String()
+	// Wait for the index endpoint to list the deployed index.
+	deployedIndexPath := fmt.Sprintf(`deployedIndexes.#(id=="%s").id`, deployedIndexID)
+	wait.Until(t, "deployed index "+deployedIndexID, gcloud.JSONField(t, deployedIndexPath, []string{deployedIndexID}, "ai", "index-endpoints", "describe", indexEndpointID, "--region="+region))
 
 	t.Log(" ========= Verify Vector Search Index ID name ========= ")
 	indexIDPath := fmt.Sprintf("%s.index_id", indexDisplayName)
@@ -146,98 +134,6 @@ func TestCreateVectorSearch(t *testing.T) {
 	}
 }
 
-/*
-deleteVPC is a helper function which deletes the VPC after
-completion of the test.
-*/
-func deleteVPC(t *testing.T, projectID string, networkName string) {
-	time.Sleep(60 * time.Second)
-	text := "compute"
-	time.Sleep(60 * time.Second)
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "delete", networkName, "--project=" + projectID, "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-/*
-deletePSA is a helper function which deletes the PSA range after the
-execution of the test.
-*/
-func deletePSA(t *testing.T, projectID string, networkName string, rangeName string) {
-	// Delete PSA IP range
-	time.Sleep(60 * time.Second)
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "addresses", "delete", rangeName, "--project=" + projectID, "--global", "--verbosity=info", "--format=json", "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Logf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
-	// Delete PSA range
-	text = "services"
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "vpc-peerings", "delete", "--service=servicenetworking.googleapis.com", "--project=" + projectID, "--network=" + networkName, "--verbosity=info", "--format=json", "--quiet"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Logf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-/*
-createVPC is a helper function which creates the VPC before the
-execution of the test.
-*/
-func createVPC(t *testing.T, projectID string, networkName string) error {
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "create", networkName, "--project=" + projectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=info"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	return err
-}
-
-/*
-createPSA is a helper function which creates the PSA range before the
-execution of the test.
-*/
-func createPSA(t *testing.T, projectID string, networkName string, rangeName string) {
-	// Create an IP range
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "addresses", "create", rangeName, "--purpose=VPC_PEERING", "--addresses=10.0.64.0", "--prefix-length=20", "--project=" + projectID, "--network=" + networkName, "--global", "--verbosity=info", "--format=json"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	// Create PSA range
-	text = "services"
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "vpc-peerings", "connect", "--service=servicenetworking.googleapis.com", "--ranges=" + rangeName, "--project=" + projectID, "--network=" + networkName, "--verbosity=info", "--format=json"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
-}
-
 /*
 createConfigYAML is a helper function which creates the config YAML file which is used
 for creation of test instance.
@@ -256,19 +152,20 @@ func createConfigYAML(t *testing.T) {
 	t.Log("========= YAML File =========")
 	indexEndpointNetwork := fmt.Sprintf("projects/%s/global/networks/%s", projectNumber, networkName)
 	t.Logf("Index Endpoint Network : %s", indexEndpointNetwork)
-	instance1 := VectorSearchStruct{
+	instance1 := configschema.VectorSearch{
 		ProjectID:                 projectID,
 		Region:                    region,
 		IndexDisplayName:          indexDisplayName,
-		ApproximateNeighborsCount: approximateNeighborsCount,
-		Dimension:                 dimension,
+		ApproximateNeighborsCount: configschema.Int(approximateNeighborsCount),
 		IndexUpdateMethod:         indexUpdateMethod,
-		IndexEndpointDisplayname:  indexEndpointDisplayName,
-		IndexEndpointNetwork:      indexEndpointNetwork,
-		BruteForceConfig:          "",
-		DeployedIndexId:           deployedIndexID,
-	}
-	yamlData, err := yaml.Marshal(&instance1)
+		IndexEndpointDisplayName:  indexEndpointDisplayName,
+		IndexEndpointNetwork:      configschema.String(indexEndpointNetwork),
+		BruteForceConfig:          configschema.String(""),
+		DeployedIndexID:           deployedIndexID,
+		IndexLabels:               naming.Labels(t),
+		IndexEndpointLabels:       naming.Labels(t),
+	}
+	yamlData, err := configschema.Marshal(&instance1)
 	if err != nil {
 		t.Errorf("Error while marshallaing %v", err)
 	}
@@ -19,46 +19,47 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
-	"time"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configschema"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/gruntwork-io/terratest/modules/shell"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/tidwall/gjson"
-	"golang.org/x/exp/rand"
-	"gopkg.in/yaml.v2"
 )
 
 var (
 	projectRoot, _ = filepath.Abs("../")
 
 	// Path to the main Terraform directory for the VertexAI module.
-	terraformDirectoryPath = filepath.Join(projectRoot, "../../../04-producer/Vertex-AI-Online-Endpoints")
+	terraformDirectoryPath = stages.MustGet("producer/onlineendpoint").TerraformDir()
 
 	// Path to the main Terraform directory for the VertexAI module.
 	configFolderPath = filepath.Join(projectRoot, "Vertex-AI-Online-Endpoints/config")
 	projectID        = os.Getenv("TF_VAR_project_id")
 	region           = "us-central1"
-	psaRangeName     = "psa-range-cncs-test"
+	names            = naming.New("producer/onlineendpoint", "TestCreateEndpointWithVPC")
+	psaRangeName     = names.Name(naming.Compute, "psa")
 )
 
-type EndpointConfig struct {
-	Name        string `yaml:"name"`
-	Project     string `yaml:"project"`
-	DisplayName string `yaml:"display_name"`
-	Description string `yaml:"description"`
-	Location    string `yaml:"location"`
-	Region      string `yaml:"region"`
-	Network     string `yaml:"network"`
-}
-
 // TestCreateEndpointWithVPC creates a VPC and then creates an Vertex AI Online Endpoint with the new VPC
 func TestCreateEndpointWithVPC(t *testing.T) {
 
-	timestamp := time.Now().Format("20060102150405")
-	VPCName := fmt.Sprintf("vpc-%s-%d", timestamp, rand.Intn(100000))
+	VPCName := names.Name(naming.Compute, "vpc")
 
-	createVPC(t, projectID, VPCName)
-	defer deleteVPC(t, projectID, VPCName)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, region)
+	// Create a VPC with a subnet and Private Service Access. They are deleted
+	// once the test completes, after "terraform destroy".
+	gcloud := fixtures.New(projectID, region)
+	gcloud.Recorder = sup
+	network := gcloud.Network(t, VPCName)
+	gcloud.Subnet(t, network, names.Name(naming.Compute, "subnet"), "10.0.0.0/24")
+	gcloud.PSARange(t, network, psaRangeName, "/24")
 
 	createEndpointConfigYAML(t, VPCName, "endpoint_vpc.yaml")
 
@@ -79,9 +80,9 @@ func TestCreateEndpointWithVPC(t *testing.T) {
 	// Refresh the Terraform state before applying changes
 	terraform.RunTerraformCommand(t, terraformOptions, "refresh")
 
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 
-	terraform.InitAndApply(t, terraformOptions)
+	sup.InitAndApply(t, terraformOptions)
 
 	// Read the YAML file
 	yamlConfig, err := readEndpointConfigYAML("endpoint_vpc.yaml")
@@ -89,27 +90,25 @@ func TestCreateEndpointWithVPC(t *testing.T) {
 		t.Logf("Error reading YAML config: %v", err)
 	}
 
-	validateEndpoints(t, terraformOptions, yamlConfig.Network)
+	validateEndpoints(t, gcloud, terraformOptions, yamlConfig.Network)
 }
 
 // Function to create a YAML config for the Online Endpoint
 func createEndpointConfigYAML(t *testing.T, vpcName string, fileName string) {
 	t.Log("========= YAML File =========")
 
-	// Generate a unique endpoint name with a timestamp
-	endpointName := fmt.Sprintf("vertexai-name-%s-%08d", time.Now().Format("20060102150405"), rand.Intn(100000000))
-
-	endpointConfig := EndpointConfig{
-		Name:        endpointName,
+	endpointConfig := configschema.VertexEndpoint{
+		Name:        names.Name(naming.VertexDisplayName, "endpoint"),
 		Project:     projectID,
-		DisplayName: fmt.Sprintf("vertexai-displayname-%s-%08d", time.Now().Format("20060102150405"), rand.Intn(100000000)),
+		DisplayName: names.Name(naming.VertexDisplayName, "endpoint-display"),
 		Description: "test-description",
 		Location:    region,
 		Region:      region,
 		Network:     fmt.Sprintf("projects/%s/global/networks/%s", getProjectNumber(t, projectID), vpcName),
+		Labels:      naming.Labels(t),
 	}
 
-	yamlData, err := yaml.Marshal(&endpointConfig)
+	yamlData, err := configschema.Marshal(&endpointConfig)
 	if err != nil {
 		t.Errorf("Error while marshalling %v", err)
 	}
@@ -123,16 +122,16 @@ func createEndpointConfigYAML(t *testing.T, vpcName string, fileName string) {
 	}
 }
 
-// readEndpointConfigYAML reads the YAML file and returns the EndpointConfig struct
-func readEndpointConfigYAML(fileName string) (*EndpointConfig, error) {
+// readEndpointConfigYAML reads the YAML file and returns the configschema.VertexEndpoint struct
+func readEndpointConfigYAML(fileName string) (*configschema.VertexEndpoint, error) {
 	filePath := fmt.Sprintf("%s/%s", configFolderPath, fileName)
 	yamlData, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read YAML file: %v", err)
 	}
 
-	var config EndpointConfig
-	err = yaml.Unmarshal(yamlData, &config)
+	var config configschema.VertexEndpoint
+	err = configschema.Unmarshal(yamlData, &config, true)
 	if err != nil {
 		return nil, fmt.Errorf("unable to unmarshal YAML data: %v", err)
 	}
@@ -140,52 +139,42 @@ func readEndpointConfigYAML(fileName string) (*EndpointConfig, error) {
 	return &config, nil
 }
 
-// validateEndpoints validates the endpoints created by the Terraform module
-func validateEndpoints(t *testing.T, terraformOptions *terraform.Options, expectedNetwork string) {
-	maxRetries := 10
-	retryInterval := 10 * time.Second
-	endpointsReady := false
+// validateEndpoints waits for each endpoint created by the Terraform module to
+// answer on its network and validates its configuration
+func validateEndpoints(t *testing.T, gcloud *fixtures.Fixtures, terraformOptions *terraform.Options, expectedNetwork string) {
+	endpointOutputValue := terraform.OutputJson(t, terraformOptions, "endpoint_configurations")
+
+	if !gjson.Valid(endpointOutputValue) {
+		t.Fatalf("Error parsing output, invalid json: %s", endpointOutputValue)
+	}
 
-	for i := 0; i < maxRetries; i++ {
-		endpointOutputValue := terraform.OutputJson(t, terraformOptions, "endpoint_configurations")
+	result := gjson.Parse(endpointOutputValue)
 
-		if !gjson.Valid(endpointOutputValue) {
-			t.Errorf("Error parsing output, invalid json: %s", endpointOutputValue)
-			continue
+	result.ForEach(func(key, value gjson.Result) bool {
+		expectedDisplayName := key.String()
+
+		// Wait for the endpoint to be described with its network
+		endpointName := value.Get("name").String()
+		wait.Until(t, "endpoint "+endpointName+" on "+expectedNetwork, gcloud.JSONField(t, "network", []string{expectedNetwork}, "ai", "endpoints", "describe", endpointName, "--region="+region))
+
+		// Verify Endpoint Display Name
+		gotDisplayName := value.Get("display_name").String()
+		if gotDisplayName != expectedDisplayName {
+			t.Errorf("Endpoint '%s' has invalid display_name: got %s, want %s", expectedDisplayName, gotDisplayName, expectedDisplayName)
+		} else {
+			t.Logf("Endpoint has valid display_name")
 		}
 
-		result := gjson.Parse(endpointOutputValue)
-		endpointsReady = true
-
-		result.ForEach(func(key, value gjson.Result) bool {
-			expectedDisplayName := key.String()
-
-			// Verify Endpoint Display Name
-			gotDisplayName := value.Get("display_name").String()
-			if gotDisplayName != expectedDisplayName {
-				t.Errorf("Endpoint '%s' has invalid display_name: got %s, want %s", expectedDisplayName, gotDisplayName, expectedDisplayName)
-			} else {
-				t.Logf("Endpoint has valid display_name")
-			}
-
-			// Verify Endpoint Network (using the expectedNetwork argument)
-			gotNetwork := value.Get("network").String()
-			if gotNetwork != expectedNetwork {
-				t.Errorf("Endpoint '%s' has invalid network: got %s, want %s", expectedDisplayName, gotNetwork, expectedNetwork)
-			} else {
-				t.Logf("Endpoint has valid network")
-			}
-
-			return true
-		})
-
-		if endpointsReady {
-			break
+		// Verify Endpoint Network (using the expectedNetwork argument)
+		gotNetwork := value.Get("network").String()
+		if gotNetwork != expectedNetwork {
+			t.Errorf("Endpoint '%s' has invalid network: got %s, want %s", expectedDisplayName, gotNetwork, expectedNetwork)
 		} else {
-			t.Errorf("Endpoints not ready after %d retries", maxRetries)
-			time.Sleep(retryInterval)
+			t.Logf("Endpoint has valid network")
 		}
-	}
+
+		return true
+	})
 }
 
 // getProjectNumber gets the Project Number for the Endpoint configuration
@@ -201,150 +190,6 @@ func getProjectNumber(t *testing.T, projectID string) string {
 	return output
 }
 
-// createVPC creates a VPC and required subnet
-func createVPC(t *testing.T, projectID string, networkName string) {
-	text := "compute"
-
-	// Create VPC
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "create", networkName, "--project=" + projectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=none"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Logf("===Error %s Encountered while executing %s", err, text)
-	}
-
-	// Wait for VPC creation to propagate
-	time.Sleep(60 * time.Second)
-
-	// Create Subnet
-	subnetName := fmt.Sprintf("%s-subnet", networkName)
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			text, "networks", "subnets", "create", subnetName,
-			"--project=" + projectID,
-			"--network=" + networkName,
-			"--region=" + region,
-			"--range=10.0.0.0/24",
-		},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Logf("===Error %s Encountered while executing %s", err, text)
-	}
-
-	// Enable Private Service Access for the VPC
-	createInternalIPRange(t, projectID, networkName)
-	enablePrivateServiceAccess(t, projectID, networkName, psaRangeName)
-}
-
-// createInternalIPRange creates an IP Range for testing
-func createInternalIPRange(t *testing.T, projectID, networkName string) {
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "addresses", "create", psaRangeName,
-			"--global",
-			"--project=" + projectID,
-			"--network=" + networkName,
-			"--purpose=VPC_PEERING",
-			"--prefix-length=24", // Adjust prefix length if needed
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error creating internal IP range: %v", err)
-	}
-}
-
-// enablePrivateServiceAccess creates peering for VPC network
-func enablePrivateServiceAccess(t *testing.T, projectID, networkName, psaRangeName string) {
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"services", "vpc-peerings", "connect",
-			"--service=servicenetworking.googleapis.com",
-			"--project=" + projectID,
-			"--network=" + networkName,
-			"--ranges=" + psaRangeName,
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error creating PSA connection: %v", err)
-	}
-}
-
-// deletePSARange deletes the PSA range after testing
-func deletePSARange(t *testing.T, projectID string, psaRangeName string) {
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"compute", "addresses", "delete", psaRangeName,
-			"--project=" + projectID,
-			"--global",
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error deleting internal IP range: %v", err)
-	}
-}
-
-// deletePSAConnection deletes the PSA connection after testing
-func deletePSAConnection(t *testing.T, projectID string, networkName string) {
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			"services", "vpc-peerings", "delete", "--service=servicenetworking.googleapis.com",
-			"--network=" + networkName,
-			"--project=" + projectID,
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("Error deleting PSA Connection: %v", err)
-	}
-}
-
-// deleteVPC deletes the VPC and subnets after testing
-func deleteVPC(t *testing.T, projectID string, networkName string) {
-	text := "compute"
-	time.Sleep(60 * time.Second)
-
-	deletePSARange(t, projectID, psaRangeName)
-	deletePSAConnection(t, projectID, networkName)
-
-	// Delete Subnet
-	subnetName := fmt.Sprintf("%s-subnet", networkName)
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args: []string{
-			text, "networks", "subnets", "delete", subnetName,
-			"--project=" + projectID,
-			"--region=" + region,
-			"--quiet",
-		},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-
-	// Delete VPC
-	time.Sleep(120 * time.Second)
-	cmd = shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "delete", networkName, "--project=" + projectID, "--quiet"},
-	}
-	_, err = shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
 func TestMain(m *testing.M) {
 	if err := cleanupYAMLFiles(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error cleaning up YAML files: %v\n", err)
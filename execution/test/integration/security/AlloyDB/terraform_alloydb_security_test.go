@@ -16,21 +16,23 @@ package integrationtest
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
 	"testing"
-	"time"
 
-	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/tidwall/gjson"
 )
 
 var (
-	terraformDirectoryPath = "../../../../03-security/AlloyDB"
+	terraformDirectoryPath = stages.MustGet("security/alloydb").TerraformDir()
 	projectID              = os.Getenv("TF_VAR_project_id")
-	uniqueID               = rand.Int() //included as a suffix to the VPC and subnet names.
-	networkName            = fmt.Sprintf("test-vpc-security-%d", uniqueID)
+	names                  = naming.New("security/alloydb", "TestCreateAlloyDBFirewallRule")
+	networkName            = names.Name(naming.Compute, "vpc")
 	firewallName           = "test-allow-egress-alloydb"
 	firewallDirection      = "EGRESS"
 )
@@ -69,20 +71,23 @@ func TestCreateAlloyDBFirewallRule(t *testing.T) {
 		NoColor:              true,
 		SetVarsAfterVarFiles: true,
 	})
-	// Create VPC outside of the terraform module.
-	createVPC(t, projectID, networkName)
-
-	// Delete VPC created outside of the terraform module.
-	defer deleteVPC(t, projectID, networkName)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, "")
+	// Create VPC outside of the terraform module. It is deleted once the test
+	// completes, after "terraform destroy".
+	gcloud := fixtures.New(projectID, "")
+	gcloud.Recorder = sup
+	gcloud.Network(t, networkName)
 
 	// Clean up resources with "terraform destroy" at the end of the test.
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 
 	// Run "terraform init" and "terraform apply". Fail the test if there are any errors.
-	terraform.InitAndApply(t, terraformOptions)
+	sup.InitAndApply(t, terraformOptions)
 
-	// Wait for 60 seconds to let resource acheive stable state.
-	time.Sleep(60 * time.Second)
+	// Wait for the firewall rule to be visible.
+	wait.Until(t, "firewall rule "+firewallName, gcloud.FirewallRuleVisible(t, firewallName))
 
 	// Run `terraform output` to get the values of output variables and check they have the expected values.
 	want := firewallName
@@ -109,38 +114,3 @@ func TestCreateAlloyDBFirewallRule(t *testing.T) {
 		t.Errorf("Firewall with invalid direction created = %v, want = %v", got, want)
 	}
 }
-
-/*
-deleteVPC is a helper function which deletes the VPC after
-completion of the test.
-*/
-func deleteVPC(t *testing.T, projectID string, networkName string) {
-	text := "compute"
-	time.Sleep(60 * time.Second)
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "delete", networkName, "--project=" + projectID, "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-/*
- createVPC is a helper function which creates the VPC before the
- execution of the test.
-*/
-
-func createVPC(t *testing.T, projectID string, networkName string) {
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "create", networkName, "--project=" + projectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=none"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
-}
@@ -15,23 +15,24 @@
 package integrationtest
 
 import (
-	"fmt"
-	"math/rand"
 	"os"
 	"testing"
-	"time"
 
-	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/tidwall/gjson"
 )
 
 var (
-	terraformDirectoryPath = "../../../../03-security/GCE" // Update with your GCE directory path
+	terraformDirectoryPath = stages.MustGet("security/gce").TerraformDir()
 	projectID              = os.Getenv("TF_VAR_project_id")
-	uniqueID               = rand.Int()
-	network                = fmt.Sprintf("test-vpc-security-%d", uniqueID)
+	names                  = naming.New("security/gce", "TestGCEFirewallRuleProperties")
+	network                = names.Name(naming.Compute, "vpc")
 	firewallRuleName       = "allow-ssh-custom-ranges-gce"
 )
 
@@ -62,15 +63,17 @@ func TestGCEFirewallRuleProperties(t *testing.T) {
 		NoColor:      true,
 	})
 
-	// Create VPC
-	createVPC(t, projectID, network)
-
-	// Defer VPC deletion
-	defer deleteVPC(t, projectID, network)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, "")
+	// Create VPC, deleted once the test completes
+	gcloud := fixtures.New(projectID, "")
+	gcloud.Recorder = sup
+	gcloud.Network(t, network)
 
 	// Terraform init and apply
-	terraform.InitAndApply(t, terraformOptions)
-	time.Sleep(60 * time.Second) // Wait for resource creation
+	sup.InitAndApply(t, terraformOptions)
+	wait.Until(t, "firewall rule "+firewallRuleName, gcloud.FirewallRuleVisible(t, firewallRuleName))
 
 	// Get Firewall rule from output
 	firewallRulesOutput := terraform.OutputJson(t, terraformOptions, "rules")
@@ -152,32 +155,5 @@ func TestGCEFirewallRuleProperties(t *testing.T) {
 	})
 
 	// Clean up resources with "terraform destroy"
-	terraform.Destroy(t, terraformOptions)
-}
-
-// Helper Functions
-func deleteVPC(t *testing.T, projectID string, network string) {
-	text := "compute"
-	time.Sleep(60 * time.Second)
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "delete", network, "--project=" + projectID, "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-func createVPC(t *testing.T, projectID string, network string) {
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "create", network, "--project=" + projectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=none"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
+	sup.Destroy(t, terraformOptions)
 }
@@ -16,22 +16,24 @@ package integrationtest
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
 	"slices"
 	"testing"
-	"time"
 
-	"github.com/gruntwork-io/terratest/modules/shell"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/fixtures"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/teardown"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/tidwall/gjson"
 )
 
 var (
-	terraformDirectoryPath = "../../../../03-security/MRC" // Update with your actual path
+	terraformDirectoryPath = stages.MustGet("security/mrc").TerraformDir()
 	projectID              = os.Getenv("TF_VAR_project_id")
-	uniqueID               = rand.Int()
-	networkName            = fmt.Sprintf("test-vpc-security-%d", uniqueID)
+	names                  = naming.New("security/mrc", "TestCreateMemorystoreRedisFirewallRule")
+	networkName            = names.Name(naming.Compute, "vpc")
 	firewallName           = "test-allow-egress-mrc"
 	firewallDirection      = "EGRESS"
 )
@@ -64,16 +66,20 @@ func TestCreateMemorystoreRedisFirewallRule(t *testing.T) {
 		SetVarsAfterVarFiles: true,
 	})
 
-	// Create VPC
-	createVPC(t, projectID, networkName)
-	defer deleteVPC(t, projectID, networkName)
+	// Record the fixtures and the Terraform directory in a ledger, so that they
+	// are torn down even when the test is interrupted or runs out of time.
+	sup := teardown.Supervise(t, projectID, "")
+	// Create VPC, deleted after "terraform destroy"
+	gcloud := fixtures.New(projectID, "")
+	gcloud.Recorder = sup
+	gcloud.Network(t, networkName)
 
 	// Clean up Terraform resources
-	defer terraform.Destroy(t, terraformOptions)
+	defer sup.Destroy(t, terraformOptions)
 
 	// Initialize and Apply
-	terraform.InitAndApply(t, terraformOptions)
-	time.Sleep(60 * time.Second)
+	sup.InitAndApply(t, terraformOptions)
+	wait.Until(t, "firewall rule "+firewallName, gcloud.FirewallRuleVisible(t, firewallName))
 
 	// Get Output and Validate
 	want := firewallName
@@ -140,30 +146,3 @@ func TestCreateMemorystoreRedisFirewallRule(t *testing.T) {
 		}
 	})
 }
-
-// Helper Functions
-func deleteVPC(t *testing.T, projectID string, networkName string) {
-	text := "compute"
-	time.Sleep(60 * time.Second)
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "delete", networkName, "--project=" + projectID, "--quiet"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-}
-
-func createVPC(t *testing.T, projectID string, networkName string) {
-	text := "compute"
-	cmd := shell.Command{
-		Command: "gcloud",
-		Args:    []string{text, "networks", "create", networkName, "--project=" + projectID, "--format=json", "--bgp-routing-mode=global", "--subnet-mode=custom", "--verbosity=none"},
-	}
-	_, err := shell.RunCommandAndGetOutputE(t, cmd)
-	if err != nil {
-		t.Errorf("===Error %s Encountered while executing %s", err, text)
-	}
-	time.Sleep(60 * time.Second)
-}
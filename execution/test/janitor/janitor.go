@@ -0,0 +1,354 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package janitor finds and deletes the resources integration tests leaked
+// when a run panicked or was killed before its teardown ran.
+//
+// Resources are read from the gcloud --format=json listings of a project.
+// A resource is an orphan when it is older than a TTL and either its name
+// follows a naming pattern of the integration tests, such as cloudsql-%d or
+// test-vpc-security-%d, or it carries the labels of package naming, which
+// networks, subnets and addresses carry as their description instead. The
+// cncs-created label, when set, dates a resource instead of its creation
+// time. Everything attached to an orphaned network, such as instances,
+// service connection policies, PSA peerings, addresses, subnets and
+// firewall rules, is an orphan too, since the network cannot be deleted
+// before it. Orphans are deleted in Order, so that dependants go first.
+//
+// Listing and planning never change anything; only Delete does, so a dry
+// run is a List followed by a Plan.
+package janitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
+)
+
+// Kind is a type of resource the janitor lists and deletes.
+type Kind string
+
+const (
+	SQLInstance     Kind = "sql-instance"
+	AlloyDBCluster  Kind = "alloydb-cluster"
+	RedisCluster    Kind = "redis-cluster"
+	GKECluster      Kind = "gke-cluster"
+	ComputeInstance Kind = "compute-instance"
+	// ServiceConnectionPolicy is a policy the Redis clusters create their
+	// PSC endpoints with.
+	ServiceConnectionPolicy Kind = "service-connection-policy"
+	PSAPeering              Kind = "psa-peering"
+	Address                 Kind = "address"
+	Subnet                  Kind = "subnet"
+	Firewall                Kind = "firewall"
+	Network                 Kind = "network"
+)
+
+// Order lists the kinds in the order they are deleted: instances, service
+// connection policies, then the PSA peerings and the addresses they connect,
+// subnets, firewall rules and finally networks.
+var Order = []Kind{SQLInstance, AlloyDBCluster, RedisCluster, GKECluster, ComputeInstance, ServiceConnectionPolicy, PSAPeering, Address, Subnet, Firewall, Network}
+
+// PSAPeeringName is the name of the peering service networking creates for
+// private services access.
+const PSAPeeringName = "servicenetworking-googleapis-com"
+
+// Resource is a listed resource.
+type Resource struct {
+	Kind Kind
+	Name string
+	// Location is the region or zone of the resource, empty when global.
+	Location string
+	// Network is the name of the network the resource is attached to.
+	Network string
+	Created time.Time
+	Labels  map[string]string
+}
+
+func (r Resource) String() string {
+	location := r.Location
+	if location == "" {
+		location = "global"
+	}
+	if r.Kind == PSAPeering {
+		return fmt.Sprintf("%s %s of network %s", r.Kind, r.Name, r.Network)
+	}
+	return fmt.Sprintf("%s %s (%s)", r.Kind, r.Name, location)
+}
+
+// listing is the gcloud command that lists the resources of a kind.
+type listing struct {
+	kind Kind
+	args []string
+	// regional listings need a --region flag.
+	regional bool
+}
+
+// listings lists every kind but PSAPeering, which is read from the
+// peerings of the network listing.
+var listings = []listing{
+	{kind: SQLInstance, args: []string{"sql", "instances", "list"}},
+	{kind: AlloyDBCluster, args: []string{"alloydb", "clusters", "list"}, regional: true},
+	{kind: RedisCluster, args: []string{"redis", "clusters", "list"}, regional: true},
+	{kind: GKECluster, args: []string{"container", "clusters", "list"}},
+	{kind: ComputeInstance, args: []string{"compute", "instances", "list"}},
+	{kind: ServiceConnectionPolicy, args: []string{"network-connectivity", "service-connection-policies", "list"}, regional: true},
+	{kind: Address, args: []string{"compute", "addresses", "list"}},
+	{kind: Subnet, args: []string{"compute", "networks", "subnets", "list"}},
+	{kind: Firewall, args: []string{"compute", "firewall-rules", "list"}},
+	{kind: Network, args: []string{"compute", "networks", "list"}},
+}
+
+// Runner runs a gcloud command and returns its standard output.
+type Runner interface {
+	Run(args ...string) ([]byte, error)
+}
+
+// GcloudRunner runs commands with the gcloud binary found in PATH.
+type GcloudRunner struct{}
+
+// Run implements Runner.
+func (GcloudRunner) Run(args ...string) ([]byte, error) {
+	cmd := exec.Command("gcloud", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("gcloud %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Janitor lists and deletes the resources of a project. AlloyDB and Redis
+// clusters and service connection policies are listed in Region only.
+type Janitor struct {
+	ProjectID string
+	Region    string
+	Runner    Runner
+
+	// Retry retries a failed delete, typically of a peering or network
+	// whose dependants are still being detached, until its Timeout passes.
+	Retry *wait.Waiter
+}
+
+// DefaultRetryTimeout bounds the retries of a single delete.
+const DefaultRetryTimeout = 5 * time.Minute
+
+// New returns a Janitor that runs gcloud against projectID and region.
+func New(projectID, region string) *Janitor {
+	retry := wait.New()
+	retry.Timeout = DefaultRetryTimeout
+	return &Janitor{ProjectID: projectID, Region: region, Runner: GcloudRunner{}, Retry: retry}
+}
+
+// List lists the resources of every kind.
+func (j *Janitor) List() ([]Resource, error) {
+	var resources []Resource
+	for _, l := range listings {
+		args := append(append([]string{}, l.args...), "--project="+j.ProjectID, "--format=json")
+		if l.regional {
+			args = append(args, "--region="+j.Region)
+		}
+		out, err := j.Runner.Run(args...)
+		if err != nil {
+			return nil, fmt.Errorf("listing %ss: %w", l.kind, err)
+		}
+		listed, err := ParseListing(l.kind, out)
+		if err != nil {
+			return nil, fmt.Errorf("listing %ss: %w", l.kind, err)
+		}
+		resources = append(resources, listed...)
+	}
+	return resources, nil
+}
+
+// listed holds the fields of every listing the janitor reads.
+type listed struct {
+	Name              string            `json:"name"`
+	Description       string            `json:"description"`
+	Region            string            `json:"region"`
+	Zone              string            `json:"zone"`
+	Location          string            `json:"location"`
+	Network           string            `json:"network"`
+	CreationTimestamp string            `json:"creationTimestamp"`
+	CreateTime        string            `json:"createTime"`
+	Labels            map[string]string `json:"labels"`
+	ResourceLabels    map[string]string `json:"resourceLabels"`
+	Settings          struct {
+		UserLabels      map[string]string `json:"userLabels"`
+		IPConfiguration struct {
+			PrivateNetwork string `json:"privateNetwork"`
+		} `json:"ipConfiguration"`
+	} `json:"settings"`
+	NetworkConfig struct {
+		Network string `json:"network"`
+	} `json:"networkConfig"`
+	PSCConfigs []struct {
+		Network string `json:"network"`
+	} `json:"pscConfigs"`
+	NetworkInterfaces []struct {
+		Network string `json:"network"`
+	} `json:"networkInterfaces"`
+	Peerings []struct {
+		Name string `json:"name"`
+	} `json:"peerings"`
+}
+
+// ParseListing returns the resources of a gcloud --format=json listing of
+// kind. The listing of networks also returns their PSA peerings.
+func ParseListing(kind Kind, data []byte) ([]Resource, error) {
+	var items []listed
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	var resources []Resource
+	for _, item := range items {
+		created := item.CreationTimestamp
+		if created == "" {
+			created = item.CreateTime
+		}
+		r := Resource{Kind: kind, Name: lastSegment(item.Name)}
+		if created != "" {
+			t, err := time.Parse(time.RFC3339, created)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", kind, r.Name, err)
+			}
+			r.Created = t
+		}
+		// AlloyDB and Redis clusters and service connection policies are
+		// named projects/{project}/locations/{location}/{collection}/{name}.
+		if parts := strings.Split(item.Name, "/"); len(parts) == 6 && parts[2] == "locations" {
+			r.Location = parts[3]
+		}
+		for _, location := range []string{item.Region, item.Zone, item.Location} {
+			if location != "" {
+				r.Location = lastSegment(location)
+			}
+		}
+		network := firstNonEmpty(item.Network, item.Settings.IPConfiguration.PrivateNetwork, item.NetworkConfig.Network)
+		for _, c := range item.PSCConfigs {
+			network = firstNonEmpty(network, c.Network)
+		}
+		for _, i := range item.NetworkInterfaces {
+			network = firstNonEmpty(network, i.Network)
+		}
+		if kind != Network {
+			r.Network = lastSegment(network)
+		}
+		r.Labels = naming.Parse(item.Description)
+		for _, labels := range []map[string]string{item.Labels, item.ResourceLabels, item.Settings.UserLabels} {
+			if len(labels) > 0 {
+				r.Labels = labels
+			}
+		}
+		resources = append(resources, r)
+		if kind != Network {
+			continue
+		}
+		for _, p := range item.Peerings {
+			if p.Name == PSAPeeringName {
+				resources = append(resources, Resource{Kind: PSAPeering, Name: p.Name, Network: r.Name, Created: r.Created})
+			}
+		}
+	}
+	return resources, nil
+}
+
+// Delete deletes candidates, which must be in Order as returned by Plan,
+// and reports each delete to w. A failed delete is retried, then reported,
+// and the remaining deletes still run; the returned error joins those that
+// failed. A resource that no longer exists counts as deleted.
+func (j *Janitor) Delete(w io.Writer, candidates []Candidate) error {
+	var errs []error
+	for _, c := range candidates {
+		args := DeleteArgs(j.ProjectID, c.Resource)
+		result, err := j.Retry.UntilE("deleting "+c.Resource.String(), func() (bool, error) {
+			_, err := j.Runner.Run(args...)
+			if err != nil && !isNotFound(err) {
+				return false, err
+			}
+			return true, nil
+		})
+		if err != nil {
+			fmt.Fprintf(w, "failed %s: %v\n", result.Name, err)
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(w, "finished %s\n", result)
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteArgs returns the gcloud command that deletes r in projectID.
+func DeleteArgs(projectID string, r Resource) []string {
+	var args []string
+	switch r.Kind {
+	case SQLInstance:
+		args = []string{"sql", "instances", "delete", r.Name}
+	case AlloyDBCluster:
+		args = []string{"alloydb", "clusters", "delete", r.Name, "--region=" + r.Location, "--force"}
+	case RedisCluster:
+		args = []string{"redis", "clusters", "delete", r.Name, "--region=" + r.Location}
+	case GKECluster:
+		args = []string{"container", "clusters", "delete", r.Name, "--location=" + r.Location}
+	case ComputeInstance:
+		args = []string{"compute", "instances", "delete", r.Name, "--zone=" + r.Location}
+	case ServiceConnectionPolicy:
+		args = []string{"network-connectivity", "service-connection-policies", "delete", r.Name, "--region=" + r.Location}
+	case PSAPeering:
+		args = []string{"services", "vpc-peerings", "delete", "--network=" + r.Network, "--service=servicenetworking.googleapis.com"}
+	case Address:
+		args = []string{"compute", "addresses", "delete", r.Name}
+		if r.Location == "" {
+			args = append(args, "--global")
+		} else {
+			args = append(args, "--region="+r.Location)
+		}
+	case Subnet:
+		args = []string{"compute", "networks", "subnets", "delete", r.Name, "--region=" + r.Location}
+	case Firewall:
+		args = []string{"compute", "firewall-rules", "delete", r.Name}
+	case Network:
+		args = []string{"compute", "networks", "delete", r.Name}
+	}
+	return append(args, "--project="+projectID, "--quiet")
+}
+
+// isNotFound reports whether err is gcloud failing because the resource does
+// not exist.
+func isNotFound(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "was not found") || strings.Contains(msg, "NOT_FOUND")
+}
+
+// lastSegment returns the last element of a resource name or URL.
+func lastSegment(s string) string {
+	return s[strings.LastIndex(s, "/")+1:]
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package janitor
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
+	"github.com/google/go-cmp/cmp"
+)
+
+// now is when the canned listings of testdata are planned.
+var now = time.Date(2024, 6, 2, 12, 0, 0, 0, time.UTC)
+
+// fakeRunner answers the list commands with the canned listings of testdata
+// and records every command. Errors scripts the responses of a command,
+// written as its arguments up to the first flag; the last one repeats.
+type fakeRunner struct {
+	Errors map[string][]error
+	calls  []string
+	counts map[string]int
+}
+
+var listingFiles = map[string]string{
+	"sql instances list":                                    "sql-instances.json",
+	"alloydb clusters list":                                 "alloydb-clusters.json",
+	"redis clusters list":                                   "redis-clusters.json",
+	"container clusters list":                               "gke-clusters.json",
+	"compute instances list":                                "compute-instances.json",
+	"network-connectivity service-connection-policies list": "service-connection-policies.json",
+	"compute addresses list":                                "addresses.json",
+	"compute networks subnets list":                         "subnets.json",
+	"compute firewall-rules list":                           "firewalls.json",
+	"compute networks list":                                 "networks.json",
+}
+
+func (r *fakeRunner) Run(args ...string) ([]byte, error) {
+	r.calls = append(r.calls, strings.Join(args, " "))
+	name := strings.Join(args, " ")
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			name = strings.Join(args[:i], " ")
+			break
+		}
+	}
+	if r.counts == nil {
+		r.counts = map[string]int{}
+	}
+	n := r.counts[name]
+	r.counts[name]++
+	if errs := r.Errors[name]; len(errs) > 0 {
+		if err := errs[min(n, len(errs)-1)]; err != nil {
+			return nil, err
+		}
+	}
+	if file, ok := listingFiles[name]; ok {
+		return os.ReadFile(filepath.Join("testdata", file))
+	}
+	return nil, nil
+}
+
+func newFakeJanitor() (*Janitor, *fakeRunner) {
+	runner := &fakeRunner{Errors: map[string][]error{}}
+	retry := wait.NewFake(wait.NewFakeClock(now))
+	retry.Timeout = DefaultRetryTimeout
+	return &Janitor{ProjectID: "test-project", Region: "us-central1", Runner: runner, Retry: retry}, runner
+}
+
+/*
+TestPlan verifies the orphans found in the canned listings: resources named
+like the integration tests name them or labeled with their creation time, in
+their labels or description, older than the TTL, and everything attached to
+their networks, in deletion order. Resources of a run still in progress and
+those of the project itself are kept.
+*/
+func TestPlan(t *testing.T) {
+	j, runner := newFakeJanitor()
+	resources, err := j.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range Plan(resources, Patterns, 24*time.Hour, now) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`sql-instance cloudsql-5577006791947779410 (us-central1): name matches ^cloudsql-\d+$, 50h47m0s old`,
+		"sql-instance reports (us-central1): labeled cncs-created=1714521600, 780h0m0s old",
+		`alloydb-cluster cid-6129484611666145821-test (us-central1): name matches ^cid-\d+-test$, 76h0m0s old`,
+		`redis-cluster mrc-4037200794235010051 (us-central1): name matches ^mrc-\d+$, 30h0m0s old`,
+		`compute-instance gce-1443635317331776148 (us-central1-a): name matches ^gce-\d+$, 51h0m0s old`,
+		"compute-instance bastion (us-central1-b): attached to orphaned network test-vpc-security-894385949183117216",
+		"service-connection-policy mrc-policy (us-central1): attached to orphaned network vpc-mrc-4037200794235010051-test",
+		"psa-peering servicenetworking-googleapis-com of network vpc-6129484611666145821-test: attached to orphaned network vpc-6129484611666145821-test",
+		"psa-peering servicenetworking-googleapis-com of network vpc-cloudsql-5577006791947779410-test: attached to orphaned network vpc-cloudsql-5577006791947779410-test",
+		"address psatestrangealloydb (global): name matches ^psatestrange(cloudsql|alloydb)?$, 76h4m0s old",
+		"address psatestrangecloudsql (global): name matches ^psatestrange(cloudsql|alloydb)?$, 50h49m0s old",
+		"subnet cloudsql-createcloudsql-subnet-k3f9q2-4y6r (us-central1): labeled cncs-created=1717200010, 35h59m0s old",
+		"subnet subnet-cloudsql-5577006791947779410 (us-central1): attached to orphaned network vpc-cloudsql-5577006791947779410-test",
+		"subnet subnet-gce-1443635317331776148 (us-central1): attached to orphaned network vpc-gce-1443635317331776148-test",
+		"subnet test-vpc-security-894385949183117216-subnet (us-central1): attached to orphaned network test-vpc-security-894385949183117216",
+		"firewall test-allow-egress-cloudsql (global): attached to orphaned network test-vpc-security-894385949183117216",
+		"network cloudsql-createcloudsql-vpc-k3f9q2-wzl9 (global): labeled cncs-created=1717200000, 36h0m0s old",
+		`network test-vpc-security-894385949183117216 (global): name matches ^test-vpc-(security|new|existing)-\d+$, 92h0m0s old`,
+		`network vpc-6129484611666145821-test (global): name matches ^vpc-(cloudsql-|mrc-|gce-|vectorsearch)?\d+-test$, 76h5m0s old`,
+		`network vpc-cloudsql-5577006791947779410-test (global): name matches ^vpc-(cloudsql-|mrc-|gce-|vectorsearch)?\d+-test$, 50h50m0s old`,
+		`network vpc-gce-1443635317331776148-test (global): name matches ^vpc-(cloudsql-|mrc-|gce-|vectorsearch)?\d+-test$, 51h5m0s old`,
+		`network vpc-mrc-4037200794235010051-test (global): name matches ^vpc-(cloudsql-|mrc-|gce-|vectorsearch)?\d+-test$, 30h10m0s old`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Plan() mismatch (-want +got):\n%s", diff)
+	}
+	if len(runner.calls) != len(listings) {
+		t.Errorf("List() ran %d commands, want %d", len(runner.calls), len(listings))
+	}
+	for _, call := range runner.calls {
+		if !strings.Contains(call, "--project=test-project --format=json") {
+			t.Errorf("List() ran %q, want it in test-project as JSON", call)
+		}
+	}
+}
+
+/*
+TestPlanUnknownAge verifies that a resource whose creation time is unknown
+is never an orphan, and that the TTL is honoured.
+*/
+func TestPlanUnknownAge(t *testing.T) {
+	resources := []Resource{
+		{Kind: SQLInstance, Name: "cloudsql-1"},
+		{Kind: SQLInstance, Name: "cloudsql-2", Created: now.Add(-2 * time.Hour)},
+		{Kind: SQLInstance, Name: "cloudsql-3", Labels: map[string]string{naming.CreatedLabel: "not-a-time"}},
+	}
+	if got := Plan(resources, Patterns, 3*time.Hour, now); len(got) != 0 {
+		t.Errorf("Plan() = %v, want no candidates", got)
+	}
+	if got := Plan(resources, Patterns, time.Hour, now); len(got) != 1 || got[0].Name != "cloudsql-2" {
+		t.Errorf("Plan() = %v, want cloudsql-2", got)
+	}
+}
+
+/*
+TestDelete verifies the delete commands, that a resource already gone counts
+as deleted, and that a failed delete is retried, reported and does not stop
+the remaining deletes.
+*/
+func TestDelete(t *testing.T) {
+	j, runner := newFakeJanitor()
+	runner.Errors["sql instances delete cloudsql-1"] = []error{errors.New("gcloud: ERROR: (gcloud.sql.instances.delete) HTTPError 404: The Cloud SQL instance does not exist. NOT_FOUND")}
+	runner.Errors["services vpc-peerings delete"] = []error{errors.New("Producer services (e.g. CloudSQL, Cloud Memstore, etc.) are still using this connection.")}
+	candidates := []Candidate{
+		{Resource: Resource{Kind: SQLInstance, Name: "cloudsql-1", Location: "us-central1"}},
+		{Resource: Resource{Kind: AlloyDBCluster, Name: "cid-1-test", Location: "us-central1"}},
+		{Resource: Resource{Kind: RedisCluster, Name: "mrc-1", Location: "us-central1"}},
+		{Resource: Resource{Kind: GKECluster, Name: "gke-1", Location: "us-central1"}},
+		{Resource: Resource{Kind: ComputeInstance, Name: "gce-1", Location: "us-central1-a"}},
+		{Resource: Resource{Kind: ServiceConnectionPolicy, Name: "policy", Location: "us-central1"}},
+		{Resource: Resource{Kind: PSAPeering, Name: PSAPeeringName, Network: "vpc-1-test"}},
+		{Resource: Resource{Kind: Address, Name: "psatestrangecloudsql"}},
+		{Resource: Resource{Kind: Address, Name: "nat", Location: "us-central1"}},
+		{Resource: Resource{Kind: Subnet, Name: "subnet", Location: "us-central1"}},
+		{Resource: Resource{Kind: Firewall, Name: "allow-ssh"}},
+		{Resource: Resource{Kind: Network, Name: "vpc-1-test"}},
+	}
+	var out bytes.Buffer
+	err := j.Delete(&out, candidates)
+	if err == nil || !strings.Contains(err.Error(), "still using this connection") {
+		t.Errorf("Delete() error = %v, want the failed peering delete", err)
+	}
+	if !strings.Contains(out.String(), "failed deleting psa-peering servicenetworking-googleapis-com of network vpc-1-test") {
+		t.Errorf("Delete() output = %q, want the failed peering delete", out.String())
+	}
+
+	var got []string
+	for _, call := range runner.calls {
+		if !strings.Contains(call, "vpc-peerings") || len(got) == 0 || got[len(got)-1] != call {
+			got = append(got, call)
+		}
+	}
+	want := []string{
+		"sql instances delete cloudsql-1 --project=test-project --quiet",
+		"alloydb clusters delete cid-1-test --region=us-central1 --force --project=test-project --quiet",
+		"redis clusters delete mrc-1 --region=us-central1 --project=test-project --quiet",
+		"container clusters delete gke-1 --location=us-central1 --project=test-project --quiet",
+		"compute instances delete gce-1 --zone=us-central1-a --project=test-project --quiet",
+		"network-connectivity service-connection-policies delete policy --region=us-central1 --project=test-project --quiet",
+		"services vpc-peerings delete --network=vpc-1-test --service=servicenetworking.googleapis.com --project=test-project --quiet",
+		"compute addresses delete psatestrangecloudsql --global --project=test-project --quiet",
+		"compute addresses delete nat --region=us-central1 --project=test-project --quiet",
+		"compute networks subnets delete subnet --region=us-central1 --project=test-project --quiet",
+		"compute firewall-rules delete allow-ssh --project=test-project --quiet",
+		"compute networks delete vpc-1-test --project=test-project --quiet",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("gcloud commands mismatch (-want +got):\n%s", diff)
+	}
+	if n := runner.counts["services vpc-peerings delete"]; n < 2 {
+		t.Errorf("peering delete ran %d times, want it retried", n)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package janitor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+)
+
+// Pattern matches the names the integration tests give to resources of a
+// kind.
+type Pattern struct {
+	Kind Kind
+	Name *regexp.Regexp
+}
+
+// Patterns are the names the integration tests give to the resources they
+// create, most of them with a rand.Int() suffix.
+var Patterns = []Pattern{
+	{Kind: SQLInstance, Name: regexp.MustCompile(`^cloudsql-\d+$`)},
+	{Kind: AlloyDBCluster, Name: regexp.MustCompile(`^cid-\d+-test$`)},
+	{Kind: RedisCluster, Name: regexp.MustCompile(`^mrc-\d+$`)},
+	{Kind: GKECluster, Name: regexp.MustCompile(`^gke-\d+$`)},
+	{Kind: ComputeInstance, Name: regexp.MustCompile(`^gce-\d+$`)},
+	{Kind: Address, Name: regexp.MustCompile(`^psatestrange(cloudsql|alloydb)?$`)},
+	{Kind: Address, Name: regexp.MustCompile(`^psa-vectorsearch\d+$`)},
+	{Kind: Address, Name: regexp.MustCompile(`^psa-range-cncs-test$`)},
+	{Kind: Subnet, Name: regexp.MustCompile(`^gke-cluster-subnetwork-\d+$`)},
+	{Kind: Subnet, Name: regexp.MustCompile(`^test-subnet-(new|existing)-\d+$`)},
+	{Kind: Network, Name: regexp.MustCompile(`^vpc-(cloudsql-|mrc-|gce-|vectorsearch)?\d+-test$`)},
+	{Kind: Network, Name: regexp.MustCompile(`^vpc-\d{14}-\d+$`)},
+	{Kind: Network, Name: regexp.MustCompile(`^gke-cluster-vpc-\d+$`)},
+	{Kind: Network, Name: regexp.MustCompile(`^test-vpc-(security|new|existing)-\d+$`)},
+}
+
+// Candidate is an orphan to delete.
+type Candidate struct {
+	Resource
+	// Reason explains why the resource is an orphan.
+	Reason string
+}
+
+func (c Candidate) String() string {
+	return c.Resource.String() + ": " + c.Reason
+}
+
+// Plan returns the orphans among resources, those older than ttl at now
+// that match patterns or carry the labels of a run, and everything attached to
+// an orphaned network. Candidates are sorted in Order, then by location,
+// name and network. Resources whose age is unknown are never orphans.
+func Plan(resources []Resource, patterns []Pattern, ttl time.Duration, now time.Time) []Candidate {
+	var candidates []Candidate
+	orphaned := map[string]bool{}
+	for _, r := range resources {
+		if r.Kind != Network {
+			continue
+		}
+		if reason, ok := orphan(r, patterns, ttl, now); ok {
+			candidates = append(candidates, Candidate{Resource: r, Reason: reason})
+			orphaned[r.Name] = true
+		}
+	}
+	for _, r := range resources {
+		if r.Kind == Network {
+			continue
+		}
+		if reason, ok := orphan(r, patterns, ttl, now); ok {
+			candidates = append(candidates, Candidate{Resource: r, Reason: reason})
+		} else if orphaned[r.Network] {
+			candidates = append(candidates, Candidate{Resource: r, Reason: "attached to orphaned network " + r.Network})
+		}
+	}
+	rank := map[Kind]int{}
+	for i, kind := range Order {
+		rank[kind] = i
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if rank[a.Kind] != rank[b.Kind] {
+			return rank[a.Kind] < rank[b.Kind]
+		}
+		if a.Location != b.Location {
+			return a.Location < b.Location
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Network < b.Network
+	})
+	return candidates
+}
+
+// orphan reports whether r itself is an orphan and why. The cncs-created
+// label, when set, dates r instead of its creation time.
+func orphan(r Resource, patterns []Pattern, ttl time.Duration, now time.Time) (string, bool) {
+	var reason string
+	created := r.Created
+	if value, ok := r.Labels[naming.CreatedLabel]; ok {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			created = time.Unix(seconds, 0)
+			reason = fmt.Sprintf("labeled %s=%s", naming.CreatedLabel, value)
+		}
+	}
+	if run, ok := r.Labels[naming.RunLabel]; ok && reason == "" {
+		reason = fmt.Sprintf("labeled %s=%s", naming.RunLabel, run)
+	}
+	for _, p := range patterns {
+		if reason == "" && p.Kind == r.Kind && p.Name.MatchString(r.Name) {
+			reason = "name matches " + p.Name.String()
+		}
+	}
+	if reason == "" || created.IsZero() {
+		return "", false
+	}
+	age := now.Sub(created)
+	if age < ttl {
+		return "", false
+	}
+	return fmt.Sprintf("%s, %s old", reason, age.Truncate(time.Minute)), true
+}
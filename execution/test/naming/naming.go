@@ -0,0 +1,235 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package naming names and labels the resources integration tests create,
+// so that every resource can be traced back to the run and test that
+// created it.
+//
+// A Run is identified by a short ID, read from $CNCS_RUN_ID when set so
+// that CI can tie resources to a build, or random otherwise. The Namer of a
+// test builds names such as
+//
+//	cloudsql-createcloudsql-vpc-k3f9q2-wzl9
+//
+// from the stage, the test, the role of the resource in the test, the run
+// ID and a hash of the stage, test and role, shortened to fit the Rule of
+// the resource type. The hash keeps shortened names distinct and the run ID
+// keeps concurrent runs apart. Labels returns the cncs-run, cncs-test and
+// cncs-created labels of a test, which fixtures and YAML configurations
+// attach to what they create.
+package naming
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Label keys set on every resource integration tests create.
+const (
+	RunLabel     = "cncs-run"
+	TestLabel    = "cncs-test"
+	CreatedLabel = "cncs-created"
+)
+
+// RunIDEnv is the environment variable that sets the ID of the run.
+const RunIDEnv = "CNCS_RUN_ID"
+
+// Rule is the naming rule of a resource type.
+type Rule struct {
+	// Resource describes the resource type in errors.
+	Resource string
+	MaxLen   int
+	// Separator joins the words of a name.
+	Separator string
+	// Valid matches the valid names.
+	Valid *regexp.Regexp
+}
+
+var rfc1035 = regexp.MustCompile(`^[a-z]([a-z0-9-]*[a-z0-9])?$`)
+
+// Rules of the resources integration tests create.
+var (
+	// Compute is the rule of networks, subnets, addresses, firewall rules
+	// and VM instances.
+	Compute = Rule{Resource: "Compute Engine resource", MaxLen: 63, Separator: "-", Valid: rfc1035}
+	// CloudSQL counts the instance ID only, not the project ID prefix of the
+	// connection name.
+	CloudSQL = Rule{Resource: "Cloud SQL instance", MaxLen: 98, Separator: "-", Valid: rfc1035}
+	AlloyDB  = Rule{Resource: "AlloyDB cluster or instance", MaxLen: 63, Separator: "-", Valid: rfc1035}
+	MRC      = Rule{Resource: "Memorystore for Redis cluster", MaxLen: 63, Separator: "-", Valid: rfc1035}
+	GKE      = Rule{Resource: "GKE cluster", MaxLen: 40, Separator: "-", Valid: rfc1035}
+	// CloudRun is the rule of services, whose names are shorter than those
+	// of jobs.
+	CloudRun = Rule{Resource: "Cloud Run service or job", MaxLen: 49, Separator: "-", Valid: rfc1035}
+	// VertexDisplayName is the rule of the display names of Vertex AI
+	// endpoints, indexes and index endpoints.
+	VertexDisplayName = Rule{Resource: "Vertex AI display name", MaxLen: 128, Separator: "-", Valid: rfc1035}
+	// VertexDeployedIndexID must start with a letter and hold only letters,
+	// numbers and underscores.
+	VertexDeployedIndexID = Rule{Resource: "Vertex AI deployed index ID", MaxLen: 128, Separator: "_", Valid: regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)}
+)
+
+// Check returns an error when name breaks r.
+func (r Rule) Check(name string) error {
+	if len(name) > r.MaxLen {
+		return fmt.Errorf("%s name %q is %d characters long, more than %d", r.Resource, name, len(name), r.MaxLen)
+	}
+	if !r.Valid.MatchString(name) {
+		return fmt.Errorf("%s name %q does not match %s", r.Resource, name, r.Valid)
+	}
+	return nil
+}
+
+// Run is a run of the integration tests.
+type Run struct {
+	ID string
+}
+
+var (
+	current     Run
+	currentOnce sync.Once
+)
+
+// Current returns the run of this test binary, whose ID is read from
+// $CNCS_RUN_ID or generated once.
+func Current() Run {
+	currentOnce.Do(func() {
+		current = Run{ID: RunID(os.Getenv(RunIDEnv))}
+	})
+	return current
+}
+
+var notAlnum = regexp.MustCompile(`[^a-z0-9]+`)
+
+// RunID returns a run ID made of at most 8 lowercase letters and digits
+// that starts with a letter, derived from id, or a random one when id is
+// empty.
+func RunID(id string) string {
+	id = notAlnum.ReplaceAllString(strings.ToLower(id), "")
+	if id == "" {
+		const letters, alnum = "abcdefghijklmnopqrstuvwxyz", "abcdefghijklmnopqrstuvwxyz0123456789"
+		b := []byte{letters[rand.Intn(len(letters))]}
+		for len(b) < 6 {
+			b = append(b, alnum[rand.Intn(len(alnum))])
+		}
+		return string(b)
+	}
+	if id[0] < 'a' {
+		id = "r" + id
+	}
+	return id[:min(len(id), 8)]
+}
+
+// Namer names the resources of one test of a run.
+type Namer struct {
+	Run Run
+	// Stage is the stage under test, such as "producer/cloudsql".
+	Stage string
+	// Test is the name of the test function.
+	Test string
+}
+
+// New returns the Namer of test, of stage, in the current run.
+func New(stage, test string) Namer {
+	return Namer{Run: Current(), Stage: stage, Test: test}
+}
+
+// Name returns the name of the resource playing role in the test, valid
+// under rule.
+func (n Namer) Name(rule Rule, role string) string {
+	stage := n.Stage[strings.LastIndex(n.Stage, "/")+1:]
+	test := strings.TrimPrefix(n.Test, "Test")
+	var words []string
+	for _, w := range []string{stage, test, role} {
+		w = strings.Trim(notAlnum.ReplaceAllString(strings.ToLower(w), rule.Separator), rule.Separator)
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	suffix := n.Run.ID + rule.Separator + n.hash(role)
+	base := strings.Join(words, rule.Separator)
+	if room := rule.MaxLen - len(rule.Separator) - len(suffix); len(base) > room {
+		base = strings.TrimRight(base[:room], rule.Separator)
+	}
+	if base == "" {
+		return suffix
+	}
+	return base + rule.Separator + suffix
+}
+
+// hash returns 4 base 36 digits of a hash of the stage, test and role.
+func (n Namer) hash(role string) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", n.Stage, n.Test, role)
+	s := strconv.FormatUint(uint64(h.Sum32()%(36*36*36*36)), 36)
+	return strings.Repeat("0", 4-len(s)) + s
+}
+
+// Labels returns the labels of a resource created now by the test t in the
+// current run.
+func Labels(t testing.TB) map[string]string {
+	return Current().Labels(t.Name(), time.Now())
+}
+
+var notLabel = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// Labels returns the labels of a resource created at created by test in r.
+func (r Run) Labels(test string, created time.Time) map[string]string {
+	test = notLabel.ReplaceAllString(strings.ToLower(test), "_")
+	return map[string]string{
+		RunLabel:     r.ID,
+		TestLabel:    test[:min(len(test), 63)],
+		CreatedLabel: strconv.FormatInt(created.Unix(), 10),
+	}
+}
+
+// Format returns labels as sorted key=value pairs separated by commas, the
+// form of the gcloud --labels flag. Resources without labels, such as
+// networks and subnets, carry it as their description.
+func Format(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Parse returns the labels of s, written by Format, or nil when s is not a
+// list of key=value pairs with at least one cncs- key.
+func Parse(s string) map[string]string {
+	labels := map[string]string{}
+	found := false
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil
+		}
+		labels[k] = v
+		found = found || strings.HasPrefix(k, "cncs-")
+	}
+	if !found {
+		return nil
+	}
+	return labels
+}
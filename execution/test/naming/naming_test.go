@@ -0,0 +1,197 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package naming
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var run = Run{ID: "k3f9q2"}
+
+/*
+TestName verifies the layout of names: stage, test and role, then the run ID
+and a hash, joined with the separator of the rule.
+*/
+func TestName(t *testing.T) {
+	n := Namer{Run: run, Stage: "producer/cloudsql", Test: "TestCreateCloudSQL"}
+	tests := []struct {
+		rule Rule
+		role string
+		want string
+	}{
+		{rule: Compute, role: "vpc", want: "cloudsql-createcloudsql-vpc-k3f9q2-wzl9"},
+		{rule: CloudSQL, role: "", want: "cloudsql-createcloudsql-k3f9q2-wqfu"},
+		{rule: VertexDeployedIndexID, role: "deployed-index", want: "cloudsql_createcloudsql_deployed_index_k3f9q2_dwh9"},
+	}
+	for _, tc := range tests {
+		if got := n.Name(tc.rule, tc.role); got != tc.want {
+			t.Errorf("Name(%s, %q) = %q, want %q", tc.rule.Resource, tc.role, got, tc.want)
+		}
+	}
+}
+
+/*
+TestNameRules verifies that names of long stages, tests and roles are
+shortened to valid names of every product: Cloud SQL instance IDs of at most
+98 characters, GKE cluster names of at most 40 and Vertex AI deployed index
+IDs starting with a letter without hyphens, among others.
+*/
+func TestNameRules(t *testing.T) {
+	rules := map[string]Rule{
+		"Compute":               Compute,
+		"CloudSQL":              CloudSQL,
+		"AlloyDB":               AlloyDB,
+		"MRC":                   MRC,
+		"GKE":                   GKE,
+		"CloudRun":              CloudRun,
+		"VertexDisplayName":     VertexDisplayName,
+		"VertexDeployedIndexID": VertexDeployedIndexID,
+	}
+	namers := []Namer{
+		{Run: run, Stage: "producer/cloudsql", Test: "TestCreateCloudSQL"},
+		{Run: run, Stage: "consumer/CloudRun/Service", Test: "TestCreateCloudRunServiceWithAVeryLongNameThatKeepsGoing/Sub-test_with spaces"},
+		{Run: Run{ID: RunID("")}, Stage: "", Test: "Test"},
+		{Run: run, Stage: "producer/VectorSearch", Test: strings.Repeat("TestX", 40)},
+	}
+	for name, rule := range rules {
+		t.Run(name, func(t *testing.T) {
+			for _, n := range namers {
+				got := n.Name(rule, "deployed-index-"+strings.Repeat("x", 100))
+				if err := rule.Check(got); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+
+	if got := (Namer{Run: run, Stage: "producer/gke", Test: "TestCreateGKECluster"}).Name(GKE, "cluster"); len(got) > 40 {
+		t.Errorf("GKE name %q is %d characters long, want at most 40", got, len(got))
+	}
+	id := (Namer{Run: run, Stage: "producer/vectorsearch", Test: "TestCreateVectorSearch"}).Name(VertexDeployedIndexID, "deployed-index")
+	if strings.Contains(id, "-") || id[0] < 'a' || id[0] > 'z' {
+		t.Errorf("deployed index ID %q, want it to start with a letter and hold no hyphen", id)
+	}
+}
+
+/*
+TestCheck verifies the errors of names breaking a rule.
+*/
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		name string
+		want string
+	}{
+		{rule: CloudSQL, name: "a" + strings.Repeat("b", 98), want: "99 characters long, more than 98"},
+		{rule: GKE, name: "gke-" + strings.Repeat("c", 37), want: "41 characters long, more than 40"},
+		{rule: GKE, name: "1-cluster", want: "does not match"},
+		{rule: Compute, name: "vpc-", want: "does not match"},
+		{rule: VertexDeployedIndexID, name: "deployed-index", want: "does not match"},
+		{rule: VertexDeployedIndexID, name: "_deployed", want: "does not match"},
+	}
+	for _, tc := range tests {
+		if err := tc.rule.Check(tc.name); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Check(%q) = %v, want an error with %q", tc.name, err, tc.want)
+		}
+	}
+	for _, name := range []string{"cloudsql-1", "a"} {
+		if err := CloudSQL.Check(name); err != nil {
+			t.Errorf("Check(%q) = %v, want nil", name, err)
+		}
+	}
+	if err := VertexDeployedIndexID.Check("Deployed_index_1"); err != nil {
+		t.Errorf("Check(Deployed_index_1) = %v, want nil", err)
+	}
+}
+
+/*
+TestNamesAreDistinct verifies that names shortened to the same prefix still
+differ by their hash, and that runs differ by their ID.
+*/
+func TestNamesAreDistinct(t *testing.T) {
+	seen := map[string]string{}
+	long := strings.Repeat("LongTestName", 5)
+	for _, test := range []string{long + "A", long + "B", long + "C"} {
+		for _, role := range []string{"vpc", "subnet", "psa"} {
+			n := Namer{Run: run, Stage: "producer/gke", Test: test}
+			got := n.Name(GKE, role)
+			if other, ok := seen[got]; ok {
+				t.Errorf("Name() = %q for %s and %s %s", got, other, test, role)
+			}
+			seen[got] = test + " " + role
+		}
+	}
+	a := Namer{Run: Run{ID: "aaaaaa"}, Stage: "producer/gke", Test: "TestX"}.Name(GKE, "vpc")
+	b := Namer{Run: Run{ID: "bbbbbb"}, Stage: "producer/gke", Test: "TestX"}.Name(GKE, "vpc")
+	if a == b {
+		t.Errorf("Name() = %q in two runs, want distinct names", a)
+	}
+}
+
+/*
+TestRunID verifies that run IDs are short, start with a letter and are
+derived from $CNCS_RUN_ID when it is set.
+*/
+func TestRunID(t *testing.T) {
+	for id, want := range map[string]string{
+		"k3f9q2":            "k3f9q2",
+		"12345678901":       "r1234567",
+		"Build-4821/Retry":  "build482",
+		"nightly_2024_06_0": "nightly2",
+	} {
+		if got := RunID(id); got != want {
+			t.Errorf("RunID(%q) = %q, want %q", id, got, want)
+		}
+	}
+	if got := RunID(""); len(got) != 6 || !rfc1035.MatchString(got) {
+		t.Errorf("RunID(\"\") = %q, want 6 random letters and digits", got)
+	}
+}
+
+/*
+TestLabels verifies the labels of a test and that Parse reads back what
+Format writes, as stored in the description of a network.
+*/
+func TestLabels(t *testing.T) {
+	created := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	labels := run.Labels("TestCreateCloudSQL/PSA Range", created)
+	want := map[string]string{
+		RunLabel:     "k3f9q2",
+		TestLabel:    "testcreatecloudsql_psa_range",
+		CreatedLabel: "1717200000",
+	}
+	if diff := cmp.Diff(want, labels); diff != "" {
+		t.Errorf("Labels() mismatch (-want +got):\n%s", diff)
+	}
+	formatted := Format(labels)
+	if formatted != "cncs-created=1717200000,cncs-run=k3f9q2,cncs-test=testcreatecloudsql_psa_range" {
+		t.Errorf("Format() = %q", formatted)
+	}
+	if diff := cmp.Diff(want, Parse(formatted)); diff != "" {
+		t.Errorf("Parse() mismatch (-want +got):\n%s", diff)
+	}
+	for _, description := range []string{"", "VPC for the team", "owner=team,env=dev"} {
+		if got := Parse(description); got != nil {
+			t.Errorf("Parse(%q) = %v, want nil", description, got)
+		}
+	}
+	if got := run.Labels(strings.Repeat("TestLong", 10), created)[TestLabel]; len(got) != 63 {
+		t.Errorf("test label %q is %d characters long, want 63", got, len(got))
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package planassert asserts on the planned attribute values of the resources
+// in a terratest PlanStruct, so that unit tests can pin down what a stage
+// creates rather than only how many resources it creates.
+//
+// Resources are selected by address glob or by type, and attribute values
+// are read with gjson paths such as "settings.0.ip_configuration.0.ipv4_enabled"
+// or "allow.#.protocol":
+//
+//	plan := planassert.New(t, terraform.InitAndPlanAndShowWithStruct(t, terraformOptions))
+//	plan.Address(`module.cloudsql["dummy1"].*google_sql_database_instance.*`).
+//		Count(1).
+//		Attribute("settings.0.ip_configuration.0.ipv4_enabled", false)
+//
+// Values that are only known after apply are absent from the plan and fail
+// an Attribute assertion as missing.
+package planassert
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/tidwall/gjson"
+)
+
+// Plan wraps a PlanStruct for assertions.
+type Plan struct {
+	t         testing.TB
+	resources []*tfjson.StateResource
+}
+
+// New returns a Plan over the planned values of plan, which is typically the
+// result of terraform.InitAndPlanAndShowWithStruct.
+func New(t testing.TB, plan *terraform.PlanStruct) *Plan {
+	t.Helper()
+	if plan == nil {
+		t.Fatal("planassert: nil plan")
+	}
+	resources := make([]*tfjson.StateResource, 0, len(plan.ResourcePlannedValuesMap))
+	for _, resource := range plan.ResourcePlannedValuesMap {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Address < resources[j].Address })
+	return &Plan{t: t, resources: resources}
+}
+
+// Address selects the resources whose address matches glob, where "*"
+// matches any run of characters and everything else, including the brackets
+// and quotes of for_each keys, matches literally.
+func (p *Plan) Address(glob string) *Selection {
+	re := GlobRegexp(glob)
+	return p.filter(fmt.Sprintf("resources matching %q", glob), func(r *tfjson.StateResource) bool {
+		return re.MatchString(r.Address)
+	})
+}
+
+// Type selects the resources of resourceType, for example
+// "google_compute_firewall".
+func (p *Plan) Type(resourceType string) *Selection {
+	return p.filter(fmt.Sprintf("%s resources", resourceType), func(r *tfjson.StateResource) bool {
+		return r.Type == resourceType
+	})
+}
+
+func (p *Plan) filter(desc string, keep func(*tfjson.StateResource) bool) *Selection {
+	s := &Selection{t: p.t, desc: desc}
+	for _, r := range p.resources {
+		if keep(r) {
+			s.resources = append(s.resources, r)
+		}
+	}
+	return s
+}
+
+// GlobRegexp compiles an address glob, where "*" matches any run of
+// characters and everything else matches literally, into an anchored
+// regular expression.
+func GlobRegexp(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// Selection is a set of planned resources, sorted by address. Assertions
+// report failures with t.Errorf and return the Selection so that they can be
+// chained.
+type Selection struct {
+	t         testing.TB
+	desc      string
+	resources []*tfjson.StateResource
+}
+
+// Addresses returns the addresses of the selected resources.
+func (s *Selection) Addresses() []string {
+	addresses := make([]string, len(s.resources))
+	for i, r := range s.resources {
+		addresses[i] = r.Address
+	}
+	return addresses
+}
+
+// Where narrows the selection to the resources whose attribute at path
+// equals want.
+func (s *Selection) Where(path string, want any) *Selection {
+	narrowed := &Selection{t: s.t, desc: fmt.Sprintf("%s where %s = %v", s.desc, path, want)}
+	wantValue, err := normalize(want)
+	if err != nil {
+		s.t.Helper()
+		s.t.Fatalf("planassert: %v", err)
+	}
+	for _, r := range s.resources {
+		got, ok, err := attribute(r, path)
+		if err == nil && ok && cmp.Equal(wantValue, got) {
+			narrowed.resources = append(narrowed.resources, r)
+		}
+	}
+	return narrowed
+}
+
+// Count asserts that want resources are selected.
+func (s *Selection) Count(want int) *Selection {
+	s.t.Helper()
+	if err := s.CountE(want); err != nil {
+		s.t.Error(err)
+	}
+	return s
+}
+
+// CountE is like Count but returns the failure instead of reporting it.
+func (s *Selection) CountE(want int) error {
+	if got := len(s.resources); got != want {
+		return fmt.Errorf("%s: got %d resources %q, want %d", s.desc, got, s.Addresses(), want)
+	}
+	return nil
+}
+
+// Attribute asserts that the attribute at path of every selected resource
+// equals want. want is compared after a round trip through JSON, so Go
+// values such as []string{"22", "443"} or map[string]any literals can be
+// used for lists and blocks. Selecting no resources is a failure.
+func (s *Selection) Attribute(path string, want any) *Selection {
+	s.t.Helper()
+	if err := s.AttributeE(path, want); err != nil {
+		s.t.Error(err)
+	}
+	return s
+}
+
+// AttributeE is like Attribute but returns the failure instead of reporting
+// it.
+func (s *Selection) AttributeE(path string, want any) error {
+	if len(s.resources) == 0 {
+		return fmt.Errorf("%s: no resources selected", s.desc)
+	}
+	wantValue, err := normalize(want)
+	if err != nil {
+		return err
+	}
+	var failures []string
+	for _, r := range s.resources {
+		got, ok, err := attribute(r, path)
+		switch {
+		case err != nil:
+			failures = append(failures, fmt.Sprintf("%s: %v", r.Address, err))
+		case !ok:
+			failures = append(failures, fmt.Sprintf("%s: %s is not set or known only after apply", r.Address, path))
+		default:
+			if diff := cmp.Diff(wantValue, got); diff != "" {
+				failures = append(failures, fmt.Sprintf("%s: %s mismatch (-want +got):\n%s", r.Address, path, diff))
+			}
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s:\n%s", s.desc, strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// attribute returns the planned value at path of r, and whether it is set.
+func attribute(r *tfjson.StateResource, path string) (any, bool, error) {
+	values, err := json.Marshal(r.AttributeValues)
+	if err != nil {
+		return nil, false, fmt.Errorf("encoding planned values: %w", err)
+	}
+	result := gjson.GetBytes(values, path)
+	if !result.Exists() {
+		return nil, false, nil
+	}
+	return result.Value(), true, nil
+}
+
+// normalize converts v to the types encoding/json decodes into, matching
+// the values read from the plan.
+func normalize(v any) (any, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encoding want %v: %w", v, err)
+	}
+	var decoded any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("decoding want %v: %w", v, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package planassert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func newPlan(t *testing.T) *Plan {
+	resources := []*tfjson.StateResource{
+		{
+			Address: `module.cloudsql["dummy1"].google_sql_database_instance.primary`,
+			Type:    "google_sql_database_instance",
+			AttributeValues: map[string]any{
+				"name": "dummy1",
+				"settings": []any{map[string]any{
+					"ip_configuration": []any{map[string]any{"ipv4_enabled": false}},
+				}},
+			},
+		},
+		{
+			Address: `module.cloudsql["dummy2"].google_sql_database_instance.primary`,
+			Type:    "google_sql_database_instance",
+			AttributeValues: map[string]any{
+				"name": "dummy2",
+				"settings": []any{map[string]any{
+					"ip_configuration": []any{map[string]any{"ipv4_enabled": true}},
+				}},
+			},
+		},
+		{
+			Address: `module.ssh_firewall.google_compute_firewall.custom-rules["allow-ingress"]`,
+			Type:    "google_compute_firewall",
+			AttributeValues: map[string]any{
+				"priority": 1000,
+				"allow": []any{
+					map[string]any{"protocol": "tcp", "ports": []any{"22", "443"}},
+				},
+			},
+		},
+	}
+	plan := &terraform.PlanStruct{ResourcePlannedValuesMap: map[string]*tfjson.StateResource{}}
+	for _, r := range resources {
+		plan.ResourcePlannedValuesMap[r.Address] = r
+	}
+	return New(t, plan)
+}
+
+/*
+TestSelectors verifies that resources are selected by address glob, type and
+attribute value, in address order.
+*/
+func TestSelectors(t *testing.T) {
+	plan := newPlan(t)
+	tests := []struct {
+		name      string
+		selection *Selection
+		want      []string
+	}{
+		{
+			name:      "address glob",
+			selection: plan.Address(`module.cloudsql["*"].google_sql_database_instance.*`),
+			want: []string{
+				`module.cloudsql["dummy1"].google_sql_database_instance.primary`,
+				`module.cloudsql["dummy2"].google_sql_database_instance.primary`,
+			},
+		},
+		{
+			name:      "exact address",
+			selection: plan.Address(`module.ssh_firewall.google_compute_firewall.custom-rules["allow-ingress"]`),
+			want:      []string{`module.ssh_firewall.google_compute_firewall.custom-rules["allow-ingress"]`},
+		},
+		{
+			name:      "brackets match literally",
+			selection: plan.Address(`module.cloudsql[d*`),
+			want:      []string{},
+		},
+		{
+			name:      "type",
+			selection: plan.Type("google_compute_firewall"),
+			want:      []string{`module.ssh_firewall.google_compute_firewall.custom-rules["allow-ingress"]`},
+		},
+		{
+			name:      "where",
+			selection: plan.Type("google_sql_database_instance").Where("name", "dummy2"),
+			want:      []string{`module.cloudsql["dummy2"].google_sql_database_instance.primary`},
+		},
+	}
+	for _, tc := range tests {
+		if diff := cmp.Diff(tc.want, tc.selection.Addresses()); diff != "" {
+			t.Errorf("%s: addresses mismatch (-want +got):\n%s", tc.name, diff)
+		}
+	}
+}
+
+/*
+TestAttribute verifies attribute assertions against planned values,
+including lists, blocks and numbers given as Go values.
+*/
+func TestAttribute(t *testing.T) {
+	plan := newPlan(t)
+	firewall := plan.Type("google_compute_firewall")
+	tests := []struct {
+		name      string
+		selection *Selection
+		path      string
+		want      any
+		wantErr   []string
+	}{
+		{
+			name:      "bool",
+			selection: plan.Address(`*["dummy1"]*`),
+			path:      "settings.0.ip_configuration.0.ipv4_enabled",
+			want:      false,
+		},
+		{
+			name:      "number",
+			selection: firewall,
+			path:      "priority",
+			want:      1000,
+		},
+		{
+			name:      "blocks",
+			selection: firewall,
+			path:      "allow",
+			want:      []map[string]any{{"protocol": "tcp", "ports": []string{"22", "443"}}},
+		},
+		{
+			name:      "query",
+			selection: firewall,
+			path:      "allow.#.ports",
+			want:      [][]string{{"22", "443"}},
+		},
+		{
+			name:      "mismatch in one of several resources",
+			selection: plan.Type("google_sql_database_instance"),
+			path:      "settings.0.ip_configuration.0.ipv4_enabled",
+			want:      false,
+			wantErr: []string{
+				`module.cloudsql["dummy2"].google_sql_database_instance.primary: settings.0.ip_configuration.0.ipv4_enabled mismatch (-want +got)`,
+				"- false,",
+				"+ true,",
+			},
+		},
+		{
+			name:      "missing",
+			selection: firewall,
+			path:      "self_link",
+			want:      "",
+			wantErr:   []string{"self_link is not set or known only after apply"},
+		},
+		{
+			name:      "empty selection",
+			selection: plan.Type("google_compute_instance"),
+			path:      "name",
+			want:      "",
+			wantErr:   []string{"google_compute_instance resources: no resources selected"},
+		},
+	}
+	for _, tc := range tests {
+		err := tc.selection.AttributeE(tc.path, tc.want)
+		if len(tc.wantErr) == 0 {
+			if err != nil {
+				t.Errorf("%s: AttributeE() = %v, want nil", tc.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: AttributeE() = nil, want error", tc.name)
+			continue
+		}
+		// cmp.Diff output is not stable, so compare whitespace-normalized lines.
+		got := strings.ReplaceAll(err.Error(), " ", " ")
+		for _, want := range tc.wantErr {
+			if !strings.Contains(strings.Join(strings.Fields(got), " "), strings.Join(strings.Fields(want), " ")) {
+				t.Errorf("%s: AttributeE() = %q, want it to contain %q", tc.name, got, want)
+			}
+		}
+	}
+}
+
+/*
+TestCount verifies the count assertion and its failure message.
+*/
+func TestCount(t *testing.T) {
+	plan := newPlan(t)
+	if err := plan.Type("google_sql_database_instance").CountE(2); err != nil {
+		t.Errorf("CountE(2) = %v, want nil", err)
+	}
+	err := plan.Type("google_compute_firewall").CountE(2)
+	want := `google_compute_firewall resources: got 1 resources ["module.ssh_firewall.google_compute_firewall.custom-rules[\"allow-ingress\"]"], want 2`
+	if err == nil || err.Error() != want {
+		t.Errorf("CountE(2) = %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plancache runs terraform init and plan once per distinct
+// configuration and shares the result between the tests of a package.
+//
+// A unit test package creates the cache in TestMain and removes its plan
+// files once the tests have run:
+//
+//	var plans *plancache.Cache
+//
+//	func TestMain(m *testing.M) {
+//		plans = plancache.New()
+//		code := m.Run()
+//		plans.Close()
+//		os.Exit(code)
+//	}
+//
+// Tests then call plans.Plan or plans.ExitCode with their terraform.Options
+// instead of terraform.InitAndPlan*. Options with the same TerraformDir,
+// Vars and VarFiles share one plan, whichever test asks for it first. Each
+// plan is written to its own file in a temporary directory, ignoring
+// Options.PlanFilePath, and init and plan are serialized per TerraformDir,
+// so tests may run in parallel.
+package plancache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Cache holds the plans of a test package.
+type Cache struct {
+	// planFunc runs init, plan and show for one configuration. Tests
+	// replace it to avoid running terraform.
+	planFunc func(t testing.TB, options *terraform.Options, e *entry)
+
+	mu      sync.Mutex
+	dir     string
+	files   int
+	entries map[string]*entry
+	dirs    map[string]*sync.Mutex
+}
+
+// entry is the outcome of planning one configuration.
+type entry struct {
+	once sync.Once
+
+	// initErr is set when terraform init failed, in which case the plan
+	// never ran.
+	initErr error
+	// exitCode is the detailed exit code of terraform plan: 0 without
+	// changes, 1 on error and 2 with changes.
+	exitCode int
+	plan     *terraform.PlanStruct
+	err      error
+}
+
+// New returns an empty Cache.
+func New() *Cache {
+	c := &Cache{entries: map[string]*entry{}, dirs: map[string]*sync.Mutex{}}
+	c.planFunc = c.terraformPlan
+	return c
+}
+
+// Plan returns the parsed plan for options, failing the test if init or
+// plan failed.
+func (c *Cache) Plan(t testing.TB, options *terraform.Options) *terraform.PlanStruct {
+	t.Helper()
+	plan, err := c.PlanE(t, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan
+}
+
+// PlanE is like Plan but returns the error instead of failing the test.
+func (c *Cache) PlanE(t testing.TB, options *terraform.Options) (*terraform.PlanStruct, error) {
+	e := c.get(t, options)
+	if e.initErr != nil {
+		return nil, e.initErr
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.plan, nil
+}
+
+// ExitCode returns the detailed exit code of terraform plan for options, as
+// terraform.InitAndPlanWithExitCode does, failing the test if init failed.
+func (c *Cache) ExitCode(t testing.TB, options *terraform.Options) int {
+	t.Helper()
+	e := c.get(t, options)
+	if e.initErr != nil {
+		t.Fatal(e.initErr)
+	}
+	return e.exitCode
+}
+
+// Close removes the plan files.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(c.dir)
+}
+
+// get returns the entry for options, planning it on first use.
+func (c *Cache) get(t testing.TB, options *terraform.Options) *entry {
+	key, err := cacheKey(options)
+	if err != nil {
+		return &entry{initErr: err}
+	}
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &entry{}
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+	e.once.Do(func() { c.planFunc(t, options, e) })
+	return e
+}
+
+// cacheKey identifies the configuration planned by options.
+func cacheKey(options *terraform.Options) (string, error) {
+	dir, err := filepath.Abs(options.TerraformDir)
+	if err != nil {
+		return "", err
+	}
+	key, err := json.Marshal(struct {
+		Dir      string
+		Vars     map[string]any
+		VarFiles []string
+	}{dir, options.Vars, options.VarFiles})
+	if err != nil {
+		return "", fmt.Errorf("encoding terraform vars: %w", err)
+	}
+	return string(key), nil
+}
+
+// terraformPlan runs init, plan and show for options.
+func (c *Cache) terraformPlan(t testing.TB, options *terraform.Options, e *entry) {
+	unlock := c.lockDir(options.TerraformDir)
+	defer unlock()
+
+	planFile, err := c.planFile()
+	if err != nil {
+		e.initErr = err
+		return
+	}
+	opts := *options
+	opts.PlanFilePath = planFile
+	if _, err := terraform.InitE(t, &opts); err != nil {
+		e.initErr = fmt.Errorf("terraform init in %s: %w", opts.TerraformDir, err)
+		return
+	}
+	e.exitCode, err = terraform.PlanExitCodeE(t, &opts)
+	if err != nil {
+		e.exitCode = 1
+		e.err = fmt.Errorf("terraform plan in %s: %w", opts.TerraformDir, err)
+		return
+	}
+	if e.exitCode == 1 {
+		e.err = fmt.Errorf("terraform plan in %s exited with code 1", opts.TerraformDir)
+		return
+	}
+	e.plan, err = terraform.ShowWithStructE(t, &opts)
+	if err != nil {
+		e.err = fmt.Errorf("terraform show in %s: %w", opts.TerraformDir, err)
+	}
+}
+
+// lockDir serializes terraform runs in dir, which share its .terraform
+// directory and lock file.
+func (c *Cache) lockDir(dir string) func() {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	c.mu.Lock()
+	mu, ok := c.dirs[dir]
+	if !ok {
+		mu = &sync.Mutex{}
+		c.dirs[dir] = mu
+	}
+	c.mu.Unlock()
+	mu.Lock()
+	return mu.Unlock
+}
+
+// planFile returns a new plan file path in the cache directory.
+func (c *Cache) planFile() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dir == "" {
+		dir, err := os.MkdirTemp("", "plancache")
+		if err != nil {
+			return "", err
+		}
+		c.dir = dir
+	}
+	c.files++
+	return filepath.Join(c.dir, fmt.Sprintf("plan-%d", c.files)), nil
+}
+
+// ResourceCount counts the resources plan adds, changes and destroys the
+// way the summary line of terraform plan does, so that it can replace
+// terraform.GetResourceCount on the plan output. A replaced resource counts
+// as both added and destroyed.
+func ResourceCount(plan *terraform.PlanStruct) *terraform.ResourceCount {
+	count := &terraform.ResourceCount{}
+	for _, rc := range plan.RawPlan.ResourceChanges {
+		if rc.Mode == tfjson.DataResourceMode || rc.Change == nil {
+			continue
+		}
+		actions := rc.Change.Actions
+		switch {
+		case actions.Replace():
+			count.Add++
+			count.Destroy++
+		case actions.Create():
+			count.Add++
+		case actions.Update():
+			count.Change++
+		case actions.Delete():
+			count.Destroy++
+		}
+	}
+	return count
+}
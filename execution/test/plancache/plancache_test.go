@@ -0,0 +1,128 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plancache
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// newFakeCache returns a Cache whose plans fail with exit code 1 when the
+// "invalid" variable is set and that counts how often it planned.
+func newFakeCache() (*Cache, *atomic.Int32) {
+	var runs atomic.Int32
+	c := New()
+	c.planFunc = func(t testing.TB, options *terraform.Options, e *entry) {
+		runs.Add(1)
+		if _, ok := options.Vars["invalid"]; ok {
+			e.exitCode = 1
+			e.err = errors.New("invalid value for variable")
+			return
+		}
+		e.exitCode = 2
+		e.plan = &terraform.PlanStruct{}
+	}
+	return c, &runs
+}
+
+/*
+TestPlansOncePerConfiguration verifies that options with the same directory
+and variables share one plan, including when requested concurrently, and
+that other variables or directories get their own.
+*/
+func TestPlansOncePerConfiguration(t *testing.T) {
+	c, runs := newFakeCache()
+	options := func(dir, folder string) *terraform.Options {
+		return &terraform.Options{
+			TerraformDir: dir,
+			Vars:         map[string]any{"config_folder_path": folder},
+			PlanFilePath: "./plan",
+		}
+	}
+	var wg sync.WaitGroup
+	plans := make([]*terraform.PlanStruct, 8)
+	for i := range plans {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plans[i], _ = c.PlanE(t, options("../04-producer/CloudSQL", "config"))
+		}()
+	}
+	wg.Wait()
+	for _, plan := range plans[1:] {
+		if plan != plans[0] {
+			t.Fatal("concurrent Plan() calls returned different plans")
+		}
+	}
+	if got := c.ExitCode(t, options("../04-producer/CloudSQL", "config")); got != 2 {
+		t.Errorf("ExitCode() = %d, want 2", got)
+	}
+	if got := runs.Load(); got != 1 {
+		t.Errorf("planned %d times for one configuration, want 1", got)
+	}
+
+	c.Plan(t, options("../04-producer/CloudSQL", "other-config"))
+	c.Plan(t, options("../04-producer/AlloyDB", "config"))
+	if got := runs.Load(); got != 3 {
+		t.Errorf("planned %d times for three configurations, want 3", got)
+	}
+}
+
+/*
+TestFailedPlan verifies that a failed plan is reported by PlanE and its exit
+code by ExitCode, without planning again.
+*/
+func TestFailedPlan(t *testing.T) {
+	c, runs := newFakeCache()
+	options := &terraform.Options{TerraformDir: "../04-producer/CloudSQL", Vars: map[string]any{"invalid": true}}
+	if got := c.ExitCode(t, options); got != 1 {
+		t.Errorf("ExitCode() = %d, want 1", got)
+	}
+	if _, err := c.PlanE(t, options); err == nil {
+		t.Error("PlanE() error = nil, want the plan error")
+	}
+	if got := runs.Load(); got != 1 {
+		t.Errorf("planned %d times, want 1", got)
+	}
+}
+
+/*
+TestResourceCount verifies that resources are counted like the summary of
+terraform plan, ignoring data sources and no-ops.
+*/
+func TestResourceCount(t *testing.T) {
+	change := func(mode tfjson.ResourceMode, actions ...tfjson.Action) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{Mode: mode, Change: &tfjson.Change{Actions: actions}}
+	}
+	plan := &terraform.PlanStruct{RawPlan: tfjson.Plan{ResourceChanges: []*tfjson.ResourceChange{
+		change(tfjson.ManagedResourceMode, tfjson.ActionCreate),
+		change(tfjson.ManagedResourceMode, tfjson.ActionCreate),
+		change(tfjson.ManagedResourceMode, tfjson.ActionUpdate),
+		change(tfjson.ManagedResourceMode, tfjson.ActionDelete, tfjson.ActionCreate),
+		change(tfjson.ManagedResourceMode, tfjson.ActionDelete),
+		change(tfjson.ManagedResourceMode, tfjson.ActionNoop),
+		change(tfjson.DataResourceMode, tfjson.ActionRead),
+	}}}
+	want := &terraform.ResourceCount{Add: 3, Change: 1, Destroy: 2}
+	if diff := cmp.Diff(want, ResourceCount(plan)); diff != "" {
+		t.Errorf("ResourceCount() mismatch (-want +got):\n%s", diff)
+	}
+}
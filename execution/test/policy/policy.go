@@ -0,0 +1,434 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy evaluates policy rules against the planned values of a
+// terratest PlanStruct, so that a unit test fails when a stage would create a
+// resource that breaks a security or compliance rule.
+//
+// Rules are declared in YAML. Each rule applies to one resource type, is
+// narrowed by optional when conditions and fails when one of its require
+// conditions does not hold. Conditions read attribute values with gjson
+// paths, as planassert does:
+//
+//	rules:
+//	  - id: cloudsql-no-public-ipv4
+//	    description: Cloud SQL instances have no public IPv4 address.
+//	    severity: error
+//	    resource_type: google_sql_database_instance
+//	    require:
+//	      - path: settings.0.ip_configuration.0.ipv4_enabled
+//	        equals: false
+//	    exceptions:
+//	      - address: module.cloudsql["demo"].*
+//	        reason: public demo instance, deleted after the workshop
+//
+// A condition uses exactly one of equals, one_of, in_parameter (one of the
+// values of a pack parameter), exists or empty. The built-in pack, rules.yaml,
+// is checked with one line in a unit test:
+//
+//	policy.Check(t, plans.Plan(t, terraformOptions))
+//
+// Violations of error rules fail the test, violations of warning rules and
+// exempted violations are logged.
+package policy
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/planassert"
+	"github.com/google/go-cmp/cmp"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/tidwall/gjson"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity is the severity of a rule.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// Pack is a set of rules and the parameters their conditions refer to.
+type Pack struct {
+	Parameters map[string][]any `yaml:"parameters"`
+	Rules      []Rule           `yaml:"rules"`
+}
+
+// Rule is a policy rule over the resources of one type.
+type Rule struct {
+	ID           string      `yaml:"id"`
+	Description  string      `yaml:"description"`
+	Severity     Severity    `yaml:"severity"`
+	ResourceType string      `yaml:"resource_type"`
+	When         []Condition `yaml:"when"`
+	Require      []Condition `yaml:"require"`
+	Exceptions   []Exception `yaml:"exceptions"`
+}
+
+// Condition tests the attribute at Path of a resource with exactly one of
+// its operators.
+type Condition struct {
+	Path        string `yaml:"path"`
+	Equals      any    `yaml:"equals"`
+	OneOf       []any  `yaml:"one_of"`
+	InParameter string `yaml:"in_parameter"`
+	Exists      *bool  `yaml:"exists"`
+	Empty       *bool  `yaml:"empty"`
+}
+
+// Exception exempts the resources whose address matches the Address glob
+// from a rule. Reason is required so that every exception is explained.
+type Exception struct {
+	Address string `yaml:"address"`
+	Reason  string `yaml:"reason"`
+}
+
+// Violation is a resource that breaks a rule.
+type Violation struct {
+	Rule     string
+	Severity Severity
+	Address  string
+	Message  string
+	// Exception is the reason of the exception that exempts the resource,
+	// empty when it is not exempted.
+	Exception string
+}
+
+// String formats v as "address: severity: message [rule]".
+func (v Violation) String() string {
+	s := fmt.Sprintf("%s: %s: %s [%s]", v.Address, v.Severity, v.Message, v.Rule)
+	if v.Exception != "" {
+		s += " (exempted: " + v.Exception + ")"
+	}
+	return s
+}
+
+//go:embed rules.yaml
+var builtinRules []byte
+
+var builtin = mustLoad(builtinRules)
+
+func mustLoad(data []byte) *Pack {
+	p, err := Load(data)
+	if err != nil {
+		panic(fmt.Sprintf("policy: built-in rules: %v", err))
+	}
+	return p
+}
+
+// Builtin returns a copy of the built-in rule pack.
+func Builtin() *Pack {
+	return builtin.clone()
+}
+
+// Load parses and validates a rule pack.
+func Load(data []byte) (*Pack, error) {
+	var p Pack
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("unmarshalling rules: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// LoadFile is like Load but reads the rule pack from path.
+func LoadFile(path string) (*Pack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p *Pack) validate() error {
+	var errs []error
+	seen := map[string]bool{}
+	for i, r := range p.Rules {
+		if r.ID == "" {
+			errs = append(errs, fmt.Errorf("rule %d: missing id", i))
+			continue
+		}
+		if seen[r.ID] {
+			errs = append(errs, fmt.Errorf("rule %s: duplicate id", r.ID))
+		}
+		seen[r.ID] = true
+		if r.Severity != Error && r.Severity != Warning {
+			errs = append(errs, fmt.Errorf("rule %s: severity %q is not %s or %s", r.ID, r.Severity, Error, Warning))
+		}
+		if r.ResourceType == "" {
+			errs = append(errs, fmt.Errorf("rule %s: missing resource_type", r.ID))
+		}
+		if len(r.Require) == 0 {
+			errs = append(errs, fmt.Errorf("rule %s: no require conditions", r.ID))
+		}
+		for _, c := range append(append([]Condition(nil), r.When...), r.Require...) {
+			if err := p.validateCondition(c); err != nil {
+				errs = append(errs, fmt.Errorf("rule %s: %w", r.ID, err))
+			}
+		}
+		for _, e := range r.Exceptions {
+			if e.Address == "" || e.Reason == "" {
+				errs = append(errs, fmt.Errorf("rule %s: exceptions need an address and a reason", r.ID))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *Pack) validateCondition(c Condition) error {
+	if c.Path == "" {
+		return errors.New("condition without path")
+	}
+	operators := 0
+	for _, set := range []bool{c.Equals != nil, c.OneOf != nil, c.InParameter != "", c.Exists != nil, c.Empty != nil} {
+		if set {
+			operators++
+		}
+	}
+	if operators != 1 {
+		return fmt.Errorf("condition on %s needs exactly one of equals, one_of, in_parameter, exists or empty", c.Path)
+	}
+	if c.InParameter != "" {
+		if _, ok := p.Parameters[c.InParameter]; !ok {
+			return fmt.Errorf("condition on %s refers to undeclared parameter %q", c.Path, c.InParameter)
+		}
+	}
+	return nil
+}
+
+func (p *Pack) clone() *Pack {
+	c := &Pack{Parameters: map[string][]any{}, Rules: p.Rules}
+	for name, values := range p.Parameters {
+		c.Parameters[name] = values
+	}
+	return c
+}
+
+// With returns a copy of p with parameter name set to values, for example
+// p.With("regulated_projects", "my-project").
+func (p *Pack) With(name string, values ...any) *Pack {
+	c := p.clone()
+	c.Parameters[name] = values
+	return c
+}
+
+// Evaluate returns the violations of the rules of p by the planned resources
+// of plan, sorted by address and then in the order of the rules of p.
+func (p *Pack) Evaluate(plan *terraform.PlanStruct) ([]Violation, error) {
+	addresses := make([]string, 0, len(plan.ResourcePlannedValuesMap))
+	for address := range plan.ResourcePlannedValuesMap {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	var violations []Violation
+	for _, address := range addresses {
+		resource := plan.ResourcePlannedValuesMap[address]
+		values, err := json.Marshal(resource.AttributeValues)
+		if err != nil {
+			return nil, fmt.Errorf("%s: encoding planned values: %w", address, err)
+		}
+		for _, r := range p.Rules {
+			if r.ResourceType != resource.Type {
+				continue
+			}
+			if v, ok := p.evaluateRule(r, address, values); ok {
+				violations = append(violations, v)
+			}
+		}
+	}
+	return violations, nil
+}
+
+// evaluateRule returns the violation of r by the resource at address, if
+// any.
+func (p *Pack) evaluateRule(r Rule, address string, values []byte) (Violation, bool) {
+	for _, c := range r.When {
+		if ok, _ := p.holds(c, values); !ok {
+			return Violation{}, false
+		}
+	}
+	var failures []string
+	for _, c := range r.Require {
+		if ok, failure := p.holds(c, values); !ok {
+			failures = append(failures, failure)
+		}
+	}
+	if len(failures) == 0 {
+		return Violation{}, false
+	}
+	v := Violation{
+		Rule:     r.ID,
+		Severity: r.Severity,
+		Address:  address,
+		Message:  strings.TrimSuffix(r.Description, ".") + ": " + strings.Join(failures, ", "),
+	}
+	for _, e := range r.Exceptions {
+		if planassert.GlobRegexp(e.Address).MatchString(address) {
+			v.Exception = e.Reason
+			break
+		}
+	}
+	return v, true
+}
+
+// holds reports whether c holds for the planned values of a resource and,
+// when it does not, describes why.
+func (p *Pack) holds(c Condition, values []byte) (bool, string) {
+	result := gjson.GetBytes(values, c.Path)
+	set := result.Exists() && result.Type != gjson.Null
+	switch {
+	case c.Exists != nil:
+		if set == *c.Exists {
+			return true, ""
+		}
+		if *c.Exists {
+			return false, fmt.Sprintf("%s is not set", c.Path)
+		}
+		return false, fmt.Sprintf("%s is %s, want it unset", c.Path, result.Raw)
+	case c.Empty != nil:
+		if isEmpty(result) == *c.Empty {
+			return true, ""
+		}
+		if *c.Empty {
+			return false, fmt.Sprintf("%s is %s, want it empty", c.Path, result.Raw)
+		}
+		return false, fmt.Sprintf("%s is empty, want it set", c.Path)
+	}
+	if !set {
+		return false, fmt.Sprintf("%s is not set or known only after apply", c.Path)
+	}
+	got := result.Value()
+	switch {
+	case c.Equals != nil:
+		if equal(c.Equals, got) {
+			return true, ""
+		}
+		return false, fmt.Sprintf("%s is %s, want %s", c.Path, result.Raw, encode(c.Equals))
+	case c.OneOf != nil:
+		return oneOf(c.Path, result, c.OneOf)
+	default:
+		return oneOf(c.Path, result, p.Parameters[c.InParameter])
+	}
+}
+
+func oneOf(path string, result gjson.Result, values []any) (bool, string) {
+	got := result.Value()
+	for _, want := range values {
+		if equal(want, got) {
+			return true, ""
+		}
+	}
+	return false, fmt.Sprintf("%s is %s, want one of %s", path, result.Raw, encode(values))
+}
+
+// isEmpty reports whether result is unset, null, an empty string, list or
+// object, or a list of such values, as returned by "#" paths.
+func isEmpty(result gjson.Result) bool {
+	switch {
+	case !result.Exists() || result.Type == gjson.Null:
+		return true
+	case result.Type == gjson.String:
+		return result.Str == ""
+	case result.IsArray():
+		for _, element := range result.Array() {
+			if !isEmpty(element) {
+				return false
+			}
+		}
+		return true
+	case result.IsObject():
+		return len(result.Map()) == 0
+	}
+	return false
+}
+
+// equal compares a value read from YAML with a value read from the plan
+// after a round trip through JSON, so that 5432 equals 5432.0.
+func equal(want, got any) bool {
+	var decoded any
+	if err := json.Unmarshal([]byte(encode(want)), &decoded); err != nil {
+		return false
+	}
+	return cmp.Equal(decoded, got)
+}
+
+func encode(v any) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(encoded)
+}
+
+// Check evaluates p against plan. Violations of error rules fail the test,
+// while violations of warning rules and exempted violations are logged.
+func (p *Pack) Check(t testing.TB, plan *terraform.PlanStruct) {
+	t.Helper()
+	violations, err := p.Evaluate(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range violations {
+		if v.Severity == Error && v.Exception == "" {
+			t.Error(v)
+		} else {
+			t.Log(v)
+		}
+	}
+}
+
+// CheckE is like Check but returns the violations of error rules that are
+// not exempted as an error instead of reporting them.
+func (p *Pack) CheckE(plan *terraform.PlanStruct) error {
+	violations, err := p.Evaluate(plan)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, v := range violations {
+		if v.Severity == Error && v.Exception == "" {
+			errs = append(errs, errors.New(v.String()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Check evaluates the built-in rule pack against plan, see Pack.Check.
+func Check(t testing.TB, plan *terraform.PlanStruct) {
+	t.Helper()
+	builtin.Check(t, plan)
+}
+
+// CheckE is like Check but returns the failures instead of reporting them.
+func CheckE(plan *terraform.PlanStruct) error {
+	return builtin.CheckE(plan)
+}
@@ -0,0 +1,252 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// newPlan returns a PlanStruct planning one resource of resourceType with
+// values at each address.
+func newPlan(resourceType string, values map[string]map[string]any) *terraform.PlanStruct {
+	plan := &terraform.PlanStruct{ResourcePlannedValuesMap: map[string]*tfjson.StateResource{}}
+	for address, v := range values {
+		plan.ResourcePlannedValuesMap[address] = &tfjson.StateResource{Address: address, Type: resourceType, AttributeValues: v}
+	}
+	return plan
+}
+
+func sqlInstance(ipv4 bool, labels map[string]any, deletionProtection bool) map[string]any {
+	return map[string]any{
+		"settings": []any{map[string]any{
+			"ip_configuration":            []any{map[string]any{"ipv4_enabled": ipv4}},
+			"user_labels":                 labels,
+			"deletion_protection_enabled": deletionProtection,
+		}},
+	}
+}
+
+func violations(t *testing.T, p *Pack, plan *terraform.PlanStruct) []string {
+	t.Helper()
+	vs, err := p.Evaluate(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range vs {
+		got = append(got, v.String())
+	}
+	return got
+}
+
+/*
+TestBuiltin verifies each rule of the built-in pack on planned values that
+follow and break it.
+*/
+func TestBuiltin(t *testing.T) {
+	tests := []struct {
+		name string
+		pack *Pack
+		plan *terraform.PlanStruct
+		want []string
+	}{
+		{
+			name: "Cloud SQL public IPv4",
+			plan: newPlan("google_sql_database_instance", map[string]map[string]any{
+				"sql.private": sqlInstance(false, nil, false),
+				"sql.public":  sqlInstance(true, nil, false),
+			}),
+			want: []string{
+				"sql.public: error: Cloud SQL instances are reached over PSA or PSC only, without a public IPv4 address: settings.0.ip_configuration.0.ipv4_enabled is true, want false [cloudsql-no-public-ipv4]",
+			},
+		},
+		{
+			name: "Cloud SQL deletion protection in prod",
+			plan: newPlan("google_sql_database_instance", map[string]map[string]any{
+				"sql.dev":            sqlInstance(false, map[string]any{"env": "dev"}, false),
+				"sql.prod":           sqlInstance(false, map[string]any{"env": "prod"}, false),
+				"sql.prod-protected": sqlInstance(false, map[string]any{"env": "prod"}, true),
+			}),
+			want: []string{
+				"sql.prod: error: Cloud SQL instances labelled env=prod set gcp_deletion_protection: settings.0.deletion_protection_enabled is false, want true [cloudsql-prod-deletion-protection]",
+			},
+		},
+		{
+			name: "GKE private nodes",
+			plan: newPlan("google_container_cluster", map[string]map[string]any{
+				"gke.private": {"private_cluster_config": []any{map[string]any{"enable_private_nodes": true}}},
+				"gke.public":  {"private_cluster_config": []any{}},
+			}),
+			want: []string{
+				"gke.public: error: GKE clusters use private nodes, with internal IP addresses only: private_cluster_config.0.enable_private_nodes is not set or known only after apply [gke-private-nodes]",
+			},
+		},
+		{
+			name: "AlloyDB outside regulated projects",
+			plan: newPlan("google_alloydb_cluster", map[string]map[string]any{
+				"alloydb.plain": {"project": "regulated"},
+			}),
+		},
+		{
+			name: "AlloyDB in regulated projects",
+			pack: Builtin().With("regulated_projects", "regulated"),
+			plan: newPlan("google_alloydb_cluster", map[string]map[string]any{
+				"alloydb.cmek":  {"project": "regulated", "encryption_config": []any{map[string]any{"kms_key_name": "projects/p/locations/l/keyRings/r/cryptoKeys/k"}}},
+				"alloydb.plain": {"project": "regulated", "encryption_config": []any{}},
+				"alloydb.other": {"project": "other"},
+			}),
+			want: []string{
+				"alloydb.plain: error: AlloyDB clusters in regulated projects are encrypted with cluster_encryption_key_name: encryption_config.0.kms_key_name is not set [alloydb-cmek-in-regulated-projects]",
+			},
+		},
+		{
+			name: "GCE external IP",
+			plan: newPlan("google_compute_instance", map[string]map[string]any{
+				"vm.internal": {"network_interface": []any{map[string]any{"network": "n", "access_config": []any{}}}},
+				"vm.external": {"network_interface": []any{map[string]any{"network": "n", "access_config": []any{map[string]any{"network_tier": "PREMIUM"}}}}},
+			}),
+			want: []string{
+				`vm.external: error: GCE instances have no external IP address: network_interface.#.access_config is [[{"network_tier":"PREMIUM"}]], want it empty [gce-no-external-ip]`,
+			},
+		},
+		{
+			name: "Cloud Run ingress",
+			plan: newPlan("google_cloud_run_v2_service", map[string]map[string]any{
+				"run.all":      {"ingress": "INGRESS_TRAFFIC_ALL"},
+				"run.internal": {"ingress": "INGRESS_TRAFFIC_INTERNAL_ONLY"},
+				"run.lb":       {"ingress": "INGRESS_TRAFFIC_INTERNAL_LOAD_BALANCER"},
+			}),
+			want: []string{
+				`run.all: warning: Cloud Run services accept internal traffic only, directly or through an internal load balancer: ingress is "INGRESS_TRAFFIC_ALL", want one of ["INGRESS_TRAFFIC_INTERNAL_ONLY","INGRESS_TRAFFIC_INTERNAL_LOAD_BALANCER"] [cloudrun-internal-ingress]`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pack := tt.pack
+			if pack == nil {
+				pack = Builtin()
+			}
+			if diff := cmp.Diff(tt.want, violations(t, pack, tt.plan)); diff != "" {
+				t.Errorf("Evaluate() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+/*
+TestExceptions verifies that a resource matching an exception is reported as
+exempted, and that CheckE only fails on violations of error rules that are
+not exempted.
+*/
+func TestExceptions(t *testing.T) {
+	pack, err := Load([]byte(`parameters: {}
+rules:
+  - id: no-public-ip
+    description: no public IP
+    severity: error
+    resource_type: google_sql_database_instance
+    require:
+      - path: settings.0.ip_configuration.0.ipv4_enabled
+        equals: false
+    exceptions:
+      - address: module.cloudsql["demo"].*
+        reason: public demo instance
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := newPlan("google_sql_database_instance", map[string]map[string]any{
+		`module.cloudsql["demo"].google_sql_database_instance.primary`: sqlInstance(true, nil, false),
+	})
+	want := []string{
+		`module.cloudsql["demo"].google_sql_database_instance.primary: error: no public IP: settings.0.ip_configuration.0.ipv4_enabled is true, want false [no-public-ip] (exempted: public demo instance)`,
+	}
+	if diff := cmp.Diff(want, violations(t, pack, plan)); diff != "" {
+		t.Errorf("Evaluate() mismatch (-want +got):\n%s", diff)
+	}
+	if err := pack.CheckE(plan); err != nil {
+		t.Errorf("CheckE() = %v, want nil for an exempted violation", err)
+	}
+	plan.ResourcePlannedValuesMap["sql.other"] = &tfjson.StateResource{Address: "sql.other", Type: "google_sql_database_instance", AttributeValues: sqlInstance(true, nil, false)}
+	if err := pack.CheckE(plan); err == nil || !strings.Contains(err.Error(), "sql.other") {
+		t.Errorf("CheckE() = %v, want an error for sql.other", err)
+	}
+}
+
+/*
+TestLoadErrors verifies that invalid rule packs are rejected with every
+problem they have.
+*/
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{
+			name: "unknown key",
+			yaml: "rules:\n  - id: a\n    severity: error\n    typo: x\n",
+			want: []string{"field typo not found"},
+		},
+		{
+			name: "invalid rules",
+			yaml: `parameters: {}
+rules:
+  - id: a
+    severity: fatal
+    require:
+      - path: x
+  - id: a
+    severity: error
+    resource_type: t
+    require:
+      - path: x
+        equals: 1
+        exists: true
+      - path: y
+        in_parameter: missing
+    exceptions:
+      - address: "*"
+`,
+			want: []string{
+				`rule a: severity "fatal" is not error or warning`,
+				"rule a: missing resource_type",
+				"rule a: condition on x needs exactly one of equals, one_of, in_parameter, exists or empty",
+				"rule a: duplicate id",
+				`rule a: condition on y refers to undeclared parameter "missing"`,
+				"rule a: exceptions need an address and a reason",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]byte(tt.yaml))
+			if err == nil {
+				t.Fatal("Load() = nil error, want an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
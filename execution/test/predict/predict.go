@@ -0,0 +1,416 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package predict derives the module and resource addresses a producer or
+// consumer stage plans for a configuration folder, so that unit tests
+// assert against the YAML fixtures instead of hard-coded address lists and
+// resource counts.
+//
+// Predict finds the module and resource blocks whose for_each iterates over
+// the instances locals.tf builds from the YAML files, follows the for_each
+// through locals to the key expression, and evaluates that key for every
+// YAML file the fileset pattern selects, with the fallbacks package
+// effective reproduces:
+//
+//	expected := predict.Predict(t, terraformDirectoryPath, configFolderPath)
+//	expected.Addresses() // module.cloudsql["dummy1"], module.cloudsql["dummy2"], ...
+//	expected.CheckCreates(t, plan, 1)
+//
+// Keys computed by other expressions than a YAML key or a variable fallback
+// are not supported and are reported as errors.
+package predict
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/effective"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"gopkg.in/yaml.v3"
+)
+
+// Block is a module or resource block with one instance per YAML file.
+type Block struct {
+	// Address is the address of the block, for example "module.cloudsql" or
+	// "google_redis_cluster.cluster-ha".
+	Address string
+	// Keys are the for_each keys, sorted as Terraform orders them.
+	Keys []string
+	// Files maps each key to the YAML file that sets it.
+	Files map[string]string
+}
+
+// Addresses returns the address of each instance of b, for example
+// module.cloudsql["dummy1"].
+func (b Block) Addresses() []string {
+	addresses := make([]string, 0, len(b.Keys))
+	for _, key := range b.Keys {
+		addresses = append(addresses, fmt.Sprintf("%s[%q]", b.Address, key))
+	}
+	return addresses
+}
+
+// Prediction is what a stage plans for a configuration folder.
+type Prediction struct {
+	Blocks []Block
+}
+
+// Addresses returns the address of every instance of every block.
+func (p *Prediction) Addresses() []string {
+	var addresses []string
+	for _, b := range p.Blocks {
+		addresses = append(addresses, b.Addresses()...)
+	}
+	return addresses
+}
+
+// Instances returns the number of instances of every block.
+func (p *Prediction) Instances() int {
+	n := 0
+	for _, b := range p.Blocks {
+		n += len(b.Keys)
+	}
+	return n
+}
+
+// Creates returns, for every predicted instance address, the number of
+// resources plan creates in it: in the module instance and its child
+// modules for a module block, or the resource instance itself for a
+// resource block.
+func (p *Prediction) Creates(plan *terraform.PlanStruct) map[string]int {
+	creates := map[string]int{}
+	for _, address := range p.Addresses() {
+		creates[address] = 0
+	}
+	for _, rc := range plan.ResourceChangesMap {
+		if rc.Change == nil || !rc.Change.Actions.Create() {
+			continue
+		}
+		for address := range creates {
+			if rc.Address == address || strings.HasPrefix(rc.Address, address+".") {
+				creates[address]++
+			}
+		}
+	}
+	return creates
+}
+
+// CheckCreates fails the test for every predicted instance that plan does
+// not create exactly perInstance resources in.
+func (p *Prediction) CheckCreates(t testing.TB, plan *terraform.PlanStruct, perInstance int) {
+	t.Helper()
+	creates := p.Creates(plan)
+	for _, address := range p.Addresses() {
+		if got := creates[address]; got != perInstance {
+			t.Errorf("%s: plan creates %d resources, want %d", address, got, perInstance)
+		}
+	}
+}
+
+// Predict returns the prediction for the Terraform directory dir and the
+// configuration folder configDir, failing the test on error.
+func Predict(t testing.TB, dir, configDir string) *Prediction {
+	t.Helper()
+	p, err := PredictE(dir, configDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// PredictE returns the prediction for the Terraform directory dir and the
+// configuration folder configDir. A relative configDir is relative to dir,
+// as the config_folder_path variable is.
+func PredictE(dir, configDir string) (*Prediction, error) {
+	if !filepath.IsAbs(configDir) {
+		configDir = filepath.Join(dir, configDir)
+	}
+	stage, err := effective.ReadStage(dir)
+	if err != nil {
+		return nil, err
+	}
+	m, err := readModule(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, _, err := stage.Files(configDir)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]map[string]any, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &docs[i]); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	p := &Prediction{}
+	for _, fe := range m.forEach {
+		k, err := m.key(stage, fe.expr, 0)
+		if errors.Is(err, errNotInstances) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: for_each of %s: %w", fe.rng, fe.address, err)
+		}
+		b := Block{Address: fe.address, Files: map[string]string{}}
+		for i, doc := range docs {
+			value, err := k.value(stage, doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", files[i], err)
+			}
+			if other, ok := b.Files[value]; ok {
+				return nil, fmt.Errorf("%s and %s: duplicate for_each key %q of %s", other, files[i], value, fe.address)
+			}
+			b.Files[value] = files[i]
+			b.Keys = append(b.Keys, value)
+		}
+		sort.Strings(b.Keys)
+		p.Blocks = append(p.Blocks, b)
+	}
+	if len(p.Blocks) == 0 {
+		return nil, fmt.Errorf("%s: no module or resource iterates over local.%s", dir, stage.FilesLocal)
+	}
+	return p, nil
+}
+
+// errNotInstances is returned for for_each expressions that do not iterate
+// over the YAML files.
+var errNotInstances = errors.New("not an iteration over the YAML files")
+
+// module is the locals and for_each blocks of a Terraform directory.
+type module struct {
+	locals  map[string]hclsyntax.Expression
+	forEach []forEach
+}
+
+type forEach struct {
+	address string
+	expr    hclsyntax.Expression
+	rng     hcl.Range
+}
+
+// readModule parses the *.tf files of dir.
+func readModule(dir string) (*module, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	m := &module{locals: map[string]hclsyntax.Expression{}}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, block := range f.Body.(*hclsyntax.Body).Blocks {
+			var address string
+			switch {
+			case block.Type == "locals":
+				for name, attr := range block.Body.Attributes {
+					m.locals[name] = attr.Expr
+				}
+				continue
+			case block.Type == "module" && len(block.Labels) == 1:
+				address = "module." + block.Labels[0]
+			case block.Type == "resource" && len(block.Labels) == 2:
+				address = block.Labels[0] + "." + block.Labels[1]
+			default:
+				continue
+			}
+			if attr, ok := block.Body.Attributes["for_each"]; ok {
+				m.forEach = append(m.forEach, forEach{address: address, expr: attr.Expr, rng: attr.SrcRange})
+			}
+		}
+	}
+	sort.Slice(m.forEach, func(i, j int) bool { return m.forEach[i].address < m.forEach[j].address })
+	return m, nil
+}
+
+// forKey is how the for_each key of an instance is read: from the YAML
+// file at yaml, or from the attribute of the instance object named
+// attribute.
+type forKey struct {
+	yaml      string
+	attribute string
+}
+
+// maxDepth bounds how many locals a for_each expression is followed
+// through.
+const maxDepth = 8
+
+// key returns how expr, a for_each expression, keys each instance.
+func (m *module) key(stage *effective.Stage, expr hclsyntax.Expression, depth int) (forKey, error) {
+	if depth > maxDepth {
+		return forKey{}, errNotInstances
+	}
+	switch e := expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr:
+		name, ok := localName(e.Traversal)
+		if !ok {
+			return forKey{}, errNotInstances
+		}
+		if local, ok := m.locals[name]; ok {
+			return m.key(stage, local, depth+1)
+		}
+		return forKey{}, errNotInstances
+	case *hclsyntax.ForExpr:
+		if e.KeyExpr == nil {
+			return forKey{}, errNotInstances
+		}
+		coll := ""
+		for _, t := range e.CollExpr.Variables() {
+			if name, ok := localName(t); ok {
+				coll = name
+			}
+		}
+		keyExpr, ok := e.KeyExpr.(*hclsyntax.ScopeTraversalExpr)
+		var path string
+		if ok {
+			path, ok = traversalPath(keyExpr.Traversal, e.ValVar)
+		}
+		switch {
+		case coll == stage.FilesLocal && ok:
+			return forKey{yaml: path}, nil
+		case coll == stage.FilesLocal:
+			return forKey{}, fmt.Errorf("the key %s is not a YAML key", source(e.KeyExpr))
+		case coll == "" || !m.instances(stage, coll):
+			return forKey{}, errNotInstances
+		case ok:
+			return forKey{attribute: path}, nil
+		}
+		return forKey{}, fmt.Errorf("the key %s is not an attribute of local.%s", source(e.KeyExpr), coll)
+	}
+	return forKey{}, errNotInstances
+}
+
+// instances reports whether the local name holds the instance objects built
+// from the YAML files.
+func (m *module) instances(stage *effective.Stage, name string) bool {
+	local, ok := m.locals[name]
+	return ok && effective.InstanceLoop(map[string]hclsyntax.Expression{name: local}, stage.FilesLocal) != nil
+}
+
+// value returns the for_each key of the instance of doc.
+func (k forKey) value(stage *effective.Stage, doc map[string]any) (string, error) {
+	var v any
+	if k.yaml != "" {
+		var set bool
+		v, set = lookup(doc, k.yaml)
+		if !set {
+			return "", fmt.Errorf("the for_each key %s is not set", k.yaml)
+		}
+	} else {
+		found := false
+		for _, value := range stage.ResolveDocument(doc).Values {
+			if value.Key != k.attribute {
+				continue
+			}
+			found = true
+			switch value.Source {
+			case effective.FromExpression:
+				return "", fmt.Errorf("the for_each key %s is computed by %s", k.attribute, value.Detail)
+			case effective.Missing:
+				return "", fmt.Errorf("the for_each key %s is not set", k.attribute)
+			}
+			if value.Unknown {
+				return "", fmt.Errorf("the for_each key %s defaults to %s, which is only known at plan time", k.attribute, value.Detail)
+			}
+			v = value.Value
+		}
+		if !found {
+			return "", fmt.Errorf("the instance object has no attribute %s", k.attribute)
+		}
+	}
+	switch c := v.(type) {
+	case string:
+		return c, nil
+	case int:
+		return strconv.Itoa(c), nil
+	case uint64:
+		return strconv.FormatUint(c, 10), nil
+	case float64:
+		return strconv.FormatFloat(c, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(c), nil
+	case nil:
+		return "", errors.New("the for_each key is null")
+	}
+	return "", fmt.Errorf("the for_each key is a %T, not a string", v)
+}
+
+// lookup returns the value at the dotted path of doc, and whether it is
+// set.
+func lookup(doc map[string]any, path string) (any, bool) {
+	var v any = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// localName returns X for a traversal local.X.
+func localName(t hcl.Traversal) (string, bool) {
+	if t.RootName() != "local" || len(t) < 2 {
+		return "", false
+	}
+	attr, ok := t[1].(hcl.TraverseAttr)
+	return attr.Name, ok
+}
+
+// traversalPath returns the dotted attribute path of t after root.
+func traversalPath(t hcl.Traversal, root string) (string, bool) {
+	if t.RootName() != root || len(t) < 2 {
+		return "", false
+	}
+	var parts []string
+	for _, step := range t[1:] {
+		attr, ok := step.(hcl.TraverseAttr)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, attr.Name)
+	}
+	return strings.Join(parts, "."), true
+}
+
+// source returns the source text of expr.
+func source(expr hclsyntax.Expression) string {
+	rng := expr.Range()
+	src, err := os.ReadFile(rng.Filename)
+	if err != nil || rng.End.Byte > len(src) {
+		return rng.String()
+	}
+	return strings.Join(strings.Fields(string(src[rng.Start.Byte:rng.End.Byte])), " ")
+}
@@ -0,0 +1,192 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package predict
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/google/go-cmp/cmp"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// writeFiles writes files, keyed by name, to a temporary directory and
+// returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const localsTF = `locals {
+  instances = [for file in fileset(var.config_folder_path, "[^_]*.yaml") : yamldecode(file("${var.config_folder_path}/${file}"))]
+  instance_list = flatten([
+    for instance in local.instances : {
+      name   = try(instance.name, var.name)
+      region = try(instance.region, var.region)
+    }
+  ])
+  instance_map = { for instance in local.instance_list : instance.name => instance }
+  cache_map    = { for instance in local.instances : instance.cache.id => instance }
+}
+`
+
+const mainTF = `module "vm" {
+  source   = "./vm"
+  for_each = local.instance_map
+}
+
+resource "google_redis_cluster" "cache" {
+  for_each = local.cache_map
+}
+
+resource "google_compute_network" "vpc" {
+  for_each = toset(["a"])
+}
+
+variable "config_folder_path" {
+  type = string
+}
+
+variable "name" {
+  type    = string
+  default = "default-vm"
+}
+
+variable "region" {
+  type    = string
+  default = "us-central1"
+}
+`
+
+/*
+TestPredict verifies that for_each keys are followed through locals to an
+attribute of the instance object, with its fallback, or to a YAML key, and
+that blocks iterating over anything else are ignored.
+*/
+func TestPredict(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"locals.tf": localsTF, "main.tf": mainTF})
+	config := writeFiles(t, map[string]string{
+		"b.yaml":         "name: vm-b\ncache:\n  id: 2\n",
+		"a.yaml":         "cache:\n  id: cache-a\n",
+		"_disabled.yaml": "name: disabled\n",
+	})
+	p, err := PredictE(dir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`google_redis_cluster.cache["2"]`,
+		`google_redis_cluster.cache["cache-a"]`,
+		`module.vm["default-vm"]`,
+		`module.vm["vm-b"]`,
+	}
+	if diff := cmp.Diff(want, p.Addresses()); diff != "" {
+		t.Errorf("Addresses() mismatch (-want +got):\n%s", diff)
+	}
+	if got := p.Blocks[1].Files["vm-b"]; got != filepath.Join(config, "b.yaml") {
+		t.Errorf("Files[vm-b] = %q, want b.yaml", got)
+	}
+	if got, want := p.Instances(), 4; got != want {
+		t.Errorf("Instances() = %d, want %d", got, want)
+	}
+}
+
+/*
+TestPredictErrors verifies that duplicate and unset keys are reported with
+their files.
+*/
+func TestPredictErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"locals.tf": localsTF, "main.tf": mainTF})
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name:  "duplicate",
+			files: map[string]string{"a.yaml": "cache:\n  id: 1\n", "b.yaml": "cache:\n  id: 1\n"},
+			want:  `duplicate for_each key "1" of google_redis_cluster.cache`,
+		},
+		{
+			name:  "unset",
+			files: map[string]string{"a.yaml": "name: a\n"},
+			want:  "a.yaml: the for_each key cache.id is not set",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := PredictE(dir, writeFiles(t, tc.files))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("PredictE() = %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+/*
+TestCreates verifies that created resources are counted per module and
+resource instance, including child modules, and that other actions are not.
+*/
+func TestCreates(t *testing.T) {
+	p := &Prediction{Blocks: []Block{
+		{Address: "module.vm", Keys: []string{"a", "b"}},
+		{Address: "google_redis_cluster.cache", Keys: []string{"c"}},
+	}}
+	change := func(address string, actions ...tfjson.Action) *tfjson.ResourceChange {
+		return &tfjson.ResourceChange{Address: address, Change: &tfjson.Change{Actions: actions}}
+	}
+	plan := &terraform.PlanStruct{ResourceChangesMap: map[string]*tfjson.ResourceChange{}}
+	for _, rc := range []*tfjson.ResourceChange{
+		change(`module.vm["a"].google_compute_instance.default`, tfjson.ActionCreate),
+		change(`module.vm["a"].module.disk.google_compute_disk.default`, tfjson.ActionCreate),
+		change(`module.vm["ab"].google_compute_instance.default`, tfjson.ActionCreate),
+		change(`module.vm["b"].google_compute_instance.default`, tfjson.ActionUpdate),
+		change(`google_redis_cluster.cache["c"]`, tfjson.ActionCreate),
+	} {
+		plan.ResourceChangesMap[rc.Address] = rc
+	}
+	want := map[string]int{`module.vm["a"]`: 2, `module.vm["b"]`: 0, `google_redis_cluster.cache["c"]`: 1}
+	if diff := cmp.Diff(want, p.Creates(plan)); diff != "" {
+		t.Errorf("Creates() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestPredictUnitFixtures verifies that the addresses of every stage with a
+configuration folder can be predicted for its unit test fixtures.
+*/
+func TestPredictUnitFixtures(t *testing.T) {
+	for _, st := range stages.All {
+		if st.Config == "" {
+			continue
+		}
+		t.Run(st.Name, func(t *testing.T) {
+			p := Predict(t, st.TerraformDir(), filepath.Join(st.UnitTestDir(), "config"))
+			if len(p.Addresses()) == 0 {
+				t.Errorf("Predict() found no instances in %s", st.UnitTestDir())
+			}
+		})
+	}
+}
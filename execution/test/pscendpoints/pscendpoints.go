@@ -0,0 +1,375 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pscendpoints derives the psc_endpoints entries of the
+// 05-networking-manual stage from the outputs of the CloudSQL, AlloyDB and
+// MRC producer stages, instead of copying instance names and service
+// attachments into networking-manual.tfvars by hand.
+//
+// The outputs are read as written by terraform output -json. Instances
+// with Private Service Connect enabled get one endpoint each, or one per
+// service attachment for a Redis cluster, in the network and subnetwork
+// given in Options. With Options.SubnetRange set, each endpoint gets a
+// free address of the subnetwork, skipping the addresses Google Cloud
+// reserves and those already used by existing endpoints.
+package pscendpoints
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Producer is a producer stage with PSC-capable instances.
+type Producer string
+
+const (
+	CloudSQL Producer = "cloudsql"
+	AlloyDB  Producer = "alloydb"
+	MRC      Producer = "mrc"
+)
+
+// Producers lists the producer stages in the order their endpoints are
+// written.
+var Producers = []Producer{CloudSQL, AlloyDB, MRC}
+
+// Outputs maps each producer to the output of its stage that describes its
+// instances.
+var Outputs = map[Producer]string{
+	CloudSQL: "cloudsql_instance_details",
+	AlloyDB:  "cluster_details",
+	MRC:      "redis_cluster_details",
+}
+
+// Instance is a producer instance with Private Service Connect enabled.
+type Instance struct {
+	Producer  Producer
+	Name      string
+	ProjectID string
+	Region    string
+	// ServiceAttachment is the service attachment an endpoint targets, empty
+	// when the output does not know it yet.
+	ServiceAttachment string
+}
+
+// ReadOutputs reads the instances of producer from the output of terraform
+// output -json at path.
+func ReadOutputs(producer Producer, path string) ([]Instance, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	instances, err := ParseOutputs(producer, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return instances, nil
+}
+
+// ParseOutputs returns the instances of producer with Private Service
+// Connect enabled, sorted by name, from the output of terraform output
+// -json. A Redis cluster is returned once per service attachment, and only
+// when no PSC connection exists yet, since a service connection policy
+// otherwise creates its endpoints.
+func ParseOutputs(producer Producer, data []byte) ([]Instance, error) {
+	name, ok := Outputs[producer]
+	if !ok {
+		return nil, fmt.Errorf("unknown producer %q", producer)
+	}
+	var outputs map[string]struct {
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		return nil, err
+	}
+	output, ok := outputs[name]
+	if !ok {
+		return nil, fmt.Errorf("output %q is not set", name)
+	}
+	var details map[string]struct {
+		Name                     string   `json:"name"`
+		ClusterID                string   `json:"cluster_id"`
+		ProjectID                string   `json:"project_id"`
+		Region                   string   `json:"region"`
+		PSCEnabled               bool     `json:"psc_enabled"`
+		PSCServiceAttachmentLink string   `json:"psc_service_attachment_link"`
+		PSCConnection            *string  `json:"psc_connection"`
+		PSCServiceAttachments    []string `json:"psc_service_attachments"`
+	}
+	if err := json.Unmarshal(output.Value, &details); err != nil {
+		return nil, fmt.Errorf("output %q: %w", name, err)
+	}
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var instances []Instance
+	for _, key := range keys {
+		d := details[key]
+		inst := Instance{Producer: producer, Name: key, ProjectID: d.ProjectID, Region: d.Region}
+		switch producer {
+		case CloudSQL, AlloyDB:
+			if !d.PSCEnabled {
+				continue
+			}
+			if d.Name != "" {
+				inst.Name = d.Name
+			} else if d.ClusterID != "" {
+				inst.Name = d.ClusterID
+			}
+			inst.ServiceAttachment = d.PSCServiceAttachmentLink
+			instances = append(instances, inst)
+		case MRC:
+			if d.Name != "" {
+				inst.Name = d.Name
+			}
+			if d.PSCConnection != nil {
+				continue
+			}
+			for _, attachment := range d.PSCServiceAttachments {
+				inst.ServiceAttachment = attachment
+				instances = append(instances, inst)
+			}
+		}
+	}
+	return instances, nil
+}
+
+// Existing is what a networking-manual.tfvars file already declares.
+type Existing struct {
+	// Instances are the producer_instance_name values.
+	Instances map[string]bool
+	// Targets are the target values.
+	Targets map[string]bool
+	// Addresses are the ip_address_literal values.
+	Addresses []netip.Addr
+}
+
+// Has reports whether e already has an endpoint for inst.
+func (e *Existing) Has(inst Instance) bool {
+	if e == nil {
+		return false
+	}
+	return (inst.Producer == CloudSQL && e.Instances[inst.Name]) ||
+		(inst.ServiceAttachment != "" && e.Targets[inst.ServiceAttachment])
+}
+
+// ReadExisting reads the psc_endpoints of the tfvars file at path. A file
+// that does not set psc_endpoints has no endpoints.
+func ReadExisting(path string) (*Existing, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	e := &Existing{Instances: map[string]bool{}, Targets: map[string]bool{}}
+	attr, ok := f.Body.(*hclsyntax.Body).Attributes["psc_endpoints"]
+	if !ok {
+		return e, nil
+	}
+	val, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if !val.CanIterateElements() {
+		return nil, fmt.Errorf("%s: psc_endpoints must be a list", path)
+	}
+	for it := val.ElementIterator(); it.Next(); {
+		_, endpoint := it.Element()
+		if name := stringAttr(endpoint, "producer_instance_name"); name != "" {
+			e.Instances[name] = true
+		}
+		if target := stringAttr(endpoint, "target"); target != "" {
+			e.Targets[target] = true
+		}
+		if literal := stringAttr(endpoint, "ip_address_literal"); literal != "" {
+			addr, err := netip.ParseAddr(literal)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			e.Addresses = append(e.Addresses, addr)
+		}
+	}
+	return e, nil
+}
+
+// stringAttr returns the string attribute name of obj, or "" when it is
+// not set.
+func stringAttr(obj cty.Value, name string) string {
+	if !obj.Type().IsObjectType() || !obj.Type().HasAttribute(name) {
+		return ""
+	}
+	v := obj.GetAttr(name)
+	if v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+		return ""
+	}
+	return v.AsString()
+}
+
+// Options are the settings every generated endpoint shares.
+type Options struct {
+	// EndpointProjectID is the project of the forwarding rules, the project
+	// of each instance when empty.
+	EndpointProjectID string
+	NetworkName       string
+	SubnetworkName    string
+	// SubnetRange is the primary range of the subnetwork. When it is valid,
+	// each endpoint gets a free address of it as ip_address_literal;
+	// otherwise Google Cloud allocates one.
+	SubnetRange netip.Prefix
+	// Used are addresses of the subnetwork that are already taken, for
+	// example by existing endpoints.
+	Used []netip.Addr
+}
+
+// Endpoint is an entry of the psc_endpoints variable of
+// 05-networking-manual.
+type Endpoint struct {
+	EndpointProjectID         string
+	ProducerInstanceProjectID string
+	SubnetworkName            string
+	NetworkName               string
+	IPAddressLiteral          string
+	ProducerInstanceName      string
+	Target                    string
+	// Comment describes the instance the endpoint connects to.
+	Comment string
+}
+
+// Endpoints returns an endpoint for each instance. A Cloud SQL instance in
+// the endpoint project is referenced by producer_instance_name, since the
+// stage looks the instance up in that project; every other instance
+// targets its service attachment. The returned error joins the problems of
+// the instances that get no endpoint; when the subnet range runs out of
+// addresses, the endpoints allocated so far are returned.
+func Endpoints(instances []Instance, opts Options) ([]Endpoint, error) {
+	var next func() (netip.Addr, error)
+	if opts.SubnetRange.IsValid() {
+		var err error
+		if next, err = allocator(opts.SubnetRange, opts.Used); err != nil {
+			return nil, err
+		}
+	}
+	var endpoints []Endpoint
+	var errs []error
+	for _, inst := range instances {
+		e := Endpoint{
+			EndpointProjectID:         opts.EndpointProjectID,
+			ProducerInstanceProjectID: inst.ProjectID,
+			SubnetworkName:            opts.SubnetworkName,
+			NetworkName:               opts.NetworkName,
+			Comment:                   fmt.Sprintf("%s %s", inst.Producer, inst.Name),
+		}
+		if e.EndpointProjectID == "" {
+			e.EndpointProjectID = inst.ProjectID
+		}
+		if inst.Region != "" {
+			e.Comment += " in " + inst.Region
+		}
+		switch {
+		case inst.Producer == CloudSQL && e.EndpointProjectID == inst.ProjectID:
+			e.ProducerInstanceName = inst.Name
+		case inst.ServiceAttachment != "":
+			e.Target = inst.ServiceAttachment
+		default:
+			errs = append(errs, fmt.Errorf("%s %s: the output has no service attachment", inst.Producer, inst.Name))
+			continue
+		}
+		if next != nil {
+			addr, err := next()
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			e.IPAddressLiteral = addr.String()
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, errors.Join(errs...)
+}
+
+// allocator returns a function returning the free addresses of prefix in
+// order. The first two and last two addresses of a subnet range are
+// reserved by Google Cloud.
+func allocator(prefix netip.Prefix, used []netip.Addr) (func() (netip.Addr, error), error) {
+	prefix = prefix.Masked()
+	if !prefix.Addr().Is4() || prefix.Bits() > 29 {
+		return nil, fmt.Errorf("subnet range %s must be an IPv4 range of at least /29", prefix)
+	}
+	taken := map[netip.Addr]bool{}
+	for _, addr := range used {
+		taken[addr] = true
+	}
+	base := prefix.Addr().As4()
+	broadcast := binary.BigEndian.Uint32(base[:]) | (1<<(32-prefix.Bits()) - 1)
+	var last [4]byte
+	binary.BigEndian.PutUint32(last[:], broadcast-1)
+	end := netip.AddrFrom4(last)
+	addr := prefix.Addr().Next()
+	return func() (netip.Addr, error) {
+		for addr = addr.Next(); addr.Less(end); addr = addr.Next() {
+			if !taken[addr] {
+				return addr, nil
+			}
+		}
+		return netip.Addr{}, fmt.Errorf("subnet range %s has no free address left", prefix)
+	}, nil
+}
+
+// Write writes endpoints as the psc_endpoints variable of a tfvars file,
+// with a comment naming the instance of each endpoint.
+func Write(w io.Writer, endpoints []Endpoint) error {
+	var b bytes.Buffer
+	b.WriteString("psc_endpoints = [\n")
+	for _, e := range endpoints {
+		fmt.Fprintf(&b, "# %s\n{\n", e.Comment)
+		attribute(&b, "endpoint_project_id", e.EndpointProjectID)
+		attribute(&b, "producer_instance_project_id", e.ProducerInstanceProjectID)
+		attribute(&b, "subnetwork_name", e.SubnetworkName)
+		attribute(&b, "network_name", e.NetworkName)
+		if e.IPAddressLiteral != "" {
+			attribute(&b, "ip_address_literal", e.IPAddressLiteral)
+		}
+		if e.ProducerInstanceName != "" {
+			attribute(&b, "producer_instance_name", e.ProducerInstanceName)
+		}
+		if e.Target != "" {
+			attribute(&b, "target", e.Target)
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("]\n")
+	_, err := w.Write(hclwrite.Format(b.Bytes()))
+	return err
+}
+
+// attribute writes name = "value" to b.
+func attribute(b *bytes.Buffer, name, value string) {
+	fmt.Fprintf(b, "%s = %s\n", name, hclwrite.TokensForValue(cty.StringVal(value)).Bytes())
+}
@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pscendpoints
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configlint"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/google/go-cmp/cmp"
+)
+
+const cloudSQLOutputs = `{
+  "cloudsql_instance_details": {
+    "sensitive": true,
+    "type": ["map", ["object", {}]],
+    "value": {
+      "sql-psa": {"name": "sql-psa", "project_id": "producer", "region": "us-central1", "psc_enabled": false, "psc_service_attachment_link": null},
+      "sql-psc": {"name": "sql-psc", "project_id": "producer", "region": "us-central1", "psc_enabled": true, "psc_service_attachment_link": "projects/tp-1/regions/us-central1/serviceAttachments/sql-psc"}
+    }
+  }
+}`
+
+const alloyDBOutputs = `{
+  "cluster_details": {
+    "sensitive": false,
+    "value": {
+      "cluster": {"cluster_id": "alloydb-1", "project_id": "producer", "region": "us-east1", "psc_enabled": true, "psc_service_attachment_link": "projects/tp-2/regions/us-east1/serviceAttachments/alloydb-1"}
+    }
+  }
+}`
+
+const mrcOutputs = `{
+  "redis_cluster_details": {
+    "sensitive": false,
+    "value": {
+      "auto": {"name": "auto", "project_id": "producer", "region": "us-central1", "psc_connection": "123", "psc_service_attachments": ["projects/tp-3/regions/us-central1/serviceAttachments/auto-0"]},
+      "manual": {"name": "manual", "project_id": "producer", "region": "us-central1", "psc_connection": null, "psc_service_attachments": ["projects/tp-3/regions/us-central1/serviceAttachments/manual-0", "projects/tp-3/regions/us-central1/serviceAttachments/manual-1"]}
+    }
+  }
+}`
+
+/*
+TestParseOutputs verifies that only instances with Private Service Connect
+enabled are read, and that a Redis cluster without PSC connections is read
+once per service attachment.
+*/
+func TestParseOutputs(t *testing.T) {
+	tests := []struct {
+		producer Producer
+		data     string
+		want     []Instance
+	}{
+		{
+			producer: CloudSQL,
+			data:     cloudSQLOutputs,
+			want: []Instance{
+				{Producer: CloudSQL, Name: "sql-psc", ProjectID: "producer", Region: "us-central1", ServiceAttachment: "projects/tp-1/regions/us-central1/serviceAttachments/sql-psc"},
+			},
+		},
+		{
+			producer: AlloyDB,
+			data:     alloyDBOutputs,
+			want: []Instance{
+				{Producer: AlloyDB, Name: "alloydb-1", ProjectID: "producer", Region: "us-east1", ServiceAttachment: "projects/tp-2/regions/us-east1/serviceAttachments/alloydb-1"},
+			},
+		},
+		{
+			producer: MRC,
+			data:     mrcOutputs,
+			want: []Instance{
+				{Producer: MRC, Name: "manual", ProjectID: "producer", Region: "us-central1", ServiceAttachment: "projects/tp-3/regions/us-central1/serviceAttachments/manual-0"},
+				{Producer: MRC, Name: "manual", ProjectID: "producer", Region: "us-central1", ServiceAttachment: "projects/tp-3/regions/us-central1/serviceAttachments/manual-1"},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.producer), func(t *testing.T) {
+			got, err := ParseOutputs(tc.producer, []byte(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("ParseOutputs() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	if _, err := ParseOutputs(MRC, []byte(cloudSQLOutputs)); err == nil {
+		t.Error("ParseOutputs() of another stage = nil, want an error")
+	}
+}
+
+/*
+TestEndpoints verifies the choice between producer_instance_name and target
+and that addresses are allocated past the reserved and used ones.
+*/
+func TestEndpoints(t *testing.T) {
+	instances := []Instance{
+		{Producer: CloudSQL, Name: "sql-psc", ProjectID: "producer", Region: "us-central1", ServiceAttachment: "projects/tp-1/regions/us-central1/serviceAttachments/sql-psc"},
+		{Producer: AlloyDB, Name: "alloydb-1", ProjectID: "producer", ServiceAttachment: "projects/tp-2/regions/us-east1/serviceAttachments/alloydb-1"},
+		{Producer: AlloyDB, Name: "pending", ProjectID: "producer"},
+	}
+	opts := Options{
+		NetworkName:    "vpc",
+		SubnetworkName: "subnet",
+		SubnetRange:    netip.MustParsePrefix("10.0.0.0/29"),
+		Used:           []netip.Addr{netip.MustParseAddr("10.0.0.2")},
+	}
+	got, err := Endpoints(instances, opts)
+	if err == nil || !strings.Contains(err.Error(), "alloydb pending: the output has no service attachment") {
+		t.Errorf("Endpoints() error = %v, want the missing service attachment of pending", err)
+	}
+	want := []Endpoint{
+		{EndpointProjectID: "producer", ProducerInstanceProjectID: "producer", SubnetworkName: "subnet", NetworkName: "vpc", IPAddressLiteral: "10.0.0.3", ProducerInstanceName: "sql-psc", Comment: "cloudsql sql-psc in us-central1"},
+		{EndpointProjectID: "producer", ProducerInstanceProjectID: "producer", SubnetworkName: "subnet", NetworkName: "vpc", IPAddressLiteral: "10.0.0.4", Target: "projects/tp-2/regions/us-east1/serviceAttachments/alloydb-1", Comment: "alloydb alloydb-1"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Endpoints() mismatch (-want +got):\n%s", diff)
+	}
+
+	// A Cloud SQL instance of another project is looked up by its service
+	// attachment, and the range runs out after 10.0.0.5.
+	opts.EndpointProjectID = "consumer"
+	got, err = Endpoints(instances[:1], opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Target != instances[0].ServiceAttachment || got[0].ProducerInstanceName != "" {
+		t.Errorf("Endpoints() = %+v, want the service attachment as target", got[0])
+	}
+	opts.Used = append(opts.Used, netip.MustParseAddr("10.0.0.3"), netip.MustParseAddr("10.0.0.4"), netip.MustParseAddr("10.0.0.5"))
+	if _, err := Endpoints(instances[:1], opts); err == nil {
+		t.Error("Endpoints() with a full range = nil error, want an error")
+	}
+}
+
+/*
+TestWrite verifies the rendered tfvars and that they are valid values of
+the psc_endpoints variable of the networking-manual stage.
+*/
+func TestWrite(t *testing.T) {
+	endpoints := []Endpoint{
+		{EndpointProjectID: "producer", ProducerInstanceProjectID: "producer", SubnetworkName: "subnet", NetworkName: "vpc", IPAddressLiteral: "10.0.0.3", ProducerInstanceName: "sql-psc", Comment: "cloudsql sql-psc in us-central1"},
+		{EndpointProjectID: "consumer", ProducerInstanceProjectID: "producer", SubnetworkName: "subnet", NetworkName: "vpc", Target: "projects/tp-2/regions/us-east1/serviceAttachments/alloydb-1", Comment: "alloydb alloydb-1"},
+	}
+	var b bytes.Buffer
+	if err := Write(&b, endpoints); err != nil {
+		t.Fatal(err)
+	}
+	want := `psc_endpoints = [
+  # cloudsql sql-psc in us-central1
+  {
+    endpoint_project_id          = "producer"
+    producer_instance_project_id = "producer"
+    subnetwork_name              = "subnet"
+    network_name                 = "vpc"
+    ip_address_literal           = "10.0.0.3"
+    producer_instance_name       = "sql-psc"
+  },
+  # alloydb alloydb-1
+  {
+    endpoint_project_id          = "consumer"
+    producer_instance_project_id = "producer"
+    subnetwork_name              = "subnet"
+    network_name                 = "vpc"
+    target                       = "projects/tp-2/regions/us-east1/serviceAttachments/alloydb-1"
+  },
+]
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("Write() mismatch (-want +got):\n%s", diff)
+	}
+
+	path := filepath.Join(t.TempDir(), "networking-manual.tfvars")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	diags, err := configlint.LintTFVars(path, stages.MustGet("networking-manual").TerraformDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configlint.HasErrors(diags) {
+		t.Errorf("LintTFVars() = %v, want no errors", diags)
+	}
+}
+
+/*
+TestReadExisting verifies that the endpoints of the committed
+networking-manual.tfvars are read, so that new endpoints avoid them.
+*/
+func TestReadExisting(t *testing.T) {
+	e, err := ReadExisting(stages.MustGet("networking-manual").TFVarsPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Addr{netip.MustParseAddr("10.128.0.26"), netip.MustParseAddr("10.128.0.27")}
+	if diff := cmp.Diff(want, e.Addresses, cmp.Comparer(func(a, b netip.Addr) bool { return a == b })); diff != "" {
+		t.Errorf("Addresses mismatch (-want +got):\n%s", diff)
+	}
+	if !e.Has(Instance{Producer: CloudSQL, Name: "psc-instance-name"}) {
+		t.Error(`Has(psc-instance-name) = false, want true`)
+	}
+	if e.Has(Instance{Producer: AlloyDB, Name: "psc-instance-name"}) {
+		t.Error(`Has(alloydb psc-instance-name) = true, want false`)
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stages describes the execution stages that execution/run.sh runs,
+// so that tests resolve stage directories, tfvars files and configuration
+// folders from one place instead of hard-coding relative paths.
+//
+// All mirrors valid_stages, stage_path_map, stagewise_tfvar_path_map and
+// stage_wise_description_map in run.sh, and the tests of this package fail
+// when the two drift apart.
+package stages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Stage is one stage that run.sh can execute.
+type Stage struct {
+	// Name is the value run.sh accepts for -s, for example
+	// "producer/cloudsql".
+	Name string
+	// Dir is the Terraform directory, relative to execution/.
+	Dir string
+	// TFVars is the tfvars file run.sh passes to the stage, relative to the
+	// repository root.
+	TFVars string
+	// Config is the folder with the YAML configuration examples that the
+	// stage reads through config_folder_path, relative to the repository
+	// root. It is empty for stages configured only through tfvars.
+	Config string
+	// TestDir is the directory of the stage's unit and integration test
+	// packages, relative to execution/test/unit and
+	// execution/test/integration.
+	TestDir string
+	// DependsOn names the stages whose resources this stage uses.
+	DependsOn []string
+	// Description is the text run.sh prints in its help.
+	Description string
+}
+
+// All lists the stages in the order run.sh runs them with -s all.
+var All = []Stage{
+	{
+		Name:        "organization",
+		Dir:         "01-organization",
+		TFVars:      "configuration/organization.tfvars",
+		TestDir:     "organization",
+		Description: "Executes 01-organization stage, manages Google Cloud APIs.",
+	},
+	{
+		Name:        "networking",
+		Dir:         "02-networking",
+		TFVars:      "configuration/networking.tfvars",
+		TestDir:     "networking",
+		DependsOn:   []string{"organization"},
+		Description: "Executes 02-networking stage, manages network resources.",
+	},
+	{
+		Name:        "security/alloydb",
+		Dir:         "03-security/AlloyDB",
+		TFVars:      "configuration/security/alloydb.tfvars",
+		TestDir:     "security/AlloyDB",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 03-security/AlloyDB stage, manages AlloyDB firewall rules.",
+	},
+	{
+		Name:        "security/mrc",
+		Dir:         "03-security/MRC",
+		TFVars:      "configuration/security/mrc.tfvars",
+		TestDir:     "security/MRC",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 03-security/MRC stage, manages MRC firewall rules.",
+	},
+	{
+		Name:        "security/cloudsql",
+		Dir:         "03-security/CloudSQL",
+		TFVars:      "configuration/security/cloudsql.tfvars",
+		TestDir:     "security/CloudSQL",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 03-security/CloudSQL stage, manages CloudSQL firewall rules.",
+	},
+	{
+		Name:        "security/gce",
+		Dir:         "03-security/GCE",
+		TFVars:      "configuration/security/gce.tfvars",
+		TestDir:     "security/GCE",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 03-security/GCE stage, manages GCE firewall rules.",
+	},
+	{
+		Name:        "producer/alloydb",
+		Dir:         "04-producer/AlloyDB",
+		TFVars:      "configuration/producer/AlloyDB/alloydb.tfvars",
+		Config:      "configuration/producer/AlloyDB/config",
+		TestDir:     "producer/AlloyDB",
+		DependsOn:   []string{"networking", "security/alloydb"},
+		Description: "Executes 04-producer/AlloyDB stage, manages AlloyDB instance.",
+	},
+	{
+		Name:        "producer/mrc",
+		Dir:         "04-producer/MRC",
+		TFVars:      "configuration/producer/MRC/mrc.tfvars",
+		Config:      "configuration/producer/MRC/config",
+		TestDir:     "producer/MRC",
+		DependsOn:   []string{"networking", "security/mrc"},
+		Description: "Executes 04-producer/MRC stage, manages MRC instance.",
+	},
+	{
+		Name:        "producer/cloudsql",
+		Dir:         "04-producer/CloudSQL",
+		TFVars:      "configuration/producer/CloudSQL/cloudsql.tfvars",
+		Config:      "configuration/producer/CloudSQL/config",
+		TestDir:     "producer/CloudSQL",
+		DependsOn:   []string{"networking", "security/cloudsql"},
+		Description: "Executes 04-producer/CloudSQL stage, manages CloudSQL instance.",
+	},
+	{
+		Name:        "producer/gke",
+		Dir:         "04-producer/GKE",
+		TFVars:      "configuration/producer/GKE/gke.tfvars",
+		Config:      "configuration/producer/GKE/config",
+		TestDir:     "producer/GKE",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 04-producer/GKE stage, manages GKE clusters.",
+	},
+	{
+		Name:        "producer/vectorsearch",
+		Dir:         "04-producer/VectorSearch",
+		TFVars:      "configuration/producer/VectorSearch/vectorsearch.tfvars",
+		Config:      "configuration/producer/VectorSearch/config",
+		TestDir:     "producer/VectorSearch",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 04-producer/VectorSearch stage, manages Vector Search instances.",
+	},
+	{
+		Name:        "producer/onlineendpoint",
+		Dir:         "04-producer/Vertex-AI-Online-Endpoints",
+		TFVars:      "configuration/producer/Vertex-AI-Online-Endpoints/vertex-ai-online-endpoints.tfvars",
+		Config:      "configuration/producer/Vertex-AI-Online-Endpoints/config",
+		TestDir:     "producer/Vertex-AI-Online-Endpoints",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 04-producer/Vertex-AI-Online-Endpoints stage, manages Online endpoints.",
+	},
+	{
+		Name:        "networking-manual",
+		Dir:         "05-networking-manual",
+		TFVars:      "configuration/networking-manual.tfvars",
+		TestDir:     "networking-manual",
+		DependsOn:   []string{"networking", "producer/cloudsql"},
+		Description: "Executes 05-networking-manual stage, manages PSC for supported services.",
+	},
+	{
+		Name:        "consumer/gce",
+		Dir:         "06-consumer/GCE",
+		TFVars:      "configuration/consumer/GCE/gce.tfvars",
+		Config:      "configuration/consumer/GCE/config",
+		TestDir:     "consumer/GCE",
+		DependsOn:   []string{"networking", "security/gce"},
+		Description: "Executes 06-consumer/GCE stage, manages GCE instance.",
+	},
+	{
+		Name:        "consumer/cloudrun/job",
+		Dir:         "06-consumer/CloudRun/Job",
+		TFVars:      "configuration/consumer/CloudRun/Job/cloudrunjob.tfvars",
+		Config:      "configuration/consumer/CloudRun/Job/config",
+		TestDir:     "consumer/CloudRun/Job",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 06-consumer/CloudRun/Job, manages Cloud Run jobs.",
+	},
+	{
+		Name:        "consumer/cloudrun/service",
+		Dir:         "06-consumer/CloudRun/Service",
+		TFVars:      "configuration/consumer/CloudRun/Service/cloudrunservice.tfvars",
+		Config:      "configuration/consumer/CloudRun/Service/config",
+		TestDir:     "consumer/CloudRun/Service",
+		DependsOn:   []string{"networking"},
+		Description: "Executes 06-consumer/CloudRun/Service, manages Cloud Run services.",
+	},
+}
+
+// Get returns the stage named name.
+func Get(name string) (Stage, bool) {
+	for _, s := range All {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Stage{}, false
+}
+
+// MustGet is like Get but panics if there is no such stage, for use in
+// package-level variables of test packages.
+func MustGet(name string) Stage {
+	s, ok := Get(name)
+	if !ok {
+		panic(fmt.Sprintf("stages: unknown stage %q", name))
+	}
+	return s
+}
+
+// ByDir returns the stage whose Terraform directory is dir, relative to
+// execution/, for example "04-producer/CloudSQL".
+func ByDir(dir string) (Stage, bool) {
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	for _, s := range All {
+		if s.Dir == dir {
+			return s, true
+		}
+	}
+	return Stage{}, false
+}
+
+// TerraformDir returns the absolute path of the stage's Terraform directory.
+func (s Stage) TerraformDir() string {
+	return filepath.Join(MustRoot(), "execution", filepath.FromSlash(s.Dir))
+}
+
+// TFVarsPath returns the absolute path of the stage's tfvars file.
+func (s Stage) TFVarsPath() string {
+	return filepath.Join(MustRoot(), filepath.FromSlash(s.TFVars))
+}
+
+// ConfigPath returns the absolute path of the stage's configuration folder,
+// or "" if it has none.
+func (s Stage) ConfigPath() string {
+	if s.Config == "" {
+		return ""
+	}
+	return filepath.Join(MustRoot(), filepath.FromSlash(s.Config))
+}
+
+// UnitTestDir returns the absolute path of the stage's unit test package.
+func (s Stage) UnitTestDir() string {
+	return filepath.Join(MustRoot(), "execution", "test", "unit", filepath.FromSlash(s.TestDir))
+}
+
+// IntegrationTestDir returns the absolute path of the stage's integration
+// test package.
+func (s Stage) IntegrationTestDir() string {
+	return filepath.Join(MustRoot(), "execution", "test", "integration", filepath.FromSlash(s.TestDir))
+}
+
+var (
+	rootOnce sync.Once
+	root     string
+	rootErr  error
+)
+
+// Root returns the repository root, found by walking up from the working
+// directory to the directory that contains execution/run.sh.
+func Root() (string, error) {
+	rootOnce.Do(func() {
+		dir, err := os.Getwd()
+		if err != nil {
+			rootErr = err
+			return
+		}
+		for {
+			if _, err := os.Stat(filepath.Join(dir, "execution", "run.sh")); err == nil {
+				root = dir
+				return
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				rootErr = errors.New("stages: execution/run.sh not found in any parent of the working directory")
+				return
+			}
+			dir = parent
+		}
+	})
+	return root, rootErr
+}
+
+// MustRoot is like Root but panics if the repository root is not found.
+func MustRoot() string {
+	dir, err := Root()
+	if err != nil {
+		panic(err)
+	}
+	return dir
+}
@@ -0,0 +1,198 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stages
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// runScript holds the stage tables parsed from run.sh.
+type runScript struct {
+	validStages  []string
+	paths        map[string]string
+	tfvars       map[string]string
+	descriptions map[string]string
+}
+
+func parseRunScript(t *testing.T) runScript {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(MustRoot(), "execution", "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(content)
+	valid := regexp.MustCompile(`(?m)^valid_stages="([^"]*)"`).FindStringSubmatch(src)
+	if valid == nil {
+		t.Fatal("valid_stages not found in run.sh")
+	}
+	return runScript{
+		validStages:  strings.Fields(valid[1]),
+		paths:        parseMap(t, src, "stage_path_map"),
+		tfvars:       parseMap(t, src, "stagewise_tfvar_path_map"),
+		descriptions: parseMap(t, src, "stage_wise_description_map"),
+	}
+}
+
+// parseMap parses a bash array of "key=value" strings.
+func parseMap(t *testing.T, src, name string) map[string]string {
+	t.Helper()
+	block := regexp.MustCompile(`(?s)\n` + name + `=\((.*?)\n\s*\)`).FindStringSubmatch(src)
+	if block == nil {
+		t.Fatalf("%s not found in run.sh", name)
+	}
+	entries := map[string]string{}
+	for _, m := range regexp.MustCompile(`"([^"=]+)=([^"]*)"`).FindAllStringSubmatch(block[1], -1) {
+		entries[m[1]] = m[2]
+	}
+	return entries
+}
+
+// relativeToRoot resolves path, relative to the stage directory dir, to a
+// slash-separated path relative to the repository root.
+func relativeToRoot(t *testing.T, dir, path string) string {
+	t.Helper()
+	rel, err := filepath.Rel(MustRoot(), filepath.Join(MustRoot(), "execution", dir, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.ToSlash(rel)
+}
+
+/*
+TestStagesMatchRunScript verifies that the registry lists the stages of
+run.sh in the same order, with the same directories, tfvars files and
+descriptions.
+*/
+func TestStagesMatchRunScript(t *testing.T) {
+	script := parseRunScript(t)
+	var names []string
+	for _, s := range All {
+		names = append(names, s.Name)
+	}
+	if diff := cmp.Diff(script.validStages, append([]string{"all"}, names...)); diff != "" {
+		t.Errorf("stage names mismatch with valid_stages in run.sh (-run.sh +registry):\n%s", diff)
+	}
+	for _, s := range All {
+		if got := script.paths[s.Name]; got != s.Dir {
+			t.Errorf("%s: run.sh stage_path_map = %q, registry Dir = %q", s.Name, got, s.Dir)
+		}
+		tfvars, ok := script.tfvars[s.Dir]
+		if !ok {
+			t.Errorf("%s: %s missing from stagewise_tfvar_path_map in run.sh", s.Name, s.Dir)
+		} else if got := relativeToRoot(t, s.Dir, tfvars); got != s.TFVars {
+			t.Errorf("%s: run.sh tfvars = %q, registry TFVars = %q", s.Name, got, s.TFVars)
+		}
+		if got := script.descriptions[s.Name]; got != s.Description {
+			t.Errorf("%s: run.sh description = %q, registry Description = %q", s.Name, got, s.Description)
+		}
+	}
+}
+
+/*
+TestConfigFoldersMatchTFVars verifies that the registry's configuration
+folder of each stage is the config_folder_path of its tfvars file.
+*/
+func TestConfigFoldersMatchTFVars(t *testing.T) {
+	configFolder := regexp.MustCompile(`(?m)^\s*config_folder_path\s*=\s*"([^"]*)"`)
+	for _, s := range All {
+		content, err := os.ReadFile(s.TFVarsPath())
+		if err != nil {
+			t.Errorf("%s: %v", s.Name, err)
+			continue
+		}
+		want := ""
+		if m := configFolder.FindSubmatch(content); m != nil {
+			want = relativeToRoot(t, s.Dir, string(m[1]))
+		}
+		if s.Config != want {
+			t.Errorf("%s: registry Config = %q, config_folder_path in %s resolves to %q", s.Name, s.Config, s.TFVars, want)
+		}
+	}
+}
+
+/*
+TestEveryStageHasTestsAndExamples verifies that every registered stage has
+unit and integration test packages and a configuration example.
+*/
+func TestEveryStageHasTestsAndExamples(t *testing.T) {
+	hasFile := func(dir, pattern string) bool {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		return len(matches) > 0
+	}
+	for _, s := range All {
+		if _, err := os.Stat(filepath.Join(s.TerraformDir(), "variables.tf")); err != nil {
+			t.Errorf("%s: Terraform directory %s: %v", s.Name, s.Dir, err)
+		}
+		if !hasFile(s.UnitTestDir(), "*_test.go") {
+			t.Errorf("%s: no unit tests in execution/test/unit/%s", s.Name, s.TestDir)
+		}
+		if !hasFile(s.IntegrationTestDir(), "*_test.go") {
+			t.Errorf("%s: no integration tests in execution/test/integration/%s", s.Name, s.TestDir)
+		}
+		if _, err := os.Stat(s.TFVarsPath()); err != nil {
+			t.Errorf("%s: tfvars example: %v", s.Name, err)
+		}
+		if s.Config != "" && !hasFile(s.ConfigPath(), "*.example") {
+			t.Errorf("%s: no configuration example in %s", s.Name, s.Config)
+		}
+	}
+}
+
+/*
+TestDependenciesRunFirst verifies that every dependency is a registered
+stage that run.sh runs before the stage depending on it.
+*/
+func TestDependenciesRunFirst(t *testing.T) {
+	position := map[string]int{}
+	for i, s := range All {
+		position[s.Name] = i
+	}
+	for i, s := range All {
+		for _, dep := range s.DependsOn {
+			p, ok := position[dep]
+			switch {
+			case !ok:
+				t.Errorf("%s depends on unknown stage %q", s.Name, dep)
+			case p >= i:
+				t.Errorf("%s depends on %s, which runs after it", s.Name, dep)
+			}
+		}
+	}
+}
+
+/*
+TestLookup verifies lookups by name and by Terraform directory.
+*/
+func TestLookup(t *testing.T) {
+	if s, ok := Get("producer/cloudsql"); !ok || s.Dir != "04-producer/CloudSQL" {
+		t.Errorf("Get(producer/cloudsql) = %+v, %v", s, ok)
+	}
+	if _, ok := Get("all"); ok {
+		t.Error("Get(all) found a stage, want none")
+	}
+	if s, ok := ByDir("06-consumer/CloudRun/Job/"); !ok || s.Name != "consumer/cloudrun/job" {
+		t.Errorf("ByDir(06-consumer/CloudRun/Job/) = %+v, %v", s, ok)
+	}
+	want := filepath.Join(MustRoot(), "execution", "04-producer", "CloudSQL")
+	if got := MustGet("producer/cloudsql").TerraformDir(); got != want {
+		t.Errorf("TerraformDir() = %q, want %q", got, want)
+	}
+}
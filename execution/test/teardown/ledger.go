@@ -0,0 +1,289 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package teardown
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+)
+
+// DirEnv is the environment variable that sets the directory of the ledgers.
+const DirEnv = "CNCS_LEDGER_DIR"
+
+// Dir returns the directory of the ledgers: $CNCS_LEDGER_DIR when set, or
+// cncs-teardown in the temporary directory.
+func Dir() string {
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "cncs-teardown")
+}
+
+// Header is the first line of a ledger and identifies the test and process
+// that wrote it.
+type Header struct {
+	Run       string    `json:"run"`
+	Test      string    `json:"test"`
+	ProjectID string    `json:"project_id"`
+	Region    string    `json:"region"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+}
+
+// Terraform is a Terraform directory applied with Vars and VarFiles, which
+// are relative to Dir as in terraform.Options.
+type Terraform struct {
+	Dir      string         `json:"dir"`
+	Vars     map[string]any `json:"vars,omitempty"`
+	VarFiles []string       `json:"var_files,omitempty"`
+}
+
+// Entry is a line of a ledger after the header: either a Terraform
+// directory to destroy or a resource to delete, or, when Done is set, the
+// mark that the entry Seq was torn down.
+type Entry struct {
+	Seq       int               `json:"seq"`
+	Terraform *Terraform        `json:"terraform,omitempty"`
+	Resource  *janitor.Resource `json:"resource,omitempty"`
+	Done      bool              `json:"done,omitempty"`
+}
+
+func (e Entry) String() string {
+	if e.Terraform != nil {
+		return "terraform directory " + e.Terraform.Dir
+	}
+	if e.Resource != nil {
+		return e.Resource.String()
+	}
+	return fmt.Sprintf("entry %d", e.Seq)
+}
+
+// Ledger is an append-only file of JSON lines recording what a test created
+// and what it tore down. Every line is synced to disk before the resource is
+// created, so that a ledger survives the process being killed.
+type Ledger struct {
+	Path   string
+	Header Header
+
+	mu      sync.Mutex
+	file    *os.File
+	seq     int
+	pending []Entry
+}
+
+// Create creates a ledger at path starting with header. It fails when the
+// file already exists.
+func Create(path string, header Header) (*Ledger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("creating ledger: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("creating ledger: %w", err)
+	}
+	l := &Ledger{Path: path, Header: header, file: file}
+	if err := l.append(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Open opens the ledger at path to replay it. A last line cut short by a
+// killed process is ignored.
+func Open(path string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading ledger: %w", err)
+	}
+	l := &Ledger{Path: path}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if err := json.Unmarshal(lines[0], &l.Header); err != nil {
+		return nil, fmt.Errorf("reading ledger %s: header: %w", path, err)
+	}
+	for i, line := range lines[1:] {
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if i == len(lines)-2 {
+				break
+			}
+			return nil, fmt.Errorf("reading ledger %s: line %d: %w", path, i+2, err)
+		}
+		l.seq = max(l.seq, e.Seq)
+		if e.Done {
+			l.pending = removeSeq(l.pending, e.Seq)
+			continue
+		}
+		l.pending = append(l.pending, e)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening ledger: %w", err)
+	}
+	// Start the next line on a line of its own after a cut short one.
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		if _, err := file.WriteString("\n"); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("opening ledger: %w", err)
+		}
+	}
+	l.file = file
+	return l, nil
+}
+
+// Add appends e to the ledger and returns its sequence number.
+func (l *Ledger) Add(e Entry) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	if err := l.append(e); err != nil {
+		return 0, err
+	}
+	l.pending = append(l.pending, e)
+	return e.Seq, nil
+}
+
+// Done marks the entry seq as torn down.
+func (l *Ledger) Done(seq int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.append(Entry{Seq: seq, Done: true}); err != nil {
+		return err
+	}
+	l.pending = removeSeq(l.pending, seq)
+	return nil
+}
+
+// Pending returns the entries not torn down yet, in the order they were
+// added.
+func (l *Ledger) Pending() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Entry(nil), l.pending...)
+}
+
+// Close closes the ledger and removes it once nothing is pending.
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	if err == nil && len(l.pending) == 0 {
+		err = os.Remove(l.Path)
+	}
+	return err
+}
+
+// append writes v as a line and syncs it to disk.
+func (l *Ledger) append(v any) error {
+	if l.file == nil {
+		return fmt.Errorf("writing ledger %s: closed", l.Path)
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("writing ledger %s: %w", l.Path, err)
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing ledger %s: %w", l.Path, err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("writing ledger %s: %w", l.Path, err)
+	}
+	return nil
+}
+
+func removeSeq(entries []Entry, seq int) []Entry {
+	for i, e := range entries {
+		if e.Seq == seq {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
+
+// alive reports whether the process pid of this host is running. It is a
+// variable so that tests can simulate crashed runs.
+var alive = func(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Unfinished opens the ledgers of dir left behind by processes that are no
+// longer running, in the order of their start. Ledgers of running tests on
+// this host are skipped, and ledgers with nothing pending are removed.
+func Unfinished(dir string) ([]*Ledger, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	var ledgers []*Ledger
+	var errs []error
+	for _, path := range paths {
+		l, err := Open(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if l.Header.Host == host && alive(l.Header.PID) {
+			l.file.Close()
+			continue
+		}
+		if len(l.pending) == 0 {
+			if err := l.Close(); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		ledgers = append(ledgers, l)
+	}
+	sort.SliceStable(ledgers, func(i, j int) bool {
+		return ledgers[i].Header.Started.Before(ledgers[j].Header.Started)
+	})
+	return ledgers, errors.Join(errs...)
+}
+
+// fileName returns the ledger file name of a test of run in process pid.
+func fileName(run, test string, pid int) string {
+	var b strings.Builder
+	for _, r := range test {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return fmt.Sprintf("%s-%s-%d.jsonl", run, b.String(), pid)
+}
@@ -0,0 +1,310 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package teardown tears down what an integration test created even when the
+// test never reaches its deferred terraform.Destroy or its cleanups, because
+// go test was interrupted or its -timeout expired.
+//
+// Supervise starts a Supervisor for a test. The Supervisor records every
+// Terraform directory the test applies and every fixture it creates in a
+// Ledger on disk, before creating it, and marks each one done once the test
+// tore it down. On SIGINT or SIGTERM, or shortly before the test deadline,
+// it destroys and deletes whatever is still pending, newest first, and exits.
+// A ledger left behind by a process that was killed outright is replayed by
+// the resume-cleanup command:
+//
+//	go run ./cmd/resume-cleanup
+//
+// Tests apply and destroy through the Supervisor and hand it to the fixtures:
+//
+//	sup := teardown.Supervise(t, projectID, region)
+//	gcloud := fixtures.New(projectID, region)
+//	gcloud.Recorder = sup
+//	...
+//	defer sup.Destroy(t, terraformOptions)
+//	sup.InitAndApply(t, terraformOptions)
+package teardown
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/naming"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+// DefaultGrace is how long before the test deadline a Supervisor tears down,
+// enough to destroy a database. It is capped at a quarter of the time left
+// when the test starts.
+const DefaultGrace = 15 * time.Minute
+
+// TerraformRunner runs commands with the terraform binary found in PATH.
+type TerraformRunner struct{}
+
+// Run implements janitor.Runner.
+func (TerraformRunner) Run(args ...string) ([]byte, error) {
+	out, err := exec.Command("terraform", args...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("terraform %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// Supervisor tears down the pending entries of a Ledger.
+type Supervisor struct {
+	Ledger *Ledger
+	// Janitor deletes the recorded resources.
+	Janitor *janitor.Janitor
+	// Terraform runs the terraform commands that destroy the recorded
+	// directories.
+	Terraform janitor.Runner
+	// Out receives the progress of a teardown.
+	Out io.Writer
+
+	mu       sync.Mutex
+	applied  map[string]int
+	stop     chan struct{}
+	stopOnce sync.Once
+	release  func()
+	exit     func(code int)
+}
+
+// inflight counts the Supervisors of running tests, so that the first one
+// to tear down on a signal waits for the others before exiting.
+var inflight sync.WaitGroup
+
+// New returns a Supervisor that tears down ledger in the project and region
+// of its header with gcloud and terraform.
+func New(ledger *Ledger) *Supervisor {
+	return &Supervisor{
+		Ledger:    ledger,
+		Janitor:   janitor.New(ledger.Header.ProjectID, ledger.Header.Region),
+		Terraform: TerraformRunner{},
+		Out:       os.Stderr,
+		applied:   map[string]int{},
+		stop:      make(chan struct{}),
+		release:   func() {},
+		exit:      os.Exit,
+	}
+}
+
+// Supervise creates the ledger of t in Dir and tears it down on SIGINT,
+// SIGTERM or shortly before the deadline of t. Once t and its other cleanups
+// finish, whatever is still pending is torn down and the ledger is removed.
+func Supervise(t testing.TB, projectID, region string) *Supervisor {
+	t.Helper()
+	host, _ := os.Hostname()
+	header := Header{
+		Run:       naming.Current().ID,
+		Test:      t.Name(),
+		ProjectID: projectID,
+		Region:    region,
+		Host:      host,
+		PID:       os.Getpid(),
+		Started:   time.Now(),
+	}
+	ledger, err := Create(filepath.Join(Dir(), fileName(header.Run, header.Test, header.PID)), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(ledger)
+	inflight.Add(1)
+	s.release = sync.OnceFunc(inflight.Done)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	var deadline <-chan time.Time
+	var timer *time.Timer
+	if d, ok := t.(interface{ Deadline() (time.Time, bool) }); ok {
+		if at, ok := d.Deadline(); ok {
+			left := time.Until(at)
+			timer = time.NewTimer(left - min(DefaultGrace, left/4))
+			deadline = timer.C
+		}
+	}
+	go s.watch(signals, deadline)
+
+	t.Cleanup(func() {
+		signal.Stop(signals)
+		if timer != nil {
+			timer.Stop()
+		}
+		s.stopOnce.Do(func() { close(s.stop) })
+		if err := s.Teardown(); err != nil {
+			t.Error(err)
+		}
+		if err := ledger.Close(); err != nil {
+			t.Error(err)
+		}
+		s.release()
+	})
+	return s
+}
+
+// watch tears down and exits on the first signal or the deadline, unless
+// the test finishes first.
+func (s *Supervisor) watch(signals <-chan os.Signal, deadline <-chan time.Time) {
+	var reason string
+	select {
+	case sig := <-signals:
+		reason = "received " + sig.String()
+	case <-deadline:
+		reason = "test deadline is near"
+	case <-s.stop:
+		return
+	}
+	fmt.Fprintf(s.Out, "%s: %s, tearing down %d pending entries of %s\n", s.Ledger.Header.Test, reason, len(s.Ledger.Pending()), s.Ledger.Path)
+	if err := s.Teardown(); err != nil {
+		fmt.Fprintf(s.Out, "%s: teardown failed, run resume-cleanup to retry: %v\n", s.Ledger.Header.Test, err)
+	} else if err := s.Ledger.Close(); err != nil {
+		fmt.Fprintf(s.Out, "%s: %v\n", s.Ledger.Header.Test, err)
+	}
+	s.release()
+	inflight.Wait()
+	s.exit(1)
+}
+
+// Record records r before a fixture creates it and returns the function
+// that marks it done once the fixture deleted it. It implements
+// fixtures.Recorder.
+func (s *Supervisor) Record(t testing.TB, r janitor.Resource) (done func()) {
+	t.Helper()
+	seq, err := s.Ledger.Add(Entry{Resource: &r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if err := s.Ledger.Done(seq); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// InitAndApply records the Terraform directory of options and runs
+// terraform.InitAndApply.
+func (s *Supervisor) InitAndApply(t testing.TB, options *terraform.Options) string {
+	t.Helper()
+	dir, err := filepath.Abs(options.TerraformDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := s.Ledger.Add(Entry{Terraform: &Terraform{Dir: dir, Vars: options.Vars, VarFiles: options.VarFiles}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.applied[dir] = seq
+	s.mu.Unlock()
+	return terraform.InitAndApply(t, options)
+}
+
+// Destroy runs terraform.Destroy and marks the Terraform directory of
+// options done. It is deferred in place of terraform.Destroy.
+func (s *Supervisor) Destroy(t testing.TB, options *terraform.Options) string {
+	t.Helper()
+	out := terraform.Destroy(t, options)
+	dir, err := filepath.Abs(options.TerraformDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	seq, ok := s.applied[dir]
+	delete(s.applied, dir)
+	s.mu.Unlock()
+	if ok {
+		if err := s.Ledger.Done(seq); err != nil {
+			t.Error(err)
+		}
+	}
+	return out
+}
+
+// Teardown destroys and deletes the pending entries of the ledger, newest
+// first, and marks each one done. A failed entry is reported to Out and the
+// remaining entries still run; the returned error joins those that failed.
+// Concurrent calls run one after the other.
+func (s *Supervisor) Teardown() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.Ledger.Pending()
+	var errs []error
+	for i := len(pending) - 1; i >= 0; i-- {
+		e := pending[i]
+		var err error
+		switch {
+		case e.Terraform != nil:
+			err = s.destroy(e.Seq, *e.Terraform)
+		case e.Resource != nil:
+			err = s.Janitor.Delete(s.Out, []janitor.Candidate{{Resource: *e.Resource, Reason: "recorded by " + s.Ledger.Header.Test}})
+		}
+		if err == nil {
+			err = s.Ledger.Done(e.Seq)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// destroy runs terraform init and destroy in the directory of tf, with its
+// variables written to a var file next to the ledger.
+func (s *Supervisor) destroy(seq int, tf Terraform) error {
+	args := []string{"-chdir=" + tf.Dir, "destroy", "-auto-approve", "-input=false", "-no-color"}
+	for _, file := range tf.VarFiles {
+		args = append(args, "-var-file="+file)
+	}
+	if len(tf.Vars) > 0 {
+		varFile, err := writeVarFile(fmt.Sprintf("%s.%d.tfvars.json", strings.TrimSuffix(s.Ledger.Path, ".jsonl"), seq), tf.Vars)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(varFile)
+		args = append(args, "-var-file="+varFile)
+	}
+	if _, err := s.Terraform.Run("-chdir="+tf.Dir, "init", "-input=false", "-no-color"); err != nil {
+		fmt.Fprintf(s.Out, "failed destroying %s: %v\n", tf.Dir, err)
+		return err
+	}
+	if _, err := s.Terraform.Run(args...); err != nil {
+		fmt.Fprintf(s.Out, "failed destroying %s: %v\n", tf.Dir, err)
+		return err
+	}
+	fmt.Fprintf(s.Out, "finished destroying %s\n", tf.Dir)
+	return nil
+}
+
+// writeVarFile writes vars to path as a Terraform JSON var file.
+func writeVarFile(path string, vars map[string]any) (string, error) {
+	data, err := json.MarshalIndent(vars, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("writing variables of %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return "", fmt.Errorf("writing variables: %w", err)
+	}
+	return path, nil
+}
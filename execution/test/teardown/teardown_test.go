@@ -0,0 +1,297 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package teardown
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/janitor"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/wait"
+	"github.com/google/go-cmp/cmp"
+)
+
+var started = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeRunner records every command instead of running it. Errors fails
+// every command whose arguments, joined with spaces, start with a key.
+type fakeRunner struct {
+	Errors map[string]error
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *fakeRunner) Run(args ...string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, strings.Join(args, " "))
+	for name, err := range r.Errors {
+		if strings.HasPrefix(strings.Join(args, " "), name) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func newFakeSupervisor(t *testing.T, ledger *Ledger) (*Supervisor, *fakeRunner, *bytes.Buffer) {
+	t.Helper()
+	runner := &fakeRunner{Errors: map[string]error{}}
+	retry := wait.NewFake(wait.NewFakeClock(started))
+	retry.Timeout = time.Minute
+	var out bytes.Buffer
+	s := New(ledger)
+	s.Janitor = &janitor.Janitor{ProjectID: "test-project", Region: "us-central1", Runner: runner, Retry: retry}
+	s.Terraform = runner
+	s.Out = &out
+	return s, runner, &out
+}
+
+func newLedger(t *testing.T, dir string, header Header) *Ledger {
+	t.Helper()
+	l, err := Create(filepath.Join(dir, fileName(header.Run, header.Test, header.PID)), header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// add adds the entries of a test that created a network, a subnet and then
+// applied a Terraform directory.
+func add(t *testing.T, l *Ledger) {
+	t.Helper()
+	entries := []Entry{
+		{Resource: &janitor.Resource{Kind: janitor.Network, Name: "vpc"}},
+		{Resource: &janitor.Resource{Kind: janitor.Subnet, Name: "subnet", Location: "us-central1", Network: "vpc"}},
+		{Terraform: &Terraform{Dir: "/stages/cloudsql", Vars: map[string]any{"config_folder_path": "config"}}},
+	}
+	for _, e := range entries {
+		if _, err := l.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func pendingNames(l *Ledger) []string {
+	var names []string
+	for _, e := range l.Pending() {
+		names = append(names, e.String())
+	}
+	return names
+}
+
+/*
+TestLedger verifies that a reopened ledger holds the entries not marked done,
+in order, that a last line cut short by a killed process is ignored, and that
+a ledger is removed on close only once nothing is pending.
+*/
+func TestLedger(t *testing.T) {
+	dir := t.TempDir()
+	header := Header{Run: "k3f9q2", Test: "TestCreateCloudSQL", ProjectID: "test-project", Region: "us-central1", Host: "ci", PID: 42, Started: started}
+	l := newLedger(t, dir, header)
+	add(t, l)
+	if err := l.Done(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":4,"resource":{"Kind":"sql-ins`)
+	f.Close()
+
+	reopened, err := Open(l.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(header, reopened.Header); diff != "" {
+		t.Errorf("Header mismatch (-want +got):\n%s", diff)
+	}
+	want := []string{"network vpc (global)", "terraform directory /stages/cloudsql"}
+	if diff := cmp.Diff(want, pendingNames(reopened)); diff != "" {
+		t.Errorf("Pending() mismatch (-want +got):\n%s", diff)
+	}
+	seq, err := reopened.Add(Entry{Resource: &janitor.Resource{Kind: janitor.Firewall, Name: "allow-ssh"}})
+	if err != nil || seq != 4 {
+		t.Errorf("Add() = %d, %v, want 4", seq, err)
+	}
+	for _, e := range reopened.Pending() {
+		if err := reopened.Done(e.Seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(l.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ledger %s still exists after everything was done: %v", l.Path, err)
+	}
+}
+
+/*
+TestTeardown verifies that pending entries are torn down newest first,
+Terraform directories with init and destroy and their recorded variables,
+and that a failed delete is reported and stays pending while the remaining
+entries still run.
+*/
+func TestTeardown(t *testing.T) {
+	l := newLedger(t, t.TempDir(), Header{Run: "k3f9q2", Test: "TestCreateCloudSQL", PID: 42})
+	defer l.Close()
+	add(t, l)
+	s, runner, out := newFakeSupervisor(t, l)
+	runner.Errors["compute networks subnets delete"] = errors.New("resource is in use by another resource")
+
+	err := s.Teardown()
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Teardown() = %v, want the failed subnet delete", err)
+	}
+	varFile := strings.TrimSuffix(l.Path, ".jsonl") + ".3.tfvars.json"
+	var got []string
+	for _, call := range runner.calls {
+		if len(got) == 0 || got[len(got)-1] != call {
+			got = append(got, call)
+		}
+	}
+	want := []string{
+		"-chdir=/stages/cloudsql init -input=false -no-color",
+		"-chdir=/stages/cloudsql destroy -auto-approve -input=false -no-color -var-file=" + varFile,
+		"compute networks subnets delete subnet --region=us-central1 --project=test-project --quiet",
+		"compute networks delete vpc --project=test-project --quiet",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("commands mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(varFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("var file %s still exists: %v", varFile, err)
+	}
+	if diff := cmp.Diff([]string{"subnet subnet (us-central1)"}, pendingNames(l)); diff != "" {
+		t.Errorf("Pending() mismatch (-want +got):\n%s", diff)
+	}
+	if !strings.Contains(out.String(), "finished destroying /stages/cloudsql") || !strings.Contains(out.String(), "failed deleting subnet subnet") {
+		t.Errorf("Teardown() output = %q, want the destroy and the failed delete", out.String())
+	}
+}
+
+/*
+TestWatch verifies that a signal tears down everything pending, removes the
+ledger and exits with 1, and that a finished test stops the watch.
+*/
+func TestWatch(t *testing.T) {
+	l := newLedger(t, t.TempDir(), Header{Run: "k3f9q2", Test: "TestCreateCloudSQL", PID: 42})
+	add(t, l)
+	s, runner, _ := newFakeSupervisor(t, l)
+	inflight.Add(1)
+	s.release = sync.OnceFunc(inflight.Done)
+	exited := make(chan int, 1)
+	s.exit = func(code int) { exited <- code }
+	signals := make(chan os.Signal, 1)
+	go s.watch(signals, nil)
+	signals <- syscall.SIGINT
+	if code := <-exited; code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if len(runner.calls) != 4 {
+		t.Errorf("watch ran %d commands, want 4: %v", len(runner.calls), runner.calls)
+	}
+	if _, err := os.Stat(l.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ledger %s still exists after teardown: %v", l.Path, err)
+	}
+
+	finished := New(newLedger(t, t.TempDir(), Header{Run: "k3f9q2", Test: "TestFinished", PID: 42}))
+	defer finished.Ledger.Close()
+	finished.exit = func(code int) { t.Errorf("exit(%d) after the test finished", code) }
+	done := make(chan struct{})
+	go func() {
+		finished.watch(signals, nil)
+		close(done)
+	}()
+	close(finished.stop)
+	<-done
+}
+
+/*
+TestSupervise verifies that the ledger of a test is created in $CNCS_LEDGER_DIR
+and removed once the test finished with everything torn down.
+*/
+func TestSupervise(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(DirEnv, dir)
+	var path string
+	t.Run("fixtures", func(t *testing.T) {
+		s := Supervise(t, "test-project", "us-central1")
+		path = s.Ledger.Path
+		done := s.Record(t, janitor.Resource{Kind: janitor.Network, Name: "vpc"})
+		if filepath.Dir(path) != dir || len(s.Ledger.Pending()) != 1 {
+			t.Errorf("ledger %s pending %v, want one entry in %s", path, s.Ledger.Pending(), dir)
+		}
+		done()
+	})
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ledger %s still exists after the test: %v", path, err)
+	}
+}
+
+/*
+TestUnfinished verifies that only ledgers with pending entries left by
+processes that are gone are replayed, and that finished ledgers are removed.
+*/
+func TestUnfinished(t *testing.T) {
+	defer func(f func(int) bool) { alive = f }(alive)
+	alive = func(pid int) bool { return pid == 1 }
+	host, _ := os.Hostname()
+	dir := t.TempDir()
+
+	running := newLedger(t, dir, Header{Run: "k3f9q2", Test: "TestRunning", Host: host, PID: 1, Started: started})
+	add(t, running)
+	running.Close()
+	crashed := newLedger(t, dir, Header{Run: "k3f9q2", Test: "TestCrashed", Host: host, PID: 2, Started: started.Add(time.Hour)})
+	add(t, crashed)
+	crashed.Close()
+	elsewhere := newLedger(t, dir, Header{Run: "k3f9q2", Test: "TestOnAnotherHost", Host: "other-" + host, PID: 1, Started: started})
+	add(t, elsewhere)
+	elsewhere.Close()
+	finished := newLedger(t, dir, Header{Run: "k3f9q2", Test: "TestFinished", Host: host, PID: 3, Started: started})
+	finished.Close()
+	os.WriteFile(finished.Path, []byte(`{"run":"k3f9q2","test":"TestFinished","host":"`+host+`","pid":3}`+"\n"), 0o644)
+
+	ledgers, err := Unfinished(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range ledgers {
+		got = append(got, l.Header.Test)
+		l.Close()
+	}
+	if diff := cmp.Diff([]string{"TestOnAnotherHost", "TestCrashed"}, got); diff != "" {
+		t.Errorf("Unfinished() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := os.Stat(finished.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("finished ledger %s still exists: %v", finished.Path, err)
+	}
+	if _, err := os.Stat(running.Path); err != nil {
+		t.Errorf("ledger of a running test was removed: %v", err)
+	}
+}
@@ -18,21 +18,33 @@ package unittest
 
 import (
 	compare "cmp"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configlint"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/destroyguard"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/golden"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/plancache"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/policy"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/predict"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"golang.org/x/exp/slices"
+	"os"
 	"testing"
 )
 
 const (
-	terraformDirectoryPath = "../../../../../06-consumer/CloudRun/Job"
-	configFolderPath       = "../../../test/unit/consumer/CloudRun/Job/config"
+	configFolderPath = "../../../test/unit/consumer/CloudRun/Job/config"
+
+	// resourcesPerInstance is the number of resources planned for each
+	// instance of the module.
+	resourcesPerInstance = 1
 )
 
 var (
-	projectID = "dummy-project-id"
-	tfVars    = map[string]any{
+	terraformDirectoryPath = stages.MustGet("consumer/cloudrun/job").TerraformDir()
+	projectID              = "dummy-project-id"
+	tfVars                 = map[string]any{
 		"config_folder_path": configFolderPath,
 	}
 	// used to validate an expected error code if a wrong configuration file is provided.
@@ -42,6 +54,17 @@ var (
 	}
 )
 
+var plans *plancache.Cache
+
+// TestMain plans each distinct configuration once and shares the plan
+// between the tests of the package.
+func TestMain(m *testing.M) {
+	plans = plancache.New()
+	code := m.Run()
+	plans.Close()
+	os.Exit(code)
+}
+
 /*
 	TestInitAndPlanRunWithTfVars performs sanity check to ensure the terraform init
 && terraform plan is executed successfully and returns a valid Succeeded run code.
@@ -60,10 +83,9 @@ func TestInitAndPlanRunWithTfVars(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 	want := 2
 	got := planExitCode
 	if got != want {
@@ -90,10 +112,9 @@ func TestInitAndPlanRunWithInvalidTfVarsExpectFailureScenario(t *testing.T) {
 		Vars:         invalidTFVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 	want := 1
 	got := planExitCode
 	if !cmp.Equal(got, want) {
@@ -114,20 +135,19 @@ func TestResourcesCount(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planStruct := terraform.InitAndPlan(t, terraformOptions)
-	resourceCount := terraform.GetResourceCount(t, planStruct)
-	if got, want := resourceCount.Add, 1; got != want {
+	expected := predict.Predict(t, terraformDirectoryPath, configFolderPath)
+	plan := plans.Plan(t, terraformOptions)
+	resourceCount := plancache.ResourceCount(plan)
+	if got, want := resourceCount.Add, expected.Instances()*resourcesPerInstance; got != want {
 		t.Errorf("Test Resource Count Add = %v, want = %v", got, want)
 	}
 	if got, want := resourceCount.Change, 0; got != want {
 		t.Errorf("Test Resource Count Change = %v, want = %v", got, want)
 	}
-	if got, want := resourceCount.Destroy, 0; got != want {
-		t.Errorf("Test Resource Count Destroy = %v, want = %v", got, want)
-	}
+	expected.CheckCreates(t, plan, resourcesPerInstance)
+	destroyguard.Check(t, plan)
 }
 
 /*
@@ -137,21 +157,16 @@ created by the terraform solution.
 func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
 	// Construct the terraform options with default retryable errors to handle the most common
 	// retryable errors in terraform testing.
-	expectedModulesAddress := []string{"module.cloud_run_job[\"dummy\"]"}
+	expectedModulesAddress := predict.Predict(t, terraformDirectoryPath, configFolderPath).Addresses()
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
 		// Set the path to the Terraform code that will be tested.
 		TerraformDir: terraformDirectoryPath,
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planStruct := terraform.InitAndPlanAndShow(t, terraformOptions)
-	content, err := terraform.ParsePlanJSON(planStruct)
-	if err != nil {
-		t.Error(err.Error())
-	}
+	content := plans.Plan(t, terraformOptions)
 	actualModuleAddress := make([]string, 0)
 	for _, element := range content.ResourceChangesMap {
 		if element.ModuleAddress != "" && !slices.Contains(actualModuleAddress, element.ModuleAddress) {
@@ -164,3 +179,42 @@ func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
 		t.Errorf("Test Element Mismatch = %v, want = %v", got, want)
 	}
 }
+
+/*
+TestPlanPolicies evaluates the built-in policy rules against the plan.
+*/
+func TestPlanPolicies(t *testing.T) {
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		// Set the path to the Terraform code that will be tested.
+		TerraformDir: terraformDirectoryPath,
+		Vars:         tfVars,
+		Reconfigure:  true,
+		Lock:         true,
+		NoColor:      true,
+	})
+	policy.Check(t, plans.Plan(t, terraformOptions))
+}
+
+/*
+TestPlanMatchesGolden compares the normalized plan with the golden file in
+testdata. Run the test with -update to regenerate it.
+*/
+func TestPlanMatchesGolden(t *testing.T) {
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		// Set the path to the Terraform code that will be tested.
+		TerraformDir: terraformDirectoryPath,
+		Vars:         tfVars,
+		Reconfigure:  true,
+		Lock:         true,
+		NoColor:      true,
+	})
+	golden.Plan(t, plans.Plan(t, terraformOptions), "testdata/plan.golden.json")
+}
+
+/*
+TestTFVarsMatchVariables verifies that tfVars only sets variables the stage
+declares, with values of their declared types that pass its validations.
+*/
+func TestTFVarsMatchVariables(t *testing.T) {
+	configlint.CheckVars(t, terraformDirectoryPath, tfVars)
+}
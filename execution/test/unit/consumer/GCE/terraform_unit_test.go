@@ -18,22 +18,31 @@ package unittest
 
 // Package for comparison operations
 import (
-	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configlint"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/golden"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/plancache"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/policy"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/predict"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
 	"github.com/gruntwork-io/terratest/modules/terraform" // Terraform testing library
 	"github.com/stretchr/testify/assert"
-	"gopkg.in/yaml.v2"
+)
+
+const (
+	// resourcesPerInstance is the number of resources planned for each
+	// instance of the module.
+	resourcesPerInstance = 1
 )
 
 var (
 	projectRoot, _         = filepath.Abs("../../../../")
-	terraformDirectoryPath = filepath.Join(projectRoot, "06-consumer/GCE")
+	terraformDirectoryPath = stages.MustGet("consumer/gce").TerraformDir()
 	configFolderPath       = filepath.Join(projectRoot, "test/unit/consumer/GCE/config")
 )
 
@@ -45,18 +54,28 @@ var (
 	}
 )
 
+var plans *plancache.Cache
+
+// TestMain plans each distinct configuration once and shares the plan
+// between the tests of the package.
+func TestMain(m *testing.M) {
+	plans = plancache.New()
+	code := m.Run()
+	plans.Close()
+	os.Exit(code)
+}
+
 func TestInitAndPlanRunWithTfVars(t *testing.T) {
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
 		TerraformDir: terraformDirectoryPath,
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
 
 	// Run 'terraform init' and 'terraform plan', get the exit code.
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 	want := 2 // Expect changes to be applied
 	got := planExitCode
 
@@ -73,17 +92,18 @@ func TestResourcesCount(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
 
-	// Initialize and create a plan, then parse the resource count.
-	planStruct := terraform.InitAndPlan(t, terraformOptions)
-	resourceCount := terraform.GetResourceCount(t, planStruct)
+	// Predict the instances from the YAML files, then parse the resource count.
+	expected := predict.Predict(t, terraformDirectoryPath, configFolderPath)
+	plan := plans.Plan(t, terraformOptions)
+	resourceCount := plancache.ResourceCount(plan)
 
-	if got, want := resourceCount.Add, 3; got != want { // Expect 3 resources to be added (instance1, instance2, instance3)
+	if got, want := resourceCount.Add, expected.Instances()*resourcesPerInstance; got != want { // Expect one instance per YAML file
 		t.Errorf("Test Resource Count Add = %v, want = %v", got, want)
 	}
+	expected.CheckCreates(t, plan, resourcesPerInstance)
 }
 
 func TestTerraformModuleVMResourceAddressListMatch(t *testing.T) {
@@ -92,53 +112,13 @@ func TestTerraformModuleVMResourceAddressListMatch(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
 
-	localInstanceMap := make(map[string]map[string]string) // Initialize the map
-	err := filepath.Walk(configFolderPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && filepath.Ext(path) == ".yaml" {
-			// Read the YAML file
-			yamlFile, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-
-			// Unmarshal YAML into a map
-			var instanceData map[string]string
-			err = yaml.Unmarshal(yamlFile, &instanceData)
-			if err != nil {
-				return err
-			}
-
-			// Extract the instance name and add to the map
-			instanceName := filepath.Base(path) // Assumes filename is the instance name
-			instanceName = strings.TrimSuffix(instanceName, filepath.Ext(instanceName))
-			localInstanceMap[instanceName] = instanceData
-		}
-		return nil
-	})
-	if err != nil {
-		t.Errorf("Error reading YAML files: %s", err)
-	}
+	// Derive the module addresses from the for_each keys locals.tf builds from the YAML files.
+	expectedModuleAddresses := predict.Predict(t, terraformDirectoryPath, configFolderPath).Addresses()
 
-	if len(localInstanceMap) == 0 { // Check if the map is empty
-		t.Error("No instances found in YAML files. Make sure the files exist and are correctly formatted.")
-	}
-	expectedModuleAddresses := []string{} // Start with an empty slice
-	for name := range localInstanceMap {
-		expectedModuleAddresses = append(expectedModuleAddresses, fmt.Sprintf("module.vm[\"%s\"]", name))
-	}
-
-	planStruct := terraform.InitAndPlanAndShow(t, terraformOptions)
-	content, err := terraform.ParsePlanJSON(planStruct)
-	if err != nil {
-		t.Errorf("Error parsing plan JSON: %s", err) // Fail fast if parsing errors occur
-	}
+	content := plans.Plan(t, terraformOptions)
 
 	actualModuleAddresses := make([]string, 0)
 	for _, element := range content.ResourceChangesMap {
@@ -150,3 +130,33 @@ func TestTerraformModuleVMResourceAddressListMatch(t *testing.T) {
 
 	assert.ElementsMatch(t, expectedModuleAddresses, actualModuleAddresses)
 }
+
+func TestPlanMatchesGolden(t *testing.T) {
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDirectoryPath,
+		Vars:         tfVars,
+		Reconfigure:  true,
+		Lock:         true,
+		NoColor:      true,
+	})
+	golden.Plan(t, plans.Plan(t, terraformOptions), "testdata/plan.golden.json")
+}
+
+func TestPlanPolicies(t *testing.T) {
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDirectoryPath,
+		Vars:         tfVars,
+		Reconfigure:  true,
+		Lock:         true,
+		NoColor:      true,
+	})
+	policy.Check(t, plans.Plan(t, terraformOptions))
+}
+
+/*
+TestTFVarsMatchVariables verifies that tfVars only sets variables the stage
+declares, with values of their declared types that pass its validations.
+*/
+func TestTFVarsMatchVariables(t *testing.T) {
+	configlint.CheckVars(t, terraformDirectoryPath, tfVars)
+}
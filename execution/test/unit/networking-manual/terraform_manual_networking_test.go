@@ -15,15 +15,16 @@
 package unittest
 
 import (
+	"os"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/golden"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/plancache"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 )
 
-const (
-	terraformDirectoryPath = "../../../05-networking-manual/"
-	planFilePath           = "terraform.tfplan"
-)
+var terraformDirectoryPath = stages.MustGet("networking-manual").TerraformDir()
 
 // tfVars: Define input variables for your Terraform module as a map.
 var tfVars = map[string]interface{}{
@@ -71,6 +72,17 @@ func initTfVars() {
 	}
 }
 
+var plans *plancache.Cache
+
+// TestMain plans each distinct configuration once and shares the plan
+// between the tests of the package.
+func TestMain(m *testing.M) {
+	plans = plancache.New()
+	code := m.Run()
+	plans.Close()
+	os.Exit(code)
+}
+
 func TestInitAndValidate(t *testing.T) {
 	initTfVars()
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
@@ -90,19 +102,53 @@ func TestPlanFailsWithoutValidResources(t *testing.T) {
 		TerraformDir: terraformDirectoryPath,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: planFilePath,
 		NoColor:      true,
 	})
 
-	_, err := terraform.InitAndPlanE(t, terraformOptions)
+	_, err := plans.PlanE(t, terraformOptions)
 	if err == nil {
 		t.Errorf("Expected Terraform plan to fail due to missing variables, but it succeeded")
 	}
 
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 
 	want := 1
 	if got := planExitCode; got != want {
 		t.Errorf("TestPlanFailsWithoutVars: Expected plan to fail due to missing variables, but got exit code: %v", got)
 	}
 }
+
+/*
+TestPlanMatchesGolden compares the normalized plan with the golden file in
+testdata. The endpoints name their service attachment as target, so the plan
+reads no Cloud SQL instance. Run the test with -update to regenerate it.
+*/
+func TestPlanMatchesGolden(t *testing.T) {
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDirectoryPath,
+		Vars: map[string]any{
+			"psc_endpoints": []map[string]any{
+				{
+					"target":                       "projects/producer-project/regions/us-central1/serviceAttachments/sql-attachment",
+					"subnetwork_name":              "subnetwork",
+					"network_name":                 "network",
+					"ip_address_literal":           "10.128.0.5",
+					"endpoint_project_id":          "your-project-id",
+					"producer_instance_project_id": "producer-project",
+				},
+				{
+					"target":                       "projects/producer-project/regions/us-east1/serviceAttachments/redis-attachment",
+					"subnetwork_name":              "subnetwork",
+					"network_name":                 "network",
+					"ip_address_literal":           nil,
+					"endpoint_project_id":          "your-project-id",
+					"producer_instance_project_id": "producer-project",
+				},
+			},
+		},
+		Reconfigure: true,
+		Lock:        true,
+		NoColor:     true,
+	})
+	golden.Plan(t, plans.Plan(t, terraformOptions), "testdata/plan.golden.json")
+}
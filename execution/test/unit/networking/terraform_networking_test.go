@@ -15,8 +15,15 @@ package unittest
 
 import (
 	compare "cmp"
+	"os"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configlint"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/destroyguard"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/golden"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/hybrid"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/plancache"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/gruntwork-io/terratest/modules/terraform"
@@ -24,10 +31,9 @@ import (
 )
 
 const (
-	terraformDirectoryPath   = "../../../02-networking"
 	region                   = "us-central1"
 	networkName              = "unit-test-vpc-1"
-	peerASN                  = 64513
+	peerASN                  = 64514
 	tunnel1BGPPeerASNAddress = "169.254.1.1"
 	tunnel1SharedSecret      = "secret1"
 	tunnel2BGPPeerASNAddress = "169.254.2.1"
@@ -36,8 +42,9 @@ const (
 
 // Unit tests for VPC network, subnet, Cloud NAT, and HA VPN creation.
 var (
-	projectID = "dummy-project-id"
-	tfVars    = map[string]any{
+	terraformDirectoryPath = stages.MustGet("networking").TerraformDir()
+	projectID              = "dummy-project-id"
+	tfVars                 = map[string]any{
 		"project_id":             projectID,
 		"region":                 region,
 		"create_network":         true,
@@ -105,6 +112,47 @@ var secondVaBandwidth = "BPS_1G"
 var secondVaBgpRange = "169.254.61.8/29"
 var secondVlanTag = 601
 
+var plans *plancache.Cache
+
+// TestMain plans each distinct configuration once and shares the plan
+// between the tests of the package.
+func TestMain(m *testing.M) {
+	plans = plancache.New()
+	code := m.Run()
+	plans.Close()
+	os.Exit(code)
+}
+
+/*
+TestVLANAttachmentInputs validates the Interconnect inputs of tfVars with
+the rules the API enforces, so that an invalid combination fails here
+rather than in a later apply.
+*/
+func TestVLANAttachmentInputs(t *testing.T) {
+	ic, err := hybrid.InterconnectFromVars(tfVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hybrid.ValidateInterconnect(ic); err != nil {
+		t.Errorf("Interconnect inputs are invalid:\n%v", err)
+	}
+}
+
+/*
+TestHAVPNInputs validates the HA VPN inputs of tfVars, with the defaults of
+variables.tf for router1_asn and the session ranges, with the rules the API
+enforces.
+*/
+func TestHAVPNInputs(t *testing.T) {
+	vpn, err := hybrid.HAVPNFromVars(tfVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hybrid.ValidateHAVPN(vpn); err != nil {
+		t.Errorf("HA VPN inputs are invalid:\n%v", err)
+	}
+}
+
 func TestInitAndPlanRunWithTfVars(t *testing.T) {
 	/*
 	 0 = Succeeded with empty diff (no changes)
@@ -119,10 +167,9 @@ func TestInitAndPlanRunWithTfVars(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 	want := 2
 	got := planExitCode
 	if got != want {
@@ -142,10 +189,9 @@ func TestInitAndPlanRunWithoutTfVarsExpectFailureScenario(t *testing.T) {
 		TerraformDir: terraformDirectoryPath,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 	want := 1
 	got := planExitCode
 	if !cmp.Equal(got, want) {
@@ -162,20 +208,17 @@ func TestResourcesCount(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planStruct := terraform.InitAndPlan(t, terraformOptions)
-	resourceCount := terraform.GetResourceCount(t, planStruct)
+	plan := plans.Plan(t, terraformOptions)
+	resourceCount := plancache.ResourceCount(plan)
 	if got, want := resourceCount.Add, 29; got != want {
 		t.Errorf("Test Resource Count Add = %v, want = %v", got, want)
 	}
 	if got, want := resourceCount.Change, 0; got != want {
 		t.Errorf("Test Resource Count Change = %v, want = %v", got, want)
 	}
-	if got, want := resourceCount.Destroy, 0; got != want {
-		t.Errorf("Test Resource Count Destroy = %v, want = %v", got, want)
-	}
+	destroyguard.Check(t, plan)
 }
 
 func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
@@ -188,15 +231,9 @@ func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planStruct := terraform.InitAndPlanAndShow(t, terraformOptions)
-	content, err := terraform.ParsePlanJSON(planStruct)
-	if err != nil {
-		t.Errorf("Error parsing Terraform plan: %v", err) // Detailed error message
-		return                                            // Exit early on parsing error
-	}
+	content := plans.Plan(t, terraformOptions)
 	actualModuleAddresses := make([]string, 0)
 	for _, element := range content.ResourceChangesMap {
 		if element.ModuleAddress != "" && !slices.Contains(actualModuleAddresses, element.ModuleAddress) {
@@ -249,16 +286,10 @@ func TestTerraformResourceAddressListMatch(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
 
-	planStruct := terraform.InitAndPlanAndShow(t, terraformOptions)
-	content, err := terraform.ParsePlanJSON(planStruct)
-	if err != nil {
-		t.Errorf("Error parsing Terraform plan: %v", err) // Detailed error
-		return                                            // Exit early on parsing error
-	}
+	content := plans.Plan(t, terraformOptions)
 
 	actualResourceAddresses := make([]string, 0)
 	resourcePolicyFound := false
@@ -288,3 +319,23 @@ func TestTerraformResourceAddressListMatch(t *testing.T) {
 		t.Errorf("Test Element Mismatch = %v, want = %v", got, want)
 	}
 }
+
+func TestPlanMatchesGolden(t *testing.T) {
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		// Set the path to the Terraform code that will be tested.
+		TerraformDir: terraformDirectoryPath,
+		Vars:         tfVars,
+		Reconfigure:  true,
+		Lock:         true,
+		NoColor:      true,
+	})
+	golden.Plan(t, plans.Plan(t, terraformOptions), "testdata/plan.golden.json")
+}
+
+/*
+TestTFVarsMatchVariables verifies that tfVars only sets variables the stage
+declares, with values of their declared types that pass its validations.
+*/
+func TestTFVarsMatchVariables(t *testing.T) {
+	configlint.CheckVars(t, terraformDirectoryPath, tfVars)
+}
@@ -16,21 +16,24 @@ package unittest
 import (
 	compare "cmp"
 	"fmt"
+	"os"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configlint"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/destroyguard"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/golden"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/plancache"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"golang.org/x/exp/slices"
 )
 
-const (
-	terraformDirectoryPath = "../../../01-organization"
-)
-
 var (
-	projectID = "dummy-project-id"
-	tfVars    = map[string]any{
+	terraformDirectoryPath = stages.MustGet("organization").TerraformDir()
+	projectID              = "dummy-project-id"
+	tfVars                 = map[string]any{
 		"activate_api_identities": map[string]any{
 			projectID: map[string]any{
 				"project_id":    projectID,
@@ -40,6 +43,17 @@ var (
 	}
 )
 
+var plans *plancache.Cache
+
+// TestMain plans each distinct configuration once and shares the plan
+// between the tests of the package.
+func TestMain(m *testing.M) {
+	plans = plancache.New()
+	code := m.Run()
+	plans.Close()
+	os.Exit(code)
+}
+
 func TestInitAndPlanRunWithTfVars(t *testing.T) {
 	/*
 	 0 = Succeeded with empty diff (no changes)
@@ -54,10 +68,9 @@ func TestInitAndPlanRunWithTfVars(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 	want := 2
 	got := planExitCode
 	if got != want {
@@ -77,10 +90,9 @@ func TestInitAndPlanRunWithoutTfVarsExpectFailureScenario(t *testing.T) {
 		TerraformDir: terraformDirectoryPath,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 	want := 1
 	got := planExitCode
 	if !cmp.Equal(got, want) {
@@ -97,20 +109,17 @@ func TestResourcesCount(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planStruct := terraform.InitAndPlan(t, terraformOptions)
-	resourceCount := terraform.GetResourceCount(t, planStruct)
+	plan := plans.Plan(t, terraformOptions)
+	resourceCount := plancache.ResourceCount(plan)
 	if got, want := resourceCount.Add, 8; got != want {
 		t.Errorf("Test Resource Count Add = %v, want = %v", got, want)
 	}
 	if got, want := resourceCount.Change, 0; got != want {
 		t.Errorf("Test Resource Count Change = %v, want = %v", got, want)
 	}
-	if got, want := resourceCount.Destroy, 0; got != want {
-		t.Errorf("Test Resource Count Destroy = %v, want = %v", got, want)
-	}
+	destroyguard.Check(t, plan)
 }
 
 func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
@@ -123,14 +132,9 @@ func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
-	planStruct := terraform.InitAndPlanAndShow(t, terraformOptions)
-	content, err := terraform.ParsePlanJSON(planStruct)
-	if err != nil {
-		t.Error(err.Error())
-	}
+	content := plans.Plan(t, terraformOptions)
 	actualModuleAddress := make([]string, 0)
 	for _, element := range content.ResourceChangesMap {
 		if element.ModuleAddress != "" && !slices.Contains(actualModuleAddress, element.ModuleAddress) {
@@ -143,3 +147,23 @@ func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
 		t.Errorf("Test Element Mismatch = %v, want = %v", got, want)
 	}
 }
+
+func TestPlanMatchesGolden(t *testing.T) {
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		// Set the path to the Terraform code that will be tested.
+		TerraformDir: terraformDirectoryPath,
+		Vars:         tfVars,
+		Reconfigure:  true,
+		Lock:         true,
+		NoColor:      true,
+	})
+	golden.Plan(t, plans.Plan(t, terraformOptions), "testdata/plan.golden.json")
+}
+
+/*
+TestTFVarsMatchVariables verifies that tfVars only sets variables the stage
+declares, with values of their declared types that pass its validations.
+*/
+func TestTFVarsMatchVariables(t *testing.T) {
+	configlint.CheckVars(t, terraformDirectoryPath, tfVars)
+}
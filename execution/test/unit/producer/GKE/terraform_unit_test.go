@@ -15,18 +15,19 @@
 package unittest
 
 import (
-	"path/filepath"
+	"encoding/json"
 	"strings"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/effective"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/golden"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
 	"github.com/gruntwork-io/terratest/modules/terraform" // Terraform testing library
 )
 
 var (
-	projectRoot, _ = filepath.Abs("../../../../")
-
 	// Path to the main Terraform directory for the GKE module.
-	terraformDirectoryPath = filepath.Join(projectRoot, "04-producer/GKE")
+	terraformDirectoryPath = stages.MustGet("producer/gke").TerraformDir()
 )
 
 // TestTerraformConfigValidity checks if the Terraform configuration files are valid.
@@ -67,3 +68,26 @@ func TestTerraformInit(t *testing.T) {
 		t.Errorf("Terraform initialization failed. Output = %v", initOutput)
 	}
 }
+
+/*
+TestEffectiveConfigMatchesGolden compares the effective configuration of the
+config folder, with the fallbacks of locals.tf applied, with the golden file
+in testdata. The private-cluster module reads the zones and Kubernetes
+versions of the project while planning, so the stage has no plan snapshot.
+Run the test with -update to regenerate it.
+*/
+func TestEffectiveConfigMatchesGolden(t *testing.T) {
+	stage, err := effective.ReadStage(terraformDirectoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances, err := stage.Resolve("config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.MarshalIndent(instances, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden.File(t, "testdata/effective.golden.json", append(got, '\n'))
+}
@@ -21,18 +21,29 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/configlint"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/destroyguard"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/golden"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/plancache"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/predict"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/gruntwork-io/terratest/modules/terraform" // Terraform testing library
 	"golang.org/x/exp/slices"                             // Slice manipulation utilities
-	"gopkg.in/yaml.v2"                                    // YAML parsing library
+)
+
+const (
+	// resourcesPerInstance is the number of resources planned for each
+	// cluster.
+	resourcesPerInstance = 1
 )
 
 var (
 	projectRoot, _ = filepath.Abs("../../../../")
 
 	// Path to the main Terraform directory for the MRC module.
-	terraformDirectoryPath = filepath.Join(projectRoot, "04-producer/MRC")
+	terraformDirectoryPath = stages.MustGet("producer/mrc").TerraformDir()
 
 	// Path to the main Terraform directory for the MRC module.
 	configFolderPath = filepath.Join(projectRoot, "test/unit/producer/MRC/config")
@@ -51,18 +62,28 @@ var (
 // TestInitAndPlanRunWithTfVars tests that Terraform initialization and planning
 // succeed with the provided variables. It expects changes (exit code 2) as it's not applying.
 
+var plans *plancache.Cache
+
+// TestMain plans each distinct configuration once and shares the plan
+// between the tests of the package.
+func TestMain(m *testing.M) {
+	plans = plancache.New()
+	code := m.Run()
+	plans.Close()
+	os.Exit(code)
+}
+
 func TestInitAndPlanRunWithTfVars(t *testing.T) {
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
 		TerraformDir: terraformDirectoryPath,
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
 
 	// Run 'terraform init' and 'terraform plan', get the exit code.
-	planExitCode := terraform.InitAndPlanWithExitCode(t, terraformOptions)
+	planExitCode := plans.ExitCode(t, terraformOptions)
 	want := 2 // Expect changes to be applied
 	got := planExitCode
 
@@ -79,15 +100,15 @@ func TestResourcesCount(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
 
-	// Initialize and create a plan, then parse the resource count.
-	planStruct := terraform.InitAndPlan(t, terraformOptions)
-	resourceCount := terraform.GetResourceCount(t, planStruct)
+	// Predict the clusters from the YAML files, then parse the resource count.
+	expected := predict.Predict(t, terraformDirectoryPath, configFolderPath)
+	plan := plans.Plan(t, terraformOptions)
+	resourceCount := plancache.ResourceCount(plan)
 
-	if got, want := resourceCount.Add, 2; got != want { // Expect 2 resources to be added
+	if got, want := resourceCount.Add, expected.Instances()*resourcesPerInstance; got != want { // Expect one cluster per YAML file
 		t.Errorf("Test Resource Count Add = %v, want = %v", got, want)
 	}
 
@@ -95,40 +116,15 @@ func TestResourcesCount(t *testing.T) {
 		t.Errorf("Test Resource Count Change = %v, want = %v", got, want)
 	}
 
-	if got, want := resourceCount.Destroy, 0; got != want { // Expect 0 resources to be destroyed
-		t.Errorf("Test Resource Count Destroy = %v, want = %v", got, want)
-	}
+	expected.CheckCreates(t, plan, resourcesPerInstance)
+	destroyguard.Check(t, plan)
 }
 
 // TestTerraformModuleResourceAddressListMatch verifies that the resources defined
 // in the Terraform plan match those specified in YAML configuration files.
 func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
-	expectedModulesAddress := []string{}
-
-	// Read the YAML files in the configuration folder.
-	yamlFiles, err := os.ReadDir(configFolderPath)
-	if err != nil {
-		t.Fatal(err.Error())
-	}
-
-	// Extract Redis cluster names from the YAML files.
-	for _, file := range yamlFiles {
-		if !file.IsDir() {
-			// Read YAML content for the cluster name
-			yamlData, _ := os.ReadFile(configFolderPath + "/" + file.Name())
-
-			var config struct {
-				RedisClusterName string `yaml:"redis_cluster_name"`
-			}
-
-			err := yaml.Unmarshal(yamlData, &config)
-			if err != nil {
-				t.Fatal(err.Error())
-			}
-
-			expectedModulesAddress = append(expectedModulesAddress, "google_redis_cluster.cluster-ha[\""+config.RedisClusterName+"\"]") // Use the cluster name
-		}
-	}
+	// Derive the cluster addresses from the for_each keys locals.tf builds from the YAML files.
+	expectedModulesAddress := predict.Predict(t, terraformDirectoryPath, configFolderPath).Addresses()
 
 	// Initialize Terraform and generate a plan.
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
@@ -136,15 +132,10 @@ func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
 		Vars:         tfVars,
 		Reconfigure:  true,
 		Lock:         true,
-		PlanFilePath: "./plan",
 		NoColor:      true,
 	})
 
-	planStruct := terraform.InitAndPlanAndShow(t, terraformOptions)
-	content, err := terraform.ParsePlanJSON(planStruct)
-	if err != nil {
-		t.Fatal(err.Error())
-	}
+	content := plans.Plan(t, terraformOptions)
 
 	actualModuleAddress := make([]string, 0)
 	for _, element := range content.ResourceChangesMap {
@@ -170,3 +161,22 @@ func TestTerraformModuleResourceAddressListMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestPlanMatchesGolden(t *testing.T) {
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: terraformDirectoryPath,
+		Vars:         tfVars,
+		Reconfigure:  true,
+		Lock:         true,
+		NoColor:      true,
+	})
+	golden.Plan(t, plans.Plan(t, terraformOptions), "testdata/plan.golden.json")
+}
+
+/*
+TestTFVarsMatchVariables verifies that tfVars only sets variables the stage
+declares, with values of their declared types that pass its validations.
+*/
+func TestTFVarsMatchVariables(t *testing.T) {
+	configlint.CheckVars(t, terraformDirectoryPath, tfVars)
+}
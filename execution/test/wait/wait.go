@@ -0,0 +1,186 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wait polls readiness conditions with exponential backoff, jitter
+// and an overall deadline, replacing fixed time.Sleep calls in the
+// integration tests.
+//
+// A Condition is any func() (bool, error), for example one that describes a
+// Cloud SQL instance with gcloud and checks for the RUNNABLE state. Errors
+// returned by a condition are treated as "not ready yet" so that lookups of
+// resources that are still being created do not end the wait; wrap an error
+// with Permanent to stop polling immediately.
+package wait
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// Condition reports whether the awaited state has been reached.
+type Condition func() (bool, error)
+
+// Clock is the time source a Waiter sleeps on.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time        { return time.Now() }
+func (realClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// Default backoff settings used by New.
+const (
+	DefaultInitial    = 5 * time.Second
+	DefaultMax        = 30 * time.Second
+	DefaultMultiplier = 2.0
+	DefaultJitter     = 0.2
+	DefaultTimeout    = 10 * time.Minute
+)
+
+// Waiter polls a Condition until it is met or Timeout has passed.
+type Waiter struct {
+	Clock Clock
+
+	// Initial is the delay after the first failed attempt. Each following
+	// delay is Multiplier times the previous one, capped at Max.
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+
+	// Jitter randomizes every delay by up to this fraction in either
+	// direction, so that parallel tests do not poll in lockstep.
+	Jitter float64
+
+	// Timeout bounds the whole wait, including the time spent in the
+	// condition itself.
+	Timeout time.Duration
+
+	// Rand returns a number in [0, 1) used for jitter.
+	Rand func() float64
+}
+
+// New returns a Waiter with the default settings and the real clock.
+func New() *Waiter {
+	return &Waiter{
+		Clock:      realClock{},
+		Initial:    DefaultInitial,
+		Max:        DefaultMax,
+		Multiplier: DefaultMultiplier,
+		Jitter:     DefaultJitter,
+		Timeout:    DefaultTimeout,
+		Rand:       rand.Float64,
+	}
+}
+
+// Result describes a finished wait.
+type Result struct {
+	Name     string
+	Attempts int
+	Elapsed  time.Duration
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s after %s (%d attempts)", r.Name, r.Elapsed, r.Attempts)
+}
+
+// TimeoutError is returned when a condition is not met before the deadline.
+type TimeoutError struct {
+	Result
+	// LastErr is the error returned by the last attempt, if any.
+	LastErr error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.LastErr != nil {
+		return fmt.Sprintf("timed out waiting for %s: %v", e.Result, e.LastErr)
+	}
+	return fmt.Sprintf("timed out waiting for %s", e.Result)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.LastErr
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as final, so that the Waiter stops polling and returns
+// it instead of retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// UntilE polls cond until it returns true, returns a Permanent error or the
+// Timeout passes. name describes the awaited state in the Result and errors.
+func (w *Waiter) UntilE(name string, cond Condition) (Result, error) {
+	start := w.Clock.Now()
+	result := Result{Name: name}
+	delay := w.Initial
+	for {
+		result.Attempts++
+		done, err := cond()
+		result.Elapsed = w.Clock.Now().Sub(start)
+		if done && err == nil {
+			return result, nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return result, fmt.Errorf("waiting for %s: %w", name, permanent.err)
+		}
+		remaining := w.Timeout - result.Elapsed
+		if remaining <= 0 {
+			return result, &TimeoutError{Result: result, LastErr: err}
+		}
+		w.Clock.Sleep(min(w.jitter(delay), remaining))
+		delay = min(time.Duration(float64(delay)*w.Multiplier), w.Max)
+	}
+}
+
+// Until is like UntilE but logs how long the wait took and fails the test if
+// the condition is not met.
+func (w *Waiter) Until(t testing.TB, name string, cond Condition) Result {
+	t.Helper()
+	result, err := w.UntilE(name, cond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Waited for %s", result)
+	return result
+}
+
+// Until waits for cond with a Waiter returned by New.
+func Until(t testing.TB, name string, cond Condition) Result {
+	t.Helper()
+	return New().Until(t, name, cond)
+}
+
+func (w *Waiter) jitter(d time.Duration) time.Duration {
+	if w.Jitter <= 0 || w.Rand == nil {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + w.Jitter*(2*w.Rand()-1)))
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wait
+
+import (
+	"errors"
+	"github.com/google/go-cmp/cmp"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// succeedAfter returns a condition that fails n times before succeeding.
+func succeedAfter(n int, err error) Condition {
+	calls := 0
+	return func() (bool, error) {
+		calls++
+		return calls > n, err
+	}
+}
+
+/*
+TestUntilBacksOffExponentially verifies that the delay between attempts
+doubles up to the maximum and that the result reports the attempts and the
+time actually waited.
+*/
+func TestUntilBacksOffExponentially(t *testing.T) {
+	clock := NewFakeClock(start)
+	w := NewFake(clock)
+	got, err := w.UntilE("instance RUNNABLE", succeedAfter(5, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSleeps := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second}
+	if diff := cmp.Diff(wantSleeps, clock.Sleeps()); diff != "" {
+		t.Errorf("sleeps mismatch (-want +got):\n%s", diff)
+	}
+	want := Result{Name: "instance RUNNABLE", Attempts: 6, Elapsed: 95 * time.Second}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("UntilE() result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestUntilAppliesJitter verifies that each delay is randomized by at most the
+jitter fraction.
+*/
+func TestUntilAppliesJitter(t *testing.T) {
+	tests := []struct {
+		rand float64
+		want []time.Duration
+	}{
+		{rand: 0, want: []time.Duration{4 * time.Second, 8 * time.Second}},
+		{rand: 0.5, want: []time.Duration{5 * time.Second, 10 * time.Second}},
+		{rand: 0.75, want: []time.Duration{5500 * time.Millisecond, 11 * time.Second}},
+	}
+	for _, tc := range tests {
+		clock := NewFakeClock(start)
+		w := NewFake(clock)
+		w.Rand = func() float64 { return tc.rand }
+		if _, err := w.UntilE("jitter", succeedAfter(2, nil)); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tc.want, clock.Sleeps()); diff != "" {
+			t.Errorf("rand=%v: sleeps mismatch (-want +got):\n%s", tc.rand, diff)
+		}
+	}
+}
+
+/*
+TestUntilTimesOut verifies that polling stops at the deadline, that the last
+sleep is shortened to end on it and that the last condition error is kept.
+*/
+func TestUntilTimesOut(t *testing.T) {
+	clock := NewFakeClock(start)
+	w := NewFake(clock)
+	w.Timeout = 40 * time.Second
+	notFound := errors.New("instance not found")
+	got, err := w.UntilE("instance RUNNABLE", succeedAfter(100, notFound))
+
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("UntilE() error = %v, want *TimeoutError", err)
+	}
+	if !errors.Is(err, notFound) {
+		t.Errorf("UntilE() error = %v, want it to wrap %v", err, notFound)
+	}
+	wantSleeps := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 5 * time.Second}
+	if diff := cmp.Diff(wantSleeps, clock.Sleeps()); diff != "" {
+		t.Errorf("sleeps mismatch (-want +got):\n%s", diff)
+	}
+	want := Result{Name: "instance RUNNABLE", Attempts: 5, Elapsed: 40 * time.Second}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("UntilE() result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+/*
+TestUntilCountsTimeSpentInCondition verifies that slow conditions count
+against the deadline.
+*/
+func TestUntilCountsTimeSpentInCondition(t *testing.T) {
+	clock := NewFakeClock(start)
+	w := NewFake(clock)
+	w.Timeout = time.Minute
+	attempts := 0
+	_, err := w.UntilE("slow describe", func() (bool, error) {
+		attempts++
+		clock.Advance(25 * time.Second)
+		return false, nil
+	})
+	if err == nil {
+		t.Fatal("UntilE() error = nil, want timeout")
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %d, want 3", attempts)
+	}
+}
+
+/*
+TestPermanentErrorStopsPolling verifies that a Permanent error is returned
+after the first attempt without sleeping.
+*/
+func TestPermanentErrorStopsPolling(t *testing.T) {
+	clock := NewFakeClock(start)
+	w := NewFake(clock)
+	denied := errors.New("permission denied")
+	_, err := w.UntilE("firewall rule visible", succeedAfter(100, Permanent(denied)))
+	if !errors.Is(err, denied) {
+		t.Errorf("UntilE() error = %v, want it to wrap %v", err, denied)
+	}
+	var timeout *TimeoutError
+	if errors.As(err, &timeout) {
+		t.Errorf("UntilE() error = %v, want a non-timeout error", err)
+	}
+	if len(clock.Sleeps()) != 0 {
+		t.Errorf("sleeps = %v, want none", clock.Sleeps())
+	}
+}
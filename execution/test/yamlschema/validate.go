@@ -0,0 +1,223 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamlschema
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownKey is wrapped by the error reported for a key that a schema
+// with additionalProperties false does not declare.
+var ErrUnknownKey = errors.New("is not a known key")
+
+// Validate checks a decoded YAML or JSON document against s, supporting the
+// keywords of Schema, and returns an error per violation, prefixed with the
+// dotted path of the value.
+func Validate(s *Schema, doc any) error {
+	var errs []error
+	validate(s, doc, "", &errs)
+	return errors.Join(errs...)
+}
+
+// ValidateFile checks the YAML file at path against s and returns an error
+// per violation, prefixed with path.
+func ValidateFile(s *Schema, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var errs []error
+	validate(s, doc, "", &errs)
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("%s: %w", path, err)
+	}
+	return errors.Join(errs...)
+}
+
+// CheckFiles fails the test for each YAML file of paths that does not match
+// the committed schema at schemaPath.
+func CheckFiles(t *testing.T, schemaPath string, paths ...string) {
+	t.Helper()
+	if err := CheckFilesE(schemaPath, paths...); err != nil {
+		t.Error(err)
+	}
+}
+
+// CheckFilesE checks each YAML file of paths against the committed schema at
+// schemaPath.
+func CheckFilesE(schemaPath string, paths ...string) error {
+	s, err := Load(schemaPath)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, path := range paths {
+		errs = append(errs, ValidateFile(s, path))
+	}
+	return errors.Join(errs...)
+}
+
+func validate(s *Schema, v any, path string, errs *[]error) {
+	fail := func(format string, args ...any) {
+		at := path
+		if at == "" {
+			at = "(root)"
+		}
+		*errs = append(*errs, fmt.Errorf("%s: %s", at, fmt.Sprintf(format, args...)))
+	}
+	if s.False {
+		fail("is not allowed")
+		return
+	}
+	if s.Type != nil && !hasType(s.Type, v) {
+		fail("is %s, want %s", typeName(v), strings.Join(typeNames(s.Type), " or "))
+		return
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		fail("is %v, want one of %v", v, s.Enum)
+	}
+	if s.Pattern != "" {
+		if str, ok := v.(string); ok {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(str) {
+				fail("%q does not match %s", str, s.Pattern)
+			}
+		}
+	}
+	if len(s.AnyOf) > 0 {
+		matched := false
+		for _, alt := range s.AnyOf {
+			var altErrs []error
+			validate(alt, v, path, &altErrs)
+			if len(altErrs) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("is %s %v, which matches no allowed type", typeName(v), v)
+		}
+	}
+	switch c := v.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := c[name]; !ok {
+				fail("required key %s is not set", name)
+			}
+		}
+		keys := make([]string, 0, len(c))
+		for key := range c {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			child := join(path, key)
+			if p, ok := s.Properties[key]; ok {
+				validate(p, c[key], child, errs)
+			} else if s.AdditionalProperties != nil {
+				if s.AdditionalProperties.False {
+					*errs = append(*errs, fmt.Errorf("%s: %w", child, ErrUnknownKey))
+				} else {
+					validate(s.AdditionalProperties, c[key], child, errs)
+				}
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range c {
+				validate(s.Items, item, join(path, fmt.Sprint(i)), errs)
+			}
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// typeNames returns the type keyword as a list of names.
+func typeNames(t any) []string {
+	switch c := t.(type) {
+	case string:
+		return []string{c}
+	case []string:
+		return c
+	case []any:
+		var names []string
+		for _, n := range c {
+			names = append(names, fmt.Sprint(n))
+		}
+		return names
+	}
+	return nil
+}
+
+func hasType(t any, v any) bool {
+	got := typeName(v)
+	for _, name := range typeNames(t) {
+		if name == got || (name == "number" && got == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns the JSON type of a decoded YAML or JSON value.
+func typeName(v any) string {
+	switch c := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		if c == float64(int64(c)) {
+			return "integer"
+		}
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func inEnum(enum []any, v any) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
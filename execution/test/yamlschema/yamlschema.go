@@ -0,0 +1,443 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package yamlschema generates the JSON Schema of the YAML configuration
+// files of each 04-producer and 06-consumer stage from its Terraform source,
+// so that editors can complete and validate configuration/**/config/*.yaml
+// and tests can validate their fixtures against the same rules.
+//
+// The properties of a schema are the YAML keys locals.tf reads, as found by
+// package effective: keys read without try() are required, and keys read
+// with a fallback to a variable get the type, description and default of
+// that variable from variables.tf. Keys read only by other expressions, or
+// for which no variable declares a type, accept any value. Keys locals.tf
+// never reads are rejected, as they have no effect, unless the
+// configuration examples of the stage set them.
+//
+// Types follow the conversions Terraform applies: a string accepts numbers
+// and booleans, a number accepts numeric strings, a bool accepts "true" and
+// "false", and every type accepts null. Attributes of object types are never
+// required, as the YAML value is passed on to a module rather than converted
+// to the type of the fallback variable.
+//
+// The schemas are committed next to the config folder of each stage, as
+// config.schema.json, and regenerated with go run ./cmd/yamlschema. Editors
+// with the YAML language server pick a schema up from a comment at the top
+// of a YAML file:
+//
+//	# yaml-language-server: $schema=../config.schema.json
+package yamlschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/effective"
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// unread lists, per stage, the keys locals.tf never reads that the
+// configuration examples set, so that the schema accepts them.
+var unread = map[string][]string{
+	"producer/vectorsearch": {"dimension"},
+}
+
+// Draft is the JSON Schema dialect of the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// FileName is the name of the schema file of a stage, next to its config
+// folder.
+const FileName = "config.schema.json"
+
+// Schema is the subset of JSON Schema the generated schemas use.
+type Schema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Type is a JSON type name or a list of them.
+	Type                 any                `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	// False makes the schema the boolean schema false, which no value
+	// matches.
+	False bool `json:"-"`
+}
+
+type schemaJSON Schema
+
+// MarshalJSON encodes a False schema as false.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.False {
+		return []byte("false"), nil
+	}
+	return json.Marshal((*schemaJSON)(s))
+}
+
+// UnmarshalJSON decodes the boolean schemas true and false.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "false":
+		*s = Schema{False: true}
+		return nil
+	case "true":
+		*s = Schema{}
+		return nil
+	}
+	return json.Unmarshal(data, (*schemaJSON)(s))
+}
+
+// Variable is a variable of variables.tf.
+type Variable struct {
+	Type        cty.Type
+	Defaults    *typeexpr.Defaults
+	Description string
+}
+
+// ReadVariables returns the type constraints and descriptions of the
+// variables of the Terraform directory dir. Variables without a type are of
+// type any.
+func ReadVariables(dir string) (map[string]Variable, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]Variable{}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, block := range f.Body.(*hclsyntax.Body).Blocks {
+			if block.Type != "variable" || len(block.Labels) != 1 {
+				continue
+			}
+			v := Variable{Type: cty.DynamicPseudoType}
+			if attr, ok := block.Body.Attributes["type"]; ok {
+				if v.Type, v.Defaults, diags = typeexpr.TypeConstraintWithDefaults(attr.Expr); diags.HasErrors() {
+					return nil, diags
+				}
+			}
+			if attr, ok := block.Body.Attributes["description"]; ok {
+				if d, diags := attr.Expr.Value(nil); !diags.HasErrors() && d.Type() == cty.String && d.IsKnown() && !d.IsNull() {
+					v.Description = d.AsString()
+				}
+			}
+			vars[block.Labels[0]] = v
+		}
+	}
+	return vars, nil
+}
+
+// Generate returns the schema of the YAML files of the stage named title,
+// whose Terraform directory is dir.
+func Generate(title, dir string) (*Schema, error) {
+	stage, err := effective.ReadStage(dir)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := ReadVariables(dir)
+	if err != nil {
+		return nil, err
+	}
+	root := &node{}
+	for _, k := range stage.Keys {
+		if k.Kind == effective.Computed {
+			continue
+		}
+		n := root.at(k.YAML)
+		n.leaf = keySchema(k, stage, vars)
+		n.required = n.required || k.Kind == effective.Required
+	}
+	for _, path := range stage.Reads {
+		if n := root.at(path); n.leaf == nil && len(n.children) == 0 {
+			n.leaf = &Schema{Description: "Read by an expression of locals.tf."}
+		}
+	}
+	for _, path := range unread[title] {
+		root.at(path).leaf = &Schema{Description: "Never read by locals.tf, so it has no effect."}
+	}
+	s := root.schema()
+	s.Schema = Draft
+	s.Title = title
+	s.Description = fmt.Sprintf("A YAML file of the config folder of the %s stage, selected by the fileset pattern %q. Generated from variables.tf and locals.tf by go run ./cmd/yamlschema; do not edit.", title, stage.Pattern)
+	return s, nil
+}
+
+// GenerateStage returns the schema of the YAML files of st.
+func GenerateStage(st stages.Stage) (*Schema, error) {
+	return Generate(st.Name, st.TerraformDir())
+}
+
+// Path returns the path of the committed schema of st, or "" if st has no
+// config folder.
+func Path(st stages.Stage) string {
+	if st.Config == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(st.ConfigPath()), FileName)
+}
+
+// Marshal returns s as indented JSON, as the schema files are written.
+func Marshal(s *Schema) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Load reads a schema file.
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// node is a YAML key in the tree of the keys locals.tf reads.
+type node struct {
+	leaf     *Schema
+	required bool
+	children map[string]*node
+}
+
+// at returns the node of the dotted path, creating it and its parents.
+func (n *node) at(path string) *node {
+	for _, part := range strings.Split(path, ".") {
+		if n.children == nil {
+			n.children = map[string]*node{}
+		}
+		child, ok := n.children[part]
+		if !ok {
+			child = &node{}
+			n.children[part] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// schema returns the schema of n. A key read as a whole accepts whatever
+// its own schema accepts, even if keys below it are read too; other keys
+// are objects of the keys read below them.
+func (n *node) schema() *Schema {
+	if n.leaf != nil {
+		return n.leaf
+	}
+	s := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: &Schema{False: true},
+	}
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := n.children[name]
+		s.Properties[name] = child.schema()
+		if child.needed() {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// needed reports whether n or a key below it is required.
+func (n *node) needed() bool {
+	if n.required {
+		return true
+	}
+	for _, child := range n.children {
+		if child.needed() {
+			return true
+		}
+	}
+	return false
+}
+
+// keySchema returns the schema of the YAML key of k. The type comes from
+// the fallback variable or, for keys without one, from the variable of the
+// same name if there is one.
+func keySchema(k effective.Key, stage *effective.Stage, vars map[string]Variable) *Schema {
+	path := k.Variable
+	if k.Kind != effective.Fallback {
+		path = k.YAML
+	}
+	parts := strings.Split(path, ".")
+	v, ok := vars[parts[0]]
+	if !ok {
+		return &Schema{Description: "No variable declares the type of this key."}
+	}
+	ty, defaults, ok := typeAt(v.Type, v.Defaults, parts[1:])
+	if !ok {
+		return &Schema{Description: "No variable declares the type of this key."}
+	}
+	s := typeSchema(ty, defaults)
+	if len(parts) == 1 {
+		s.Description = v.Description
+	}
+	if k.Kind == effective.Fallback {
+		note := fmt.Sprintf("Defaults to var.%s.", k.Variable)
+		s.Description = strings.TrimSpace(s.Description + " " + note)
+		if value, ok := defaultAt(stage.Defaults[parts[0]], parts[1:]); ok {
+			s.Default = value
+		}
+	}
+	return s
+}
+
+// typeAt returns the type, and its optional attribute defaults, at the
+// dotted path below ty.
+func typeAt(ty cty.Type, d *typeexpr.Defaults, path []string) (cty.Type, *typeexpr.Defaults, bool) {
+	for _, part := range path {
+		var child *typeexpr.Defaults
+		switch {
+		case ty == cty.DynamicPseudoType:
+			return ty, nil, true
+		case ty.IsObjectType():
+			if !ty.HasAttribute(part) {
+				return cty.NilType, nil, false
+			}
+			ty = ty.AttributeType(part)
+			if d != nil {
+				child = d.Children[part]
+			}
+		case ty.IsMapType():
+			ty = ty.ElementType()
+			if d != nil {
+				child = d.Children[""]
+			}
+		default:
+			return cty.NilType, nil, false
+		}
+		d = child
+	}
+	return ty, d, true
+}
+
+// defaultAt returns the literal default at the dotted path below v, if it
+// is known and not null.
+func defaultAt(v cty.Value, path []string) (any, bool) {
+	for _, part := range path {
+		if v == cty.NilVal || !v.IsKnown() || v.IsNull() {
+			return nil, false
+		}
+		switch {
+		case v.Type().IsObjectType() && v.Type().HasAttribute(part):
+			v = v.GetAttr(part)
+		case v.Type().IsMapType() && v.HasIndex(cty.StringVal(part)).True():
+			v = v.Index(cty.StringVal(part))
+		default:
+			return nil, false
+		}
+	}
+	if v == cty.NilVal || !v.IsWhollyKnown() || v.IsNull() {
+		return nil, false
+	}
+	data, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		return nil, false
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// numberPattern matches the strings Terraform converts to numbers.
+const numberPattern = `^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`
+
+// typeSchema returns the schema of the values Terraform converts to ty.
+func typeSchema(ty cty.Type, d *typeexpr.Defaults) *Schema {
+	switch {
+	case ty == cty.String:
+		return &Schema{Type: []string{"string", "number", "boolean", "null"}}
+	case ty == cty.Number:
+		return &Schema{AnyOf: []*Schema{
+			{Type: []string{"number", "null"}},
+			{Type: "string", Pattern: numberPattern},
+		}}
+	case ty == cty.Bool:
+		return &Schema{AnyOf: []*Schema{
+			{Type: []string{"boolean", "null"}},
+			{Enum: []any{"true", "false"}},
+		}}
+	case ty.IsListType() || ty.IsSetType():
+		var child *typeexpr.Defaults
+		if d != nil {
+			child = d.Children[""]
+		}
+		return &Schema{Type: []string{"array", "null"}, Items: typeSchema(ty.ElementType(), child)}
+	case ty.IsTupleType():
+		return &Schema{Type: []string{"array", "null"}}
+	case ty.IsMapType():
+		var child *typeexpr.Defaults
+		if d != nil {
+			child = d.Children[""]
+		}
+		return &Schema{Type: []string{"object", "null"}, AdditionalProperties: typeSchema(ty.ElementType(), child)}
+	case ty.IsObjectType():
+		s := &Schema{
+			Type:                 []string{"object", "null"},
+			Properties:           map[string]*Schema{},
+			AdditionalProperties: &Schema{False: true},
+		}
+		for name, attrType := range ty.AttributeTypes() {
+			var child *typeexpr.Defaults
+			if d != nil {
+				child = d.Children[name]
+			}
+			attr := typeSchema(attrType, child)
+			if d != nil {
+				if value, ok := defaultAt(d.DefaultValues[name], nil); ok {
+					attr.Default = value
+				}
+			}
+			s.Properties[name] = attr
+		}
+		return s
+	}
+	return &Schema{}
+}
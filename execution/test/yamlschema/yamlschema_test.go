@@ -0,0 +1,256 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamlschema
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloudnetworking-config-solutions/execution/test/stages"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+const localsTF = `locals {
+  config_folder_path = var.config_folder_path
+  instances          = [for file in fileset(local.config_folder_path, "[^_]*.yaml") : yamldecode(file("${local.config_folder_path}/${file}"))]
+  instance_list = [
+    for instance in local.instances : {
+      name   = instance.name
+      region = try(instance.region, var.region)
+      count  = try(instance.count)
+      boot_disk = {
+        size = try(instance.boot_disk.size, var.boot_disk.size)
+      }
+      labels  = merge(var.labels, try(instance.labels, {}))
+      project = var.project_id
+    }
+  ]
+}
+`
+
+const variablesTF = `variable "config_folder_path" {
+  type = string
+}
+
+variable "region" {
+  type        = string
+  default     = "us-central1"
+  description = "Region of the instance."
+}
+
+variable "boot_disk" {
+  type = object({
+    size = optional(number, 10)
+  })
+  default = {
+    size = 10
+  }
+}
+
+variable "labels" {
+  type    = map(string)
+  default = {}
+}
+
+variable "project_id" {
+  type = string
+}
+`
+
+/*
+TestGenerate verifies that the generated schema requires the keys read
+without try(), types keys with their fallback variable, and rejects keys
+that locals.tf never reads.
+*/
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"locals.tf": localsTF, "variables.tf": variablesTF} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := Generate("test", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"name"}, s.Required); diff != "" {
+		t.Errorf("Generate() required mismatch (-want +got):\n%s", diff)
+	}
+	region := s.Properties["region"]
+	if region == nil || region.Default != "us-central1" || region.Description != "Region of the instance. Defaults to var.region." {
+		t.Errorf("Generate() region = %+v, want the default and description of var.region", region)
+	}
+	// The schema must survive the round trip through the committed file.
+	data, err := Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Load(path); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{
+			name: "valid",
+			yaml: "name: a\nregion: null\ncount: anything\nboot_disk:\n  size: \"20\"\nlabels:\n  team: net\n",
+		},
+		{
+			name: "invalid",
+			yaml: "region: [a]\nboot_disk:\n  size: large\n  type: pd-ssd\nlabels: {}\nzone: b\n",
+			want: []string{
+				"(root): required key name is not set",
+				"boot_disk.size: is string large, which matches no allowed type",
+				"boot_disk.type: is not a known key",
+				"region: is array, want string or number or boolean or null",
+				"zone: is not a known key",
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc any
+			if err := yaml.Unmarshal([]byte(tc.yaml), &doc); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			var errs []error
+			validate(s, doc, "", &errs)
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Validate() mismatch (-want +got):\n%s", diff)
+			}
+			if (Validate(s, doc) == nil) != (len(tc.want) == 0) {
+				t.Errorf("Validate() = %v, want %d errors", Validate(s, doc), len(tc.want))
+			}
+		})
+	}
+}
+
+/*
+TestSchemasUpToDate verifies that the committed config.schema.json of every
+stage with a configuration folder matches what its variables.tf and
+locals.tf generate.
+*/
+func TestSchemasUpToDate(t *testing.T) {
+	for _, st := range stages.All {
+		if st.Config == "" {
+			continue
+		}
+		t.Run(st.Name, func(t *testing.T) {
+			s, err := GenerateStage(st)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := Marshal(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(Path(st))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(want, got) {
+				t.Errorf("%s is out of date with %s, run go run ./cmd/yamlschema %s", Path(st), st.Dir, st.Name)
+			}
+		})
+	}
+}
+
+/*
+TestUnitFixtures verifies that the YAML fixtures of the unit tests of every
+stage match the committed schema, so that the tests plan configurations a
+user could write. Keys the schema does not know are logged as findings
+rather than failing the test, because the stage ignores them.
+*/
+func TestUnitFixtures(t *testing.T) {
+	for _, st := range stages.All {
+		if st.Config == "" {
+			continue
+		}
+		t.Run(st.Name, func(t *testing.T) {
+			files, err := filepath.Glob(filepath.Join(st.UnitTestDir(), "config", "*.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) == 0 {
+				t.Skipf("%s has no YAML fixtures", st.UnitTestDir())
+			}
+			schema, err := Load(Path(st))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				for _, err := range unwrap(ValidateFile(schema, file)) {
+					if errors.Is(err, ErrUnknownKey) {
+						t.Logf("finding: %v", err)
+					} else {
+						t.Error(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+/*
+TestConfigurationExamples verifies that the YAML files and examples of the
+config folder of every stage match the committed schema, as
+go run ./cmd/yamlschema -validate checks them.
+*/
+func TestConfigurationExamples(t *testing.T) {
+	for _, st := range stages.All {
+		if st.Config == "" {
+			continue
+		}
+		t.Run(st.Name, func(t *testing.T) {
+			var files []string
+			for _, pattern := range []string{"*.yaml", "*.yaml.example"} {
+				matches, err := filepath.Glob(filepath.Join(st.ConfigPath(), pattern))
+				if err != nil {
+					t.Fatal(err)
+				}
+				files = append(files, matches...)
+			}
+			if len(files) == 0 {
+				t.Skipf("%s has no YAML files", st.ConfigPath())
+			}
+			CheckFiles(t, Path(st), files...)
+		})
+	}
+}
+
+// unwrap returns the errors joined in err.
+func unwrap(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	if err != nil {
+		return []error{err}
+	}
+	return nil
+}